@@ -5,6 +5,8 @@ require (
 	github.com/aws/aws-sdk-go v1.21.5
 	github.com/google/go-cmp v0.5.2 // indirect
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/johannesboyne/gofakes3 v0.0.0-20200716060623-6b2b4cb092cc
+	github.com/klauspost/compress v1.11.13
 	github.com/kr/text v0.2.0 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/lib/pq v1.3.0
@@ -14,12 +16,14 @@ require (
 	github.com/onsi/gomega v1.10.2
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.5.1
 	github.com/sahilm/fuzzy v0.1.0
 	github.com/spf13/afero v1.2.2
 	github.com/stretchr/testify v1.6.1 // indirect
 	go.uber.org/zap v1.10.0
 	golang.org/x/sys v0.0.0-20201009025420-dfb3f7c4e634 // indirect
 	golang.org/x/tools v0.0.0-20201013201025-64a9e34f3752 // indirect
+	google.golang.org/protobuf v1.23.0
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gorm.io/driver/postgres v1.0.5
 	gorm.io/gorm v1.20.8
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/gtfsrt"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	//database/sql driver
+	_ "github.com/lib/pq"
+)
+
+type options struct {
+	PostgresConnectionString string `long:"postgres-connection-string" env:"POSTGRES_CONNECTION_STRING" required:"true"`
+	ListenAddress            string `long:"listen-address" env:"LISTEN_ADDRESS" default:":8080" description:"The address to serve the feed on."`
+	ActiveWindowMinutes      int    `long:"active-window-minutes" env:"ACTIVE_WINDOW_MINUTES" default:"15" description:"Runs without an event in this many minutes are left out of the feed."`
+}
+
+func main() {
+	fmt.Println("Starting GTFS-Realtime server")
+	var opts options
+	_, err := flags.Parse(&opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, _ := zap.NewProduction()
+	defer func() {
+		_ = logger.Sync() // flushes buffer, if any
+	}()
+
+	db, err := sql.Open("postgres", opts.PostgresConnectionString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	//the tables are owned by the scrapedumper, so we only read them here
+	repo := postgres.NewRepository(logger, db)
+	handler := gtfsrt.NewHandler(logger, repo, time.Minute*time.Duration(opts.ActiveWindowMinutes))
+
+	mux := http.NewServeMux()
+	handler.Register(mux)
+
+	logger.Info("serving trip updates", zap.String("address", opts.ListenAddress))
+	log.Fatal(http.ListenAndServe(opts.ListenAddress, mux))
+}
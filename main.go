@@ -14,11 +14,13 @@ import (
 
 	flags "github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
-	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
 	"github.com/smartatransit/scrapedumper/pkg/config"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
 	"github.com/smartatransit/scrapedumper/pkg/worker"
 )
 
@@ -30,6 +32,10 @@ type options struct {
 	MartaAPIKeyFile   *string `long:"marta-api-key-file" env:"MARTA_API_KEY_FILE" description:"file containing the marta api key"`
 	PollTimeInSeconds int     `long:"poll-time-in-seconds" env:"POLL_TIME_IN_SECONDS" description:"time to poll marta api every second" required:"true"`
 
+	MetricsAddress        string `long:"metrics-address" env:"METRICS_ADDRESS" description:"if set, Prometheus metrics are served at /metrics on this address, e.g. :9090"`
+	HealthAddress         string `long:"health-address" env:"HEALTH_ADDRESS" description:"if set, /healthz and /readyz are served on this address, which may be the same as the metrics address"`
+	MaxScrapeAgeInSeconds int    `long:"max-scrape-age-in-seconds" env:"MAX_SCRAPE_AGE_IN_SECONDS" default:"300" description:"/readyz fails once a work item has gone this long without a successful scrape"`
+
 	Debug      bool    `long:"debug" env:"DEBUG" description:"enabled debug logging"`
 	ConfigPath *string `long:"config-path" env:"CONFIG_PATH" description:"An optional file that overrides the default configuration of sources and targets."`
 }
@@ -59,10 +65,28 @@ func main() {
 		log.Fatal(err)
 	}
 
+	//the metrics and health endpoints can share a server
+	muxes := map[string]*http.ServeMux{}
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	var m *metrics.Metrics
+	if opts.MetricsAddress != "" {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		m = metrics.New(reg)
+		muxFor(opts.MetricsAddress).Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	}
+
 	httpClient := http.Client{}
 
-	trainClient := martaapi.New(&httpClient, martaAPIKey, logger, martaapi.RealtimeTrainTimeEndpoint, "train-data")
-	busClient := martaapi.New(&httpClient, martaAPIKey, logger, martaapi.BusEndpoint, "bus-data")
+	retryPolicy := martaapi.WithRetryPolicy(wc.RetryPolicy())
+	trainClient := martaapi.New(m.InstrumentDoer(&httpClient, "train-data"), martaAPIKey, logger, martaapi.RealtimeTrainTimeEndpoint, "train-data", retryPolicy)
+	busClient := martaapi.New(m.InstrumentDoer(&httpClient, "bus-data"), martaAPIKey, logger, martaapi.BusEndpoint, "bus-data", retryPolicy)
 
 	workList, cleanup, err := config.BuildWorkList(
 		logger,
@@ -70,6 +94,8 @@ func main() {
 		wc,
 		busClient,
 		trainClient,
+		&httpClient,
+		config.WithMetrics(m),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -83,10 +109,16 @@ func main() {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 
-	cb := circuitbreaker.New(logger, 1*time.Hour, 10)
-
 	logger.Info(fmt.Sprintf("Poll time is %d seconds", opts.PollTimeInSeconds))
-	poller := worker.New(time.Duration(opts.PollTimeInSeconds)*time.Second, logger, &workList, worker.WithCircuitBreaker(cb))
+	poller := worker.New(time.Duration(opts.PollTimeInSeconds)*time.Second, logger, &workList, worker.WithMetrics(m))
+
+	if opts.HealthAddress != "" {
+		maxAge := time.Duration(opts.MaxScrapeAgeInSeconds) * time.Second
+		worker.NewHealthHandler(poller, maxAge).Register(muxFor(opts.HealthAddress))
+	}
+	for addr, mux := range muxes {
+		go serve(logger, addr, mux)
+	}
 
 	errC := make(chan error, 1)
 	quit := make(chan os.Signal, 1)
@@ -103,6 +135,18 @@ func main() {
 		logger.Info("interrupt signal received")
 		logger.Info("shutting down...")
 	}
+
+	//Poll closes errC once the scrapes and dumps that are running return, and
+	//the sinks mustn't be cleaned up from under them before that
+	for range errC {
+	}
+}
+
+func serve(logger *zap.Logger, addr string, mux *http.ServeMux) {
+	logger.Info(fmt.Sprintf("serving on %s", addr))
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error(errors.Wrapf(err, "server on %s stopped", addr).Error())
+	}
 }
 
 func getMartaAPIKey(opts options) string {
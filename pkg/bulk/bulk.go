@@ -2,6 +2,7 @@ package bulk
 
 import (
 	"context"
+	"io"
 	"os"
 	"path"
 	"sort"
@@ -75,8 +76,34 @@ func (fil fileInfoList) Swap(i, j int) {
 }
 
 //DumpDirectory loads all files in the specified directory, excluding files that are alphabetically
-//before `startAt`. If `startAt` is empty, all files will be included.
+//before `startAt`. If `startAt` is empty, all files will be included. Hive-style partition
+//directories, such as `date=2020-03-01`, are loaded in order along with the files, so that a
+//partitioned path template is loaded chronologically. Other subdirectories are skipped.
 func (a DirectoryDumperAgent) DumpDirectory(ctx context.Context, dir string, startAt string) (err error) {
+	return a.Walk(ctx, dir, startAt, func(src Source) error {
+		return a.DumpFile(ctx, src.Name, src.Path)
+	})
+}
+
+//Walk calls fn with each file that DumpDirectory would load, in the same order,
+//stopping at the first error. Each file's path starts with the directory's own
+//name, such as `train-data/2020-03-01T12:00:00Z.json`, just as its key would in
+//the S3 bucket.
+func (a DirectoryDumperAgent) Walk(ctx context.Context, dir string, startAt string, fn WalkFunc) (err error) {
+	return a.walk(ctx, dir, dirPrefix(dir), startAt, fn)
+}
+
+//dirPrefix is the name a directory's files are dumped under, or nothing if it
+//doesn't have one
+func dirPrefix(dir string) string {
+	base := path.Base(path.Clean(dir))
+	if base == "." || base == "/" {
+		return ""
+	}
+	return base
+}
+
+func (a DirectoryDumperAgent) walk(ctx context.Context, dir string, rel string, startAt string, fn WalkFunc) (err error) {
 	f, err := a.fs.Open(dir)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to open directory contents for reading at path `%s`", dir)
@@ -94,11 +121,29 @@ func (a DirectoryDumperAgent) DumpDirectory(ctx context.Context, dir string, sta
 	sort.Sort(fileInfoList(list))
 
 	for _, finfo := range list {
-		if finfo.IsDir() || strings.Compare(startAt, finfo.Name()) > 0 {
+		if finfo.IsDir() {
+			if !isPartition(finfo.Name()) {
+				continue
+			}
+			err = a.walk(ctx, path.Join(dir, finfo.Name()), path.Join(rel, finfo.Name()), startAt, fn)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if strings.Compare(startAt, finfo.Name()) > 0 {
 			continue
 		}
 
-		err = a.DumpFile(ctx, path.Join(dir, finfo.Name()), finfo.Name())
+		filePath := path.Join(dir, finfo.Name())
+		fileRel := path.Join(rel, finfo.Name())
+		err = fn(Source{
+			Name: filePath,
+			Path: strings.TrimSuffix(fileRel, dumper.CompressionFromPath(fileRel).Extension()),
+			Open: func(context.Context) (io.ReadCloser, error) {
+				return a.openFile(filePath)
+			},
+		})
 		if err != nil {
 			return
 		}
@@ -107,16 +152,51 @@ func (a DirectoryDumperAgent) DumpDirectory(ctx context.Context, dir string, sta
 	return nil
 }
 
-//DumpFile loads a single file
+//isPartition reports whether a directory is a Hive-style `key=value` partition
+func isPartition(name string) bool {
+	i := strings.IndexByte(name, '=')
+	return i > 0 && i < len(name)-1
+}
+
+//DumpFile loads a single file. Files compressed by a dumper are decompressed
+//according to their extension, which is dropped from the name passed on.
 func (a DirectoryDumperAgent) DumpFile(ctx context.Context, path string, name string) (err error) {
-	file, err := a.fs.Open(path)
+	r, err := a.openFile(path)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to open file `%s` for reading", path)
 		return
 	}
-	defer file.Close()
+	defer r.Close()
 
-	err = a.dumper.Dump(ctx, file, name)
+	err = a.dumper.Dump(ctx, r, strings.TrimSuffix(name, dumper.CompressionFromPath(name).Extension()))
 	err = errors.Wrapf(err, "failed to dump contents of file `%s`", path)
 	return
 }
+
+//openFile opens a file, decompressing it according to its extension
+func (a DirectoryDumperAgent) openFile(path string) (io.ReadCloser, error) {
+	file, err := a.fs.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file `%s` for reading", path)
+	}
+
+	r, err := dumper.CompressionFromPath(path).NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "failed to decompress file `%s`", path)
+	}
+	return decompressedReader{r, file}, nil
+}
+
+//decompressedReader closes both a decompressor and the file beneath it
+type decompressedReader struct {
+	io.ReadCloser
+	underlying io.Closer
+}
+
+func (r decompressedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if closeErr := r.underlying.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,12 +1,15 @@
 package bulk_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io/ioutil"
 	"os"
 
 	"github.com/smartatransit/scrapedumper/pkg/bulk"
 	"github.com/smartatransit/scrapedumper/pkg/bulk/bulkfakes"
+	dumperpkg "github.com/smartatransit/scrapedumper/pkg/dumper"
 	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
 
 	. "github.com/onsi/ginkgo"
@@ -108,6 +111,72 @@ var _ = Describe("DirectoryDumperAgent", func() {
 				Expect(fs.OpenArgsForCall(3)).To(Equal("/path/to/dir/4"))
 			})
 
+			When("the files are partitioned", func() {
+				var partition *bulkfakes.FakeFile
+				BeforeEach(func() {
+					partition = &bulkfakes.FakeFile{}
+					partition.ReaddirReturns([]os.FileInfo{
+						fInfo("2b", false),
+						fInfo("2a", false),
+					}, nil)
+					dirFile.ReaddirReturns([]os.FileInfo{
+						fInfo("date=3", true),
+						fInfo("1", false),
+						fInfo("date=2", true),
+						fInfo("tmp", true),
+					}, nil)
+					fs.OpenReturnsOnCall(2, partition, nil)
+					fs.OpenReturnsOnCall(3, &bulkfakes.FakeFile{}, nil)
+					fs.OpenReturnsOnCall(4, &bulkfakes.FakeFile{}, nil)
+					fs.OpenReturnsOnCall(5, partition, nil)
+					fs.OpenReturnsOnCall(6, &bulkfakes.FakeFile{}, nil)
+					fs.OpenReturnsOnCall(7, &bulkfakes.FakeFile{}, nil)
+				})
+				It("loads each partition in order, and skips other directories", func() {
+					Expect(callErr).To(BeNil())
+					var paths []string
+					for i := 0; i < fs.OpenCallCount(); i++ {
+						paths = append(paths, fs.OpenArgsForCall(i))
+					}
+					Expect(paths).To(Equal([]string{
+						"/path/to/dir",
+						"/path/to/dir/1",
+						"/path/to/dir/date=2",
+						"/path/to/dir/date=2/2a",
+						"/path/to/dir/date=2/2b",
+						"/path/to/dir/date=3",
+						"/path/to/dir/date=3/2a",
+						"/path/to/dir/date=3/2b",
+					}))
+				})
+			})
+
+			When("a file is compressed", func() {
+				BeforeEach(func() {
+					var buf bytes.Buffer
+					w, _ := dumperpkg.Gzip.NewWriter(&buf)
+					_, _ = w.Write([]byte(`[{"TRAIN_ID":"1"}]`))
+					_ = w.Close()
+
+					gzFile := &bulkfakes.FakeFile{}
+					gzFile.ReadStub = bytes.NewReader(buf.Bytes()).Read
+					fs.OpenReturnsOnCall(3, gzFile, nil)
+					dirFile.ReaddirReturns([]os.FileInfo{
+						fInfo("1", false),
+						fInfo("4.gz", false),
+						fInfo("3", false),
+					}, nil)
+				})
+				It("decompresses it, and drops its extension", func() {
+					Expect(callErr).To(BeNil())
+					Expect(dumper.DumpCallCount()).To(Equal(3))
+
+					_, r, name := dumper.DumpArgsForCall(2)
+					Expect(name).To(Equal("dir/4"))
+					Expect(ioutil.ReadAll(r)).To(Equal([]byte(`[{"TRAIN_ID":"1"}]`)))
+				})
+			})
+
 			When("a startAt value is provided", func() {
 				BeforeEach(func() {
 					startAt = "3"
@@ -0,0 +1,266 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package bulkfakes
+
+import (
+	"sync"
+
+	"github.com/smartatransit/scrapedumper/pkg/bulk"
+)
+
+type FakeCheckpoint struct {
+	DoneStub        func(string) (bool, error)
+	doneMutex       sync.RWMutex
+	doneArgsForCall []struct {
+		arg1 string
+	}
+	doneReturns struct {
+		result1 bool
+		result2 error
+	}
+	doneReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	MarkDoneStub        func(string) error
+	markDoneMutex       sync.RWMutex
+	markDoneArgsForCall []struct {
+		arg1 string
+	}
+	markDoneReturns struct {
+		result1 error
+	}
+	markDoneReturnsOnCall map[int]struct {
+		result1 error
+	}
+	MarkFailedStub        func(string, error) error
+	markFailedMutex       sync.RWMutex
+	markFailedArgsForCall []struct {
+		arg1 string
+		arg2 error
+	}
+	markFailedReturns struct {
+		result1 error
+	}
+	markFailedReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCheckpoint) Done(arg1 string) (bool, error) {
+	fake.doneMutex.Lock()
+	ret, specificReturn := fake.doneReturnsOnCall[len(fake.doneArgsForCall)]
+	fake.doneArgsForCall = append(fake.doneArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.DoneStub
+	fakeReturns := fake.doneReturns
+	fake.recordInvocation("Done", []interface{}{arg1})
+	fake.doneMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCheckpoint) DoneCallCount() int {
+	fake.doneMutex.RLock()
+	defer fake.doneMutex.RUnlock()
+	return len(fake.doneArgsForCall)
+}
+
+func (fake *FakeCheckpoint) DoneCalls(stub func(string) (bool, error)) {
+	fake.doneMutex.Lock()
+	defer fake.doneMutex.Unlock()
+	fake.DoneStub = stub
+}
+
+func (fake *FakeCheckpoint) DoneArgsForCall(i int) string {
+	fake.doneMutex.RLock()
+	defer fake.doneMutex.RUnlock()
+	argsForCall := fake.doneArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCheckpoint) DoneReturns(result1 bool, result2 error) {
+	fake.doneMutex.Lock()
+	defer fake.doneMutex.Unlock()
+	fake.DoneStub = nil
+	fake.doneReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCheckpoint) DoneReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.doneMutex.Lock()
+	defer fake.doneMutex.Unlock()
+	fake.DoneStub = nil
+	if fake.doneReturnsOnCall == nil {
+		fake.doneReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.doneReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCheckpoint) MarkDone(arg1 string) error {
+	fake.markDoneMutex.Lock()
+	ret, specificReturn := fake.markDoneReturnsOnCall[len(fake.markDoneArgsForCall)]
+	fake.markDoneArgsForCall = append(fake.markDoneArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.MarkDoneStub
+	fakeReturns := fake.markDoneReturns
+	fake.recordInvocation("MarkDone", []interface{}{arg1})
+	fake.markDoneMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCheckpoint) MarkDoneCallCount() int {
+	fake.markDoneMutex.RLock()
+	defer fake.markDoneMutex.RUnlock()
+	return len(fake.markDoneArgsForCall)
+}
+
+func (fake *FakeCheckpoint) MarkDoneCalls(stub func(string) error) {
+	fake.markDoneMutex.Lock()
+	defer fake.markDoneMutex.Unlock()
+	fake.MarkDoneStub = stub
+}
+
+func (fake *FakeCheckpoint) MarkDoneArgsForCall(i int) string {
+	fake.markDoneMutex.RLock()
+	defer fake.markDoneMutex.RUnlock()
+	argsForCall := fake.markDoneArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCheckpoint) MarkDoneReturns(result1 error) {
+	fake.markDoneMutex.Lock()
+	defer fake.markDoneMutex.Unlock()
+	fake.MarkDoneStub = nil
+	fake.markDoneReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCheckpoint) MarkDoneReturnsOnCall(i int, result1 error) {
+	fake.markDoneMutex.Lock()
+	defer fake.markDoneMutex.Unlock()
+	fake.MarkDoneStub = nil
+	if fake.markDoneReturnsOnCall == nil {
+		fake.markDoneReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.markDoneReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCheckpoint) MarkFailed(arg1 string, arg2 error) error {
+	fake.markFailedMutex.Lock()
+	ret, specificReturn := fake.markFailedReturnsOnCall[len(fake.markFailedArgsForCall)]
+	fake.markFailedArgsForCall = append(fake.markFailedArgsForCall, struct {
+		arg1 string
+		arg2 error
+	}{arg1, arg2})
+	stub := fake.MarkFailedStub
+	fakeReturns := fake.markFailedReturns
+	fake.recordInvocation("MarkFailed", []interface{}{arg1, arg2})
+	fake.markFailedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCheckpoint) MarkFailedCallCount() int {
+	fake.markFailedMutex.RLock()
+	defer fake.markFailedMutex.RUnlock()
+	return len(fake.markFailedArgsForCall)
+}
+
+func (fake *FakeCheckpoint) MarkFailedCalls(stub func(string, error) error) {
+	fake.markFailedMutex.Lock()
+	defer fake.markFailedMutex.Unlock()
+	fake.MarkFailedStub = stub
+}
+
+func (fake *FakeCheckpoint) MarkFailedArgsForCall(i int) (string, error) {
+	fake.markFailedMutex.RLock()
+	defer fake.markFailedMutex.RUnlock()
+	argsForCall := fake.markFailedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeCheckpoint) MarkFailedReturns(result1 error) {
+	fake.markFailedMutex.Lock()
+	defer fake.markFailedMutex.Unlock()
+	fake.MarkFailedStub = nil
+	fake.markFailedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCheckpoint) MarkFailedReturnsOnCall(i int, result1 error) {
+	fake.markFailedMutex.Lock()
+	defer fake.markFailedMutex.Unlock()
+	fake.MarkFailedStub = nil
+	if fake.markFailedReturnsOnCall == nil {
+		fake.markFailedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.markFailedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCheckpoint) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.doneMutex.RLock()
+	defer fake.doneMutex.RUnlock()
+	fake.markDoneMutex.RLock()
+	defer fake.markDoneMutex.RUnlock()
+	fake.markFailedMutex.RLock()
+	defer fake.markFailedMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCheckpoint) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ bulk.Checkpoint = new(FakeCheckpoint)
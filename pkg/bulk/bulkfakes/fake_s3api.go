@@ -0,0 +1,203 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package bulkfakes
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/smartatransit/scrapedumper/pkg/bulk"
+)
+
+type FakeS3API struct {
+	GetObjectWithContextStub        func(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+	getObjectWithContextMutex       sync.RWMutex
+	getObjectWithContextArgsForCall []struct {
+		arg1 aws.Context
+		arg2 *s3.GetObjectInput
+		arg3 []request.Option
+	}
+	getObjectWithContextReturns struct {
+		result1 *s3.GetObjectOutput
+		result2 error
+	}
+	getObjectWithContextReturnsOnCall map[int]struct {
+		result1 *s3.GetObjectOutput
+		result2 error
+	}
+	ListObjectsV2PagesWithContextStub        func(aws.Context, *s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool, ...request.Option) error
+	listObjectsV2PagesWithContextMutex       sync.RWMutex
+	listObjectsV2PagesWithContextArgsForCall []struct {
+		arg1 aws.Context
+		arg2 *s3.ListObjectsV2Input
+		arg3 func(*s3.ListObjectsV2Output, bool) bool
+		arg4 []request.Option
+	}
+	listObjectsV2PagesWithContextReturns struct {
+		result1 error
+	}
+	listObjectsV2PagesWithContextReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeS3API) GetObjectWithContext(arg1 aws.Context, arg2 *s3.GetObjectInput, arg3 ...request.Option) (*s3.GetObjectOutput, error) {
+	fake.getObjectWithContextMutex.Lock()
+	ret, specificReturn := fake.getObjectWithContextReturnsOnCall[len(fake.getObjectWithContextArgsForCall)]
+	fake.getObjectWithContextArgsForCall = append(fake.getObjectWithContextArgsForCall, struct {
+		arg1 aws.Context
+		arg2 *s3.GetObjectInput
+		arg3 []request.Option
+	}{arg1, arg2, arg3})
+	stub := fake.GetObjectWithContextStub
+	fakeReturns := fake.getObjectWithContextReturns
+	fake.recordInvocation("GetObjectWithContext", []interface{}{arg1, arg2, arg3})
+	fake.getObjectWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeS3API) GetObjectWithContextCallCount() int {
+	fake.getObjectWithContextMutex.RLock()
+	defer fake.getObjectWithContextMutex.RUnlock()
+	return len(fake.getObjectWithContextArgsForCall)
+}
+
+func (fake *FakeS3API) GetObjectWithContextCalls(stub func(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)) {
+	fake.getObjectWithContextMutex.Lock()
+	defer fake.getObjectWithContextMutex.Unlock()
+	fake.GetObjectWithContextStub = stub
+}
+
+func (fake *FakeS3API) GetObjectWithContextArgsForCall(i int) (aws.Context, *s3.GetObjectInput, []request.Option) {
+	fake.getObjectWithContextMutex.RLock()
+	defer fake.getObjectWithContextMutex.RUnlock()
+	argsForCall := fake.getObjectWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeS3API) GetObjectWithContextReturns(result1 *s3.GetObjectOutput, result2 error) {
+	fake.getObjectWithContextMutex.Lock()
+	defer fake.getObjectWithContextMutex.Unlock()
+	fake.GetObjectWithContextStub = nil
+	fake.getObjectWithContextReturns = struct {
+		result1 *s3.GetObjectOutput
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeS3API) GetObjectWithContextReturnsOnCall(i int, result1 *s3.GetObjectOutput, result2 error) {
+	fake.getObjectWithContextMutex.Lock()
+	defer fake.getObjectWithContextMutex.Unlock()
+	fake.GetObjectWithContextStub = nil
+	if fake.getObjectWithContextReturnsOnCall == nil {
+		fake.getObjectWithContextReturnsOnCall = make(map[int]struct {
+			result1 *s3.GetObjectOutput
+			result2 error
+		})
+	}
+	fake.getObjectWithContextReturnsOnCall[i] = struct {
+		result1 *s3.GetObjectOutput
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeS3API) ListObjectsV2PagesWithContext(arg1 aws.Context, arg2 *s3.ListObjectsV2Input, arg3 func(*s3.ListObjectsV2Output, bool) bool, arg4 ...request.Option) error {
+	fake.listObjectsV2PagesWithContextMutex.Lock()
+	ret, specificReturn := fake.listObjectsV2PagesWithContextReturnsOnCall[len(fake.listObjectsV2PagesWithContextArgsForCall)]
+	fake.listObjectsV2PagesWithContextArgsForCall = append(fake.listObjectsV2PagesWithContextArgsForCall, struct {
+		arg1 aws.Context
+		arg2 *s3.ListObjectsV2Input
+		arg3 func(*s3.ListObjectsV2Output, bool) bool
+		arg4 []request.Option
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.ListObjectsV2PagesWithContextStub
+	fakeReturns := fake.listObjectsV2PagesWithContextReturns
+	fake.recordInvocation("ListObjectsV2PagesWithContext", []interface{}{arg1, arg2, arg3, arg4})
+	fake.listObjectsV2PagesWithContextMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4...)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeS3API) ListObjectsV2PagesWithContextCallCount() int {
+	fake.listObjectsV2PagesWithContextMutex.RLock()
+	defer fake.listObjectsV2PagesWithContextMutex.RUnlock()
+	return len(fake.listObjectsV2PagesWithContextArgsForCall)
+}
+
+func (fake *FakeS3API) ListObjectsV2PagesWithContextCalls(stub func(aws.Context, *s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool, ...request.Option) error) {
+	fake.listObjectsV2PagesWithContextMutex.Lock()
+	defer fake.listObjectsV2PagesWithContextMutex.Unlock()
+	fake.ListObjectsV2PagesWithContextStub = stub
+}
+
+func (fake *FakeS3API) ListObjectsV2PagesWithContextArgsForCall(i int) (aws.Context, *s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool, []request.Option) {
+	fake.listObjectsV2PagesWithContextMutex.RLock()
+	defer fake.listObjectsV2PagesWithContextMutex.RUnlock()
+	argsForCall := fake.listObjectsV2PagesWithContextArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeS3API) ListObjectsV2PagesWithContextReturns(result1 error) {
+	fake.listObjectsV2PagesWithContextMutex.Lock()
+	defer fake.listObjectsV2PagesWithContextMutex.Unlock()
+	fake.ListObjectsV2PagesWithContextStub = nil
+	fake.listObjectsV2PagesWithContextReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeS3API) ListObjectsV2PagesWithContextReturnsOnCall(i int, result1 error) {
+	fake.listObjectsV2PagesWithContextMutex.Lock()
+	defer fake.listObjectsV2PagesWithContextMutex.Unlock()
+	fake.ListObjectsV2PagesWithContextStub = nil
+	if fake.listObjectsV2PagesWithContextReturnsOnCall == nil {
+		fake.listObjectsV2PagesWithContextReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.listObjectsV2PagesWithContextReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeS3API) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getObjectWithContextMutex.RLock()
+	defer fake.getObjectWithContextMutex.RUnlock()
+	fake.listObjectsV2PagesWithContextMutex.RLock()
+	defer fake.listObjectsV2PagesWithContextMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeS3API) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ bulk.S3API = new(FakeS3API)
@@ -0,0 +1,116 @@
+package bulk
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+//Checkpoint records which sources have been loaded, so that an interrupted
+//load can resume where it left off
+//go:generate counterfeiter . Checkpoint
+type Checkpoint interface {
+	Done(name string) (bool, error)
+	MarkDone(name string) error
+	MarkFailed(name string, cause error) error
+}
+
+type noCheckpoint struct{}
+
+func (noCheckpoint) Done(string) (bool, error)      { return false, nil }
+func (noCheckpoint) MarkDone(string) error          { return nil }
+func (noCheckpoint) MarkFailed(string, error) error { return nil }
+
+const (
+	checkpointDone   = "done"
+	checkpointFailed = "failed"
+)
+
+//FileCheckpoint is a Checkpoint kept in a local file, with a tab-separated
+//line for each source that was loaded or failed. Failed sources are recorded
+//with their error, for inspection, and are loaded again on the next run.
+type FileCheckpoint struct {
+	mu   sync.Mutex
+	file afero.File
+	done map[string]bool
+}
+
+//OpenFileCheckpoint reads the checkpoint at path, creating it if it doesn't
+//exist yet, and opens it to record further progress
+func OpenFileCheckpoint(fs afero.Fs, path string) (*FileCheckpoint, error) {
+	c := &FileCheckpoint{
+		done: map[string]bool{},
+	}
+
+	existing, err := fs.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to open checkpoint `%s`", path)
+	}
+	if err == nil {
+		defer existing.Close()
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), "\t", 3)
+			if len(fields) < 2 {
+				continue
+			}
+			switch fields[0] {
+			case checkpointDone:
+				c.done[fields[1]] = true
+			case checkpointFailed:
+				delete(c.done, fields[1])
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "failed to read checkpoint `%s`", path)
+		}
+	}
+
+	c.file, err = fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open checkpoint `%s` for writing", path)
+	}
+	return c, nil
+}
+
+//Done reports whether the source has been loaded
+func (c *FileCheckpoint) Done(name string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[name], nil
+}
+
+//MarkDone records that the source has been loaded
+func (c *FileCheckpoint) MarkDone(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.write(checkpointDone, name); err != nil {
+		return err
+	}
+	c.done[name] = true
+	return nil
+}
+
+//MarkFailed records that the source failed to load
+func (c *FileCheckpoint) MarkFailed(name string, cause error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.done, name)
+	//keep the error on one line
+	return c.write(checkpointFailed, name, strings.Join(strings.Fields(cause.Error()), " "))
+}
+
+func (c *FileCheckpoint) write(fields ...string) error {
+	_, err := fmt.Fprintln(c.file, strings.Join(fields, "\t"))
+	return errors.Wrapf(err, "failed to write checkpoint `%s`", c.file.Name())
+}
+
+//Close closes the checkpoint file
+func (c *FileCheckpoint) Close() error {
+	return c.file.Close()
+}
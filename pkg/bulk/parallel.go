@@ -0,0 +1,317 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+)
+
+//Source is a file or object to be loaded
+type Source struct {
+	//Name identifies the source in checkpoints and summaries
+	Name string
+	//Path is passed to the dumper along with the source's contents
+	Path string
+	//Open opens the source's contents, decompressed
+	Open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+//WalkFunc is called with each source to be loaded, in order
+type WalkFunc func(src Source) error
+
+//Part is a piece of a source that can be dumped on its own
+type Part struct {
+	Key  string
+	Body []byte
+}
+
+//Partitioner splits the contents of a source into parts. Parts with the same
+//key are dumped one at a time, in the order of their sources, while parts with
+//different keys may be dumped concurrently.
+type Partitioner func(r io.Reader) ([]Part, error)
+
+//Whole keeps each source in a single part, so that sources are dumped one at a time
+func Whole(r io.Reader) ([]Part, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return []Part{{Body: b}}, nil
+}
+
+//PartitionByField splits a JSON array of objects by the value of one of their
+//fields, keeping the objects of each part in their original order. Partitioning
+//train data by TRAIN_ID keeps each train's records in order for the upserter.
+func PartitionByField(field string) Partitioner {
+	return func(r io.Reader) ([]Part, error) {
+		var records []json.RawMessage
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, err
+		}
+
+		var (
+			keys   []string
+			groups = map[string][][]byte{}
+		)
+		for _, rec := range records {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(rec, &fields); err != nil {
+				return nil, err
+			}
+
+			var key string
+			if err := json.Unmarshal(fields[field], &key); err != nil {
+				//not a string, so key on its raw JSON
+				key = string(fields[field])
+			}
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], rec)
+		}
+
+		parts := make([]Part, len(keys))
+		for i, key := range keys {
+			parts[i] = Part{
+				Key:  key,
+				Body: append(append([]byte{'['}, bytes.Join(groups[key], []byte{','})...), ']'),
+			}
+		}
+		return parts, nil
+	}
+}
+
+//Failure is a source that failed to load
+type Failure struct {
+	Name string
+	Err  error
+}
+
+//Summary counts the sources that were processed, skipped because a checkpoint
+//shows they were already loaded, and failed
+type Summary struct {
+	Processed int
+	Skipped   int
+	Failed    []Failure
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d processed, %d skipped, %d failed", s.Processed, s.Skipped, len(s.Failed))
+}
+
+//ParallelOption configures a ParallelLoader
+type ParallelOption func(*ParallelLoader)
+
+//WithConcurrency dumps up to n parts at once
+func WithConcurrency(n int) ParallelOption {
+	return func(l *ParallelLoader) {
+		if n > 0 {
+			l.concurrency = n
+		}
+	}
+}
+
+//WithPartitioner splits sources into parts that can be dumped concurrently.
+//Without one, each source is a single part.
+func WithPartitioner(p Partitioner) ParallelOption {
+	return func(l *ParallelLoader) {
+		l.partitioner = p
+	}
+}
+
+//WithCheckpoint skips the sources that the checkpoint shows were already
+//loaded, and records each source as it's loaded or fails
+func WithCheckpoint(c Checkpoint) ParallelOption {
+	return func(l *ParallelLoader) {
+		l.checkpoint = c
+	}
+}
+
+//WithSkipFailures records a source that fails to load and carries on, instead
+//of stopping the load
+func WithSkipFailures() ParallelOption {
+	return func(l *ParallelLoader) {
+		l.skipFailures = true
+	}
+}
+
+//ParallelLoader loads sources with a bounded pool of workers. Each part is
+//dumped by the worker its key hashes to, so that parts with the same key are
+//dumped in order.
+type ParallelLoader struct {
+	dumper       dumper.Dumper
+	concurrency  int
+	partitioner  Partitioner
+	checkpoint   Checkpoint
+	skipFailures bool
+}
+
+//NewParallelLoader creates a new ParallelLoader
+func NewParallelLoader(d dumper.Dumper, opts ...ParallelOption) ParallelLoader {
+	l := ParallelLoader{
+		dumper:      d,
+		concurrency: 1,
+		partitioner: Whole,
+		checkpoint:  noCheckpoint{},
+	}
+	for _, opt := range opts {
+		opt(&l)
+	}
+	return l
+}
+
+//errAborted marks the parts of sources that were abandoned when a load stopped
+var errAborted = errors.New("load aborted")
+
+//sourceLoad tracks the parts of a source that are still being dumped
+type sourceLoad struct {
+	name    string
+	mu      sync.Mutex
+	pending int
+	err     error
+}
+
+//partDone records the outcome of a part, and reports whether it was the last
+func (s *sourceLoad) partDone(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.pending--
+	return s.pending == 0
+}
+
+type partJob struct {
+	source *sourceLoad
+	path   string
+	body   []byte
+}
+
+//Load loads each source that walk calls its WalkFunc with. Sources are read and
+//partitioned in order, while their parts are dumped by the workers. A failed
+//source stops the load and its error is returned, unless failures are skipped;
+//either way it's listed in the summary.
+func (l ParallelLoader) Load(ctx context.Context, walk func(fn WalkFunc) error) (summary Summary, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex // guards summary and stopErr
+		stopErr  error
+		finished = func(src *sourceLoad, err error) {
+			if err == errAborted {
+				return
+			}
+			if err == nil {
+				err = errors.Wrapf(l.checkpoint.MarkDone(src.name), "failed to checkpoint `%s`", src.name)
+			} else if cpErr := l.checkpoint.MarkFailed(src.name, err); cpErr != nil {
+				err = errors.Wrapf(cpErr, "failed to checkpoint failure of `%s` (%s)", src.name, err.Error())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				summary.Processed++
+				return
+			}
+			summary.Failed = append(summary.Failed, Failure{Name: src.name, Err: err})
+			if !l.skipFailures && stopErr == nil {
+				stopErr = err
+				cancel()
+			}
+		}
+	)
+
+	queues := make([]chan partJob, l.concurrency)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan partJob, 16)
+		wg.Add(1)
+		go func(queue <-chan partJob) {
+			defer wg.Done()
+			for job := range queue {
+				err := errAborted
+				if ctx.Err() == nil {
+					err = l.dumper.Dump(ctx, bytes.NewReader(job.body), job.path)
+					err = errors.Wrapf(err, "failed to dump contents of `%s`", job.source.name)
+				}
+				if job.source.partDone(err) {
+					finished(job.source, job.source.err)
+				}
+			}
+		}(queues[i])
+	}
+
+	walkErr := walk(func(src Source) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		done, err := l.checkpoint.Done(src.Name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check checkpoint for `%s`", src.Name)
+		}
+		if done {
+			mu.Lock()
+			summary.Skipped++
+			mu.Unlock()
+			return nil
+		}
+
+		parts, err := l.read(ctx, src)
+		load := &sourceLoad{name: src.Name, pending: len(parts)}
+		if err != nil || len(parts) == 0 {
+			finished(load, err)
+			return nil
+		}
+
+		for _, part := range parts {
+			select {
+			case queues[l.queueFor(part.Key)] <- partJob{load, src.Path, part.Body}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	switch {
+	case stopErr != nil:
+		err = stopErr
+	case walkErr != nil:
+		err = walkErr
+	}
+	return
+}
+
+func (l ParallelLoader) read(ctx context.Context, src Source) ([]Part, error) {
+	r, err := src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	parts, err := l.partitioner(r)
+	return parts, errors.Wrapf(err, "failed to read `%s`", src.Name)
+}
+
+func (l ParallelLoader) queueFor(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(l.concurrency))
+}
@@ -0,0 +1,230 @@
+package bulk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+
+	"github.com/smartatransit/scrapedumper/pkg/bulk"
+	"github.com/smartatransit/scrapedumper/pkg/bulk/bulkfakes"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func source(name string, body string) bulk.Source {
+	return bulk.Source{
+		Name: "/data/" + name,
+		Path: name,
+		Open: func(context.Context) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(body)), nil
+		},
+	}
+}
+
+func walkSources(sources []bulk.Source) func(bulk.WalkFunc) error {
+	return func(fn bulk.WalkFunc) error {
+		for _, src := range sources {
+			if err := fn(src); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+var _ = Describe("PartitionByField", func() {
+	It("groups the records by the field, in order", func() {
+		parts, err := bulk.PartitionByField("TRAIN_ID")(strings.NewReader(`[
+			{"TRAIN_ID": "101", "STATION": "A"},
+			{"TRAIN_ID": "102", "STATION": "A"},
+			{"TRAIN_ID": "101", "STATION": "B"},
+			{"STATION": "C"}
+		]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parts).To(HaveLen(3))
+		Expect(parts[0].Key).To(Equal("101"))
+		Expect(parts[0].Body).To(MatchJSON(`[{"TRAIN_ID": "101", "STATION": "A"}, {"TRAIN_ID": "101", "STATION": "B"}]`))
+		Expect(parts[1].Key).To(Equal("102"))
+		Expect(parts[2].Key).To(Equal(""))
+		Expect(parts[2].Body).To(MatchJSON(`[{"STATION": "C"}]`))
+	})
+	It("fails on anything but an array of objects", func() {
+		_, err := bulk.PartitionByField("TRAIN_ID")(strings.NewReader(`{"TRAIN_ID": "101"}`))
+		Expect(err).To(HaveOccurred())
+		_, err = bulk.PartitionByField("TRAIN_ID")(strings.NewReader(`[1]`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ParallelLoader", func() {
+	var (
+		sources []bulk.Source
+		dumper  *dumperfakes.FakeDumper
+		opts    []bulk.ParallelOption
+
+		mu       sync.Mutex
+		stations map[string][]string
+		paths    map[string]bool
+
+		summary bulk.Summary
+		callErr error
+	)
+
+	BeforeEach(func() {
+		sources = nil
+		for i := 0; i < 20; i++ {
+			sources = append(sources, source(fmt.Sprintf("%02d.json", i), fmt.Sprintf(`[
+				{"TRAIN_ID": "101", "STATION": "%[1]d"},
+				{"TRAIN_ID": "102", "STATION": "%[1]d"},
+				{"TRAIN_ID": "103", "STATION": "%[1]d"},
+				{"TRAIN_ID": "104", "STATION": "%[1]d"}
+			]`, i)))
+		}
+
+		stations = map[string][]string{}
+		paths = map[string]bool{}
+		dumper = &dumperfakes.FakeDumper{}
+		dumper.DumpStub = func(_ context.Context, r io.Reader, path string) error {
+			var records []struct {
+				TrainID string `json:"TRAIN_ID"`
+				Station string `json:"STATION"`
+			}
+			if err := json.NewDecoder(r).Decode(&records); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			paths[path] = true
+			for _, rec := range records {
+				stations[rec.TrainID] = append(stations[rec.TrainID], rec.Station)
+			}
+			return nil
+		}
+
+		opts = []bulk.ParallelOption{
+			bulk.WithConcurrency(4),
+			bulk.WithPartitioner(bulk.PartitionByField("TRAIN_ID")),
+		}
+	})
+
+	JustBeforeEach(func() {
+		summary, callErr = bulk.NewParallelLoader(dumper, opts...).Load(context.Background(), walkSources(sources))
+	})
+
+	inOrder := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16", "17", "18", "19"}
+
+	It("loads every source, keeping each train's records in order", func() {
+		Expect(callErr).NotTo(HaveOccurred())
+		Expect(summary.String()).To(Equal("20 processed, 0 skipped, 0 failed"))
+		Expect(dumper.DumpCallCount()).To(Equal(80))
+		Expect(paths).To(HaveKey("00.json"))
+		Expect(paths).To(HaveKey("19.json"))
+		for _, train := range []string{"101", "102", "103", "104"} {
+			Expect(stations[train]).To(Equal(inOrder))
+		}
+	})
+
+	When("a source is bad", func() {
+		BeforeEach(func() {
+			sources[3] = source("03.json", `<html>`)
+		})
+		It("stops the load", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("failed to read `/data/03.json`")))
+			Expect(summary.Failed).To(HaveLen(1))
+			Expect(summary.Processed).To(BeNumerically("<", 20))
+		})
+
+		When("failures are skipped", func() {
+			BeforeEach(func() {
+				opts = append(opts, bulk.WithSkipFailures())
+			})
+			It("records it and carries on", func() {
+				Expect(callErr).NotTo(HaveOccurred())
+				Expect(summary.String()).To(Equal("19 processed, 0 skipped, 1 failed"))
+				Expect(summary.Failed[0].Name).To(Equal("/data/03.json"))
+			})
+		})
+	})
+
+	When("a dump fails", func() {
+		BeforeEach(func() {
+			stub := dumper.DumpStub
+			dumper.DumpStub = func(ctx context.Context, r io.Reader, path string) error {
+				b, _ := ioutil.ReadAll(r)
+				if path == "05.json" && strings.Contains(string(b), "103") {
+					return errors.New("connection reset")
+				}
+				return stub(ctx, strings.NewReader(string(b)), path)
+			}
+			opts = append(opts, bulk.WithSkipFailures())
+		})
+		It("fails the whole source", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(summary.String()).To(Equal("19 processed, 0 skipped, 1 failed"))
+			Expect(summary.Failed[0].Err).To(MatchError("failed to dump contents of `/data/05.json`: connection reset"))
+		})
+	})
+
+	When("loading with a checkpoint", func() {
+		var (
+			fs afero.Fs
+			cp *bulk.FileCheckpoint
+		)
+
+		BeforeEach(func() {
+			fs = afero.NewMemMapFs()
+			var err error
+			cp, err = bulk.OpenFileCheckpoint(fs, "/data/checkpoint.tsv")
+			Expect(err).NotTo(HaveOccurred())
+			opts = append(opts, bulk.WithCheckpoint(cp), bulk.WithSkipFailures())
+			sources[7] = source("07.json", `[`)
+		})
+
+		It("resumes where it left off", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(summary.String()).To(Equal("19 processed, 0 skipped, 1 failed"))
+			Expect(cp.Close()).To(Succeed())
+
+			contents, err := afero.ReadFile(fs, "/data/checkpoint.tsv")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("done\t/data/00.json\n"))
+			Expect(string(contents)).To(ContainSubstring("failed\t/data/07.json\tfailed to read `/data/07.json`: unexpected EOF\n"))
+
+			sources[7] = source("07.json", `[{"TRAIN_ID": "101", "STATION": "7"}]`)
+			cp, err = bulk.OpenFileCheckpoint(fs, "/data/checkpoint.tsv")
+			Expect(err).NotTo(HaveOccurred())
+			defer cp.Close()
+
+			dumper.DumpReturns(nil)
+			calls := dumper.DumpCallCount()
+			summary, err = bulk.NewParallelLoader(dumper, bulk.WithCheckpoint(cp)).Load(context.Background(), walkSources(sources))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary.String()).To(Equal("1 processed, 19 skipped, 0 failed"))
+			Expect(dumper.DumpCallCount()).To(Equal(calls + 1))
+		})
+	})
+
+	When("the checkpoint can't be written", func() {
+		BeforeEach(func() {
+			cp := &bulkfakes.FakeCheckpoint{}
+			cp.MarkDoneReturns(errors.New("disk full"))
+			opts = append(opts, bulk.WithCheckpoint(cp), bulk.WithSkipFailures())
+		})
+		It("counts the source as failed", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(summary.Processed).To(BeZero())
+			Expect(summary.Failed).To(HaveLen(20))
+			Expect(summary.Failed[0].Err).To(MatchError(ContainSubstring("failed to checkpoint")))
+		})
+	})
+})
@@ -0,0 +1,137 @@
+package bulk
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+)
+
+//S3API is the part of the S3 client that S3DumperAgent uses
+//go:generate counterfeiter . S3API
+type S3API interface {
+	ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+}
+
+//S3DumperAgent loads the objects in an S3 bucket, such as the one an S3 dumper
+//writes to, without downloading them first
+type S3DumperAgent struct {
+	client S3API
+	bucket string
+	dumper dumper.Dumper
+}
+
+//NewS3Dumper creates a new S3DumperAgent
+func NewS3Dumper(
+	client S3API,
+	bucket string,
+	dumper dumper.Dumper,
+) S3DumperAgent {
+	return S3DumperAgent{
+		client: client,
+		bucket: bucket,
+		dumper: dumper,
+	}
+}
+
+//DumpPrefix streams each object whose key starts with `prefix` into the dumper,
+//in key order. Keys up to and including `startAfter` are skipped, as are keys
+//from `endBefore` on; either may be empty to load from the first key or to the
+//last. Since keys begin with an RFC3339 timestamp after the prefix, these can
+//bound the load to a range of time.
+func (a S3DumperAgent) DumpPrefix(ctx context.Context, prefix string, startAfter string, endBefore string) error {
+	return a.Walk(ctx, prefix, startAfter, endBefore, func(src Source) error {
+		return a.DumpObject(ctx, src.Name)
+	})
+}
+
+//Walk calls fn with each object that DumpPrefix would load, in the same order,
+//stopping at the first error
+func (a S3DumperAgent) Walk(ctx context.Context, prefix string, startAfter string, endBefore string, fn WalkFunc) (err error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(a.bucket),
+		Prefix: aws.String(prefix),
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+
+	listErr := a.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			//S3 lists keys in order, so nothing after this one is in range
+			if endBefore != "" && key >= endBefore {
+				return false
+			}
+			//skip the placeholders that some tools create for empty "directories"
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+
+			err = fn(Source{
+				Name: key,
+				Path: strings.TrimSuffix(key, dumper.CompressionFromPath(key).Extension()),
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					return a.openObject(ctx, key)
+				},
+			})
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+
+	err = errors.Wrapf(listErr, "failed to list objects in bucket `%s` with prefix `%s`", a.bucket, prefix)
+	return
+}
+
+//DumpObject loads a single object. Objects compressed by a dumper are
+//decompressed according to their extension, which is dropped from the key
+//passed on.
+func (a S3DumperAgent) DumpObject(ctx context.Context, key string) (err error) {
+	r, err := a.openObject(ctx, key)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	err = a.dumper.Dump(ctx, r, strings.TrimSuffix(key, dumper.CompressionFromPath(key).Extension()))
+	err = errors.Wrapf(err, "failed to dump contents of object `%s`", key)
+	return
+}
+
+//identityEncoding asks for an object as it's stored. An S3 dumper uploads
+//compressed objects with a Content-Encoding, and otherwise Go's HTTP transport
+//would ask for gzip itself and then quietly decompress them.
+func identityEncoding(r *request.Request) {
+	r.HTTPRequest.Header.Set("Accept-Encoding", "identity")
+}
+
+//openObject streams an object, decompressing it according to its extension
+func (a S3DumperAgent) openObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := a.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(key),
+	}, identityEncoding)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get object `%s` from bucket `%s`", key, a.bucket)
+	}
+
+	r, err := dumper.CompressionFromPath(key).NewReader(out.Body)
+	if err != nil {
+		out.Body.Close()
+		return nil, errors.Wrapf(err, "failed to decompress object `%s`", key)
+	}
+	return decompressedReader{r, out.Body}, nil
+}
@@ -0,0 +1,175 @@
+package bulk_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+
+	"github.com/smartatransit/scrapedumper/pkg/bulk"
+	"github.com/smartatransit/scrapedumper/pkg/bulk/bulkfakes"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//standInBackend stores objects in memory for a gofakes3 server, listing two
+//keys per page and failing to get any key marked as failing
+type standInBackend struct {
+	*s3mem.Backend
+	failing map[string]bool
+}
+
+func (b standInBackend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes3.ListBucketPage) (*gofakes3.ObjectList, error) {
+	page.MaxKeys = 2
+	return b.Backend.ListBucket(name, prefix, page)
+}
+
+func (b standInBackend) GetObject(bucketName, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	if b.failing[objectName] {
+		return nil, gofakes3.ErrInternal
+	}
+	return b.Backend.GetObject(bucketName, objectName, rangeRequest)
+}
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+var _ = Describe("S3DumperAgent", func() {
+	var (
+		backend standInBackend
+		server  *httptest.Server
+		client  bulk.S3API
+		dumper  *dumperfakes.FakeDumper
+		dumped  []string
+
+		prefix     string
+		startAfter string
+		endBefore  string
+		callErr    error
+	)
+
+	BeforeEach(func() {
+		backend = standInBackend{s3mem.New(), map[string]bool{}}
+		Expect(backend.CreateBucket("marta-archive")).To(Succeed())
+		for key, body := range map[string][]byte{
+			"bus-data/2020-03-01T12:00:00Z.json":   []byte(`[]`),
+			"train-data/":                          nil,
+			"train-data/2020-03-01T12:00:00Z.json": []byte(`[1]`),
+			"train-data/2020-03-01T12:00:10Z.json": []byte(`[2]`),
+			"train-data/2020-03-01T12:00:30Z.json": []byte(`[4]`),
+			"train-data/2020-03-01T12:00:40Z.json": []byte(`[5]`),
+		} {
+			_, err := backend.PutObject("marta-archive", key, map[string]string{"Content-Type": "application/json"}, bytes.NewReader(body), int64(len(body)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		//stored as an S3 dumper uploads it, so that S3 serves it with its encoding
+		compressed := gzipped(`[3]`)
+		_, err := backend.PutObject("marta-archive", "train-data/2020-03-01T12:00:20Z.json.gz", map[string]string{
+			"Content-Type":     "application/json",
+			"Content-Encoding": "gzip",
+		}, bytes.NewReader(compressed), int64(len(compressed)))
+		Expect(err).NotTo(HaveOccurred())
+
+		server = httptest.NewServer(gofakes3.New(backend).Server())
+		client = s3.New(session.Must(session.NewSession(&aws.Config{
+			Endpoint:         aws.String(server.URL),
+			Region:           aws.String("us-east-1"),
+			S3ForcePathStyle: aws.Bool(true),
+			Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+			MaxRetries:       aws.Int(0),
+		})))
+
+		dumper = &dumperfakes.FakeDumper{}
+		dumped = nil
+		dumper.DumpStub = func(_ context.Context, r io.Reader, path string) error {
+			b, err := ioutil.ReadAll(r)
+			dumped = append(dumped, path+": "+string(b))
+			return err
+		}
+
+		prefix = "train-data/"
+		startAfter = ""
+		endBefore = ""
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	JustBeforeEach(func() {
+		callErr = bulk.NewS3Dumper(client, "marta-archive", dumper).DumpPrefix(context.Background(), prefix, startAfter, endBefore)
+	})
+
+	It("loads every object under the prefix in key order, across pages", func() {
+		Expect(callErr).NotTo(HaveOccurred())
+		Expect(dumped).To(Equal([]string{
+			"train-data/2020-03-01T12:00:00Z.json: [1]",
+			"train-data/2020-03-01T12:00:10Z.json: [2]",
+			"train-data/2020-03-01T12:00:20Z.json: [3]",
+			"train-data/2020-03-01T12:00:30Z.json: [4]",
+			"train-data/2020-03-01T12:00:40Z.json: [5]",
+		}))
+	})
+
+	When("bounded by start-after and end-before keys", func() {
+		BeforeEach(func() {
+			startAfter = "train-data/2020-03-01T12:00:00Z.json"
+			endBefore = "train-data/2020-03-01T12:00:30Z"
+		})
+		It("loads only the keys between them", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(dumped).To(Equal([]string{
+				"train-data/2020-03-01T12:00:10Z.json: [2]",
+				"train-data/2020-03-01T12:00:20Z.json: [3]",
+			}))
+		})
+	})
+
+	When("an object can't be fetched", func() {
+		BeforeEach(func() {
+			backend.failing["train-data/2020-03-01T12:00:10Z.json"] = true
+		})
+		It("stops there", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("failed to get object `train-data/2020-03-01T12:00:10Z.json` from bucket `marta-archive`")))
+			Expect(dumped).To(Equal([]string{"train-data/2020-03-01T12:00:00Z.json: [1]"}))
+		})
+	})
+
+	When("the dump fails", func() {
+		BeforeEach(func() {
+			dumper.DumpStub = nil
+			dumper.DumpReturns(errors.New("dump failed"))
+		})
+		It("stops there", func() {
+			Expect(callErr).To(MatchError("failed to dump contents of object `train-data/2020-03-01T12:00:00Z.json`: dump failed"))
+			Expect(dumper.DumpCallCount()).To(Equal(1))
+		})
+	})
+
+	When("the bucket can't be listed", func() {
+		BeforeEach(func() {
+			fake := &bulkfakes.FakeS3API{}
+			fake.ListObjectsV2PagesWithContextReturns(errors.New("access denied"))
+			client = fake
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError("failed to list objects in bucket `marta-archive` with prefix `train-data/`: access denied"))
+		})
+	})
+})
@@ -0,0 +1,320 @@
+package bulk
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+)
+
+//TreeOptions chooses the files that WalkTree loads
+type TreeOptions struct {
+	//Include lists glob patterns, at least one of which a file must match to be
+	//loaded, unless it's empty. Patterns containing a `/` are matched against the
+	//path relative to the root, and others against the file's name. Names are
+	//matched with and without a compression extension, so `*.json` matches
+	//`.json.gz` files too.
+	Include []string
+	//Exclude lists glob patterns, matched like Include, of files, directories and
+	//archives to leave out
+	Exclude []string
+	//StartAt skips files whose names sort before it
+	StartAt string
+}
+
+func (o TreeOptions) validate() error {
+	for _, pattern := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid glob pattern `%s`", pattern)
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		for _, target := range []string{rel, strings.TrimSuffix(rel, dumper.CompressionFromPath(rel).Extension())} {
+			if !strings.Contains(pattern, "/") {
+				target = path.Base(target)
+			}
+			if ok, _ := path.Match(pattern, target); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o TreeOptions) includes(rel string) bool {
+	if matchesAny(o.Exclude, rel) {
+		return false
+	}
+	return len(o.Include) == 0 || matchesAny(o.Include, rel)
+}
+
+//isArchive reports whether a file is a tarball, compressed or not
+func isArchive(name string) bool {
+	name = strings.TrimSuffix(name, dumper.CompressionFromPath(name).Extension())
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tgz")
+}
+
+//treeFile is a file, or an entry in an archive, found by WalkTree
+type treeFile struct {
+	name string
+	//rel is the path the file is dumped under: its path relative to the root,
+	//or an entry's path in its archive
+	rel string
+	//archive is the path of the archive the file is an entry in, if any, and
+	//index is the entry's position in it
+	archive string
+	index   int
+}
+
+func (f treeFile) base() string {
+	return path.Base(f.name)
+}
+
+//WalkTree calls fn with each file under root that the options include, along
+//with each included entry of the tarballs among them. Subdirectories are walked
+//recursively, and files and entries are visited in order of their names across
+//the whole tree, since their names are RFC3339 timestamps. Compressed files and
+//entries are decompressed according to their extension. A file's path is its
+//path relative to root, and an entry's is its path in the archive, so scrapes
+//kept under their prefix directories are dumped under them.
+//
+//The entries of an archive are read from a single pass over it as long as they
+//were archived in order, so each source must be read before the next is opened.
+func (a DirectoryDumperAgent) WalkTree(ctx context.Context, root string, opts TreeOptions, fn WalkFunc) (err error) {
+	if err = opts.validate(); err != nil {
+		return
+	}
+
+	var files []treeFile
+	if err = a.listTree(root, "", opts, &files); err != nil {
+		return
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].base() != files[j].base() {
+			return files[i].base() < files[j].base()
+		}
+		return files[i].name < files[j].name
+	})
+
+	cursors := archiveCursors{fs: a.fs, open: map[string]*archiveCursor{}, remaining: map[string]int{}}
+	defer cursors.closeAll()
+	for _, f := range files {
+		if f.archive != "" {
+			cursors.remaining[f.archive]++
+		}
+	}
+
+	for _, f := range files {
+		f := f
+		src := Source{
+			Name: f.name,
+			Path: strings.TrimSuffix(f.rel, dumper.CompressionFromPath(f.rel).Extension()),
+			Open: func(context.Context) (io.ReadCloser, error) {
+				return a.openFile(f.name)
+			},
+		}
+		if f.archive != "" {
+			src.Open = func(context.Context) (io.ReadCloser, error) {
+				return cursors.openEntry(f)
+			}
+		}
+
+		if err = fn(src); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (a DirectoryDumperAgent) listTree(dir string, rel string, opts TreeOptions, files *[]treeFile) error {
+	f, err := a.fs.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open directory contents for reading at path `%s`", dir)
+	}
+	defer f.Close()
+
+	list, err := f.Readdir(-1)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read directory contents for path `%s`", dir)
+	}
+
+	for _, finfo := range list {
+		filePath := path.Join(dir, finfo.Name())
+		fileRel := path.Join(rel, finfo.Name())
+		switch {
+		case matchesAny(opts.Exclude, fileRel):
+		case finfo.IsDir():
+			if err := a.listTree(filePath, fileRel, opts, files); err != nil {
+				return err
+			}
+		case isArchive(finfo.Name()):
+			if err := a.listArchive(filePath, fileRel, opts, files); err != nil {
+				return err
+			}
+		case opts.includes(fileRel) && finfo.Name() >= opts.StartAt:
+			*files = append(*files, treeFile{name: filePath, rel: fileRel})
+		}
+	}
+	return nil
+}
+
+func (a DirectoryDumperAgent) listArchive(archive string, rel string, opts TreeOptions, files *[]treeFile) error {
+	cursor, err := openArchive(a.fs, archive)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	for {
+		hdr, err := cursor.advance()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		entry := path.Clean(hdr.Name)
+		if opts.includes(path.Join(rel, entry)) && path.Base(entry) >= opts.StartAt {
+			*files = append(*files, treeFile{
+				name:    path.Join(archive, entry),
+				rel:     entry,
+				archive: archive,
+				index:   cursor.next - 1,
+			})
+		}
+	}
+}
+
+//archiveCursor reads through an archive one entry at a time
+type archiveCursor struct {
+	path string
+	file io.Closer
+	r    io.ReadCloser
+	tr   *tar.Reader
+	//next is the index of the entry that the next call to advance reads
+	next int
+}
+
+func openArchive(fs FileSystem, archive string) (*archiveCursor, error) {
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open archive `%s` for reading", archive)
+	}
+
+	compression := dumper.CompressionFromPath(archive)
+	if strings.HasSuffix(archive, ".tgz") {
+		compression = dumper.Gzip
+	}
+	r, err := compression.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "failed to decompress archive `%s`", archive)
+	}
+
+	return &archiveCursor{
+		path: archive,
+		file: file,
+		r:    r,
+		tr:   tar.NewReader(r),
+	}, nil
+}
+
+func (c *archiveCursor) advance() (*tar.Header, error) {
+	hdr, err := c.tr.Next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read archive `%s`", c.path)
+	}
+	c.next++
+	return hdr, nil
+}
+
+func (c *archiveCursor) Close() error {
+	err := c.r.Close()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//archiveCursors keeps a cursor open on each archive that still has entries to
+//be read. An entry that's behind its archive's cursor reopens the archive.
+type archiveCursors struct {
+	fs        FileSystem
+	open      map[string]*archiveCursor
+	remaining map[string]int
+}
+
+func (c archiveCursors) openEntry(f treeFile) (io.ReadCloser, error) {
+	cursor := c.open[f.archive]
+	if cursor != nil && cursor.next > f.index {
+		cursor.Close()
+		cursor = nil
+	}
+	if cursor == nil {
+		var err error
+		if cursor, err = openArchive(c.fs, f.archive); err != nil {
+			return nil, err
+		}
+		c.open[f.archive] = cursor
+	}
+
+	for cursor.next <= f.index {
+		if _, err := cursor.advance(); err != nil {
+			if err == io.EOF {
+				err = errors.Errorf("archive `%s` ended before entry `%s`", f.archive, f.name)
+			}
+			return nil, err
+		}
+	}
+
+	entry := entryReader{Reader: cursor.tr}
+	c.remaining[f.archive]--
+	if c.remaining[f.archive] <= 0 {
+		delete(c.open, f.archive)
+		entry.archive = cursor
+	}
+
+	d, err := dumper.CompressionFromPath(f.name).NewReader(entry)
+	if err != nil {
+		entry.Close()
+		return nil, errors.Wrapf(err, "failed to decompress `%s`", f.name)
+	}
+	return decompressedReader{d, entry}, nil
+}
+
+func (c archiveCursors) closeAll() {
+	for _, cursor := range c.open {
+		cursor.Close()
+	}
+}
+
+//entryReader reads an archive entry, closing the archive with it if it's the
+//last entry to be read from it
+type entryReader struct {
+	io.Reader
+	archive io.Closer
+}
+
+func (r entryReader) Close() error {
+	if r.archive == nil {
+		return nil
+	}
+	return r.archive.Close()
+}
@@ -0,0 +1,206 @@
+package bulk_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/spf13/afero"
+
+	"github.com/smartatransit/scrapedumper/pkg/bulk"
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func tarball(compress bool, entries ...string) []byte {
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	w := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = tar.NewWriter(gz)
+	}
+	for i := 0; i < len(entries); i += 2 {
+		body := []byte(entries[i+1])
+		Expect(w.WriteHeader(&tar.Header{Name: entries[i], Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := w.Write(body)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(w.Close()).To(Succeed())
+	if gz != nil {
+		Expect(gz.Close()).To(Succeed())
+	}
+	return buf.Bytes()
+}
+
+var _ = Describe("DirectoryDumperAgent.WalkTree", func() {
+	var (
+		fs      afero.Fs
+		opts    bulk.TreeOptions
+		visited []string
+		read    []string
+		callErr error
+	)
+
+	write := func(name string, body []byte) {
+		Expect(afero.WriteFile(fs, name, body, 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		fs = afero.NewMemMapFs()
+		write("/data/train-data/2020-03-01T12:00:00Z.json", []byte(`t0`))
+		write("/data/train-data/date=2020-03-02/2020-03-02T12:00:00Z.json.gz", gzipped(`t2`))
+		write("/data/bus-data/2020-03-01T12:00:05Z.json", []byte(`b0`))
+		write("/data/bus-data/notes.txt", []byte(`notes`))
+		write("/data/archive/2020-03-01.tar", tarball(false,
+			"train-data/2020-03-01T12:00:10Z.json", `t1`,
+			"./bus-data/2020-03-01T13:00:00Z.json.gz", string(gzipped(`b1`)),
+		))
+		write("/data/archive/2020-03-03.tar.gz", tarball(true,
+			"train-data/2020-03-03T12:00:00Z.json", `t3`,
+			"bus-data/2020-03-03T12:00:00Z.json", `b3`,
+		))
+		write("/data/scratch/2020-03-01T00:00:00Z.json", []byte(`scratch`))
+
+		opts = bulk.TreeOptions{
+			Include: []string{"*.json"},
+			Exclude: []string{"scratch"},
+		}
+		visited = nil
+		read = nil
+	})
+
+	JustBeforeEach(func() {
+		agent := bulk.NewDirectoryDumper(fs, &dumperfakes.FakeDumper{})
+		callErr = agent.WalkTree(context.Background(), "/data", opts, func(src bulk.Source) error {
+			visited = append(visited, src.Name+" as "+src.Path)
+			r, err := src.Open(context.Background())
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			b, err := ioutil.ReadAll(r)
+			read = append(read, string(b))
+			return err
+		})
+	})
+
+	It("visits files and archive entries across the whole tree in timestamp order, under their paths relative to it", func() {
+		Expect(callErr).NotTo(HaveOccurred())
+		Expect(visited).To(Equal([]string{
+			"/data/train-data/2020-03-01T12:00:00Z.json as train-data/2020-03-01T12:00:00Z.json",
+			"/data/bus-data/2020-03-01T12:00:05Z.json as bus-data/2020-03-01T12:00:05Z.json",
+			"/data/archive/2020-03-01.tar/train-data/2020-03-01T12:00:10Z.json as train-data/2020-03-01T12:00:10Z.json",
+			"/data/archive/2020-03-01.tar/bus-data/2020-03-01T13:00:00Z.json.gz as bus-data/2020-03-01T13:00:00Z.json",
+			"/data/train-data/date=2020-03-02/2020-03-02T12:00:00Z.json.gz as train-data/date=2020-03-02/2020-03-02T12:00:00Z.json",
+			"/data/archive/2020-03-03.tar.gz/bus-data/2020-03-03T12:00:00Z.json as bus-data/2020-03-03T12:00:00Z.json",
+			"/data/archive/2020-03-03.tar.gz/train-data/2020-03-03T12:00:00Z.json as train-data/2020-03-03T12:00:00Z.json",
+		}))
+		Expect(read).To(Equal([]string{"t0", "b0", "t1", "b1", "t2", "b3", "t3"}))
+	})
+
+	When("patterns name paths", func() {
+		BeforeEach(func() {
+			opts.Include = []string{"train-data/*", "archive/*.tar/train-data/*"}
+			opts.Exclude = []string{"train-data/date=*"}
+		})
+		It("matches them against the path relative to the root", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(read).To(Equal([]string{"t0", "t1"}))
+		})
+	})
+
+	When("starting at a name", func() {
+		BeforeEach(func() {
+			opts.StartAt = "2020-03-02"
+		})
+		It("skips the files and entries before it", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(read).To(Equal([]string{"t2", "b3", "t3"}))
+		})
+	})
+
+	When("an archive's entries aren't in order", func() {
+		BeforeEach(func() {
+			write("/data/archive/2020-03-01.tar", tarball(false,
+				"2020-03-01T12:00:20Z.json", `late`,
+				"2020-03-01T12:00:01Z.json", `early`,
+			))
+		})
+		It("still visits them in order", func() {
+			Expect(callErr).NotTo(HaveOccurred())
+			Expect(read).To(Equal([]string{"t0", "early", "b0", "late", "t2", "b3", "t3"}))
+		})
+	})
+
+	When("an archive is corrupt", func() {
+		BeforeEach(func() {
+			write("/data/archive/2020-03-03.tar.gz", []byte("not gzip"))
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("failed to decompress archive `/data/archive/2020-03-03.tar.gz`")))
+		})
+	})
+
+	When("a pattern is invalid", func() {
+		BeforeEach(func() {
+			opts.Exclude = []string{"["}
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("invalid glob pattern `[`")))
+		})
+	})
+})
+
+var _ = Describe("Loading through a TRANSFORM dumper", func() {
+	var (
+		fs        afero.Fs
+		sink      *dumperfakes.FakeDumper
+		transform dumper.TransformDumper
+		agent     bulk.DirectoryDumperAgent
+		dumped    map[string]string
+	)
+
+	BeforeEach(func() {
+		fs = afero.NewMemMapFs()
+		Expect(afero.WriteFile(fs, "/data/train-data/2020-03-01T12:00:00Z.json", []byte(`[{"TRAIN_ID":"1"}]`), 0644)).To(Succeed())
+		Expect(afero.WriteFile(fs, "/data/train-data/date=2020-03-02/2020-03-02T12:00:00Z.json.gz", gzipped(`[{"TRAIN_ID":"2"}]`), 0644)).To(Succeed())
+
+		var mu sync.Mutex
+		dumped = map[string]string{}
+		sink = &dumperfakes.FakeDumper{}
+		sink.DumpStub = func(_ context.Context, r io.Reader, path string) error {
+			body, err := ioutil.ReadAll(r)
+			mu.Lock()
+			defer mu.Unlock()
+			dumped[path] = string(body)
+			return err
+		}
+		transform = dumper.NewTransformDumper(sink, dumper.NDJSON)
+		agent = bulk.NewDirectoryDumper(fs, transform)
+	})
+
+	It("takes each record's source and time from the file's path", func() {
+		Expect(agent.DumpDirectory(context.Background(), "/data/train-data", "")).To(Succeed())
+		Expect(dumped).To(Equal(map[string]string{
+			"train-data/2020-03-01T12:00:00Z.ndjson":                 `{"scraped_at":"2020-03-01T12:00:00Z","source":"train-data","TRAIN_ID":"1"}` + "\n",
+			"train-data/date=2020-03-02/2020-03-02T12:00:00Z.ndjson": `{"scraped_at":"2020-03-02T12:00:00Z","source":"train-data","TRAIN_ID":"2"}` + "\n",
+		}))
+	})
+
+	It("does the same when loading a tree in parallel", func() {
+		_, err := bulk.NewParallelLoader(transform, bulk.WithPartitioner(bulk.PartitionByField("TRAIN_ID"))).Load(context.Background(), func(fn bulk.WalkFunc) error {
+			return agent.WalkTree(context.Background(), "/data", bulk.TreeOptions{}, fn)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dumped).To(HaveKeyWithValue("train-data/2020-03-01T12:00:00Z.ndjson", `{"scraped_at":"2020-03-01T12:00:00Z","source":"train-data","TRAIN_ID":"1"}`+"\n"))
+		Expect(dumped).To(HaveKeyWithValue("train-data/date=2020-03-02/2020-03-02T12:00:00Z.ndjson", `{"scraped_at":"2020-03-02T12:00:00Z","source":"train-data","TRAIN_ID":"2"}`+"\n"))
+	})
+})
@@ -1,6 +1,8 @@
 package circuitbreaker
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,6 +18,19 @@ const (
 	HalfOpen CircuitState = 2
 )
 
+func (s CircuitState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
 type BooleanRollingWindow struct {
 	Vals []bool
 	size int
@@ -37,6 +52,26 @@ func (r *BooleanRollingWindow) Add(x bool) {
 	r.Vals = append(r.Vals, x)
 }
 
+//Reset empties the window
+func (r *BooleanRollingWindow) Reset() {
+	r.Vals = nil
+}
+
+//Full is whether the window holds as many values as its size
+func (r *BooleanRollingWindow) Full() bool {
+	return len(r.Vals) >= r.size
+}
+
+//Count counts the values in the window that are equal to x
+func (r *BooleanRollingWindow) Count(x bool) (n int) {
+	for _, y := range r.Vals {
+		if x == y {
+			n++
+		}
+	}
+	return
+}
+
 func (r *BooleanRollingWindow) All(x bool) bool {
 	for _, y := range r.Vals {
 		if x != y {
@@ -49,60 +84,143 @@ func (r *BooleanRollingWindow) All(x bool) bool {
 var (
 	//ErrOpenCircuit is an error returned when the circuit is opened
 	ErrOpenCircuit = errors.New("circuit is open")
-	//ErrSystemFailure is returned when a half open state exceeds the error window
+	//ErrSystemFailure is returned when a half open breaker's first attempt fails, which opens it again
 	ErrSystemFailure = errors.New("poor recovery - half open state reverted back to failure")
 )
 
+//Listener is notified whenever a breaker changes state. It's called with the
+//breaker's lock held, so it mustn't call back into the breaker.
+type Listener func(name string, from CircuitState, to CircuitState)
+
+//CircuitBreaker is safe for use by multiple goroutines
 type CircuitBreaker struct {
-	state    CircuitState
-	window   *BooleanRollingWindow
-	openedAt time.Time
-	waitTime time.Duration
-	logger   *zap.Logger
+	mu        sync.Mutex
+	name      string
+	state     CircuitState
+	window    *BooleanRollingWindow
+	openedAt  time.Time
+	waitTime  time.Duration
+	logger    *zap.Logger
+	listeners []Listener
+}
+
+type Option = func(*CircuitBreaker)
+
+//WithName names the breaker in logs and in calls to listeners
+func WithName(name string) Option {
+	return func(c *CircuitBreaker) {
+		c.name = name
+	}
+}
+
+//WithListener adds a listener that's notified of state changes
+func WithListener(l Listener) Option {
+	return func(c *CircuitBreaker) {
+		c.listeners = append(c.listeners, l)
+	}
 }
 
 // New will initialize a new circuit breaker, which will "OPEN" whenever it reaches the window val
 //after being opened, we will wait until the waitTime has expired before going into a "HALFOPEN" state, allowing whatever service we are hitting to recover.
-//if we get enough successful requests at this point to be the window size, we'll go back to an "OPEN" state
-func New(logger *zap.Logger, waitTime time.Duration, window int) *CircuitBreaker {
-	return &CircuitBreaker{
+//if we get enough successful requests at this point to be the window size, we'll go back to a "CLOSED" state, and
+//if any of them fails, we'll go back to an "OPEN" state
+func New(logger *zap.Logger, waitTime time.Duration, window int, opts ...Option) *CircuitBreaker {
+	c := &CircuitBreaker{
 		state:    Closed,
 		window:   NewBooleanWindow(window),
 		waitTime: waitTime,
 		logger:   logger,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+//Name is the name given with WithName
+func (c *CircuitBreaker) Name() string {
+	return c.name
+}
+
+//State is the current state of the breaker
+func (c *CircuitBreaker) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+//Failures is the number of failures in the breaker's rolling window
+func (c *CircuitBreaker) Failures() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.window.Count(true)
+}
+
+//OpenedAt is when the breaker last opened, or the zero time if it never has
+func (c *CircuitBreaker) OpenedAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.openedAt
+}
+
+func (c *CircuitBreaker) setState(state CircuitState) {
+	if state == c.state {
+		return
+	}
+
+	from := c.state
+	c.state = state
+	c.logger.Info("circuit breaker changed state",
+		zap.String("name", c.name),
+		zap.Stringer("from", from),
+		zap.Stringer("to", state),
+	)
+	for _, l := range c.listeners {
+		l(c.name, from, state)
+	}
 }
 
 // Run will run a given function, and record if there is an error.  It will control its state
 //based on values given in the New function
 func (c *CircuitBreaker) Run(cmd func() error) error {
+	c.mu.Lock()
 	if c.state == Open {
 		// If enough time has passed, go to a safety state
 		if c.openedAt.Before(time.Now().Add(-c.waitTime)) {
-			c.state = HalfOpen
+			// start counting afresh, so that the failures that opened the circuit don't count against its recovery
+			c.window.Reset()
+			c.setState(HalfOpen)
 		} else {
+			c.mu.Unlock()
 			return ErrOpenCircuit
 		}
 	}
+	c.mu.Unlock()
 
+	// the lock isn't held while cmd runs, so that several workers can share a breaker
 	err := cmd()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if err != nil {
 		c.window.Add(true)
+		// if we are half open, we haven't recovered, so we are in a system failure state and open the circuit again
+		if c.state == HalfOpen {
+			c.openedAt = time.Now()
+			c.setState(Open)
+			return errors.Wrap(ErrSystemFailure, err.Error())
+		}
 		// if we have exceeded our error threshold, open the circuit
-		if c.window.All(true) {
-			// if we are at half open, we are in a system failure state
-			if c.state == HalfOpen {
-				return errors.Wrap(ErrSystemFailure, err.Error())
-			}
-			c.state = Open
+		if c.window.Full() && c.window.All(true) {
 			c.openedAt = time.Now()
+			c.setState(Open)
 			return ErrOpenCircuit
 		}
 	} else {
 		c.window.Add(false)
-		// if we are half open, we can revert back to closed if everything is good now
-		if c.window.All(false) && c.state == HalfOpen {
-			c.state = Closed
+		// if we are half open, we can revert back to closed once a full window has succeeded
+		if c.state == HalfOpen && c.window.Full() && c.window.All(false) {
+			c.setState(Closed)
 		}
 	}
 
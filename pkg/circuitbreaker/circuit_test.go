@@ -50,6 +50,11 @@ var _ = Describe("Circuit", func() {
 				It("returns an open circuit error", func() {
 					Expect(err).To(MatchError(ErrOpenCircuit))
 				})
+				It("reports that it's open", func() {
+					Expect(cb.State()).To(Equal(Open))
+					Expect(cb.Failures()).To(Equal(window))
+					Expect(cb.OpenedAt()).To(BeTemporally("~", time.Now(), time.Second))
+				})
 				When("we then recover", func() {
 					JustBeforeEach(func() {
 						for i := 0; i < window; i++ {
@@ -61,9 +66,92 @@ var _ = Describe("Circuit", func() {
 						Expect(err).To(BeNil())
 					})
 				})
+				When("we then fail again", func() {
+					JustBeforeEach(func() {
+						Expect(cb.Run(func() error { return nil })).To(BeNil())
+						Expect(cb.State()).To(Equal(HalfOpen))
+						err = cb.Run(func() error { return errors.New("still down") })
+					})
+					It("opens the circuit again", func() {
+						Expect(errors.Cause(err)).To(MatchError(ErrSystemFailure))
+						Expect(cb.State()).To(Equal(Open))
+						Expect(cb.OpenedAt()).To(BeTemporally("~", time.Now(), time.Second))
+					})
+				})
+			})
+			When("we are half open", func() {
+				BeforeEach(func() {
+					for i := 0; i < window; i++ {
+						_ = cb.Run(func() error { return errors.New("") })
+					}
+					Expect(cb.State()).To(Equal(Open))
+				})
+				It("closes only after a full window of successes", func() {
+					for i := 0; i < window-1; i++ {
+						Expect(cb.Run(func() error { return nil })).To(BeNil())
+						Expect(cb.State()).To(Equal(HalfOpen))
+					}
+					Expect(cb.Failures()).To(BeZero())
+					Expect(cb.Run(func() error { return nil })).To(BeNil())
+					Expect(cb.State()).To(Equal(Closed))
+				})
 			})
 		})
 	})
+	Context("Listeners", func() {
+		var (
+			cb          *CircuitBreaker
+			transitions []string
+		)
+		BeforeEach(func() {
+			transitions = nil
+			cb = New(zap.NewNop(), 0, 2,
+				WithName("trains"),
+				WithListener(func(name string, from, to CircuitState) {
+					transitions = append(transitions, name+": "+from.String()+" -> "+to.String())
+				}),
+			)
+		})
+		It("notifies them of each state change", func() {
+			Expect(cb.Name()).To(Equal("trains"))
+			Expect(cb.State()).To(Equal(Closed))
+
+			for i := 0; i < 2; i++ {
+				_ = cb.Run(func() error { return errors.New("") })
+			}
+			for i := 0; i < 2; i++ {
+				Expect(cb.Run(func() error { return nil })).To(BeNil())
+			}
+
+			Expect(transitions).To(Equal([]string{
+				"trains: closed -> open",
+				"trains: open -> half-open",
+				"trains: half-open -> closed",
+			}))
+			Expect(cb.State()).To(Equal(Closed))
+			Expect(cb.Failures()).To(BeZero())
+		})
+		It("is safe to share between goroutines", func() {
+			done := make(chan struct{})
+			for i := 0; i < 8; i++ {
+				go func(i int) {
+					defer func() { done <- struct{}{} }()
+					for j := 0; j < 100; j++ {
+						_ = cb.Run(func() error {
+							if (i+j)%2 == 0 {
+								return errors.New("")
+							}
+							return nil
+						})
+						_ = cb.State()
+					}
+				}(i)
+			}
+			for i := 0; i < 8; i++ {
+				<-done
+			}
+		})
+	})
 	Context("BooleanRollingWindow", func() {
 		var (
 			bw   *BooleanRollingWindow
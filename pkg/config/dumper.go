@@ -1,7 +1,9 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
 	"go.uber.org/zap"
@@ -16,9 +18,12 @@ import (
 	"github.com/spf13/afero"
 
 	"github.com/smartatransit/scrapedumper/pkg/alias"
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
 	"github.com/smartatransit/scrapedumper/pkg/dumper"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
 	"github.com/smartatransit/scrapedumper/pkg/postgres"
+	"github.com/smartatransit/scrapedumper/pkg/worker"
 
 	//database/sql driver
 	_ "github.com/lib/pq"
@@ -38,12 +43,59 @@ const (
 	DynamoDBDumperKind DumperKind = "DYNAMODB"
 	//PostgresDumperKind creates a dumper that writes to a postgres table
 	PostgresDumperKind DumperKind = "POSTGRES"
+	//BusPostgresDumperKind creates a dumper that writes bus positions to postgres tables
+	BusPostgresDumperKind DumperKind = "POSTGRES_BUS"
+	//TransformKind creates a dumper that converts scrapes into another format
+	//before passing them to its own dumper
+	TransformKind DumperKind = "TRANSFORM"
+	//DedupeKind creates a dumper that passes scrapes to its own dumper unless
+	//they're identical to the last one from the same source
+	DedupeKind DumperKind = "DEDUPE"
+	//SpoolKind creates a dumper that spools the scrapes its own dumper fails to
+	//dump in a local directory, and replays them in the background
+	SpoolKind DumperKind = "SPOOL"
+)
+
+const (
+	//DefaultSpoolReplayInterval is used for spools that don't set a replay interval
+	DefaultSpoolReplayInterval = 30 * time.Second
+	//DefaultSpoolMaxBackoff is used for spools that don't set a maximum backoff
+	DefaultSpoolMaxBackoff = 10 * time.Minute
 )
 
 //DumpConfig specifies configuration for one dumper
 type DumpConfig struct {
 	Kind DumperKind `json:"kind"`
 
+	//Name identifies a component of a ROUND_ROBIN dumper in errors and logs, and
+	//TimeoutSeconds bounds each of its dumps
+	Name           string `json:"name"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	//FailurePolicy decides whether a ROUND_ROBIN dumper fails when ANY, a QUORUM,
+	//or ALL of its components fail. It defaults to ANY.
+	FailurePolicy dumper.FailurePolicy `json:"failure_policy"`
+	//CircuitBreaker gives this dumper its own circuit breaker. Components of
+	//a ROUND_ROBIN dumper get one with the default thresholds if it's omitted.
+	CircuitBreaker *BreakerConfig `json:"circuit_breaker"`
+	//Compression compresses each scrape written by a FILE or S3 dumper, with
+	//`gzip` or `zstd`
+	Compression dumper.Compression `json:"compression"`
+
+	//Dumper is the dumper that a TRANSFORM, DEDUPE or SPOOL dumper passes its
+	//output to, and Format is the format a TRANSFORM dumper converts to: NDJSON or CSV
+	Dumper *DumpConfig   `json:"dumper"`
+	Format dumper.Format `json:"format"`
+	//NormalizeJSON makes a DEDUPE dumper ignore field order and whitespace, and
+	//DedupeStatePath keeps its last hashes in a file so they survive restarts
+	NormalizeJSON   bool   `json:"normalize_json"`
+	DedupeStatePath string `json:"dedupe_state_path"`
+	//SpoolDirectory is where a SPOOL dumper keeps failed dumps. They're replayed
+	//every SpoolReplayIntervalSeconds, backing off to SpoolMaxBackoffSeconds
+	//while replays keep failing.
+	SpoolDirectory             string `json:"spool_directory"`
+	SpoolReplayIntervalSeconds int    `json:"spool_replay_interval_seconds"`
+	SpoolMaxBackoffSeconds     int    `json:"spool_max_backoff_seconds"`
+
 	Components               []DumpConfig `json:"components"`
 	LocalOutputLocation      string       `json:"local_output_location"`
 	S3BucketName             string       `json:"s3_bucket_name"`
@@ -78,37 +130,228 @@ func NewRoundRobinCleanup(comps []CleanupFunc) CleanupFunc {
 	}
 }
 
+//Option configures how dumpers and work lists are built
+type Option func(*options)
+
+type options struct {
+	metrics    *metrics.Metrics
+	sinkChecks *[]worker.SinkCheck
+}
+
+//WithMetrics instruments the dumpers, sources, circuit breakers and postgres
+//upserters that are built
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+func buildOptions(opts []Option) (o options) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+//collectSinkChecks collects a check for each sink that can be checked, so
+//that a work item can report whether its sinks are usable
+func collectSinkChecks(checks *[]worker.SinkCheck) Option {
+	return func(o *options) {
+		o.sinkChecks = checks
+	}
+}
+
+func (o options) addSinkCheck(name string, check func(ctx context.Context) error) {
+	if o.sinkChecks == nil {
+		return
+	}
+	*o.sinkChecks = append(*o.sinkChecks, worker.SinkCheck{Name: name, Check: check})
+}
+
+//startSpoolReplayer replays the spool in the background until cleanup, which
+//waits for the replayer to stop before cleaning up the dumper it replays to
+func startSpoolReplayer(r dumper.SpoolReplayer, cleanup CleanupFunc) CleanupFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	return func() error {
+		cancel()
+		<-done
+		return cleanup()
+	}
+}
+
+//dumperName names a dumper in logs, metrics and health checks
+func dumperName(c DumpConfig) string {
+	if c.Name == "" {
+		return string(c.Kind)
+	}
+	return c.Name
+}
+
+//buildBreaker builds a breaker that reports its state to the metrics, if any
+func (o options) buildBreaker(log *zap.Logger, c *BreakerConfig, name string) *circuitbreaker.CircuitBreaker {
+	if o.metrics == nil {
+		return c.Build(log, name)
+	}
+	cb := c.Build(log, name, circuitbreaker.WithListener(o.metrics.BreakerListener()))
+	o.metrics.TrackBreaker(cb)
+	return cb
+}
+
 //BuildDumper builds the dumper described by the given config option.
 //If no SQL-based dumpers are to be used, then `sqlOpen` is not required.
 func BuildDumper(
 	log *zap.Logger,
 	sqlOpen SQLOpener,
 	c DumpConfig,
+	opts ...Option,
+) (dumper.Dumper, CleanupFunc, error) {
+	o := buildOptions(opts)
+	d, cleanup, err := buildDumper(log, sqlOpen, c, opts)
+	if err != nil {
+		return d, cleanup, err
+	}
+	if o.metrics != nil {
+		d = dumper.NewInstrumentedDumper(d, string(c.Kind), o.metrics)
+	}
+	if c.CircuitBreaker == nil {
+		return d, cleanup, nil
+	}
+
+	cb := o.buildBreaker(log, c.CircuitBreaker, dumperName(c))
+	o.addSinkCheck(dumperName(c)+" circuit breaker", func(context.Context) error {
+		if cb.State() == circuitbreaker.Open {
+			return circuitbreaker.ErrOpenCircuit
+		}
+		return nil
+	})
+	return dumper.NewCircuitBreakerDumper(d, cb), cleanup, nil
+}
+
+func buildDumper(
+	log *zap.Logger,
+	sqlOpen SQLOpener,
+	c DumpConfig,
+	opts []Option,
 ) (dumper.Dumper, CleanupFunc, error) {
+	o := buildOptions(opts)
+	if c.Compression != dumper.NoCompression {
+		if c.Kind != FileDumperKind && c.Kind != S3DumperKind {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested with compression, which only %s and %s dumpers support", c.Kind, FileDumperKind, S3DumperKind)
+		}
+		if !c.Compression.Valid() {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested with unsupported compression `%s`: use %s or %s", c.Kind, c.Compression, dumper.Gzip, dumper.Zstd)
+		}
+	}
+
 	switch c.Kind {
 	case RoundRobinKind:
-		componentDumpers := make([]dumper.Dumper, len(c.Components))
+		components := make([]dumper.Component, len(c.Components))
 		componentCleanups := make([]CleanupFunc, len(c.Components))
 		if len(c.Components) == 0 {
 			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no components provided: provide components using the config file, a command-line argument, or an environment variable", RoundRobinKind)
 		}
 
-		for i := range c.Components {
+		policy := c.FailurePolicy
+		switch policy {
+		case "":
+			policy = dumper.FailOnAny
+		case dumper.FailOnAny, dumper.FailOnQuorum, dumper.FailOnAll:
+		default:
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested with unsupported failure policy `%s`: use %s, %s or %s", RoundRobinKind, policy, dumper.FailOnAny, dumper.FailOnQuorum, dumper.FailOnAll)
+		}
+
+		for i, comp := range c.Components {
+			if comp.Name == "" {
+				comp.Name = fmt.Sprintf("%s[%d]", comp.Kind, i)
+			}
+			//each sink gets its own breaker, so that one broken sink doesn't trip the others'
+			if comp.CircuitBreaker == nil && comp.Kind != RoundRobinKind {
+				comp.CircuitBreaker = &BreakerConfig{}
+			}
+
 			var err error
-			componentDumpers[i], componentCleanups[i], err = BuildDumper(log, sqlOpen, c.Components[i])
+			components[i].Dumper, componentCleanups[i], err = BuildDumper(log, sqlOpen, comp, opts...)
 			if err != nil {
+				//don't leak the connections of the components we already built
+				_ = NewRoundRobinCleanup(componentCleanups[:i])()
 				return nil, nil, err
 			}
+
+			components[i].Name = comp.Name
+			components[i].Timeout = time.Duration(comp.TimeoutSeconds) * time.Second
 		}
 
-		return dumper.NewRoundRobinDumpClient(log, componentDumpers...),
+		return dumper.NewRoundRobinDumpClientWithPolicy(log, policy, components...),
 			NewRoundRobinCleanup(componentCleanups), nil
+	case TransformKind:
+		if !c.Format.Valid() {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested with unsupported format `%s`: use %s or %s", TransformKind, c.Format, dumper.NDJSON, dumper.CSV)
+		}
+		if c.Dumper == nil {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no dumper provided", TransformKind)
+		}
+
+		d, cleanup, err := BuildDumper(log, sqlOpen, *c.Dumper, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dumper.NewTransformDumper(d, c.Format), cleanup, nil
+	case DedupeKind:
+		if c.Dumper == nil {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no dumper provided", DedupeKind)
+		}
+
+		d, cleanup, err := BuildDumper(log, sqlOpen, *c.Dumper, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var store dumper.HashStore = dumper.NewMemoryHashStore()
+		if c.DedupeStatePath != "" {
+			store = dumper.SharedFileHashStore(afero.NewOsFs(), c.DedupeStatePath)
+		}
+		return dumper.NewDedupeDumper(log, d, store, c.NormalizeJSON, o.metrics), cleanup, nil
+	case SpoolKind:
+		if c.Dumper == nil {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no dumper provided", SpoolKind)
+		}
+		if c.SpoolDirectory == "" {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no spool directory provided", SpoolKind)
+		}
+
+		d, cleanup, err := BuildDumper(log, sqlOpen, *c.Dumper, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		interval := DefaultSpoolReplayInterval
+		if c.SpoolReplayIntervalSeconds > 0 {
+			interval = time.Duration(c.SpoolReplayIntervalSeconds) * time.Second
+		}
+		maxBackoff := DefaultSpoolMaxBackoff
+		if c.SpoolMaxBackoffSeconds > 0 {
+			maxBackoff = time.Duration(c.SpoolMaxBackoffSeconds) * time.Second
+		}
+
+		if log == nil {
+			log = zap.NewNop()
+		}
+		spool := dumper.NewSpool(afero.NewOsFs(), c.SpoolDirectory)
+		return dumper.NewSpoolDumper(log, d, spool),
+			startSpoolReplayer(dumper.NewSpoolReplayer(log, spool, d, interval, maxBackoff), cleanup),
+			nil
 	case FileDumperKind:
 		if c.LocalOutputLocation == "" {
 			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no file output location provided: provide a local output location using the config file, a command-line argument, or an environment variable", FileDumperKind)
 		}
 
-		return dumper.NewLocalDumpHandler(c.LocalOutputLocation, log, afero.NewOsFs()), NoopCleanup, nil
+		return dumper.NewLocalDumpHandler(c.LocalOutputLocation, log, afero.NewOsFs(), dumper.WithCompression(c.Compression)), NoopCleanup, nil
 	case DynamoDBDumperKind:
 		if c.DynamoTableName == "" {
 			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no dynamo table name provided: provide a dynamo table name using the config file, a command-line argument, or an environment variable", DynamoDBDumperKind)
@@ -124,7 +367,7 @@ func BuildDumper(
 
 		s3Manager := s3manager.NewUploaderWithClient(s3.New(session.Must(session.NewSession())))
 
-		return dumper.NewS3DumpHandler(s3Manager, c.S3BucketName, log), NoopCleanup, nil
+		return dumper.NewS3DumpHandler(s3Manager, c.S3BucketName, log, dumper.WithCompression(c.Compression)), NoopCleanup, nil
 	case PostgresDumperKind:
 		if c.PostgresConnectionString == "" {
 			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no postgres connection string provided: provide a postgres connection string using the config file, a command-line argument, or an environment variable", PostgresDumperKind)
@@ -157,8 +400,25 @@ func BuildDumper(
 			aliaser = alias.New(gormDB)
 		}
 
-		upserter := postgres.NewUpserter(repo, time.Hour, c.ThirdRailContext)
+		o.addSinkCheck(dumperName(c), db.PingContext)
+		upserter := postgres.NewUpserter(repo, time.Hour, c.ThirdRailContext, postgres.WithMetrics(o.metrics))
 		return dumper.NewPostgresDumpHandler(log, upserter, aliaser), db.Close, nil
+	case BusPostgresDumperKind:
+		if c.PostgresConnectionString == "" {
+			return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "dumper kind %s requested but no postgres connection string provided: provide a postgres connection string using the config file, a command-line argument, or an environment variable", BusPostgresDumperKind)
+		}
+		db, err := sqlOpen("postgres", c.PostgresConnectionString)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed connecting to postgres database")
+		}
+		repo := postgres.NewRepository(log, db)
+		err = repo.EnsureTables(c.ThirdRailContext)
+		if err != nil {
+			db.Close()
+			return nil, nil, errors.Wrap(err, "failed to ensure postgres bus tables")
+		}
+		o.addSinkCheck(dumperName(c), db.PingContext)
+		return dumper.NewBusPostgresDumpHandler(log, repo), db.Close, nil
 	default:
 		return nil, nil, errors.Wrapf(ErrDumperValidationFailed, "unsupported dumper kind `%s`", string(c.Kind))
 	}
@@ -2,23 +2,45 @@ package config_test
 
 import (
 	"database/sql"
+	"io/ioutil"
+	"os"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/smartatransit/scrapedumper/pkg/config"
 	"github.com/smartatransit/scrapedumper/pkg/config/configfakes"
 	"github.com/smartatransit/scrapedumper/pkg/dumper"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
 	"github.com/pkg/errors"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+//expectMigrations expects every migration to be applied to a new database
+//once the migration lock is taken
+func expectMigrations(smock sqlmock.Sqlmock) {
+	smock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	smock.ExpectQuery(`SELECT version, applied_at, third_rail FROM schema_migrations`).WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at", "third_rail"}))
+	for _, migration := range postgres.Migrations {
+		smock.ExpectBegin()
+		for range migration.Up(false) {
+			smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		smock.ExpectExec(`INSERT INTO schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 1))
+		smock.ExpectCommit()
+	}
+	smock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
 var _ = Describe("BuildDumper", func() {
 	var (
 		cfg     config.DumpConfig
 		sqlOpen *configfakes.FakeSQLOpener
 
 		result  dumper.Dumper
+		cleanup config.CleanupFunc
 		callErr error
 	)
 
@@ -27,7 +49,7 @@ var _ = Describe("BuildDumper", func() {
 	})
 
 	JustBeforeEach(func() {
-		result, _, callErr = config.BuildDumper(nil, sqlOpen.Spy, cfg)
+		result, cleanup, callErr = config.BuildDumper(nil, sqlOpen.Spy, cfg)
 	})
 
 	When("the Kind is RoundRobinKind", func() {
@@ -58,6 +80,26 @@ var _ = Describe("BuildDumper", func() {
 			})
 		})
 
+		When("a supported failure policy is specified", func() {
+			BeforeEach(func() {
+				cfg.FailurePolicy = dumper.FailOnQuorum
+				cfg.Components[0].Name = "archive"
+				cfg.Components[0].TimeoutSeconds = 30
+			})
+			It("succeeds", func() {
+				Expect(callErr).To(BeNil())
+			})
+		})
+
+		When("an unsupported failure policy is specified", func() {
+			BeforeEach(func() {
+				cfg.FailurePolicy = "MOST"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind ROUND_ROBIN requested with unsupported failure policy `MOST`")))
+			})
+		})
+
 		When("one of the dumpers can't be build", func() {
 			BeforeEach(func() {
 				cfg.Components[0].S3BucketName = ""
@@ -68,6 +110,171 @@ var _ = Describe("BuildDumper", func() {
 		})
 	})
 
+	When("a circuit breaker is configured", func() {
+		BeforeEach(func() {
+			cfg = config.DumpConfig{
+				Kind:                config.FileDumperKind,
+				Name:                "local",
+				LocalOutputLocation: "/my/dir",
+				CircuitBreaker:      &config.BreakerConfig{Window: 3},
+			}
+		})
+
+		It("guards the dumper with its own breaker", func() {
+			Expect(callErr).To(BeNil())
+			cbd, ok := result.(dumper.CircuitBreakerDumper)
+			Expect(ok).To(BeTrue())
+			Expect(cbd.Breaker().Name()).To(Equal("local"))
+		})
+	})
+
+	When("metrics are enabled", func() {
+		BeforeEach(func() {
+			cfg = config.DumpConfig{
+				Kind:                config.FileDumperKind,
+				LocalOutputLocation: "/my/dir",
+			}
+		})
+
+		It("instruments the dumper", func() {
+			result, _, callErr = config.BuildDumper(nil, sqlOpen.Spy, cfg, config.WithMetrics(metrics.New(prometheus.NewRegistry())))
+			Expect(callErr).To(BeNil())
+			_, ok := result.(dumper.InstrumentedDumper)
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	When("the Kind is TransformKind", func() {
+		BeforeEach(func() {
+			cfg = config.DumpConfig{
+				Kind:   config.TransformKind,
+				Format: dumper.NDJSON,
+				Dumper: &config.DumpConfig{
+					Kind:         config.S3DumperKind,
+					S3BucketName: "my-bucket",
+					Compression:  dumper.Gzip,
+				},
+			}
+		})
+
+		It("produces a TransformDumper", func() {
+			Expect(callErr).To(BeNil())
+			_, ok := result.(dumper.TransformDumper)
+			Expect(ok).To(BeTrue())
+		})
+
+		When("the format is unsupported", func() {
+			BeforeEach(func() {
+				cfg.Format = "PARQUET"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind TRANSFORM requested with unsupported format `PARQUET`: use NDJSON or CSV")))
+			})
+		})
+
+		When("no dumper is provided", func() {
+			BeforeEach(func() {
+				cfg.Dumper = nil
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind TRANSFORM requested but no dumper provided")))
+			})
+		})
+
+		When("its dumper can't be built", func() {
+			BeforeEach(func() {
+				cfg.Dumper.S3BucketName = ""
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind S3 requested but no s3 bucket name provided")))
+			})
+		})
+	})
+
+	When("the Kind is DedupeKind", func() {
+		BeforeEach(func() {
+			cfg = config.DumpConfig{
+				Kind:          config.DedupeKind,
+				NormalizeJSON: true,
+				Dumper: &config.DumpConfig{
+					Kind:         config.S3DumperKind,
+					S3BucketName: "my-bucket",
+				},
+			}
+		})
+
+		It("produces a DedupeDumper", func() {
+			Expect(callErr).To(BeNil())
+			_, ok := result.(dumper.DedupeDumper)
+			Expect(ok).To(BeTrue())
+		})
+
+		When("no dumper is provided", func() {
+			BeforeEach(func() {
+				cfg.Dumper = nil
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind DEDUPE requested but no dumper provided")))
+			})
+		})
+
+		When("its dumper can't be built", func() {
+			BeforeEach(func() {
+				cfg.Dumper.S3BucketName = ""
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind S3 requested but no s3 bucket name provided")))
+			})
+		})
+	})
+
+	When("the Kind is SpoolKind", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "spool")
+			Expect(err).NotTo(HaveOccurred())
+
+			cfg = config.DumpConfig{
+				Kind:           config.SpoolKind,
+				SpoolDirectory: dir,
+				Dumper: &config.DumpConfig{
+					Kind:         config.S3DumperKind,
+					S3BucketName: "my-bucket",
+				},
+			}
+		})
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("produces a SpoolDumper whose replayer stops on cleanup", func() {
+			Expect(callErr).To(BeNil())
+			_, ok := result.(dumper.SpoolDumper)
+			Expect(ok).To(BeTrue())
+			Expect(cleanup()).To(Succeed())
+		})
+
+		When("no dumper is provided", func() {
+			BeforeEach(func() {
+				cfg.Dumper = nil
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind SPOOL requested but no dumper provided")))
+			})
+		})
+
+		When("no spool directory is provided", func() {
+			BeforeEach(func() {
+				cfg.SpoolDirectory = ""
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind SPOOL requested but no spool directory provided")))
+			})
+		})
+	})
+
 	When("the Kind is FileDumperKind", func() {
 		BeforeEach(func() {
 			cfg = config.DumpConfig{
@@ -91,6 +298,38 @@ var _ = Describe("BuildDumper", func() {
 			})
 		})
 	})
+	When("compression is requested", func() {
+		BeforeEach(func() {
+			cfg = config.DumpConfig{
+				Kind:                config.FileDumperKind,
+				LocalOutputLocation: "/my/dir",
+				Compression:         dumper.Zstd,
+			}
+		})
+
+		It("succeeds", func() {
+			Expect(callErr).To(BeNil())
+		})
+
+		When("the compression is unsupported", func() {
+			BeforeEach(func() {
+				cfg.Compression = "lz4"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind FILE requested with unsupported compression `lz4`: use gzip or zstd")))
+			})
+		})
+
+		When("the kind doesn't write files", func() {
+			BeforeEach(func() {
+				cfg.Kind = config.DynamoDBDumperKind
+				cfg.DynamoTableName = "my-table"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind DYNAMODB requested with compression, which only FILE and S3 dumpers support")))
+			})
+		})
+	})
 	When("the Kind is S3DumperKind", func() {
 		BeforeEach(func() {
 			cfg = config.DumpConfig{
@@ -175,9 +414,9 @@ var _ = Describe("BuildDumper", func() {
 		})
 
 		When("EnsureTables is executed", func() {
-			var exec *sqlmock.ExpectedExec
+			var lock *sqlmock.ExpectedExec
 			BeforeEach(func() {
-				exec = smock.ExpectExec(".*")
+				lock = smock.ExpectExec(`SELECT pg_advisory_lock`)
 			})
 			AfterEach(func() {
 				Expect(smock.ExpectationsWereMet()).To(BeNil())
@@ -185,7 +424,7 @@ var _ = Describe("BuildDumper", func() {
 
 			When("the EnsureTables call fails", func() {
 				BeforeEach(func() {
-					exec.WillReturnError(errors.New("CREATE TABLE failed"))
+					lock.WillReturnError(errors.New("lock failed"))
 				})
 				It("fails", func() {
 					Expect(callErr).To(MatchError(ContainSubstring("failed to ensure postgres tables")))
@@ -194,16 +433,8 @@ var _ = Describe("BuildDumper", func() {
 
 			When("all goes well", func() {
 				BeforeEach(func() {
-					exec.WillReturnResult(sqlmock.NewResult(0, 0))
-
-					//we're also expecting a second query, to create the index
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
-					smock.ExpectExec(".*").WillReturnResult(sqlmock.NewResult(0, 0))
+					lock.WillReturnResult(sqlmock.NewResult(0, 0))
+					expectMigrations(smock)
 				})
 				It("produces a PostgresDumpHandler", func() {
 					Expect(callErr).To(BeNil())
@@ -213,6 +444,60 @@ var _ = Describe("BuildDumper", func() {
 			})
 		})
 	})
+	When("the Kind is BusPostgresDumperKind", func() {
+		var (
+			db    *sql.DB
+			smock sqlmock.Sqlmock
+		)
+		BeforeEach(func() {
+			cfg = config.DumpConfig{
+				Kind:                     config.BusPostgresDumperKind,
+				PostgresConnectionString: "postgres://host/db?option=value",
+			}
+
+			var err error
+			db, smock, err = sqlmock.New()
+			Expect(err).To(BeNil())
+			sqlOpen.Returns(db, nil)
+		})
+		When("the required configs are missing", func() {
+			BeforeEach(func() {
+				cfg.PostgresConnectionString = ""
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("dumper kind POSTGRES_BUS requested but no postgres connection string provided")))
+			})
+		})
+		When("the database connection can't be opened", func() {
+			BeforeEach(func() {
+				sqlOpen.Returns(nil, errors.New("open failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed connecting to postgres database")))
+			})
+		})
+		When("the EnsureTables call fails", func() {
+			BeforeEach(func() {
+				smock.ExpectExec(`SELECT pg_advisory_lock`).WillReturnError(errors.New("lock failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to ensure postgres bus tables")))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				smock.ExpectExec(`SELECT pg_advisory_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectMigrations(smock)
+			})
+			It("produces a BusPostgresDumpHandler", func() {
+				Expect(callErr).To(BeNil())
+				_, ok := result.(dumper.BusPostgresDumpHandler)
+				Expect(ok).To(BeTrue())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+	})
+
 	When("the Kind is not recognized", func() {
 		BeforeEach(func() {
 			cfg.Kind = ""
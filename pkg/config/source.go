@@ -0,0 +1,108 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+	"github.com/smartatransit/scrapedumper/pkg/scraper"
+)
+
+//SourceKind is an enum type used to specify which type of source is being configured
+type SourceKind string
+
+const (
+	//HTTPSourceKind creates a source that requests an arbitrary HTTP endpoint
+	HTTPSourceKind SourceKind = "HTTP"
+)
+
+//SourceConfig specifies configuration for one source, and the dumper that its scrapes go to
+type SourceConfig struct {
+	Kind SourceKind `json:"kind"`
+
+	URL          string               `json:"url"`
+	Method       string               `json:"method"`
+	Headers      map[string]string    `json:"headers"`
+	Query        map[string]string    `json:"query"`
+	SecretQuery  map[string]SecretRef `json:"secret_query"`
+	OutputPrefix string               `json:"output_prefix"`
+
+	Dumper *DumpConfig `json:"dumper"`
+
+	//WorkItemConfig schedules this source, e.g. `"poll_time_in_seconds": 60`
+	WorkItemConfig
+}
+
+//SecretRef refers to a secret kept outside of the config file, either in an
+//environment variable or in a file
+type SecretRef struct {
+	Env  string `json:"env"`
+	File string `json:"file"`
+}
+
+//ErrSourceValidationFailed indicates that a source's configuration was invalid
+var ErrSourceValidationFailed = errors.New("source failed to build due to missing args")
+
+//Resolve looks up the secret value
+func (s SecretRef) Resolve() (string, error) {
+	switch {
+	case s.Env != "":
+		val, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", errors.Errorf("environment variable `%s` is not set", s.Env)
+		}
+		return val, nil
+	case s.File != "":
+		bs, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed reading secret file `%s`", s.File)
+		}
+		return strings.TrimSpace(string(bs)), nil
+	default:
+		return "", errors.New("secret reference has neither `env` nor `file`")
+	}
+}
+
+//BuildScraper builds the scraper described by the given config option
+func BuildScraper(
+	log *zap.Logger,
+	doer scraper.Doer,
+	policy retry.Policy,
+	c SourceConfig,
+) (scraper.Scraper, error) {
+	switch c.Kind {
+	case HTTPSourceKind:
+		if c.URL == "" {
+			return nil, errors.Wrapf(ErrSourceValidationFailed, "source kind %s requested but no url provided", HTTPSourceKind)
+		}
+		if c.OutputPrefix == "" {
+			return nil, errors.Wrapf(ErrSourceValidationFailed, "source kind %s requested but no output prefix provided", HTTPSourceKind)
+		}
+
+		opts := []scraper.HTTPOption{scraper.WithRetryPolicy(policy)}
+		if c.Method != "" {
+			opts = append(opts, scraper.WithMethod(c.Method))
+		}
+		for k, v := range c.Headers {
+			opts = append(opts, scraper.WithHeader(k, v))
+		}
+		for k, v := range c.Query {
+			opts = append(opts, scraper.WithQueryParam(k, v))
+		}
+		for k, ref := range c.SecretQuery {
+			v, err := ref.Resolve()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to resolve secret query parameter `%s`", k)
+			}
+			opts = append(opts, scraper.WithQueryParam(k, v))
+		}
+
+		return scraper.NewHTTPScraper(doer, log, c.URL, c.OutputPrefix, opts...), nil
+	default:
+		return nil, errors.Wrapf(ErrSourceValidationFailed, "unsupported source kind `%s`", string(c.Kind))
+	}
+}
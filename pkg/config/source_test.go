@@ -0,0 +1,110 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/smartatransit/scrapedumper/pkg/config"
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+	"github.com/smartatransit/scrapedumper/pkg/scraper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildScraper", func() {
+	var (
+		cfg     config.SourceConfig
+		result  scraper.Scraper
+		callErr error
+	)
+	BeforeEach(func() {
+		cfg = config.SourceConfig{
+			Kind:         config.HTTPSourceKind,
+			URL:          "https://example.com/feed.json",
+			Method:       "POST",
+			Headers:      map[string]string{"Accept": "application/json"},
+			Query:        map[string]string{"format": "json"},
+			OutputPrefix: "alerts",
+		}
+	})
+	JustBeforeEach(func() {
+		result, callErr = config.BuildScraper(nil, http.DefaultClient, retry.DefaultPolicy, cfg)
+	})
+
+	It("produces an HTTPScraper", func() {
+		Expect(callErr).To(BeNil())
+		s, ok := result.(scraper.HTTPScraper)
+		Expect(ok).To(BeTrue())
+		Expect(s.Method).To(Equal("POST"))
+		Expect(s.Headers).To(Equal(map[string]string{"Accept": "application/json"}))
+		Expect(s.Query).To(Equal(map[string]string{"format": "json"}))
+		Expect(s.RetryPolicy).To(Equal(retry.DefaultPolicy))
+		Expect(s.Prefix()).To(Equal("alerts"))
+	})
+	When("the url is missing", func() {
+		BeforeEach(func() {
+			cfg.URL = ""
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("source kind HTTP requested but no url provided")))
+		})
+	})
+	When("the output prefix is missing", func() {
+		BeforeEach(func() {
+			cfg.OutputPrefix = ""
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("source kind HTTP requested but no output prefix provided")))
+		})
+	})
+	When("a secret query parameter is configured", func() {
+		BeforeEach(func() {
+			os.Setenv("SCRAPEDUMPER_TEST_API_KEY", "hunter2")
+			cfg.SecretQuery = map[string]config.SecretRef{"apiKey": {Env: "SCRAPEDUMPER_TEST_API_KEY"}}
+		})
+		AfterEach(func() {
+			os.Unsetenv("SCRAPEDUMPER_TEST_API_KEY")
+		})
+		It("resolves it into the query", func() {
+			Expect(callErr).To(BeNil())
+			Expect(result.(scraper.HTTPScraper).Query).To(HaveKeyWithValue("apiKey", "hunter2"))
+		})
+		When("the secret can't be resolved", func() {
+			BeforeEach(func() {
+				cfg.SecretQuery = map[string]config.SecretRef{"apiKey": {Env: "SCRAPEDUMPER_TEST_MISSING"}}
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to resolve secret query parameter `apiKey`: environment variable `SCRAPEDUMPER_TEST_MISSING` is not set"))
+			})
+		})
+	})
+	When("the kind is not recognized", func() {
+		BeforeEach(func() {
+			cfg.Kind = "FTP"
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("unsupported source kind `FTP`")))
+		})
+	})
+})
+
+var _ = Describe("SecretRef", func() {
+	It("reads secrets from files", func() {
+		f, err := ioutil.TempFile("", "secret")
+		Expect(err).To(BeNil())
+		defer os.Remove(f.Name())
+		_, err = f.WriteString("hunter2\n")
+		Expect(err).To(BeNil())
+		Expect(f.Close()).To(Succeed())
+
+		val, err := config.SecretRef{File: f.Name()}.Resolve()
+		Expect(err).To(BeNil())
+		Expect(val).To(Equal("hunter2"))
+	})
+	It("requires a location", func() {
+		_, err := config.SecretRef{}.Resolve()
+		Expect(err).To(MatchError("secret reference has neither `env` nor `file`"))
+	})
+})
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
 	"github.com/smartatransit/scrapedumper/pkg/dumper"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/pathtemplate"
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+	"github.com/smartatransit/scrapedumper/pkg/scraper"
 	"github.com/smartatransit/scrapedumper/pkg/worker"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -13,39 +19,212 @@ import (
 type WorkConfig struct {
 	BusDumper   *DumpConfig `json:"bus_dumper"`
 	TrainDumper *DumpConfig `json:"train_dumper"`
+
+	Bus   *WorkItemConfig `json:"bus"`
+	Train *WorkItemConfig `json:"train"`
+
+	Sources []SourceConfig `json:"sources"`
+
+	Retry *RetryConfig `json:"retry"`
+}
+
+//WorkItemConfig specifies how one unit of work is scheduled. Work items that
+//don't set a poll time use the global one.
+type WorkItemConfig struct {
+	PollTimeInSeconds int            `json:"poll_time_in_seconds"`
+	SkipIfBusy        bool           `json:"skip_if_busy"`
+	MaxInFlight       int            `json:"max_in_flight"`
+	CircuitBreaker    *BreakerConfig `json:"circuit_breaker"`
+	//PathTemplate names each dump, e.g. `{prefix}/date={yyyy-MM-dd}/{rfc3339}.json`.
+	//See pathtemplate.Template for the placeholders.
+	PathTemplate string `json:"path_template"`
+}
+
+//WorkOptions produces the worker options for this work item, which always
+//include a circuit breaker of its own
+func (c *WorkItemConfig) WorkOptions(log *zap.Logger, name string, opts ...Option) (workOpts []worker.WorkOption, err error) {
+	if c == nil {
+		c = &WorkItemConfig{}
+	}
+	if c.PollTimeInSeconds > 0 {
+		workOpts = append(workOpts, worker.WithPollTime(time.Duration(c.PollTimeInSeconds)*time.Second))
+	}
+	if c.PathTemplate != "" {
+		var t pathtemplate.Template
+		t, err = pathtemplate.Parse(c.PathTemplate)
+		if err != nil {
+			return nil, errors.Wrap(ErrWorkItemValidationFailed, err.Error())
+		}
+		workOpts = append(workOpts, worker.WithPathTemplate(t))
+	}
+	return append(workOpts,
+		worker.WithSkipIfBusy(c.SkipIfBusy),
+		worker.WithMaxInFlight(c.MaxInFlight),
+		worker.WithBreaker(buildOptions(opts).buildBreaker(log, c.CircuitBreaker, name)),
+	), nil
+}
+
+//ErrWorkItemValidationFailed indicates that a work item's configuration was invalid
+var ErrWorkItemValidationFailed = errors.New("work item failed to build due to invalid args")
+
+//BreakerConfig specifies the thresholds of a circuit breaker. The breaker opens
+//after `window` consecutive failures, and lets a request through again after
+//`wait_time_in_seconds`.
+type BreakerConfig struct {
+	WaitTimeInSeconds int `json:"wait_time_in_seconds"`
+	Window            int `json:"window"`
+}
+
+const (
+	//DefaultBreakerWaitTime is used for breakers that don't set a wait time
+	DefaultBreakerWaitTime = time.Hour
+	//DefaultBreakerWindow is used for breakers that don't set a window
+	DefaultBreakerWindow = 10
+)
+
+//Build builds the circuit breaker, falling back to the default thresholds for
+//any that aren't set
+func (c *BreakerConfig) Build(log *zap.Logger, name string, opts ...circuitbreaker.Option) *circuitbreaker.CircuitBreaker {
+	if c == nil {
+		c = &BreakerConfig{}
+	}
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	waitTime := DefaultBreakerWaitTime
+	if c.WaitTimeInSeconds > 0 {
+		waitTime = time.Duration(c.WaitTimeInSeconds) * time.Second
+	}
+	window := DefaultBreakerWindow
+	if c.Window > 0 {
+		window = c.Window
+	}
+
+	return circuitbreaker.New(log, waitTime, window, append([]circuitbreaker.Option{circuitbreaker.WithName(name)}, opts...)...)
+}
+
+//RetryConfig specifies how failed requests to the MARTA API are retried. Any
+//field left unset takes its value from retry.DefaultPolicy.
+type RetryConfig struct {
+	MaxAttempts             int      `json:"max_attempts"`
+	BaseDelayInMilliseconds int      `json:"base_delay_in_milliseconds"`
+	MaxDelayInMilliseconds  int      `json:"max_delay_in_milliseconds"`
+	Jitter                  *float64 `json:"jitter"`
+}
+
+//RetryPolicy produces the retry policy for the MARTA API clients, falling
+//back to retry.DefaultPolicy for anything that isn't configured
+func (c WorkConfig) RetryPolicy() retry.Policy {
+	policy := retry.DefaultPolicy
+	if c.Retry == nil {
+		return policy
+	}
+
+	if c.Retry.MaxAttempts > 0 {
+		policy.MaxAttempts = c.Retry.MaxAttempts
+	}
+	if c.Retry.BaseDelayInMilliseconds > 0 {
+		policy.BaseDelay = time.Duration(c.Retry.BaseDelayInMilliseconds) * time.Millisecond
+	}
+	if c.Retry.MaxDelayInMilliseconds > 0 {
+		policy.MaxDelay = time.Duration(c.Retry.MaxDelayInMilliseconds) * time.Millisecond
+	}
+	if c.Retry.Jitter != nil {
+		policy.Jitter = *c.Retry.Jitter
+	}
+	return policy
+}
+
+func sinkCheckOptions(checks []worker.SinkCheck) (opts []worker.WorkOption) {
+	for _, check := range checks {
+		opts = append(opts, worker.WithSinkCheck(check.Name, check.Check))
+	}
+	return
 }
 
 //BuildWorkList builds a worklist from the specified clients
-//and dumper config
+//and dumper config. Any additional sources are requested using doer.
+//The same options are used to build every dumper and work item.
 func BuildWorkList(
 	log *zap.Logger,
 	sqlOpen SQLOpener,
 	c WorkConfig,
 	busClient martaapi.Client,
 	trainClient martaapi.Client,
+	doer scraper.Doer,
+	opts ...Option,
 ) (workList worker.WorkList, f CleanupFunc, err error) {
+	o := buildOptions(opts)
 	var cleanups []CleanupFunc
 	var cleanup CleanupFunc
+	var checks []worker.SinkCheck
 	if c.BusDumper != nil {
 		var busDumper dumper.Dumper
-		busDumper, cleanup, err = BuildDumper(log, sqlOpen, *c.BusDumper)
+		checks = nil
+		busDumper, cleanup, err = BuildDumper(log, sqlOpen, *c.BusDumper, append(opts, collectSinkChecks(&checks))...)
 		if err != nil {
 			err = errors.Wrap(err, "failed to build bus dumper")
 			return
 		}
 		cleanups = append(cleanups, cleanup)
-		workList.AddWork(busClient, busDumper)
+
+		var workOpts []worker.WorkOption
+		workOpts, err = c.Bus.WorkOptions(log, "bus", opts...)
+		if err != nil {
+			err = errors.Wrap(err, "failed to build bus work item")
+			return
+		}
+		workList.AddWork(busClient, busDumper, append(workOpts, sinkCheckOptions(checks)...)...)
 	}
 
 	if c.TrainDumper != nil {
 		var trainDumper dumper.Dumper
-		trainDumper, cleanup, err = BuildDumper(log, sqlOpen, *c.TrainDumper)
+		checks = nil
+		trainDumper, cleanup, err = BuildDumper(log, sqlOpen, *c.TrainDumper, append(opts, collectSinkChecks(&checks))...)
 		if err != nil {
 			err = errors.Wrap(err, "failed to build train dumper")
 			return
 		}
 		cleanups = append(cleanups, cleanup)
-		workList.AddWork(trainClient, trainDumper)
+
+		var workOpts []worker.WorkOption
+		workOpts, err = c.Train.WorkOptions(log, "train", opts...)
+		if err != nil {
+			err = errors.Wrap(err, "failed to build train work item")
+			return
+		}
+		workList.AddWork(trainClient, trainDumper, append(workOpts, sinkCheckOptions(checks)...)...)
+	}
+
+	for i, sc := range c.Sources {
+		var s scraper.Scraper
+		s, err = BuildScraper(log, o.metrics.InstrumentDoer(doer, sc.OutputPrefix), c.RetryPolicy(), sc)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to build source %d", i)
+			return
+		}
+		if sc.Dumper == nil {
+			err = errors.Wrapf(ErrSourceValidationFailed, "failed to build source %d: no dumper provided", i)
+			return
+		}
+
+		var d dumper.Dumper
+		checks = nil
+		d, cleanup, err = BuildDumper(log, sqlOpen, *sc.Dumper, append(opts, collectSinkChecks(&checks))...)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to build dumper for source %d", i)
+			return
+		}
+		cleanups = append(cleanups, cleanup)
+
+		var workOpts []worker.WorkOption
+		workOpts, err = sc.WorkItemConfig.WorkOptions(log, sc.OutputPrefix, opts...)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to build source %d", i)
+			return
+		}
+		workList.AddWork(s, d, append(workOpts, sinkCheckOptions(checks)...)...)
 	}
 	f = NewRoundRobinCleanup(cleanups)
 	return
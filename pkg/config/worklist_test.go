@@ -1,8 +1,12 @@
 package config_test
 
 import (
+	"context"
+	"time"
+
 	"github.com/smartatransit/scrapedumper/pkg/config"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/retry"
 	"github.com/smartatransit/scrapedumper/pkg/worker"
 
 	. "github.com/onsi/ginkgo"
@@ -30,7 +34,7 @@ var _ = Describe("BuildWorkList", func() {
 	})
 
 	JustBeforeEach(func() {
-		result, _, callErr = config.BuildWorkList(nil, nil, cfg, martaapi.Client{}, martaapi.Client{})
+		result, _, callErr = config.BuildWorkList(nil, nil, cfg, martaapi.Client{}, martaapi.Client{}, nil)
 	})
 
 	It("builds a worklist", func() {
@@ -47,6 +51,121 @@ var _ = Describe("BuildWorkList", func() {
 		})
 	})
 
+	When("work items are scheduled", func() {
+		BeforeEach(func() {
+			cfg.Train = &config.WorkItemConfig{PollTimeInSeconds: 10, SkipIfBusy: true, MaxInFlight: 2}
+			cfg.Bus = &config.WorkItemConfig{PollTimeInSeconds: 30}
+		})
+		AfterEach(func() {
+			cfg.Train = nil
+			cfg.Bus = nil
+		})
+		It("gives each one its own circuit breaker", func() {
+			Expect(result.GetWork()[0].Breaker.Name()).To(Equal("bus"))
+			Expect(result.GetWork()[1].Breaker.Name()).To(Equal("train"))
+			Expect(result.GetWork()[0].Breaker).NotTo(BeIdenticalTo(result.GetWork()[1].Breaker))
+		})
+		When("a work item has a path template", func() {
+			BeforeEach(func() {
+				cfg.Train.PathTemplate = "{prefix}/date={yyyy-MM-dd}/{rfc3339}.json"
+			})
+			It("names its dumps with it", func() {
+				Expect(callErr).To(BeNil())
+				Expect(result.GetWork()[0].PathTemplate.String()).To(Equal(""))
+				Expect(result.GetWork()[1].PathTemplate.String()).To(Equal("{prefix}/date={yyyy-MM-dd}/{rfc3339}.json"))
+			})
+		})
+		When("a work item's path template is invalid", func() {
+			BeforeEach(func() {
+				cfg.Train.PathTemplate = "{prefix}/{line}.json"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to build train work item: invalid path template `{prefix}/{line}.json`: unknown placeholder `{line}`")))
+			})
+		})
+		It("schedules each one independently", func() {
+			Expect(callErr).To(BeNil())
+			Expect(result.GetWork()[0].PollTime).To(Equal(30 * time.Second))
+			Expect(result.GetWork()[0].SkipIfBusy).To(BeFalse())
+			Expect(result.GetWork()[1].PollTime).To(Equal(10 * time.Second))
+			Expect(result.GetWork()[1].SkipIfBusy).To(BeTrue())
+			Expect(result.GetWork()[1].MaxInFlight).To(Equal(2))
+		})
+	})
+
+	When("a dumper has sinks that can be checked", func() {
+		BeforeEach(func() {
+			cfg.TrainDumper = &config.DumpConfig{
+				Kind: config.RoundRobinKind,
+				Components: []config.DumpConfig{{
+					Kind:         config.S3DumperKind,
+					Name:         "archive",
+					S3BucketName: "my-bucket",
+				}},
+			}
+		})
+		AfterEach(func() {
+			cfg.TrainDumper = &config.DumpConfig{
+				Kind:         config.S3DumperKind,
+				S3BucketName: "my-bucket",
+			}
+		})
+		It("checks them for that work item only", func() {
+			Expect(callErr).To(BeNil())
+			Expect(result.GetWork()[0].SinkChecks).To(BeEmpty())
+			Expect(result.GetWork()[1].SinkChecks).To(HaveLen(1))
+
+			check := result.GetWork()[1].SinkChecks[0]
+			Expect(check.Name).To(Equal("archive circuit breaker"))
+			Expect(check.Check(context.Background())).To(Succeed())
+		})
+	})
+
+	When("additional sources are configured", func() {
+		BeforeEach(func() {
+			cfg.Sources = []config.SourceConfig{{
+				Kind:         config.HTTPSourceKind,
+				URL:          "https://example.com/feed.json",
+				OutputPrefix: "alerts",
+				Dumper: &config.DumpConfig{
+					Kind:         config.S3DumperKind,
+					S3BucketName: "my-bucket",
+				},
+			}}
+		})
+		AfterEach(func() {
+			cfg.Sources = nil
+		})
+		It("adds them to the worklist", func() {
+			Expect(callErr).To(BeNil())
+			Expect(result.GetWork()).To(HaveLen(3))
+			Expect(result.GetWork()[2].Scraper.Prefix()).To(Equal("alerts"))
+		})
+		When("a source can't be built", func() {
+			BeforeEach(func() {
+				cfg.Sources[0].URL = ""
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to build source 0: source kind HTTP requested but no url provided")))
+			})
+		})
+		When("a source has no dumper", func() {
+			BeforeEach(func() {
+				cfg.Sources[0].Dumper = nil
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to build source 0: no dumper provided")))
+			})
+		})
+		When("a source's dumper can't be built", func() {
+			BeforeEach(func() {
+				cfg.Sources[0].Dumper.S3BucketName = ""
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to build dumper for source 0: dumper kind S3 requested but no s3 bucket name provided")))
+			})
+		})
+	})
 	When("the train dumper can't be built", func() {
 		BeforeEach(func() {
 			cfg.TrainDumper.S3BucketName = ""
@@ -56,3 +175,41 @@ var _ = Describe("BuildWorkList", func() {
 		})
 	})
 })
+
+var _ = Describe("WorkConfig", func() {
+	Describe("RetryPolicy", func() {
+		It("falls back to the default policy", func() {
+			Expect(config.WorkConfig{}.RetryPolicy()).To(Equal(retry.DefaultPolicy))
+		})
+		It("converts the configured values", func() {
+			jitter := 0.5
+			cfg := config.WorkConfig{Retry: &config.RetryConfig{
+				MaxAttempts:             5,
+				BaseDelayInMilliseconds: 250,
+				MaxDelayInMilliseconds:  4000,
+				Jitter:                  &jitter,
+			}}
+			Expect(cfg.RetryPolicy()).To(Equal(retry.Policy{
+				MaxAttempts: 5,
+				BaseDelay:   250 * time.Millisecond,
+				MaxDelay:    4 * time.Second,
+				Jitter:      0.5,
+			}))
+		})
+		It("falls back to the default for each value that isn't configured", func() {
+			cfg := config.WorkConfig{Retry: &config.RetryConfig{MaxAttempts: 5}}
+			Expect(cfg.RetryPolicy()).To(Equal(retry.Policy{
+				MaxAttempts: 5,
+				BaseDelay:   retry.DefaultPolicy.BaseDelay,
+				MaxDelay:    retry.DefaultPolicy.MaxDelay,
+				Jitter:      retry.DefaultPolicy.Jitter,
+			}))
+		})
+		It("keeps a jitter of zero", func() {
+			jitter := 0.0
+			cfg := config.WorkConfig{Retry: &config.RetryConfig{Jitter: &jitter}}
+			Expect(cfg.RetryPolicy().Jitter).To(BeZero())
+			Expect(cfg.RetryPolicy().MaxAttempts).To(Equal(retry.DefaultPolicy.MaxAttempts))
+		})
+	})
+})
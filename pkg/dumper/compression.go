@@ -0,0 +1,136 @@
+package dumper
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Compression is an encoding that a file dumper can compress its scrapes with
+type Compression string
+
+const (
+	// NoCompression writes scrapes as they are
+	NoCompression Compression = ""
+	// Gzip compresses scrapes with gzip, and names them with a .gz extension
+	Gzip Compression = "gzip"
+	// Zstd compresses scrapes with zstandard, and names them with a .zst extension
+	Zstd Compression = "zstd"
+)
+
+// Valid reports whether the compression is supported
+func (c Compression) Valid() bool {
+	switch c {
+	case NoCompression, Gzip, Zstd:
+		return true
+	}
+	return false
+}
+
+// Extension is appended to the path of each compressed scrape
+func (c Compression) Extension() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// withExtension appends the extension to path, unless a path template already has
+func (c Compression) withExtension(path string) string {
+	if strings.HasSuffix(path, c.Extension()) {
+		return path
+	}
+	return path + c.Extension()
+}
+
+// NewWriter compresses everything written to it into w. Closing it flushes the compressed stream, but doesn't close w.
+func (c Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	case NoCompression:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, errors.Errorf("unsupported compression `%s`", c)
+}
+
+// CompressionFromPath detects the compression of a scrape from its extension
+func CompressionFromPath(path string) Compression {
+	for _, c := range []Compression{Gzip, Zstd} {
+		if strings.HasSuffix(path, c.Extension()) {
+			return c
+		}
+	}
+	return NoCompression
+}
+
+// NewReader decompresses r
+func (c Compression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case NoCompression:
+		return ioutil.NopCloser(r), nil
+	}
+	return nil, errors.Errorf("unsupported compression `%s`", c)
+}
+
+// compress streams a compressed copy of r
+func (c Compression) compress(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := c.NewWriter(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err = io.Copy(w, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// FileOption configures a dumper that writes each scrape to its own file
+type FileOption = func(*fileOptions)
+
+type fileOptions struct {
+	compression Compression
+}
+
+// WithCompression compresses each scrape before it's written
+func WithCompression(c Compression) FileOption {
+	return func(o *fileOptions) {
+		o.compression = c
+	}
+}
+
+func buildFileOptions(opts []FileOption) (o fileOptions) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
@@ -0,0 +1,40 @@
+package dumper_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+)
+
+var _ = Describe("Compression", func() {
+	It("round trips a scrape", func() {
+		for _, c := range []dumper.Compression{dumper.NoCompression, dumper.Gzip, dumper.Zstd} {
+			var buf bytes.Buffer
+			w, err := c.NewWriter(&buf)
+			Expect(err).To(BeNil())
+			_, err = w.Write([]byte(`[{"TRAIN_ID":"1"}]`))
+			Expect(err).To(BeNil())
+			Expect(w.Close()).To(Succeed())
+
+			r, err := c.NewReader(&buf)
+			Expect(err).To(BeNil())
+			Expect(ioutil.ReadAll(r)).To(Equal([]byte(`[{"TRAIN_ID":"1"}]`)), string(c))
+		}
+	})
+
+	It("detects the compression of a path", func() {
+		Expect(dumper.CompressionFromPath("train-data/2020-03-01T12:00:00Z.json")).To(Equal(dumper.NoCompression))
+		Expect(dumper.CompressionFromPath("train-data/2020-03-01T12:00:00Z.json.gz")).To(Equal(dumper.Gzip))
+		Expect(dumper.CompressionFromPath("train-data/2020-03-01T12:00:00Z.json.zst")).To(Equal(dumper.Zstd))
+	})
+
+	It("rejects unsupported compressions", func() {
+		Expect(dumper.Compression("lz4").Valid()).To(BeFalse())
+		_, err := dumper.Compression("lz4").NewWriter(&bytes.Buffer{})
+		Expect(err).To(MatchError("unsupported compression `lz4`"))
+	})
+})
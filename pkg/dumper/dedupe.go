@@ -0,0 +1,248 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+)
+
+// HashStore remembers the hash of the last scrape dumped from each source
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . HashStore
+type HashStore interface {
+	LastHash(prefix string) (string, error)
+	SaveHash(prefix string, hash string) error
+}
+
+// MemoryHashStore is a HashStore that forgets everything on restart
+type MemoryHashStore struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// NewMemoryHashStore instantiates a new in-memory hash store
+func NewMemoryHashStore() *MemoryHashStore {
+	return &MemoryHashStore{hashes: map[string]string{}}
+}
+
+func (s *MemoryHashStore) LastHash(prefix string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hashes[prefix], nil
+}
+
+func (s *MemoryHashStore) SaveHash(prefix string, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[prefix] = hash
+	return nil
+}
+
+// FileHashStore is a HashStore that keeps its hashes in a JSON file, so that they survive restarts
+type FileHashStore struct {
+	fs     afero.Fs
+	path   string
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// NewFileHashStore instantiates a new hash store backed by the file at path, which is created when a hash is first saved
+func NewFileHashStore(fs afero.Fs, path string) *FileHashStore {
+	return &FileHashStore{
+		fs:   fs,
+		path: path,
+	}
+}
+
+type fileHashStoreKey struct {
+	fs   afero.Fs
+	path string
+}
+
+var (
+	fileHashStoresMu sync.Mutex
+	fileHashStores   = map[fileHashStoreKey]*FileHashStore{}
+)
+
+// SharedFileHashStore returns the one hash store backed by the file at path, so that dumpers configured with the same
+// file keep each other's hashes rather than overwriting them
+func SharedFileHashStore(fs afero.Fs, path string) *FileHashStore {
+	key := fileHashStoreKey{fs, filepath.Clean(path)}
+
+	fileHashStoresMu.Lock()
+	defer fileHashStoresMu.Unlock()
+	if store, ok := fileHashStores[key]; ok {
+		return store
+	}
+	store := NewFileHashStore(fs, key.path)
+	fileHashStores[key] = store
+	return store
+}
+
+// load reads the file the first time it's needed. The caller holds the lock.
+func (s *FileHashStore) load() error {
+	if s.hashes != nil {
+		return nil
+	}
+
+	b, err := afero.ReadFile(s.fs, s.path)
+	if os.IsNotExist(err) {
+		s.hashes = map[string]string{}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read dedupe state from `%s`", s.path)
+	}
+
+	hashes := map[string]string{}
+	if err := json.Unmarshal(b, &hashes); err != nil {
+		return errors.Wrapf(err, "failed to parse dedupe state from `%s`", s.path)
+	}
+	s.hashes = hashes
+	return nil
+}
+
+func (s *FileHashStore) LastHash(prefix string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	return s.hashes[prefix], nil
+}
+
+func (s *FileHashStore) SaveHash(prefix string, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.hashes[prefix] = hash
+
+	b, err := json.Marshal(s.hashes)
+	if err != nil {
+		return err
+	}
+
+	// write a temporary file and move it into place, so that a crash can't leave a truncated file behind
+	if err := s.fs.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory for dedupe state `%s`", s.path)
+	}
+	tmp, err := afero.TempFile(s.fs, filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file for dedupe state `%s`", s.path)
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = s.fs.Remove(tmp.Name())
+		return errors.Wrapf(err, "failed to write dedupe state to `%s`", tmp.Name())
+	}
+	if err := s.fs.Rename(tmp.Name(), s.path); err != nil {
+		_ = s.fs.Remove(tmp.Name())
+		return errors.Wrapf(err, "failed to move dedupe state into place at `%s`", s.path)
+	}
+	return nil
+}
+
+// DedupeDumper skips scrapes that are identical to the last one dumped from the same source
+type DedupeDumper struct {
+	logger    *zap.Logger
+	dumper    Dumper
+	store     HashStore
+	normalize bool
+	metrics   *metrics.Metrics
+	skipped   *int64
+	// prefixes holds a *sync.Mutex for each source, so that its scrapes are compared and dumped one at a time
+	prefixes *sync.Map
+}
+
+// NewDedupeDumper instantiates a new dedupe dumper. If normalize is set, scrapes are compared as JSON, ignoring
+// the order of each object's fields and any whitespace.
+func NewDedupeDumper(logger *zap.Logger, d Dumper, store HashStore, normalize bool, m *metrics.Metrics) DedupeDumper {
+	return DedupeDumper{
+		logger,
+		d,
+		store,
+		normalize,
+		m,
+		new(int64),
+		&sync.Map{},
+	}
+}
+
+// Skipped counts the dumps that have been skipped as duplicates
+func (c DedupeDumper) Skipped() int64 {
+	return atomic.LoadInt64(c.skipped)
+}
+
+// Dump passes the scrape on unless it's a duplicate. Its hash is only remembered once it's been dumped, so that a
+// failed dump isn't skipped the next time around. Scrapes from the same source wait for each other, so that two
+// identical scrapes in flight at once aren't both dumped.
+func (c DedupeDumper) Dump(ctx context.Context, r io.Reader, path string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	hash, err := c.hash(b)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash scrape")
+	}
+
+	prefix := ScrapeInfoFrom(ctx, path).Prefix
+	lock, _ := c.prefixes.LoadOrStore(prefix, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	last, err := c.store.LastHash(prefix)
+	if err != nil {
+		return err
+	}
+	if hash == last {
+		atomic.AddInt64(c.skipped, 1)
+		c.metrics.DedupeSkipped(prefix)
+		c.logger.Debug(fmt.Sprintf("skipping duplicate scrape %s", path))
+		return nil
+	}
+
+	if err := c.dumper.Dump(ctx, bytes.NewReader(b), path); err != nil {
+		return err
+	}
+	return c.store.SaveHash(prefix, hash)
+}
+
+func (c DedupeDumper) hash(b []byte) (string, error) {
+	if c.normalize {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return "", err
+		}
+		// objects are marshalled with their keys sorted
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return "", err
+		}
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
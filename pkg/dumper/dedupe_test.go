@@ -0,0 +1,170 @@
+package dumper_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+)
+
+var _ = Describe("DedupeDumper", func() {
+	var (
+		fake      *dumperfakes.FakeDumper
+		store     dumper.HashStore
+		normalize bool
+		reg       *prometheus.Registry
+		d         dumper.DedupeDumper
+		dumped    []string
+	)
+
+	dump := func(prefix string, body string) error {
+		ctx := dumper.WithScrapeInfo(context.Background(), dumper.ScrapeInfo{Prefix: prefix})
+		return d.Dump(ctx, strings.NewReader(body), prefix+"/some path")
+	}
+
+	BeforeEach(func() {
+		fake = &dumperfakes.FakeDumper{}
+		dumped = nil
+		fake.DumpStub = func(_ context.Context, r io.Reader, _ string) error {
+			b, err := ioutil.ReadAll(r)
+			dumped = append(dumped, string(b))
+			return err
+		}
+		store = dumper.NewMemoryHashStore()
+		normalize = false
+		reg = prometheus.NewRegistry()
+	})
+
+	JustBeforeEach(func() {
+		d = dumper.NewDedupeDumper(zap.NewNop(), fake, store, normalize, metrics.New(reg))
+	})
+
+	It("skips a scrape identical to the last one from the same source", func() {
+		Expect(dump("train-data", `[{"TRAIN_ID":"1"}]`)).To(Succeed())
+		Expect(dump("train-data", `[{"TRAIN_ID":"1"}]`)).To(Succeed())
+		Expect(dump("bus-data", `[{"TRAIN_ID":"1"}]`)).To(Succeed())
+		Expect(dump("train-data", `[{"TRAIN_ID":"2"}]`)).To(Succeed())
+		Expect(dump("train-data", `[{"TRAIN_ID":"1"}]`)).To(Succeed())
+
+		Expect(dumped).To(Equal([]string{
+			`[{"TRAIN_ID":"1"}]`,
+			`[{"TRAIN_ID":"1"}]`,
+			`[{"TRAIN_ID":"2"}]`,
+			`[{"TRAIN_ID":"1"}]`,
+		}))
+		Expect(d.Skipped()).To(Equal(int64(1)))
+		Expect(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP scrapedumper_dedupe_skipped_total Dumps skipped because the scrape was identical to the last one from its source.
+# TYPE scrapedumper_dedupe_skipped_total counter
+scrapedumper_dedupe_skipped_total{prefix="train-data"} 1
+`), "scrapedumper_dedupe_skipped_total")).To(Succeed())
+	})
+
+	It("compares field order unless normalizing", func() {
+		Expect(dump("train-data", `[{"TRAIN_ID":"1","LINE":"GOLD"}]`)).To(Succeed())
+		Expect(dump("train-data", `[{"LINE": "GOLD", "TRAIN_ID": "1"}]`)).To(Succeed())
+		Expect(d.Skipped()).To(BeZero())
+	})
+
+	When("normalizing", func() {
+		BeforeEach(func() {
+			normalize = true
+		})
+		It("ignores field order and whitespace", func() {
+			Expect(dump("train-data", `[{"TRAIN_ID":"1","LINE":"GOLD","TTL":12345678901234567890}]`)).To(Succeed())
+			Expect(dump("train-data", `[{"LINE": "GOLD", "TTL": 12345678901234567890, "TRAIN_ID": "1"}]`)).To(Succeed())
+			Expect(d.Skipped()).To(Equal(int64(1)))
+			Expect(dumped).To(HaveLen(1))
+		})
+		It("fails on a scrape that isn't JSON", func() {
+			Expect(dump("train-data", `<html>`)).To(MatchError(ContainSubstring("failed to hash scrape")))
+		})
+	})
+
+	When("the dump fails", func() {
+		It("doesn't skip the same scrape next time", func() {
+			fake.DumpReturnsOnCall(0, errors.New("upload failed"))
+			Expect(dump("train-data", `[]`)).To(MatchError("upload failed"))
+			Expect(dump("train-data", `[]`)).To(Succeed())
+			Expect(fake.DumpCallCount()).To(Equal(2))
+		})
+	})
+
+	When("the hashes are kept in a file", func() {
+		var fs afero.Fs
+		BeforeEach(func() {
+			fs = afero.NewMemMapFs()
+			store = dumper.NewFileHashStore(fs, "/var/lib/scrapedumper/dedupe.json")
+		})
+		It("remembers them across restarts", func() {
+			Expect(dump("train-data", `[]`)).To(Succeed())
+
+			d = dumper.NewDedupeDumper(zap.NewNop(), fake, dumper.NewFileHashStore(fs, "/var/lib/scrapedumper/dedupe.json"), false, nil)
+			Expect(dump("train-data", `[]`)).To(Succeed())
+			Expect(d.Skipped()).To(Equal(int64(1)))
+			Expect(fake.DumpCallCount()).To(Equal(1))
+		})
+		It("fails if the file is corrupt", func() {
+			Expect(afero.WriteFile(fs, "/var/lib/scrapedumper/dedupe.json", []byte("{"), 0644)).To(Succeed())
+			Expect(dump("train-data", `[]`)).To(MatchError(ContainSubstring("failed to parse dedupe state from `/var/lib/scrapedumper/dedupe.json`")))
+		})
+		When("dumpers share the file", func() {
+			BeforeEach(func() {
+				store = dumper.SharedFileHashStore(fs, "/var/lib/scrapedumper/dedupe.json")
+			})
+			It("keeps each one's hashes", func() {
+				bus := dumper.NewDedupeDumper(zap.NewNop(), fake, dumper.SharedFileHashStore(fs, "/var/lib/scrapedumper/../scrapedumper/dedupe.json"), false, nil)
+				Expect(dump("train-data", `[1]`)).To(Succeed())
+				busCtx := dumper.WithScrapeInfo(context.Background(), dumper.ScrapeInfo{Prefix: "bus-data"})
+				Expect(bus.Dump(busCtx, strings.NewReader(`[2]`), "bus-data/some path")).To(Succeed())
+
+				b, err := afero.ReadFile(fs, "/var/lib/scrapedumper/dedupe.json")
+				Expect(err).NotTo(HaveOccurred())
+				var hashes map[string]string
+				Expect(json.Unmarshal(b, &hashes)).To(Succeed())
+				Expect(hashes).To(HaveKey("train-data"))
+				Expect(hashes).To(HaveKey("bus-data"))
+
+				files, err := afero.ReadDir(fs, "/var/lib/scrapedumper")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(HaveLen(1))
+			})
+		})
+	})
+
+	When("identical scrapes from a source are in flight at once", func() {
+		var release chan struct{}
+		BeforeEach(func() {
+			release = make(chan struct{})
+			released := release
+			fake.DumpStub = func(context.Context, io.Reader, string) error {
+				<-released
+				return nil
+			}
+		})
+		It("dumps only one of them", func() {
+			errs := make(chan error, 2)
+			go func() { errs <- dump("train-data", `[]`) }()
+			go func() { errs <- dump("train-data", `[]`) }()
+			Eventually(fake.DumpCallCount).Should(Equal(1))
+			close(release)
+			Eventually(errs).Should(Receive(BeNil()))
+			Eventually(errs).Should(Receive(BeNil()))
+			Expect(fake.DumpCallCount()).To(Equal(1))
+			Expect(d.Skipped()).To(Equal(int64(1)))
+		})
+	})
+})
@@ -8,6 +8,9 @@ import (
 	"io"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/afero"
 
@@ -15,10 +18,13 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/smartatransit/scrapedumper/pkg/alias"
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
 	"github.com/smartatransit/scrapedumper/pkg/postgres"
 )
 
@@ -32,20 +38,109 @@ type Uploader interface {
 	Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
 }
 
-// RoundRobinDumpClient reads the scrape into disk, and then dumps that result into each dumper synchronously
+//FailurePolicy decides whether a fan-out counts as failed, given how many of
+//its components failed
+type FailurePolicy string
+
+const (
+	//FailOnAny fails the fan-out if any component fails
+	FailOnAny FailurePolicy = "ANY"
+	//FailOnQuorum fails the fan-out if more than half of the components fail
+	FailOnQuorum FailurePolicy = "QUORUM"
+	//FailOnAll fails the fan-out only if every component fails
+	FailOnAll FailurePolicy = "ALL"
+)
+
+//Failed reports whether the given number of component failures fails the fan-out
+func (p FailurePolicy) Failed(failures, total int) bool {
+	if failures == 0 {
+		return false
+	}
+
+	switch p {
+	case FailOnQuorum:
+		return failures*2 > total
+	case FailOnAll:
+		return failures == total
+	default:
+		return true
+	}
+}
+
+//Component is one destination of a RoundRobinDumpClient
+type Component struct {
+	//Name identifies the component in errors and logs
+	Name   string
+	Dumper Dumper
+	//Timeout bounds each dump, unless it's zero
+	Timeout time.Duration
+}
+
+//ComponentError is the failure of a single component of a fan-out
+type ComponentError struct {
+	Name string
+	Err  error
+}
+
+func (e ComponentError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err.Error())
+}
+
+//FanOutError collects the failures of every component that failed during a fan-out
+type FanOutError struct {
+	Failures []ComponentError
+	Total    int
+}
+
+func (e *FanOutError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i := range e.Failures {
+		msgs[i] = e.Failures[i].Error()
+	}
+	return fmt.Sprintf("%d of %d dump components failed: %s", len(e.Failures), e.Total, strings.Join(msgs, "; "))
+}
+
+//Failed lists the names of the components that failed
+func (e *FanOutError) Failed() []string {
+	names := make([]string, len(e.Failures))
+	for i := range e.Failures {
+		names[i] = e.Failures[i].Name
+	}
+	return names
+}
+
+// RoundRobinDumpClient reads the scrape into memory, and then dumps that result into each dumper concurrently.
+// A slow or failing component doesn't keep the others from getting the scrape.
 type RoundRobinDumpClient struct {
-	logger  *zap.Logger
-	clients []Dumper
+	logger     *zap.Logger
+	components []Component
+	policy     FailurePolicy
 }
 
-// NewRoundRobinDumpClient instantiates a new RoundRobin client
+// NewRoundRobinDumpClient instantiates a new RoundRobin client that fails if any of its clients fail
 func NewRoundRobinDumpClient(logger *zap.Logger, clients ...Dumper) RoundRobinDumpClient {
+	components := make([]Component, len(clients))
+	for i := range clients {
+		components[i] = Component{
+			Name:   fmt.Sprintf("component %d", i),
+			Dumper: clients[i],
+		}
+	}
+	return NewRoundRobinDumpClientWithPolicy(logger, FailOnAny, components...)
+}
+
+// NewRoundRobinDumpClientWithPolicy instantiates a new RoundRobin client from named components
+func NewRoundRobinDumpClientWithPolicy(logger *zap.Logger, policy FailurePolicy, components ...Component) RoundRobinDumpClient {
 	return RoundRobinDumpClient{
 		logger,
-		clients,
+		components,
+		policy,
 	}
 }
 
+//Dump dumps to every component at once. If any component fails, a *FanOutError
+//naming each failed component is returned if the failure policy deems the fan-out
+//failed, and logged otherwise.
 func (c RoundRobinDumpClient) Dump(ctx context.Context, r io.Reader, path string) error {
 	// this could potentially load a lot into memory, but we have to buffer it somehow so that we can read it into multiple
 	// dump clients.  This could potentially be better if we use Go pipelining here, but for now i'm keeping it as is
@@ -53,42 +148,148 @@ func (c RoundRobinDumpClient) Dump(ctx context.Context, r io.Reader, path string
 	if err != nil {
 		return err
 	}
-	for _, client := range c.clients {
-		br := bytes.NewReader(b)
-		err := client.Dump(ctx, br, path)
-		if err != nil {
-			return err
+
+	errs := make([]error, len(c.components))
+	var wg sync.WaitGroup
+	for i := range c.components {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.dumpComponent(ctx, c.components[i], b, path)
+		}(i)
+	}
+	wg.Wait()
+
+	fanOutErr := &FanOutError{Total: len(c.components)}
+	for i := range errs {
+		if errs[i] != nil {
+			fanOutErr.Failures = append(fanOutErr.Failures, ComponentError{
+				Name: c.components[i].Name,
+				Err:  errs[i],
+			})
 		}
 	}
+
+	if len(fanOutErr.Failures) == 0 {
+		return nil
+	}
+	if !c.policy.Failed(len(fanOutErr.Failures), fanOutErr.Total) {
+		c.logger.Warn("some dump components failed",
+			zap.String("path", path),
+			zap.Error(fanOutErr),
+		)
+		return nil
+	}
+	return fanOutErr
+}
+
+func (c RoundRobinDumpClient) dumpComponent(ctx context.Context, comp Component, b []byte, path string) error {
+	if comp.Timeout <= 0 {
+		return comp.Dumper.Dump(ctx, bytes.NewReader(b), path)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, comp.Timeout)
+	defer cancel()
+
+	// not every dumper respects its context, so don't wait on one past its timeout
+	done := make(chan error, 1)
+	go func() {
+		done <- comp.Dumper.Dump(ctx, bytes.NewReader(b), path)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "dump timed out after %s", comp.Timeout)
+	}
+}
+
+// CircuitBreakerDumper guards a single sink with its own circuit breaker, so that a broken sink
+// fails fast without affecting the breakers of other sinks or of the scrape itself
+type CircuitBreakerDumper struct {
+	dumper Dumper
+	cb     *circuitbreaker.CircuitBreaker
+}
+
+// NewCircuitBreakerDumper instantiates a new circuit breaker dumper
+func NewCircuitBreakerDumper(d Dumper, cb *circuitbreaker.CircuitBreaker) CircuitBreakerDumper {
+	return CircuitBreakerDumper{
+		d,
+		cb,
+	}
+}
+
+// Breaker is the breaker guarding the sink
+func (c CircuitBreakerDumper) Breaker() *circuitbreaker.CircuitBreaker {
+	return c.cb
+}
+
+// Dump dumps to the sink unless its circuit is open. Unlike CircuitBreaker.Run, every failure is returned,
+// so that a round robin's failure policy still sees it.
+func (c CircuitBreakerDumper) Dump(ctx context.Context, r io.Reader, path string) error {
+	var dumpErr error
+	err := c.cb.Run(func() error {
+		dumpErr = c.dumper.Dump(ctx, r, path)
+		return dumpErr
+	})
+	if err != nil {
+		return err
+	}
+	return dumpErr
+}
+
+// InstrumentedDumper records the latency and errors of a dumper's dumps, labelled by kind
+type InstrumentedDumper struct {
+	dumper  Dumper
+	kind    string
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedDumper instantiates a new instrumented dumper
+func NewInstrumentedDumper(d Dumper, kind string, m *metrics.Metrics) InstrumentedDumper {
+	return InstrumentedDumper{
+		d,
+		kind,
+		m,
+	}
+}
+
+func (c InstrumentedDumper) Dump(ctx context.Context, r io.Reader, path string) error {
+	start := time.Now()
+	err := c.dumper.Dump(ctx, r, path)
+	c.metrics.ObserveDump(c.kind, time.Since(start), err)
 	return err
 }
 
 // LocalDumpHandler will write a scrape to the local file sysem
 type LocalDumpHandler struct {
-	path   string
-	logger *zap.Logger
-	fs     afero.Fs
+	path        string
+	logger      *zap.Logger
+	fs          afero.Fs
+	compression Compression
 }
 
 // NewLocalDumpHandler instantiates a new local dump handler
-func NewLocalDumpHandler(path string, logger *zap.Logger, fs afero.Fs) LocalDumpHandler {
+func NewLocalDumpHandler(path string, logger *zap.Logger, fs afero.Fs, opts ...FileOption) LocalDumpHandler {
 	return LocalDumpHandler{
 		path,
 		logger,
 		fs,
+		buildFileOptions(opts).compression,
 	}
 }
 
 func (c LocalDumpHandler) Dump(ctx context.Context, r io.Reader, path string) error {
-	c.logger.Debug(fmt.Sprintf("Local dump to %s", path))
-	location := filepath.Join(c.path, path)
+	location := c.compression.withExtension(filepath.Join(c.path, path))
+	c.logger.Debug(fmt.Sprintf("Local dump to %s", location))
 
 	f, err := c.fs.Create(location)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(f, r)
+	err = c.write(f, r)
 	if err != nil {
 		//avoid leaving a malformed JSON file behind if possible
 		if f.Close() == nil {
@@ -103,29 +304,54 @@ func (c LocalDumpHandler) Dump(ctx context.Context, r io.Reader, path string) er
 	return f.Close()
 }
 
+func (c LocalDumpHandler) write(f io.Writer, r io.Reader) error {
+	w, err := c.compression.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
 // NewS3DumpHandler instantiates a new S3 dump handler
-func NewS3DumpHandler(uploader Uploader, bucket string, logger *zap.Logger) S3DumpHandler {
+func NewS3DumpHandler(uploader Uploader, bucket string, logger *zap.Logger, opts ...FileOption) S3DumpHandler {
 	return S3DumpHandler{
 		uploader,
 		bucket,
 		logger,
+		buildFileOptions(opts).compression,
 	}
 }
 
 // S3DumpHandler will write a scrape to an s3 bucket
 type S3DumpHandler struct {
-	uploader Uploader
-	bucket   string
-	logger   *zap.Logger
+	uploader    Uploader
+	bucket      string
+	logger      *zap.Logger
+	compression Compression
 }
 
 func (c S3DumpHandler) Dump(ctx context.Context, r io.Reader, path string) error {
-	c.logger.Debug(fmt.Sprintf("S3 dump to bucket %s, path %s", c.bucket, path))
-	_, err := c.uploader.Upload(&s3manager.UploadInput{
+	input := &s3manager.UploadInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(path),
 		Body:   r,
-	})
+	}
+	if c.compression != NoCompression {
+		// the encoding lets clients that understand it decompress the scrape transparently
+		input.Key = aws.String(c.compression.withExtension(path))
+		input.ContentEncoding = aws.String(string(c.compression))
+		input.ContentType = aws.String("application/json")
+
+		body := c.compression.compress(r)
+		defer body.Close()
+		input.Body = body
+	}
+
+	c.logger.Debug(fmt.Sprintf("S3 dump to bucket %s, path %s", c.bucket, *input.Key))
+	_, err := c.uploader.Upload(input)
 	return err
 }
 
@@ -236,13 +462,36 @@ func (c PostgresDumpHandler) Dump(ctx context.Context, r io.Reader, path string)
 		stationSeq := make([]martaapi.Station, len(run))
 		for i := range run {
 			stationSeq[i] = martaapi.Station(run[i].Station)
+			if station, ok := martaapi.StationFromAPIName(run[i].Station); ok {
+				stationSeq[i] = station
+			}
 			seenStationNames[run[i].Station] = struct{}{}
 		}
-		line, dir := martaapi.ClassifySequenceList(
-			stationSeq,
-			martaapi.Line(run[0].Line),
-			martaapi.Direction(run[0].Direction),
-		)
+
+		// the API's spellings don't match the taxonomy, so resolve them
+		// before classifying, or the classifier will have nothing to go on
+		claimedLine := martaapi.Line(run[0].Line)
+		if l, ok := martaapi.LineFromAPIName(run[0].Line); ok {
+			claimedLine = l
+		}
+		claimedDir := martaapi.Direction(run[0].Direction)
+		if d, ok := martaapi.DirectionFromAPIName(run[0].Direction); ok {
+			claimedDir = d
+		}
+		line, dir := martaapi.ClassifySequenceList(stationSeq, claimedLine, claimedDir)
+
+		// but the corrections are stored as the API spells them, like the
+		// rest of the rows, and it's up to readers to resolve them
+		if line == claimedLine {
+			line = martaapi.Line(run[0].Line)
+		} else {
+			line = martaapi.Line(martaapi.LineAPIName(line))
+		}
+		if dir == claimedDir {
+			dir = martaapi.Direction(run[0].Direction)
+		} else {
+			dir = martaapi.Direction(martaapi.DirectionAPIName(dir))
+		}
 
 		seenLineNames[string(line)] = struct{}{}
 		seenDirectionNames[string(dir)] = struct{}{}
@@ -259,24 +508,44 @@ func (c PostgresDumpHandler) Dump(ctx context.Context, r io.Reader, path string)
 		stationNameResolutions = c.ResolveAliases(ctx, seenStationNames, "stations")
 	}
 
-	for _, rec := range records {
+	recs := make([]postgres.Record, len(records))
+	for i, rec := range records {
 		corr := corrections[rec.TrainID]
-		var lineID, stationID, directionID *uint
+		recs[i] = postgres.Record{
+			Schedule:      rec,
+			CorrectedLine: corr.line,
+			CorrectedDir:  corr.dir,
+		}
 
 		if c.aliaser != nil {
-			lineID = lineNameResolutions[string(corr.line)]
-			stationID = directionNameResolutions[string(corr.dir)]
-			directionID = stationNameResolutions[rec.Station]
+			recs[i].LineID = lineNameResolutions[string(corr.line)]
+			recs[i].DirID = directionNameResolutions[string(corr.dir)]
+			recs[i].StationID = stationNameResolutions[rec.Station]
+		}
+	}
+
+	// upsert the whole snapshot in one transaction when the upserter can, in which case a failed transaction fails the
+	// dump, since none of it was written
+	if batcher, ok := c.upserter.(postgres.BatchUpserter); ok {
+		err := batcher.AddRecordsToDatabase(recs)
+		if recErrs, ok := err.(postgres.RecordErrors); ok {
+			for _, err := range recErrs {
+				c.logger.Error(fmt.Sprintf("failed to upsert MARTA API response to postgres: %s", err.Error()))
+			}
+			return nil
 		}
+		return err
+	}
 
+	for _, rec := range recs {
 		err := c.upserter.AddRecordToDatabase(
-			rec,
-			martaapi.Line(corr.line),
-			martaapi.Direction(corr.dir),
+			rec.Schedule,
+			rec.CorrectedLine,
+			rec.CorrectedDir,
 
-			lineID,
-			stationID,
-			directionID,
+			rec.LineID,
+			rec.DirID,
+			rec.StationID,
 		)
 		if err != nil {
 			c.logger.Error(fmt.Sprintf("failed to upsert MARTA API response to postgres: %s", err.Error()))
@@ -300,3 +569,34 @@ func (c PostgresDumpHandler) ResolveAliases(ctx context.Context, queries map[str
 
 	return resolutions
 }
+
+// BusPostgresDumpHandler will write a bus scrape into postgres
+type BusPostgresDumpHandler struct {
+	logger *zap.Logger
+	repo   postgres.BusRepository
+}
+
+// NewBusPostgresDumpHandler instantiates a new bus postgres dump handler
+func NewBusPostgresDumpHandler(logger *zap.Logger, repo postgres.BusRepository) BusPostgresDumpHandler {
+	return BusPostgresDumpHandler{
+		logger,
+		repo,
+	}
+}
+
+func (c BusPostgresDumpHandler) Dump(ctx context.Context, r io.Reader, path string) error {
+	c.logger.Debug("Bus postgres dump")
+
+	positions, err := martaapi.ParseBusPositions(r)
+	if err != nil {
+		return err
+	}
+
+	for _, pos := range positions {
+		if err := c.repo.AddBusPosition(pos); err != nil {
+			c.logger.Error(fmt.Sprintf("failed to upsert MARTA bus API response to postgres: %s", err.Error()))
+		}
+	}
+
+	return nil
+}
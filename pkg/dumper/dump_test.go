@@ -1,17 +1,26 @@
 package dumper_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
 	"github.com/smartatransit/scrapedumper/pkg/dumper"
 	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
 	"github.com/smartatransit/scrapedumper/pkg/postgres/postgresfakes"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
@@ -43,7 +52,10 @@ var _ = Describe("Dump", func() {
 				fake1.DumpReturns(errors.New("an error"))
 			})
 			It("does err", func() {
-				Expect(err).To(MatchError("an error"))
+				Expect(err).To(MatchError("1 of 2 dump components failed: component 0: an error"))
+			})
+			It("still dumps to the other client", func() {
+				Expect(fake2.DumpCallCount()).To(Equal(1))
 			})
 		})
 		When("it dumps", func() {
@@ -54,12 +66,189 @@ var _ = Describe("Dump", func() {
 				Expect(fake1.DumpCallCount()).To(Equal(1))
 				Expect(fake2.DumpCallCount()).To(Equal(1))
 			})
+			It("gives each client the whole scrape", func() {
+				_, r1, _ := fake1.DumpArgsForCall(0)
+				_, r2, _ := fake2.DumpArgsForCall(0)
+				Expect(ioutil.ReadAll(r1)).To(Equal([]byte("ahhhhh")))
+				Expect(ioutil.ReadAll(r2)).To(Equal([]byte("ahhhhh")))
+			})
+		})
+	})
+	Context("RoundRobinDump with a failure policy", func() {
+		var (
+			fakes      []*dumperfakes.FakeDumper
+			components []dumper.Component
+			policy     dumper.FailurePolicy
+			err        error
+		)
+		BeforeEach(func() {
+			fakes = []*dumperfakes.FakeDumper{{}, {}, {}}
+			components = []dumper.Component{
+				{Name: "s3", Dumper: fakes[0]},
+				{Name: "postgres", Dumper: fakes[1]},
+				{Name: "file", Dumper: fakes[2]},
+			}
+			policy = dumper.FailOnQuorum
+		})
+		JustBeforeEach(func() {
+			client := dumper.NewRoundRobinDumpClientWithPolicy(zap.NewNop(), policy, components...)
+			err = client.Dump(context.Background(), strings.NewReader("ahhhhh"), "some path")
+		})
+		When("a minority of components fail", func() {
+			BeforeEach(func() {
+				fakes[0].DumpReturns(errors.New("s3 is down"))
+			})
+			It("succeeds", func() {
+				Expect(err).To(BeNil())
+			})
+		})
+		When("a majority of components fail", func() {
+			BeforeEach(func() {
+				fakes[0].DumpReturns(errors.New("s3 is down"))
+				fakes[2].DumpReturns(errors.New("disk full"))
+			})
+			It("reports which components failed", func() {
+				Expect(err).To(MatchError("2 of 3 dump components failed: s3: s3 is down; file: disk full"))
+
+				var fanOutErr *dumper.FanOutError
+				Expect(errors.As(err, &fanOutErr)).To(BeTrue())
+				Expect(fanOutErr.Failed()).To(Equal([]string{"s3", "file"}))
+			})
+		})
+		When("the policy is ALL", func() {
+			BeforeEach(func() {
+				policy = dumper.FailOnAll
+				fakes[0].DumpReturns(errors.New("s3 is down"))
+				fakes[1].DumpReturns(errors.New("postgres is down"))
+			})
+			It("tolerates anything short of a total failure", func() {
+				Expect(err).To(BeNil())
+			})
+			When("every component fails", func() {
+				BeforeEach(func() {
+					fakes[2].DumpReturns(errors.New("disk full"))
+				})
+				It("fails", func() {
+					Expect(err).To(MatchError(ContainSubstring("3 of 3 dump components failed")))
+				})
+			})
+		})
+		When("a component is slow", func() {
+			var release chan struct{}
+			BeforeEach(func() {
+				release = make(chan struct{})
+				fakes[1].DumpStub = func(context.Context, io.Reader, string) error {
+					<-release
+					return nil
+				}
+				components[1].Timeout = 10 * time.Millisecond
+				policy = dumper.FailOnAny
+			})
+			AfterEach(func() {
+				close(release)
+			})
+			It("gives up on it after its timeout without holding up the others", func() {
+				Expect(err).To(MatchError("1 of 3 dump components failed: postgres: dump timed out after 10ms: context deadline exceeded"))
+				Expect(fakes[0].DumpCallCount()).To(Equal(1))
+				Expect(fakes[2].DumpCallCount()).To(Equal(1))
+			})
+		})
+	})
+	Context("CircuitBreakerDumper", func() {
+		var (
+			fake *dumperfakes.FakeDumper
+			cb   *circuitbreaker.CircuitBreaker
+			d    dumper.CircuitBreakerDumper
+		)
+		BeforeEach(func() {
+			fake = &dumperfakes.FakeDumper{}
+			cb = circuitbreaker.New(zap.NewNop(), time.Hour, 2)
+			d = dumper.NewCircuitBreakerDumper(fake, cb)
+		})
+		It("returns every failure of the sink", func() {
+			fake.DumpReturns(errors.New("table not found"))
+			Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(MatchError("table not found"))
+		})
+		When("the sink keeps failing", func() {
+			BeforeEach(func() {
+				fake.DumpReturns(errors.New("table not found"))
+				for i := 0; i < 2; i++ {
+					_ = d.Dump(context.Background(), strings.NewReader(""), "some path")
+				}
+			})
+			It("fails fast without calling it", func() {
+				Expect(d.Breaker().State()).To(Equal(circuitbreaker.Open))
+				Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(MatchError(circuitbreaker.ErrOpenCircuit))
+				Expect(fake.DumpCallCount()).To(Equal(2))
+			})
+		})
+		When("the sink is still failing once the breaker half opens", func() {
+			BeforeEach(func() {
+				cb = circuitbreaker.New(zap.NewNop(), 50*time.Millisecond, 2)
+				d = dumper.NewCircuitBreakerDumper(fake, cb)
+				fake.DumpReturns(errors.New("table not found"))
+				for i := 0; i < 2; i++ {
+					_ = d.Dump(context.Background(), strings.NewReader(""), "some path")
+				}
+				time.Sleep(60 * time.Millisecond)
+			})
+			It("opens the breaker again after one attempt", func() {
+				Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(HaveOccurred())
+				Expect(d.Breaker().State()).To(Equal(circuitbreaker.Open))
+				Expect(fake.DumpCallCount()).To(Equal(3))
+
+				Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(MatchError(circuitbreaker.ErrOpenCircuit))
+				Expect(fake.DumpCallCount()).To(Equal(3))
+			})
+		})
+		When("the sink has recovered once the breaker half opens", func() {
+			BeforeEach(func() {
+				cb = circuitbreaker.New(zap.NewNop(), 50*time.Millisecond, 2)
+				d = dumper.NewCircuitBreakerDumper(fake, cb)
+				fake.DumpReturns(errors.New("table not found"))
+				for i := 0; i < 2; i++ {
+					_ = d.Dump(context.Background(), strings.NewReader(""), "some path")
+				}
+				time.Sleep(60 * time.Millisecond)
+				fake.DumpReturns(nil)
+			})
+			It("closes the breaker after a full window", func() {
+				Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(Succeed())
+				Expect(d.Breaker().State()).To(Equal(circuitbreaker.HalfOpen))
+				Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(Succeed())
+				Expect(d.Breaker().State()).To(Equal(circuitbreaker.Closed))
+			})
+		})
+	})
+	Context("InstrumentedDumper", func() {
+		var (
+			fake *dumperfakes.FakeDumper
+			reg  *prometheus.Registry
+			d    dumper.InstrumentedDumper
+		)
+		BeforeEach(func() {
+			fake = &dumperfakes.FakeDumper{}
+			reg = prometheus.NewRegistry()
+			d = dumper.NewInstrumentedDumper(fake, "S3", metrics.New(reg))
+		})
+		It("passes the dump through and counts its failures by kind", func() {
+			_ = d.Dump(context.Background(), strings.NewReader(""), "some path")
+			fake.DumpReturns(errors.New("upload failed"))
+			Expect(d.Dump(context.Background(), strings.NewReader(""), "some path")).To(MatchError("upload failed"))
+			Expect(fake.DumpCallCount()).To(Equal(2))
+
+			Expect(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP scrapedumper_dump_errors_total Dumps that failed.
+# TYPE scrapedumper_dump_errors_total counter
+scrapedumper_dump_errors_total{kind="S3"} 1
+`), "scrapedumper_dump_errors_total")).To(Succeed())
 		})
 	})
 	Context("S3DumpHandler", func() {
 		var (
 			uploader *dumperfakes.FakeUploader
 			logger   *zap.Logger
+			opts     []dumper.FileOption
 			client   dumper.Dumper
 			r        io.Reader
 			err      error
@@ -67,13 +256,38 @@ var _ = Describe("Dump", func() {
 		BeforeEach(func() {
 			uploader = &dumperfakes.FakeUploader{}
 			logger = zap.NewNop()
+			opts = nil
 			r = strings.NewReader("ahhhhh")
 			err = nil
 		})
 		JustBeforeEach(func() {
-			client = dumper.NewS3DumpHandler(uploader, "bucket", logger)
+			client = dumper.NewS3DumpHandler(uploader, "bucket", logger, opts...)
 			err = client.Dump(context.Background(), r, "some path")
 		})
+		When("it compresses", func() {
+			var uploaded []byte
+			BeforeEach(func() {
+				opts = append(opts, dumper.WithCompression(dumper.Gzip))
+				uploader.UploadStub = func(inp *s3manager.UploadInput, _ ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+					var readErr error
+					uploaded, readErr = ioutil.ReadAll(inp.Body)
+					return nil, readErr
+				}
+			})
+			It("uploads the compressed scrape with a matching extension and encoding", func() {
+				Expect(err).To(BeNil())
+				inp, _ := uploader.UploadArgsForCall(0)
+				Expect(inp).To(PointTo(MatchFields(IgnoreExtras, Fields{
+					"Key":             PointTo(Equal("some path.gz")),
+					"ContentEncoding": PointTo(Equal("gzip")),
+					"ContentType":     PointTo(Equal("application/json")),
+				})))
+
+				zr, zErr := dumper.Gzip.NewReader(bytes.NewReader(uploaded))
+				Expect(zErr).To(BeNil())
+				Expect(ioutil.ReadAll(zr)).To(Equal([]byte("ahhhhh")))
+			})
+		})
 		When("it dumps", func() {
 			It("does not err", func() {
 				Expect(err).To(BeNil())
@@ -91,6 +305,7 @@ var _ = Describe("Dump", func() {
 		var (
 			fs     afero.Fs
 			logger *zap.Logger
+			opts   []dumper.FileOption
 			client dumper.Dumper
 			r      io.Reader
 			err    error
@@ -98,13 +313,34 @@ var _ = Describe("Dump", func() {
 		BeforeEach(func() {
 			fs = afero.NewMemMapFs()
 			logger = zap.NewNop()
+			opts = nil
 			r = strings.NewReader("ahhhhh")
 			err = nil
 		})
 		JustBeforeEach(func() {
-			client = dumper.NewLocalDumpHandler("path", logger, fs)
+			client = dumper.NewLocalDumpHandler("path", logger, fs, opts...)
 			err = client.Dump(context.Background(), r, "somepath")
 		})
+		When("it compresses", func() {
+			BeforeEach(func() {
+				opts = append(opts, dumper.WithCompression(dumper.Zstd))
+			})
+			It("writes the compressed scrape with a matching extension", func() {
+				Expect(err).To(BeNil())
+				f, openErr := fs.Open("path/somepath.zst")
+				Expect(openErr).To(BeNil())
+				defer f.Close()
+
+				zr, zErr := dumper.Zstd.NewReader(f)
+				Expect(zErr).To(BeNil())
+				Expect(ioutil.ReadAll(zr)).To(Equal([]byte("ahhhhh")))
+			})
+			It("doesn't repeat an extension the path already has", func() {
+				Expect(client.Dump(context.Background(), strings.NewReader("ahhhhh"), "otherpath.json.zst")).To(Succeed())
+				_, statErr := fs.Stat("path/otherpath.json.zst")
+				Expect(statErr).To(BeNil())
+			})
+		})
 		When("it dumps", func() {
 			It("does not err", func() {
 				Expect(err).To(BeNil())
@@ -228,5 +464,165 @@ var _ = Describe("Dump", func() {
 				Expect(d).To(Equal(martaapi.North))
 			})
 		})
+		When("the records use the API's spellings", func() {
+			BeforeEach(func() {
+				r = strings.NewReader(`[
+					{
+						"DIRECTION": "N",
+						"LINE": "GOLD",
+						"STATION": "GARNETT STATION",
+						"TRAIN_ID": "301"
+					},
+					{
+						"DIRECTION": "N",
+						"LINE": "GOLD",
+						"STATION": "DORAVILLE STATION",
+						"TRAIN_ID": "301"
+					},
+					{
+						"DIRECTION": "N",
+						"LINE": "GOLD",
+						"STATION": "LINDBERGH CENTER STATION",
+						"TRAIN_ID": "301"
+					}
+				]`)
+			})
+			It("classifies them against the taxonomy, but keeps the API's spellings", func() {
+				Expect(err).To(BeNil())
+				Expect(upserter.AddRecordToDatabaseCallCount()).To(Equal(3))
+
+				_, l, d, _, _, _ := upserter.AddRecordToDatabaseArgsForCall(0)
+				Expect(l).To(Equal(martaapi.Line("GOLD")))
+				Expect(d).To(Equal(martaapi.Direction("N")))
+			})
+		})
+		When("the API's spellings are corrected", func() {
+			BeforeEach(func() {
+				r = strings.NewReader(`[
+					{
+						"DIRECTION": "S",
+						"LINE": "RED",
+						"STATION": "GARNETT STATION",
+						"TRAIN_ID": "301"
+					},
+					{
+						"DIRECTION": "S",
+						"LINE": "RED",
+						"STATION": "DORAVILLE STATION",
+						"TRAIN_ID": "301"
+					},
+					{
+						"DIRECTION": "S",
+						"LINE": "RED",
+						"STATION": "LINDBERGH CENTER STATION",
+						"TRAIN_ID": "301"
+					}
+				]`)
+			})
+			It("spells the corrections as the API does", func() {
+				Expect(err).To(BeNil())
+				Expect(upserter.AddRecordToDatabaseCallCount()).To(Equal(3))
+
+				_, l, d, _, _, _ := upserter.AddRecordToDatabaseArgsForCall(0)
+				Expect(l).To(Equal(martaapi.Line("GOLD")))
+				Expect(d).To(Equal(martaapi.Direction("N")))
+			})
+		})
+	})
+	Context("PostgresDumpHandler with a batching upserter", func() {
+		type batchingUpserter struct {
+			*postgresfakes.FakeUpserter
+			*postgresfakes.FakeBatchUpserter
+		}
+
+		var (
+			dh       dumper.PostgresDumpHandler
+			upserter batchingUpserter
+			err      error
+		)
+		BeforeEach(func() {
+			upserter = batchingUpserter{&postgresfakes.FakeUpserter{}, &postgresfakes.FakeBatchUpserter{}}
+		})
+		JustBeforeEach(func() {
+			dh = dumper.NewPostgresDumpHandler(zap.NewNop(), upserter, nil)
+			err = dh.Dump(context.Background(), strings.NewReader(`[
+				{"DIRECTION": "N", "LINE": "GOLD", "STATION": "GARNETT STATION", "TRAIN_ID": "301"},
+				{"DIRECTION": "N", "LINE": "GOLD", "STATION": "DORAVILLE STATION", "TRAIN_ID": "301"}
+			]`), "somepath")
+		})
+		When("all goes well", func() {
+			It("upserts the whole snapshot at once", func() {
+				Expect(err).To(BeNil())
+				Expect(upserter.AddRecordToDatabaseCallCount()).To(Equal(0))
+				Expect(upserter.AddRecordsToDatabaseCallCount()).To(Equal(1))
+
+				recs := upserter.AddRecordsToDatabaseArgsForCall(0)
+				Expect(recs).To(HaveLen(2))
+				Expect(recs[0].Schedule.Station).To(Equal("GARNETT STATION"))
+				Expect(recs[1].Schedule.Station).To(Equal("DORAVILLE STATION"))
+				Expect(recs[0].CorrectedLine).To(Equal(martaapi.Line("GOLD")))
+				Expect(recs[0].CorrectedDir).To(Equal(martaapi.Direction("N")))
+			})
+		})
+		When("some records fail", func() {
+			BeforeEach(func() {
+				upserter.AddRecordsToDatabaseReturns(postgres.RecordErrors{errors.New("bad record")})
+			})
+			It("logs and moves on", func() {
+				Expect(err).To(BeNil())
+			})
+		})
+		When("the batch fails", func() {
+			BeforeEach(func() {
+				upserter.AddRecordsToDatabaseReturns(errors.New("transaction failed"))
+			})
+			It("fails", func() {
+				Expect(err).To(MatchError("transaction failed"))
+			})
+		})
+	})
+	Context("BusPostgresDumpHandler", func() {
+		var (
+			logger *zap.Logger
+			dh     dumper.BusPostgresDumpHandler
+			repo   *postgresfakes.FakeBusRepository
+			err    error
+			r      io.Reader
+		)
+		BeforeEach(func() {
+			logger = zap.NewNop()
+			repo = &postgresfakes.FakeBusRepository{}
+			r = strings.NewReader(martaapi.ValidBusJSON)
+			err = nil
+		})
+		JustBeforeEach(func() {
+			dh = dumper.NewBusPostgresDumpHandler(logger, repo)
+			err = dh.Dump(context.Background(), r, "somepath")
+		})
+		When("the JSON is invalid", func() {
+			BeforeEach(func() {
+				r = strings.NewReader("{")
+			})
+			It("fails", func() {
+				Expect(err).To(MatchError("unexpected EOF"))
+				Expect(repo.AddBusPositionCallCount()).To(Equal(0))
+			})
+		})
+		When("an insert fails", func() {
+			BeforeEach(func() {
+				repo.AddBusPositionReturnsOnCall(0, errors.New("insert failed"))
+			})
+			It("logs and moves on", func() {
+				Expect(err).To(BeNil())
+				Expect(repo.AddBusPositionCallCount()).To(Equal(2))
+			})
+		})
+		When("all goes well", func() {
+			It("succeeds", func() {
+				Expect(err).To(BeNil())
+				Expect(repo.AddBusPositionCallCount()).To(Equal(2))
+				Expect(repo.AddBusPositionArgsForCall(1)).To(Equal(martaapi.ValidBusExpectation[1]))
+			})
+		})
 	})
 })
@@ -0,0 +1,192 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package dumperfakes
+
+import (
+	"sync"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+)
+
+type FakeHashStore struct {
+	LastHashStub        func(string) (string, error)
+	lastHashMutex       sync.RWMutex
+	lastHashArgsForCall []struct {
+		arg1 string
+	}
+	lastHashReturns struct {
+		result1 string
+		result2 error
+	}
+	lastHashReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	SaveHashStub        func(string, string) error
+	saveHashMutex       sync.RWMutex
+	saveHashArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	saveHashReturns struct {
+		result1 error
+	}
+	saveHashReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeHashStore) LastHash(arg1 string) (string, error) {
+	fake.lastHashMutex.Lock()
+	ret, specificReturn := fake.lastHashReturnsOnCall[len(fake.lastHashArgsForCall)]
+	fake.lastHashArgsForCall = append(fake.lastHashArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.LastHashStub
+	fakeReturns := fake.lastHashReturns
+	fake.recordInvocation("LastHash", []interface{}{arg1})
+	fake.lastHashMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeHashStore) LastHashCallCount() int {
+	fake.lastHashMutex.RLock()
+	defer fake.lastHashMutex.RUnlock()
+	return len(fake.lastHashArgsForCall)
+}
+
+func (fake *FakeHashStore) LastHashCalls(stub func(string) (string, error)) {
+	fake.lastHashMutex.Lock()
+	defer fake.lastHashMutex.Unlock()
+	fake.LastHashStub = stub
+}
+
+func (fake *FakeHashStore) LastHashArgsForCall(i int) string {
+	fake.lastHashMutex.RLock()
+	defer fake.lastHashMutex.RUnlock()
+	argsForCall := fake.lastHashArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeHashStore) LastHashReturns(result1 string, result2 error) {
+	fake.lastHashMutex.Lock()
+	defer fake.lastHashMutex.Unlock()
+	fake.LastHashStub = nil
+	fake.lastHashReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHashStore) LastHashReturnsOnCall(i int, result1 string, result2 error) {
+	fake.lastHashMutex.Lock()
+	defer fake.lastHashMutex.Unlock()
+	fake.LastHashStub = nil
+	if fake.lastHashReturnsOnCall == nil {
+		fake.lastHashReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.lastHashReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHashStore) SaveHash(arg1 string, arg2 string) error {
+	fake.saveHashMutex.Lock()
+	ret, specificReturn := fake.saveHashReturnsOnCall[len(fake.saveHashArgsForCall)]
+	fake.saveHashArgsForCall = append(fake.saveHashArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.SaveHashStub
+	fakeReturns := fake.saveHashReturns
+	fake.recordInvocation("SaveHash", []interface{}{arg1, arg2})
+	fake.saveHashMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeHashStore) SaveHashCallCount() int {
+	fake.saveHashMutex.RLock()
+	defer fake.saveHashMutex.RUnlock()
+	return len(fake.saveHashArgsForCall)
+}
+
+func (fake *FakeHashStore) SaveHashCalls(stub func(string, string) error) {
+	fake.saveHashMutex.Lock()
+	defer fake.saveHashMutex.Unlock()
+	fake.SaveHashStub = stub
+}
+
+func (fake *FakeHashStore) SaveHashArgsForCall(i int) (string, string) {
+	fake.saveHashMutex.RLock()
+	defer fake.saveHashMutex.RUnlock()
+	argsForCall := fake.saveHashArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeHashStore) SaveHashReturns(result1 error) {
+	fake.saveHashMutex.Lock()
+	defer fake.saveHashMutex.Unlock()
+	fake.SaveHashStub = nil
+	fake.saveHashReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeHashStore) SaveHashReturnsOnCall(i int, result1 error) {
+	fake.saveHashMutex.Lock()
+	defer fake.saveHashMutex.Unlock()
+	fake.SaveHashStub = nil
+	if fake.saveHashReturnsOnCall == nil {
+		fake.saveHashReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.saveHashReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeHashStore) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.lastHashMutex.RLock()
+	defer fake.lastHashMutex.RUnlock()
+	fake.saveHashMutex.RLock()
+	defer fake.saveHashMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeHashStore) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ dumper.HashStore = new(FakeHashStore)
@@ -0,0 +1,317 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+)
+
+// spoolExtension marks a complete spool entry. Entries are written under another name and renamed into place, so
+// that a crash mid-write never leaves a truncated entry to be replayed.
+const spoolExtension = ".spool"
+
+// SpoolEntry is a failed dump waiting in a spool
+type SpoolEntry struct {
+	// Name identifies the entry within its spool. Entries sort by name in the order they were spooled.
+	Name   string    `json:"-"`
+	Path   string    `json:"path"`
+	Prefix string    `json:"prefix"`
+	Time   time.Time `json:"time"`
+	Size   int64     `json:"size"`
+}
+
+// Spool keeps failed dumps in a local directory, with the path they were dumped to, until they can be replayed.
+// Each entry is a file holding a JSON header line followed by the scrape.
+type Spool struct {
+	fs  afero.Fs
+	dir string
+	seq *int64
+	// replaying serializes replays, so that an entry is never dumped twice by the same process
+	replaying *sync.Mutex
+}
+
+// NewSpool instantiates a spool in the directory dir, which is created when the first entry is spooled
+func NewSpool(fs afero.Fs, dir string) Spool {
+	return Spool{
+		fs,
+		dir,
+		new(int64),
+		&sync.Mutex{},
+	}
+}
+
+// Dir is the directory that the spool keeps its entries in
+func (s Spool) Dir() string {
+	return s.dir
+}
+
+// Put adds a dump to the end of the spool
+func (s Spool) Put(info ScrapeInfo, path string, b []byte) (SpoolEntry, error) {
+	entry := SpoolEntry{
+		Name:   fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), atomic.AddInt64(s.seq, 1), spoolExtension),
+		Path:   path,
+		Prefix: info.Prefix,
+		Time:   info.Time,
+		Size:   int64(len(b)),
+	}
+
+	header, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+
+	if err := s.fs.MkdirAll(s.dir, 0755); err != nil {
+		return entry, errors.Wrapf(err, "failed to create spool directory `%s`", s.dir)
+	}
+	tmp := filepath.Join(s.dir, entry.Name+".tmp")
+	content := append(append(header, '\n'), b...)
+	if err := afero.WriteFile(s.fs, tmp, content, 0644); err != nil {
+		return entry, errors.Wrapf(err, "failed to write spool entry `%s`", tmp)
+	}
+	return entry, errors.Wrapf(s.fs.Rename(tmp, filepath.Join(s.dir, entry.Name)), "failed to move spool entry `%s` into place", entry.Name)
+}
+
+// List lists the entries in the spool, oldest first
+func (s Spool) List() ([]SpoolEntry, error) {
+	infos, err := afero.ReadDir(s.fs, s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read spool directory `%s`", s.dir)
+	}
+
+	var entries []SpoolEntry
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), spoolExtension) {
+			continue
+		}
+		entry, rc, err := s.Open(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		rc.Close()
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// Empty reports whether the spool has no entries, without reading any of them
+func (s Spool) Empty() (bool, error) {
+	infos, err := afero.ReadDir(s.fs, s.dir)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read spool directory `%s`", s.dir)
+	}
+
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), spoolExtension) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Open reads the header of the named entry, and opens the scrape that follows it
+func (s Spool) Open(name string) (SpoolEntry, io.ReadCloser, error) {
+	var entry SpoolEntry
+	f, err := s.fs.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return entry, nil, errors.Wrapf(err, "failed to open spool entry `%s`", name)
+	}
+
+	br := bufio.NewReader(f)
+	header, err := br.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(header, &entry)
+	}
+	if err != nil {
+		f.Close()
+		return entry, nil, errors.Wrapf(err, "failed to read header of spool entry `%s`", name)
+	}
+	entry.Name = name
+
+	return entry, struct {
+		io.Reader
+		io.Closer
+	}{br, f}, nil
+}
+
+// Remove deletes the named entry from the spool
+func (s Spool) Remove(name string) error {
+	return errors.Wrapf(s.fs.Remove(filepath.Join(s.dir, name)), "failed to remove spool entry `%s`", name)
+}
+
+// Replay dumps each entry to d in the order they were spooled, removing each one once it's been dumped. It stops at
+// the first failure, so that the entries after it stay in order, and returns how many entries were replayed.
+func (s Spool) Replay(ctx context.Context, d Dumper) (replayed int, err error) {
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+
+	entries, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+		if err := s.replay(ctx, d, entry.Name); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (s Spool) replay(ctx context.Context, d Dumper, name string) error {
+	entry, rc, err := s.Open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	ctx = WithScrapeInfo(ctx, ScrapeInfo{Prefix: entry.Prefix, Time: entry.Time})
+	if err := d.Dump(ctx, rc, entry.Path); err != nil {
+		return errors.Wrapf(err, "failed to replay spool entry `%s` to %s", name, entry.Path)
+	}
+	return s.Remove(name)
+}
+
+// SpoolDumper passes scrapes on to another dumper, and spools the ones it fails to dump so that they can be
+// replayed later instead of being lost
+type SpoolDumper struct {
+	logger *zap.Logger
+	dumper Dumper
+	spool  Spool
+}
+
+// NewSpoolDumper instantiates a new spool dumper
+func NewSpoolDumper(logger *zap.Logger, d Dumper, spool Spool) SpoolDumper {
+	return SpoolDumper{
+		logger,
+		d,
+		spool,
+	}
+}
+
+// Dump passes the scrape on. If that fails, the scrape is spooled instead, and only a failure to spool it is returned.
+// While older scrapes are still spooled, new ones are spooled behind them rather than passed on, so that the dumper
+// gets every scrape in order once the spool is replayed.
+func (c SpoolDumper) Dump(ctx context.Context, r io.Reader, path string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	empty, err := c.spool.Empty()
+	if err != nil {
+		c.logger.Warn("couldn't tell whether the spool is empty; passing the scrape on", zap.Error(err))
+		empty = true
+	}
+	if !empty {
+		entry, err := c.spool.Put(ScrapeInfoFrom(ctx, path), path, b)
+		if err != nil {
+			return errors.Wrap(err, "failed to spool dump behind the spooled ones")
+		}
+		c.logger.Debug("spool isn't empty, spooled for replay",
+			zap.String("path", path),
+			zap.String("entry", entry.Name),
+		)
+		return nil
+	}
+
+	dumpErr := c.dumper.Dump(ctx, bytes.NewReader(b), path)
+	if dumpErr == nil {
+		return nil
+	}
+
+	entry, err := c.spool.Put(ScrapeInfoFrom(ctx, path), path, b)
+	if err != nil {
+		return errors.Wrapf(dumpErr, "failed to spool failed dump (%s)", err.Error())
+	}
+	c.logger.Warn("dump failed, spooled for replay",
+		zap.String("path", path),
+		zap.String("entry", entry.Name),
+		zap.Error(dumpErr),
+	)
+	return nil
+}
+
+// SpoolReplayer replays a spool in the background
+type SpoolReplayer struct {
+	logger   *zap.Logger
+	spool    Spool
+	dumper   Dumper
+	interval time.Duration
+	backoff  retry.Policy
+}
+
+// NewSpoolReplayer instantiates a replayer that checks the spool every interval. After a failed replay it backs off
+// exponentially, waiting no longer than maxBackoff between attempts.
+func NewSpoolReplayer(logger *zap.Logger, spool Spool, d Dumper, interval, maxBackoff time.Duration) SpoolReplayer {
+	return SpoolReplayer{
+		logger,
+		spool,
+		d,
+		interval,
+		retry.Policy{
+			BaseDelay: interval,
+			MaxDelay:  maxBackoff,
+			Jitter:    0.2,
+		},
+	}
+}
+
+// Run replays the spool until ctx is done
+func (r SpoolReplayer) Run(ctx context.Context) {
+	failures := 0
+	for {
+		delay := r.interval
+		replayed, err := r.spool.Replay(ctx, r.dumper)
+		if replayed > 0 {
+			r.logger.Info(fmt.Sprintf("replayed %d spooled dumps from %s", replayed, r.spool.Dir()))
+		}
+		if err != nil && ctx.Err() == nil {
+			failures++
+			delay = r.backoff.Backoff(failures)
+			r.logger.Warn("failed to replay spool",
+				zap.String("dir", r.spool.Dir()),
+				zap.Duration("retry_in", delay),
+				zap.Error(err),
+			)
+		} else {
+			failures = 0
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package dumper_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+)
+
+var _ = Describe("Spool", func() {
+	var (
+		fs     afero.Fs
+		spool  dumper.Spool
+		fake   *dumperfakes.FakeDumper
+		dumped []string
+		infos  []dumper.ScrapeInfo
+	)
+
+	scrapedAt := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		fs = afero.NewMemMapFs()
+		spool = dumper.NewSpool(fs, "/var/spool/scrapedumper")
+		fake = &dumperfakes.FakeDumper{}
+		dumped = nil
+		infos = nil
+		fake.DumpStub = func(ctx context.Context, r io.Reader, path string) error {
+			b, err := ioutil.ReadAll(r)
+			dumped = append(dumped, path+": "+string(b))
+			infos = append(infos, dumper.ScrapeInfoFrom(ctx, path))
+			return err
+		}
+	})
+
+	put := func(path, body string) {
+		_, err := spool.Put(dumper.ScrapeInfo{Prefix: "train-data", Time: scrapedAt}, path, []byte(body))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	Context("Put and List", func() {
+		It("lists entries in the order they were spooled", func() {
+			put("train-data/1.json", `[1]`)
+			put("train-data/2.json", `[2]`)
+
+			entries, err := spool.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Path).To(Equal("train-data/1.json"))
+			Expect(entries[0].Prefix).To(Equal("train-data"))
+			Expect(entries[0].Time.Equal(scrapedAt)).To(BeTrue())
+			Expect(entries[0].Size).To(Equal(int64(3)))
+			Expect(entries[1].Path).To(Equal("train-data/2.json"))
+
+			_, rc, err := spool.Open(entries[1].Name)
+			Expect(err).NotTo(HaveOccurred())
+			defer rc.Close()
+			Expect(ioutil.ReadAll(rc)).To(Equal([]byte(`[2]`)))
+		})
+		It("ignores entries that were never moved into place", func() {
+			Expect(afero.WriteFile(fs, "/var/spool/scrapedumper/00000000000000000001-000001.spool.tmp", []byte("{"), 0644)).To(Succeed())
+			Expect(spool.List()).To(BeEmpty())
+		})
+		It("is empty before anything is spooled", func() {
+			Expect(spool.List()).To(BeEmpty())
+			Expect(spool.Empty()).To(BeTrue())
+		})
+		It("isn't empty once something is spooled", func() {
+			Expect(afero.WriteFile(fs, "/var/spool/scrapedumper/00000000000000000001-000001.spool.tmp", []byte("{"), 0644)).To(Succeed())
+			Expect(spool.Empty()).To(BeTrue())
+			put("train-data/1.json", `[1]`)
+			Expect(spool.Empty()).To(BeFalse())
+		})
+	})
+
+	Context("Replay", func() {
+		BeforeEach(func() {
+			put("train-data/1.json", `[1]`)
+			put("train-data/2.json", `[2]`)
+			put("train-data/3.json", `[3]`)
+		})
+
+		It("dumps every entry in order with its scrape info, and removes them", func() {
+			replayed, err := spool.Replay(context.Background(), fake)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replayed).To(Equal(3))
+			Expect(dumped).To(Equal([]string{
+				"train-data/1.json: [1]",
+				"train-data/2.json: [2]",
+				"train-data/3.json: [3]",
+			}))
+			Expect(infos[0].Prefix).To(Equal("train-data"))
+			Expect(infos[0].Time.Equal(scrapedAt)).To(BeTrue())
+			Expect(spool.List()).To(BeEmpty())
+		})
+
+		When("a dump fails", func() {
+			BeforeEach(func() {
+				stub := fake.DumpStub
+				fake.DumpStub = func(ctx context.Context, r io.Reader, path string) error {
+					if path == "train-data/2.json" {
+						return errors.New("connection refused")
+					}
+					return stub(ctx, r, path)
+				}
+			})
+			It("stops there, keeping the rest in order", func() {
+				replayed, err := spool.Replay(context.Background(), fake)
+				Expect(err).To(MatchError(ContainSubstring("to train-data/2.json: connection refused")))
+				Expect(replayed).To(Equal(1))
+				Expect(dumped).To(Equal([]string{"train-data/1.json: [1]"}))
+
+				entries, err := spool.List()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(HaveLen(2))
+				Expect(entries[0].Path).To(Equal("train-data/2.json"))
+				Expect(entries[1].Path).To(Equal("train-data/3.json"))
+			})
+		})
+	})
+
+	Context("SpoolDumper", func() {
+		var (
+			child *dumperfakes.FakeDumper
+			d     dumper.SpoolDumper
+			ctx   context.Context
+		)
+
+		BeforeEach(func() {
+			child = &dumperfakes.FakeDumper{}
+			d = dumper.NewSpoolDumper(zap.NewNop(), child, spool)
+			ctx = dumper.WithScrapeInfo(context.Background(), dumper.ScrapeInfo{Prefix: "train-data", Time: scrapedAt})
+		})
+
+		It("passes scrapes on without spooling them", func() {
+			Expect(d.Dump(ctx, strings.NewReader(`[1]`), "train-data/1.json")).To(Succeed())
+			Expect(child.DumpCallCount()).To(Equal(1))
+			Expect(spool.List()).To(BeEmpty())
+		})
+
+		When("the dump fails", func() {
+			BeforeEach(func() {
+				child.DumpReturns(errors.New("connection refused"))
+			})
+			It("spools the scrape instead", func() {
+				Expect(d.Dump(ctx, strings.NewReader(`[1]`), "train-data/1.json")).To(Succeed())
+
+				Expect(spool.Replay(context.Background(), fake)).To(Equal(1))
+				Expect(dumped).To(Equal([]string{"train-data/1.json: [1]"}))
+				Expect(infos[0].Time.Equal(scrapedAt)).To(BeTrue())
+			})
+			It("spools later scrapes behind it until it's replayed, keeping them in order", func() {
+				Expect(d.Dump(ctx, strings.NewReader(`[1]`), "train-data/1.json")).To(Succeed())
+				child.DumpReturns(nil)
+				Expect(d.Dump(ctx, strings.NewReader(`[2]`), "train-data/2.json")).To(Succeed())
+				Expect(child.DumpCallCount()).To(Equal(1))
+
+				Expect(spool.Replay(context.Background(), fake)).To(Equal(2))
+				Expect(dumped).To(Equal([]string{"train-data/1.json: [1]", "train-data/2.json: [2]"}))
+
+				Expect(d.Dump(ctx, strings.NewReader(`[3]`), "train-data/3.json")).To(Succeed())
+				Expect(child.DumpCallCount()).To(Equal(2))
+				Expect(spool.List()).To(BeEmpty())
+			})
+			When("the scrape can't be spooled either", func() {
+				BeforeEach(func() {
+					d = dumper.NewSpoolDumper(zap.NewNop(), child, dumper.NewSpool(afero.NewReadOnlyFs(fs), "/var/spool/scrapedumper"))
+				})
+				It("fails", func() {
+					err := d.Dump(ctx, strings.NewReader(`[1]`), "train-data/1.json")
+					Expect(err).To(MatchError(ContainSubstring("failed to spool failed dump")))
+					Expect(err).To(MatchError(ContainSubstring("connection refused")))
+				})
+			})
+		})
+	})
+
+	Context("SpoolReplayer", func() {
+		It("replays the spool until it's stopped", func() {
+			put("train-data/1.json", `[1]`)
+
+			ctx, stop := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				dumper.NewSpoolReplayer(zap.NewNop(), spool, fake, 10*time.Millisecond, time.Second).Run(ctx)
+			}()
+
+			Eventually(fake.DumpCallCount).Should(Equal(1))
+			put("train-data/2.json", `[2]`)
+			Eventually(fake.DumpCallCount).Should(Equal(2))
+
+			stop()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
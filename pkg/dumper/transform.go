@@ -0,0 +1,219 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/pathtemplate"
+)
+
+// ScrapeInfo describes the scrape that a dump came from
+type ScrapeInfo struct {
+	Prefix string
+	Time   time.Time
+}
+
+type scrapeInfoKey struct{}
+
+// WithScrapeInfo attaches a description of the scrape to the context of its dump
+func WithScrapeInfo(ctx context.Context, info ScrapeInfo) context.Context {
+	return context.WithValue(ctx, scrapeInfoKey{}, info)
+}
+
+// ScrapeInfoFrom describes the scrape that a dump came from. Dumps that weren't given a description, such as those
+// made by a bulk load, are described by the first directory in their path, if any, and the time in their path, or the
+// current time if their path doesn't have one.
+func ScrapeInfoFrom(ctx context.Context, path string) ScrapeInfo {
+	if info, ok := ctx.Value(scrapeInfoKey{}).(ScrapeInfo); ok {
+		return info
+	}
+	t, ok := pathtemplate.TimeFromPath(path)
+	if !ok {
+		t = time.Now().UTC()
+	}
+	var prefix string
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		prefix = path[:i]
+	}
+	return ScrapeInfo{
+		Prefix: prefix,
+		Time:   t,
+	}
+}
+
+// Format is a format that a TransformDumper converts scrapes into
+type Format string
+
+const (
+	// NDJSON writes each record on its own line, with the scrape's time and source added as `scraped_at` and `source`
+	NDJSON Format = "NDJSON"
+	// CSV writes train arrival records as CSV, with a header row and a column for each field of martaapi.Schedule
+	CSV Format = "CSV"
+)
+
+// Valid reports whether the format is supported
+func (f Format) Valid() bool {
+	return f == NDJSON || f == CSV
+}
+
+// Extension replaces `.json` at the end of a dump's path
+func (f Format) Extension() string {
+	switch f {
+	case NDJSON:
+		return ".ndjson"
+	case CSV:
+		return ".csv"
+	}
+	return ".json"
+}
+
+// scheduleColumns is the column order of the CSV format. It leaves out the keys that only the dynamo dumper uses.
+var scheduleColumns = []string{
+	"DESTINATION",
+	"DIRECTION",
+	"EVENT_TIME",
+	"LINE",
+	"NEXT_ARR",
+	"STATION",
+	"TRAIN_ID",
+	"WAITING_SECONDS",
+	"WAITING_TIME",
+}
+
+func scheduleRecord(s martaapi.Schedule) []string {
+	return []string{
+		s.Destination,
+		s.Direction,
+		s.EventTime,
+		s.Line,
+		s.NextArrival,
+		s.Station,
+		s.TrainID,
+		s.WaitingSeconds,
+		s.WaitingTime,
+	}
+}
+
+// TransformDumper converts the JSON array of a scrape into another format as it's streamed to another dumper
+type TransformDumper struct {
+	dumper Dumper
+	format Format
+}
+
+// NewTransformDumper instantiates a new transform dumper
+func NewTransformDumper(d Dumper, format Format) TransformDumper {
+	return TransformDumper{
+		d,
+		format,
+	}
+}
+
+// Dump converts the scrape and passes it on, with the path's `.json` extension replaced by the format's
+func (c TransformDumper) Dump(ctx context.Context, r io.Reader, path string) error {
+	info := ScrapeInfoFrom(ctx, path)
+
+	pr, pw := io.Pipe()
+	converted := make(chan error, 1)
+	go func() {
+		err := c.convert(pw, r, info)
+		pw.CloseWithError(err)
+		converted <- err
+	}()
+
+	err := c.dumper.Dump(ctx, pr, c.transformPath(path))
+	// unblock the conversion if the dumper gave up early
+	pr.Close()
+	if convErr := <-converted; convErr != nil && convErr != io.ErrClosedPipe {
+		return errors.Wrapf(convErr, "failed to convert scrape to %s", c.format)
+	}
+	return err
+}
+
+func (c TransformDumper) transformPath(path string) string {
+	compression := CompressionFromPath(path)
+	path = strings.TrimSuffix(path, compression.Extension())
+	return strings.TrimSuffix(path, ".json") + c.format.Extension() + compression.Extension()
+}
+
+func (c TransformDumper) convert(w io.Writer, r io.Reader, info ScrapeInfo) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return errors.New("scrape is not a JSON array")
+	}
+
+	switch c.format {
+	case NDJSON:
+		return convertNDJSON(w, dec, info)
+	case CSV:
+		return convertCSV(w, dec)
+	}
+	return errors.Errorf("unsupported format `%s`", c.format)
+}
+
+func convertNDJSON(w io.Writer, dec *json.Decoder, info ScrapeInfo) error {
+	fields, err := json.Marshal(struct {
+		ScrapedAt string `json:"scraped_at"`
+		Source    string `json:"source"`
+	}{info.Time.UTC().Format(time.RFC3339), info.Prefix})
+	if err != nil {
+		return err
+	}
+	// the added fields go first, and the record's own fields follow in their original order
+	fields = fields[:len(fields)-1]
+
+	var line bytes.Buffer
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		line.Reset()
+		if err := json.Compact(&line, raw); err != nil {
+			return err
+		}
+		record := line.Bytes()
+		if len(record) < 2 || record[0] != '{' {
+			return errors.New("scrape is not an array of objects")
+		}
+
+		out := append([]byte(nil), fields...)
+		if len(record) > 2 {
+			out = append(out, ',')
+		}
+		out = append(out, record[1:]...)
+		out = append(out, '\n')
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertCSV(w io.Writer, dec *json.Decoder) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(scheduleColumns); err != nil {
+		return err
+	}
+	for dec.More() {
+		var s martaapi.Schedule
+		if err := dec.Decode(&s); err != nil {
+			return err
+		}
+		if err := cw.Write(scheduleRecord(s)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
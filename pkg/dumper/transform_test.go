@@ -0,0 +1,163 @@
+package dumper_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+)
+
+var _ = Describe("TransformDumper", func() {
+	var (
+		fake   *dumperfakes.FakeDumper
+		format dumper.Format
+		ctx    context.Context
+		body   string
+		path   string
+
+		dumped  string
+		callErr error
+	)
+
+	BeforeEach(func() {
+		fake = &dumperfakes.FakeDumper{}
+		fake.DumpStub = func(_ context.Context, r io.Reader, _ string) error {
+			b, err := ioutil.ReadAll(r)
+			dumped = string(b)
+			return err
+		}
+		ctx = dumper.WithScrapeInfo(context.Background(), dumper.ScrapeInfo{
+			Prefix: "train-data",
+			Time:   time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC),
+		})
+		body = `[
+			{"DESTINATION": "Doraville", "TRAIN_ID": "324898", "WAITING_TIME": "Boarding"},
+			{"TRAIN_ID": "101", "STATION": "FIVE POINTS STATION", "EXTRA": {"a": [1, 2]}},
+			{}
+		]`
+		path = "train-data/2020-03-01T12:00:00Z.json"
+		dumped = ""
+	})
+
+	JustBeforeEach(func() {
+		callErr = dumper.NewTransformDumper(fake, format).Dump(ctx, strings.NewReader(body), path)
+	})
+
+	When("the format is NDJSON", func() {
+		BeforeEach(func() {
+			format = dumper.NDJSON
+		})
+
+		It("writes each record on its own line, with the scrape's time and source", func() {
+			Expect(callErr).To(BeNil())
+			Expect(dumped).To(Equal(
+				`{"scraped_at":"2020-03-01T12:00:00Z","source":"train-data","DESTINATION":"Doraville","TRAIN_ID":"324898","WAITING_TIME":"Boarding"}` + "\n" +
+					`{"scraped_at":"2020-03-01T12:00:00Z","source":"train-data","TRAIN_ID":"101","STATION":"FIVE POINTS STATION","EXTRA":{"a":[1,2]}}` + "\n" +
+					`{"scraped_at":"2020-03-01T12:00:00Z","source":"train-data"}` + "\n",
+			))
+		})
+
+		It("fixes the extension", func() {
+			_, _, p := fake.DumpArgsForCall(0)
+			Expect(p).To(Equal("train-data/2020-03-01T12:00:00Z.ndjson"))
+		})
+
+		When("the path has a compression extension", func() {
+			BeforeEach(func() {
+				path = "train-data/2020-03-01T12:00:00Z.json.gz"
+			})
+			It("keeps it last", func() {
+				_, _, p := fake.DumpArgsForCall(0)
+				Expect(p).To(Equal("train-data/2020-03-01T12:00:00Z.ndjson.gz"))
+			})
+		})
+
+		When("the scrape isn't described by the context", func() {
+			BeforeEach(func() {
+				ctx = context.Background()
+			})
+			It("takes the source and time from the path", func() {
+				Expect(callErr).To(BeNil())
+				Expect(dumped).To(HavePrefix(`{"scraped_at":"2020-03-01T12:00:00Z","source":"train-data","DESTINATION"`))
+			})
+			When("the path has no time", func() {
+				BeforeEach(func() {
+					path = "train-data/4f53cda1.json"
+				})
+				It("uses the current time", func() {
+					Expect(callErr).To(BeNil())
+					var record struct {
+						ScrapedAt time.Time `json:"scraped_at"`
+					}
+					Expect(json.Unmarshal([]byte(strings.SplitN(dumped, "\n", 2)[0]), &record)).To(Succeed())
+					Expect(record.ScrapedAt).To(BeTemporally("~", time.Now(), time.Minute))
+				})
+			})
+			When("the path has no directory", func() {
+				BeforeEach(func() {
+					path = "2020-03-01T12:00:00Z.json"
+				})
+				It("leaves the source empty", func() {
+					Expect(callErr).To(BeNil())
+					Expect(dumped).To(HavePrefix(`{"scraped_at":"2020-03-01T12:00:00Z","source":"","DESTINATION"`))
+				})
+			})
+		})
+
+		When("the scrape isn't an array of objects", func() {
+			BeforeEach(func() {
+				body = `[1, 2]`
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to convert scrape to NDJSON: scrape is not an array of objects")))
+			})
+		})
+	})
+
+	When("the format is CSV", func() {
+		BeforeEach(func() {
+			format = dumper.CSV
+		})
+
+		It("writes the train arrival columns in a fixed order", func() {
+			Expect(callErr).To(BeNil())
+			Expect(dumped).To(Equal(
+				"DESTINATION,DIRECTION,EVENT_TIME,LINE,NEXT_ARR,STATION,TRAIN_ID,WAITING_SECONDS,WAITING_TIME\n" +
+					"Doraville,,,,,,324898,,Boarding\n" +
+					",,,,,FIVE POINTS STATION,101,,\n" +
+					",,,,,,,,\n",
+			))
+			_, _, p := fake.DumpArgsForCall(0)
+			Expect(p).To(Equal("train-data/2020-03-01T12:00:00Z.csv"))
+		})
+
+		When("the scrape isn't a JSON array", func() {
+			BeforeEach(func() {
+				body = `{"error": "unauthorized"}`
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(ContainSubstring("failed to convert scrape to CSV: scrape is not a JSON array")))
+			})
+		})
+	})
+
+	When("the dumper fails", func() {
+		BeforeEach(func() {
+			format = dumper.NDJSON
+			fake.DumpStub = nil
+			fake.DumpReturns(errors.New("upload failed"))
+		})
+		It("returns its error, even though it didn't read the conversion", func() {
+			Expect(callErr).To(MatchError("upload failed"))
+		})
+	})
+})
@@ -0,0 +1,144 @@
+package gtfsrt
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+)
+
+//BuildTripUpdates builds a TripUpdates feed from the given runs. Each unfinished
+//run becomes one entity, with a stop time update for every station the train
+//hasn't reached yet, using that station's latest estimate.
+func BuildTripUpdates(runs map[string]postgres.Run, now time.Time) FeedMessage {
+	feed := FeedMessage{
+		Header: FeedHeader{
+			GTFSRealtimeVersion: Version,
+			Timestamp:           uint64(now.Unix()),
+		},
+		Entities: []FeedEntity{},
+	}
+
+	for _, run := range runs {
+		if run.Finished() {
+			continue
+		}
+
+		update, ok := buildTripUpdate(run)
+		if !ok {
+			continue
+		}
+
+		feed.Entities = append(feed.Entities, FeedEntity{
+			ID:         run.Identifier,
+			TripUpdate: &update,
+		})
+	}
+
+	//map iteration is random, but consumers diffing successive feeds will
+	//appreciate a stable order
+	sort.Slice(feed.Entities, func(i, j int) bool {
+		return feed.Entities[i].ID < feed.Entities[j].ID
+	})
+
+	return feed
+}
+
+func buildTripUpdate(run postgres.Run) (update TripUpdate, ok bool) {
+	line := run.CorrectedLine
+	if l, found := martaapi.LineFromAPIName(string(line)); found {
+		line = l
+	}
+	dir := run.CorrectedDirection
+	if d, found := martaapi.DirectionFromAPIName(string(dir)); found {
+		dir = d
+	}
+	order := stationOrder(line, dir)
+
+	for _, arrival := range run.Arrivals {
+		if arrival.ArrivalTime != nil {
+			continue
+		}
+
+		estimate, found := latestEstimate(arrival.Estimates)
+		if !found {
+			continue
+		}
+
+		stopID := string(arrival.Station)
+		if station, found := martaapi.StationFromAPIName(stopID); found {
+			stopID = string(station)
+		}
+
+		update.StopTimeUpdates = append(update.StopTimeUpdates, StopTimeUpdate{
+			StopSequence: order[martaapi.Station(stopID)],
+			StopID:       stopID,
+			Arrival:      &StopTimeEvent{Time: time.Time(estimate).Unix()},
+		})
+	}
+	if len(update.StopTimeUpdates) == 0 {
+		return
+	}
+
+	//stations we can't place on the line have no sequence and go last
+	sort.Slice(update.StopTimeUpdates, func(i, j int) bool {
+		a, b := update.StopTimeUpdates[i], update.StopTimeUpdates[j]
+		if (a.StopSequence == 0) != (b.StopSequence == 0) {
+			return b.StopSequence == 0
+		}
+		if a.StopSequence != b.StopSequence {
+			return a.StopSequence < b.StopSequence
+		}
+		return a.StopID < b.StopID
+	})
+
+	update.Trip = TripDescriptor{
+		TripID:               run.Identifier,
+		RouteID:              string(line),
+		ScheduleRelationship: Added,
+	}
+	for i, d := range martaapi.LineDirections[line] {
+		if d == dir {
+			directionID := uint32(i)
+			update.Trip.DirectionID = &directionID
+		}
+	}
+	if start, err := postgres.ParseEasternTime(run.RunFirstEventMoment); err == nil {
+		update.Trip.StartDate = time.Time(start).In(postgres.EasternTimeZone).Format("20060102")
+	}
+	if latest, err := postgres.ParseEasternTime(run.MostRecentEventMoment); err == nil {
+		update.Timestamp = uint64(time.Time(latest).Unix())
+	}
+
+	if strings.Count(run.RunGroupIdentifier, "_") >= 2 {
+		_, _, trainID := postgres.ParseRunGroupIdentifier(run.RunGroupIdentifier)
+		update.Vehicle = &VehicleDescriptor{ID: trainID, Label: trainID}
+	}
+
+	ok = true
+	return
+}
+
+//stationOrder numbers the stations of a line from 1, in the order that a
+//train travelling in the given direction reaches them
+func stationOrder(line martaapi.Line, dir martaapi.Direction) map[martaapi.Station]uint32 {
+	order := map[martaapi.Station]uint32{}
+	for i, station := range martaapi.StationsInDirection(line, dir) {
+		order[station] = uint32(i + 1)
+	}
+	return order
+}
+
+func latestEstimate(estimates postgres.EstimateList) (estimate postgres.EasternTime, ok bool) {
+	var latestMoment time.Time
+	for moment, est := range estimates {
+		if !ok || time.Time(moment).After(latestMoment) {
+			latestMoment = time.Time(moment)
+			estimate = est
+			ok = true
+		}
+	}
+	return
+}
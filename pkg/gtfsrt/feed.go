@@ -0,0 +1,159 @@
+package gtfsrt
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+//Version is the GTFS-Realtime specification version of the feeds built here
+const Version = "2.0"
+
+//ScheduleRelationship is the relationship between a trip and the static schedule
+type ScheduleRelationship int32
+
+const (
+	//Scheduled trips run in accordance with their GTFS schedule
+	Scheduled ScheduleRelationship = 0
+	//Added trips are not in the static schedule. Every run we observe is one
+	//of these, since the run tables aren't linked to a GTFS schedule.
+	Added ScheduleRelationship = 1
+)
+
+//FeedMessage is the root of a GTFS-Realtime feed. The types in this file mirror
+//the subset of gtfs-realtime.proto that a TripUpdates feed uses.
+type FeedMessage struct {
+	Header   FeedHeader   `json:"header"`
+	Entities []FeedEntity `json:"entity"`
+}
+
+//FeedHeader holds metadata about a feed
+type FeedHeader struct {
+	GTFSRealtimeVersion string `json:"gtfs_realtime_version"`
+	Timestamp           uint64 `json:"timestamp"`
+}
+
+//FeedEntity is one entity of the feed, which in our case is always a TripUpdate
+type FeedEntity struct {
+	ID         string      `json:"id"`
+	TripUpdate *TripUpdate `json:"trip_update,omitempty"`
+}
+
+//TripUpdate describes the predicted progress of a single vehicle along a trip
+type TripUpdate struct {
+	Trip            TripDescriptor     `json:"trip"`
+	Vehicle         *VehicleDescriptor `json:"vehicle,omitempty"`
+	StopTimeUpdates []StopTimeUpdate   `json:"stop_time_update"`
+	Timestamp       uint64             `json:"timestamp,omitempty"`
+}
+
+//TripDescriptor identifies a trip
+type TripDescriptor struct {
+	TripID               string               `json:"trip_id,omitempty"`
+	RouteID              string               `json:"route_id,omitempty"`
+	DirectionID          *uint32              `json:"direction_id,omitempty"`
+	StartDate            string               `json:"start_date,omitempty"`
+	ScheduleRelationship ScheduleRelationship `json:"schedule_relationship"`
+}
+
+//VehicleDescriptor identifies the vehicle serving a trip
+type VehicleDescriptor struct {
+	ID    string `json:"id,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+//StopTimeUpdate is the prediction for a single stop of a trip
+type StopTimeUpdate struct {
+	StopSequence uint32         `json:"stop_sequence,omitempty"`
+	StopID       string         `json:"stop_id,omitempty"`
+	Arrival      *StopTimeEvent `json:"arrival,omitempty"`
+}
+
+//StopTimeEvent is a predicted moment
+type StopTimeEvent struct {
+	Time int64 `json:"time"`
+}
+
+//Marshal encodes the feed in the protobuf wire format described by gtfs-realtime.proto
+func (m FeedMessage) Marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, m.Header.marshal())
+	for _, e := range m.Entities {
+		b = appendMessage(b, 2, e.marshal())
+	}
+	return b
+}
+
+func (h FeedHeader) marshal() (b []byte) {
+	b = appendString(b, 1, h.GTFSRealtimeVersion)
+	return appendVarint(b, 3, h.Timestamp)
+}
+
+func (e FeedEntity) marshal() (b []byte) {
+	b = appendString(b, 1, e.ID)
+	if e.TripUpdate != nil {
+		b = appendMessage(b, 3, e.TripUpdate.marshal())
+	}
+	return
+}
+
+func (u TripUpdate) marshal() (b []byte) {
+	b = appendMessage(b, 1, u.Trip.marshal())
+	for _, stu := range u.StopTimeUpdates {
+		b = appendMessage(b, 2, stu.marshal())
+	}
+	if u.Vehicle != nil {
+		b = appendMessage(b, 3, u.Vehicle.marshal())
+	}
+	return appendVarint(b, 4, u.Timestamp)
+}
+
+func (t TripDescriptor) marshal() (b []byte) {
+	b = appendString(b, 1, t.TripID)
+	b = appendString(b, 3, t.StartDate)
+	b = appendVarint(b, 4, uint64(t.ScheduleRelationship))
+	b = appendString(b, 5, t.RouteID)
+	if t.DirectionID != nil {
+		//optional fields that are set are always written, even when zero
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*t.DirectionID))
+	}
+	return
+}
+
+func (v VehicleDescriptor) marshal() (b []byte) {
+	b = appendString(b, 1, v.ID)
+	return appendString(b, 2, v.Label)
+}
+
+func (s StopTimeUpdate) marshal() (b []byte) {
+	b = appendVarint(b, 1, uint64(s.StopSequence))
+	if s.Arrival != nil {
+		b = appendMessage(b, 2, s.Arrival.marshal())
+	}
+	return appendString(b, 4, s.StopID)
+}
+
+func (e StopTimeEvent) marshal() []byte {
+	//time is an int64, which protobuf encodes as a two's complement varint
+	return appendVarint(nil, 2, uint64(e.Time))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,13 @@
+package gtfsrt_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestGtfsrt(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Gtfsrt Suite")
+}
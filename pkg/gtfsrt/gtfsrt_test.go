@@ -0,0 +1,223 @@
+package gtfsrt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/smartatransit/scrapedumper/pkg/gtfsrt"
+	"github.com/smartatransit/scrapedumper/pkg/gtfsrt/gtfsrtfakes"
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func eastern(hour, min int) postgres.EasternTime {
+	return postgres.EasternTime(time.Date(2020, time.January, 20, hour, min, 0, 0, postgres.EasternTimeZone))
+}
+
+func estimatedAt(hour, min int) *postgres.EasternTime {
+	t := eastern(hour, min)
+	return &t
+}
+
+var _ = Describe("Gtfsrt", func() {
+	var (
+		runs map[string]postgres.Run
+		now  time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Time(eastern(10, 5))
+		runs = map[string]postgres.Run{
+			"N_GOLD_301_2020-01-20T10:00:00-05:00": {
+				Identifier:            "N_GOLD_301_2020-01-20T10:00:00-05:00",
+				RunGroupIdentifier:    "N_GOLD_301",
+				CorrectedLine:         martaapi.Gold,
+				CorrectedDirection:    martaapi.North,
+				RunFirstEventMoment:   "2020-01-20T10:00:00-05:00",
+				MostRecentEventMoment: "2020-01-20T10:04:00-05:00",
+				Arrivals: postgres.Arrivals{
+					"PEACHTREE CENTER STATION": {
+						Station: "PEACHTREE CENTER STATION",
+						Estimates: postgres.EstimateList{
+							eastern(10, 0): eastern(10, 9),
+							eastern(10, 4): eastern(10, 10),
+						},
+					},
+					"FIVE POINTS STATION": {
+						Station:   "FIVE POINTS STATION",
+						Estimates: postgres.EstimateList{eastern(10, 4): eastern(10, 7)},
+					},
+					"GARNETT STATION": {
+						Station:     "GARNETT STATION",
+						ArrivalTime: estimatedAt(10, 3),
+						Estimates:   postgres.EstimateList{eastern(10, 0): eastern(10, 3)},
+					},
+				},
+			},
+			"W_BLUE_102_2020-01-20T09:00:00-05:00": {
+				Identifier:         "W_BLUE_102_2020-01-20T09:00:00-05:00",
+				RunGroupIdentifier: "W_BLUE_102",
+				CorrectedLine:      martaapi.Blue,
+				CorrectedDirection: martaapi.West,
+				Arrivals: postgres.Arrivals{
+					"ASHBY STATION": {
+						Station:     "ASHBY STATION",
+						ArrivalTime: estimatedAt(9, 30),
+						Estimates:   postgres.EstimateList{eastern(9, 0): eastern(9, 30)},
+					},
+				},
+			},
+		}
+	})
+
+	Describe("BuildTripUpdates", func() {
+		var feed gtfsrt.FeedMessage
+
+		JustBeforeEach(func() {
+			feed = gtfsrt.BuildTripUpdates(runs, now)
+		})
+
+		It("builds an entity per unfinished run from the latest estimates", func() {
+			Expect(feed.Header).To(Equal(gtfsrt.FeedHeader{
+				GTFSRealtimeVersion: "2.0",
+				Timestamp:           uint64(now.Unix()),
+			}))
+
+			zero := uint32(0)
+			Expect(feed.Entities).To(Equal([]gtfsrt.FeedEntity{{
+				ID: "N_GOLD_301_2020-01-20T10:00:00-05:00",
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: gtfsrt.TripDescriptor{
+						TripID:               "N_GOLD_301_2020-01-20T10:00:00-05:00",
+						RouteID:              "Gold",
+						DirectionID:          &zero,
+						StartDate:            "20200120",
+						ScheduleRelationship: gtfsrt.Added,
+					},
+					Vehicle: &gtfsrt.VehicleDescriptor{ID: "301", Label: "301"},
+					StopTimeUpdates: []gtfsrt.StopTimeUpdate{
+						{
+							StopSequence: 8,
+							StopID:       "Five Points",
+							Arrival:      &gtfsrt.StopTimeEvent{Time: time.Time(eastern(10, 7)).Unix()},
+						},
+						{
+							StopSequence: 9,
+							StopID:       "Peachtree Center",
+							Arrival:      &gtfsrt.StopTimeEvent{Time: time.Time(eastern(10, 10)).Unix()},
+						},
+					},
+					Timestamp: uint64(time.Time(eastern(10, 4)).Unix()),
+				},
+			}}))
+		})
+
+		When("the run is heading in its line's second direction", func() {
+			BeforeEach(func() {
+				run := runs["N_GOLD_301_2020-01-20T10:00:00-05:00"]
+				run.CorrectedDirection = martaapi.South
+				runs["N_GOLD_301_2020-01-20T10:00:00-05:00"] = run
+			})
+			It("numbers the stations in reverse", func() {
+				updates := feed.Entities[0].TripUpdate.StopTimeUpdates
+				Expect(updates[0].StopID).To(Equal("Peachtree Center"))
+				Expect(updates[0].StopSequence).To(Equal(uint32(10)))
+				Expect(updates[1].StopID).To(Equal("Five Points"))
+				Expect(*feed.Entities[0].TripUpdate.Trip.DirectionID).To(Equal(uint32(1)))
+			})
+		})
+	})
+
+	Describe("Marshal", func() {
+		It("encodes the feed in the protobuf wire format", func() {
+			feed := gtfsrt.BuildTripUpdates(runs, now)
+			b := feed.Marshal()
+
+			num, typ, n := protowire.ConsumeTag(b)
+			Expect(num).To(Equal(protowire.Number(1)))
+			Expect(typ).To(Equal(protowire.BytesType))
+			header, m := protowire.ConsumeBytes(b[n:])
+			Expect(m).To(BeNumerically(">", 0))
+
+			num, _, n = protowire.ConsumeTag(header)
+			Expect(num).To(Equal(protowire.Number(1)))
+			version, _ := protowire.ConsumeString(header[n:])
+			Expect(version).To(Equal("2.0"))
+
+			b = b[n+m:]
+			num, typ, n = protowire.ConsumeTag(b)
+			Expect(num).To(Equal(protowire.Number(2)))
+			Expect(typ).To(Equal(protowire.BytesType))
+			entity, m := protowire.ConsumeBytes(b[n:])
+			Expect(n + m).To(Equal(len(b)))
+
+			_, _, n = protowire.ConsumeTag(entity)
+			id, _ := protowire.ConsumeString(entity[n:])
+			Expect(id).To(Equal("N_GOLD_301_2020-01-20T10:00:00-05:00"))
+		})
+	})
+
+	Describe("Handler", func() {
+		var (
+			source  *gtfsrtfakes.FakeRunSource
+			handler *gtfsrt.Handler
+			mux     *http.ServeMux
+			rec     *httptest.ResponseRecorder
+			path    string
+		)
+
+		BeforeEach(func() {
+			source = &gtfsrtfakes.FakeRunSource{}
+			source.GetRecentlyActiveRunsReturns(runs, nil)
+			path = "/gtfs-rt/trip-updates"
+		})
+
+		JustBeforeEach(func() {
+			handler = gtfsrt.NewHandler(zap.NewNop(), source, 10*time.Minute)
+			handler.Now = func() time.Time { return now }
+			mux = http.NewServeMux()
+			handler.Register(mux)
+
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		})
+
+		When("the runs can't be loaded", func() {
+			BeforeEach(func() {
+				source.GetRecentlyActiveRunsReturns(nil, errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+			})
+		})
+		It("serves protobuf, looking back over the window", func() {
+			Expect(source.GetRecentlyActiveRunsCallCount()).To(Equal(1))
+			Expect(time.Time(source.GetRecentlyActiveRunsArgsForCall(0))).To(BeTemporally("==", now.Add(-10*time.Minute)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get("Content-Type")).To(Equal("application/x-protobuf"))
+			Expect(rec.Body.Bytes()).To(Equal(gtfsrt.BuildTripUpdates(runs, now).Marshal()))
+		})
+		When("JSON is requested", func() {
+			BeforeEach(func() {
+				path = "/gtfs-rt/trip-updates.json"
+			})
+			It("serves JSON", func() {
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+				var feed gtfsrt.FeedMessage
+				Expect(json.Unmarshal(rec.Body.Bytes(), &feed)).To(Succeed())
+				Expect(feed).To(Equal(gtfsrt.BuildTripUpdates(runs, now)))
+			})
+		})
+	})
+})
@@ -0,0 +1,117 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package gtfsrtfakes
+
+import (
+	"sync"
+
+	"github.com/smartatransit/scrapedumper/pkg/gtfsrt"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+)
+
+type FakeRunSource struct {
+	GetRecentlyActiveRunsStub        func(postgres.EasternTime) (map[string]postgres.Run, error)
+	getRecentlyActiveRunsMutex       sync.RWMutex
+	getRecentlyActiveRunsArgsForCall []struct {
+		arg1 postgres.EasternTime
+	}
+	getRecentlyActiveRunsReturns struct {
+		result1 map[string]postgres.Run
+		result2 error
+	}
+	getRecentlyActiveRunsReturnsOnCall map[int]struct {
+		result1 map[string]postgres.Run
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeRunSource) GetRecentlyActiveRuns(arg1 postgres.EasternTime) (map[string]postgres.Run, error) {
+	fake.getRecentlyActiveRunsMutex.Lock()
+	ret, specificReturn := fake.getRecentlyActiveRunsReturnsOnCall[len(fake.getRecentlyActiveRunsArgsForCall)]
+	fake.getRecentlyActiveRunsArgsForCall = append(fake.getRecentlyActiveRunsArgsForCall, struct {
+		arg1 postgres.EasternTime
+	}{arg1})
+	stub := fake.GetRecentlyActiveRunsStub
+	fakeReturns := fake.getRecentlyActiveRunsReturns
+	fake.recordInvocation("GetRecentlyActiveRuns", []interface{}{arg1})
+	fake.getRecentlyActiveRunsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRunSource) GetRecentlyActiveRunsCallCount() int {
+	fake.getRecentlyActiveRunsMutex.RLock()
+	defer fake.getRecentlyActiveRunsMutex.RUnlock()
+	return len(fake.getRecentlyActiveRunsArgsForCall)
+}
+
+func (fake *FakeRunSource) GetRecentlyActiveRunsCalls(stub func(postgres.EasternTime) (map[string]postgres.Run, error)) {
+	fake.getRecentlyActiveRunsMutex.Lock()
+	defer fake.getRecentlyActiveRunsMutex.Unlock()
+	fake.GetRecentlyActiveRunsStub = stub
+}
+
+func (fake *FakeRunSource) GetRecentlyActiveRunsArgsForCall(i int) postgres.EasternTime {
+	fake.getRecentlyActiveRunsMutex.RLock()
+	defer fake.getRecentlyActiveRunsMutex.RUnlock()
+	argsForCall := fake.getRecentlyActiveRunsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRunSource) GetRecentlyActiveRunsReturns(result1 map[string]postgres.Run, result2 error) {
+	fake.getRecentlyActiveRunsMutex.Lock()
+	defer fake.getRecentlyActiveRunsMutex.Unlock()
+	fake.GetRecentlyActiveRunsStub = nil
+	fake.getRecentlyActiveRunsReturns = struct {
+		result1 map[string]postgres.Run
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRunSource) GetRecentlyActiveRunsReturnsOnCall(i int, result1 map[string]postgres.Run, result2 error) {
+	fake.getRecentlyActiveRunsMutex.Lock()
+	defer fake.getRecentlyActiveRunsMutex.Unlock()
+	fake.GetRecentlyActiveRunsStub = nil
+	if fake.getRecentlyActiveRunsReturnsOnCall == nil {
+		fake.getRecentlyActiveRunsReturnsOnCall = make(map[int]struct {
+			result1 map[string]postgres.Run
+			result2 error
+		})
+	}
+	fake.getRecentlyActiveRunsReturnsOnCall[i] = struct {
+		result1 map[string]postgres.Run
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRunSource) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.getRecentlyActiveRunsMutex.RLock()
+	defer fake.getRecentlyActiveRunsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeRunSource) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ gtfsrt.RunSource = new(FakeRunSource)
@@ -0,0 +1,82 @@
+package gtfsrt
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+)
+
+//RunSource provides the runs that a feed is built from. It's satisfied by
+//postgres.Repository.
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . RunSource
+type RunSource interface {
+	GetRecentlyActiveRuns(touchThreshold postgres.EasternTime) (runs map[string]postgres.Run, err error)
+}
+
+//TripUpdatesPath is where the protobuf feed is served, and the debug JSON
+//feed is served at the same path with a `.json` suffix
+const TripUpdatesPath = "/gtfs-rt/trip-updates"
+
+//NewHandler creates a Handler that serves runs that have been active within window
+func NewHandler(logger *zap.Logger, source RunSource, window time.Duration) *Handler {
+	return &Handler{
+		Logger: logger,
+		Source: source,
+		Window: window,
+		Now:    time.Now,
+	}
+}
+
+//Handler serves TripUpdates feeds over HTTP
+type Handler struct {
+	Logger *zap.Logger
+	Source RunSource
+	Window time.Duration
+	Now    func() time.Time
+}
+
+//Register adds the feed endpoints to a ServeMux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc(TripUpdatesPath, h.ServeProtobuf)
+	mux.HandleFunc(TripUpdatesPath+".json", h.ServeJSON)
+}
+
+//ServeProtobuf serves the feed in the protobuf wire format
+func (h *Handler) ServeProtobuf(w http.ResponseWriter, r *http.Request) {
+	feed, ok := h.buildFeed(w)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(feed.Marshal())
+}
+
+//ServeJSON serves the feed as JSON, for debugging
+func (h *Handler) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	feed, ok := h.buildFeed(w)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(feed); err != nil {
+		h.Logger.Error("failed to encode trip updates feed", zap.Error(err))
+	}
+}
+
+func (h *Handler) buildFeed(w http.ResponseWriter) (feed FeedMessage, ok bool) {
+	now := h.Now()
+	runs, err := h.Source.GetRecentlyActiveRuns(postgres.EasternTime(now.Add(-h.Window)))
+	if err != nil {
+		h.Logger.Error("failed to get recently active runs", zap.Error(err))
+		http.Error(w, "failed to get recently active runs", http.StatusInternalServerError)
+		return
+	}
+
+	return BuildTripUpdates(runs, now), true
+}
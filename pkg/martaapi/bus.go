@@ -0,0 +1,71 @@
+package martaapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//BusPosition is a single vehicle report from the MARTA bus API.
+//All fields are strings on the wire, so the typed accessors below
+//are used to interpret them.
+type BusPosition struct {
+	Adherence   string `json:"ADHERENCE"`
+	BlockID     string `json:"BLOCKID"`
+	BlockAbbr   string `json:"BLOCK_ABBR"`
+	Direction   string `json:"DIRECTION"`
+	Latitude    string `json:"LATITUDE"`
+	Longitude   string `json:"LONGITUDE"`
+	MessageTime string `json:"MSGTIME"`
+	Route       string `json:"ROUTE"`
+	StopID      string `json:"STOPID"`
+	Timepoint   string `json:"TIMEPOINT"`
+	TripID      string `json:"TRIPID"`
+	Vehicle     string `json:"VEHICLE"`
+}
+
+//ParseBusPositions decodes a bus API response body
+func ParseBusPositions(r io.Reader) (positions []BusPosition, err error) {
+	err = json.NewDecoder(r).Decode(&positions)
+	return
+}
+
+//MessageTimeIn parses the MSGTIME field in the given location. The
+//MARTA API doesn't include an offset, so the caller must supply one.
+func (b BusPosition) MessageTimeIn(loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(MartaAPIDatetimeFormat, strings.TrimSpace(b.MessageTime), loc)
+}
+
+//Coordinates parses the LATITUDE and LONGITUDE fields
+func (b BusPosition) Coordinates() (lat float64, lon float64, err error) {
+	lat, err = strconv.ParseFloat(strings.TrimSpace(b.Latitude), 64)
+	if err != nil {
+		err = fmt.Errorf("malformed latitude `%s`: %w", b.Latitude, err)
+		return
+	}
+
+	lon, err = strconv.ParseFloat(strings.TrimSpace(b.Longitude), 64)
+	if err != nil {
+		err = fmt.Errorf("malformed longitude `%s`: %w", b.Longitude, err)
+		return
+	}
+
+	return
+}
+
+//AdherenceMinutes parses the ADHERENCE field, which is the number of
+//minutes the bus is off schedule. Negative values mean the bus is late.
+func (b BusPosition) AdherenceMinutes() (int, error) {
+	adh, err := strconv.Atoi(strings.TrimSpace(b.Adherence))
+	if err != nil {
+		return 0, fmt.Errorf("malformed adherence `%s`: %w", b.Adherence, err)
+	}
+	return adh, nil
+}
+
+func (b BusPosition) String() string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s", b.Route, b.Direction, b.TripID, b.Vehicle, b.MessageTime)
+}
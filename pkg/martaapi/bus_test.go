@@ -0,0 +1,72 @@
+package martaapi_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+)
+
+var _ = Describe("BusPosition", func() {
+	Describe("ParseBusPositions", func() {
+		It("decodes a valid response", func() {
+			positions, err := martaapi.ParseBusPositions(strings.NewReader(martaapi.ValidBusJSON))
+			Expect(err).To(BeNil())
+			Expect(positions).To(Equal(martaapi.ValidBusExpectation))
+		})
+		It("fails on malformed JSON", func() {
+			_, err := martaapi.ParseBusPositions(strings.NewReader("{"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("MessageTimeIn", func() {
+		It("parses the message time in the given location", func() {
+			t, err := martaapi.ValidBusExpectation[0].MessageTimeIn(time.UTC)
+			Expect(err).To(BeNil())
+			Expect(t).To(Equal(time.Date(2020, time.January, 20, 10, 54, 47, 0, time.UTC)))
+		})
+		It("fails on a malformed message time", func() {
+			_, err := martaapi.BusPosition{MessageTime: "yesterday"}.MessageTimeIn(time.UTC)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Coordinates", func() {
+		It("parses the latitude and longitude", func() {
+			lat, lon, err := martaapi.ValidBusExpectation[0].Coordinates()
+			Expect(err).To(BeNil())
+			Expect(lat).To(BeNumerically("~", 33.7589027, 1e-9))
+			Expect(lon).To(BeNumerically("~", -84.3879138, 1e-9))
+		})
+		It("fails on a malformed latitude", func() {
+			_, _, err := martaapi.BusPosition{Latitude: "north", Longitude: "1"}.Coordinates()
+			Expect(err).To(MatchError(ContainSubstring("malformed latitude `north`")))
+		})
+		It("fails on a malformed longitude", func() {
+			_, _, err := martaapi.BusPosition{Latitude: "1", Longitude: "west"}.Coordinates()
+			Expect(err).To(MatchError(ContainSubstring("malformed longitude `west`")))
+		})
+	})
+
+	Describe("AdherenceMinutes", func() {
+		It("parses the adherence", func() {
+			adh, err := martaapi.ValidBusExpectation[0].AdherenceMinutes()
+			Expect(err).To(BeNil())
+			Expect(adh).To(Equal(-2))
+		})
+		It("fails on a malformed adherence", func() {
+			_, err := martaapi.BusPosition{Adherence: "late"}.AdherenceMinutes()
+			Expect(err).To(MatchError(ContainSubstring("malformed adherence `late`")))
+		})
+	})
+
+	Describe("String", func() {
+		It("works", func() {
+			Expect(martaapi.ValidBusExpectation[0].String()).To(Equal("110:Northbound:6828745:1545:1/20/2020 10:54:47 AM"))
+		})
+	})
+})
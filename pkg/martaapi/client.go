@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/retry"
 )
 
 //MartaAPIDatetimeFormat is the datetime format used by the MARTA API
@@ -63,14 +65,31 @@ type Doer interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-func New(doer Doer, apiKey string, logger *zap.Logger, endpoint string, prefix string) Client {
-	return Client{
-		doer,
-		apiKey,
-		logger,
-		endpoint,
-		prefix,
+//Option configures optional Client behavior
+type Option = func(*Client)
+
+//WithRetryPolicy sets the policy for retrying failed requests
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(c *Client) {
+		c.RetryPolicy = p
+	}
+}
+
+//New creates a new Client. Unless a retry policy is provided, failed
+//requests are not retried.
+func New(doer Doer, apiKey string, logger *zap.Logger, endpoint string, prefix string, opts ...Option) Client {
+	c := Client{
+		Doer:         doer,
+		ApiKey:       apiKey,
+		logger:       logger,
+		Endpoint:     endpoint,
+		OutputPrefix: prefix,
+	}
+	for _, opt := range opts {
+		opt(&c)
 	}
+
+	return c
 }
 
 // Client will hold all of the deps required to find schedules
@@ -80,14 +99,20 @@ type Client struct {
 	logger       *zap.Logger
 	Endpoint     string
 	OutputPrefix string
+	RetryPolicy  retry.Policy
 }
 
 func (c Client) Prefix() string {
 	return c.OutputPrefix
 }
 
-func (c Client) buildRequest(method string, path string) (*http.Request, error) {
-	req, err := http.NewRequest(method, path, nil)
+//Scrape implements scraper.Scraper
+func (c Client) Scrape(ctx context.Context) (io.ReadCloser, error) {
+	return c.FindSchedules(ctx)
+}
+
+func (c Client) buildRequest(ctx context.Context, method string, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, nil)
 	if err != nil {
 		return req, err
 	}
@@ -97,27 +122,37 @@ func (c Client) buildRequest(method string, path string) (*http.Request, error)
 	return req, err
 }
 
-// FindSchedules will retrieve a set of schedules
-func (c Client) FindSchedules(ctx context.Context) (io.ReadCloser, error) {
-	var (
-		err error
-	)
-
+// FindSchedules will retrieve a set of schedules, retrying transient
+// failures according to the client's retry policy
+func (c Client) FindSchedules(ctx context.Context) (body io.ReadCloser, err error) {
 	path := MartaBaseURI + c.Endpoint
 
-	req, err := c.buildRequest("GET", path)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Doer.Do(req)
+	err = retry.Do(ctx, c.RetryPolicy, func(attempt int) error {
+		req, err := c.buildRequest(ctx, "GET", path)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+
+		resp, err := c.Doer.Do(req)
+		if err != nil {
+			c.logger.Warn(fmt.Sprintf("attempt %d to reach the MARTA API for `%s` failed: %s", attempt, c.OutputPrefix, err.Error()))
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+			c.logger.Warn(fmt.Sprintf("attempt %d to reach the MARTA API for `%s` received status `%v`", attempt, c.OutputPrefix, resp.StatusCode))
+			return retry.ClassifyResponse(resp, fmt.Errorf("request to the MARTA API failed with status `%v`", resp.StatusCode))
+		}
+
+		body = resp.Body
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request to the MARTA API failed with status `%v`", resp.StatusCode)
-	}
-
-	return resp.Body, nil
+	return body, nil
 }
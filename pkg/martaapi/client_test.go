@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -14,12 +15,14 @@ import (
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
 	. "github.com/smartatransit/scrapedumper/pkg/martaapi"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi/martaapifakes"
+	"github.com/smartatransit/scrapedumper/pkg/retry"
 )
 
 var _ = Describe("Client", func() {
 	var (
 		doer   *martaapifakes.FakeDoer
 		apiKey string
+		opts   []Option
 		client Client
 		resp   *http.Response
 		retErr error
@@ -33,6 +36,7 @@ var _ = Describe("Client", func() {
 		apiKey = "apikey"
 		retErr = nil
 		err = nil
+		opts = nil
 	})
 	JustBeforeEach(func() {
 		doer.DoReturns(resp, retErr)
@@ -46,6 +50,7 @@ var _ = Describe("Client", func() {
 			logger,
 			"test",
 			"prefix",
+			opts...,
 		)
 	})
 	Context("New", func() {
@@ -75,6 +80,46 @@ var _ = Describe("Client", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
+		When("a retry policy is set", func() {
+			BeforeEach(func() {
+				opts = append(opts, WithRetryPolicy(retry.Policy{
+					MaxAttempts: 3,
+					BaseDelay:   time.Millisecond,
+					MaxDelay:    10 * time.Millisecond,
+				}))
+				doer.DoReturnsOnCall(0, &http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil)
+			})
+			When("a transient failure is followed by a success", func() {
+				BeforeEach(func() {
+					resp.StatusCode = http.StatusOK
+				})
+				It("retries", func() {
+					Expect(err).To(BeNil())
+					Expect(doer.DoCallCount()).To(Equal(2))
+				})
+			})
+			When("the failures persist", func() {
+				BeforeEach(func() {
+					retErr = errors.New("connection reset")
+				})
+				It("gives up after the max attempts", func() {
+					Expect(err).To(MatchError("connection reset"))
+					Expect(doer.DoCallCount()).To(Equal(3))
+				})
+			})
+			When("the API key is rejected", func() {
+				BeforeEach(func() {
+					resp.StatusCode = http.StatusUnauthorized
+				})
+				It("stops retrying", func() {
+					Expect(err).To(MatchError("request to the MARTA API failed with status `401`"))
+					Expect(doer.DoCallCount()).To(Equal(2))
+				})
+			})
+			It("sends the request with the caller's context", func() {
+				Expect(doer.DoArgsForCall(0).Context()).To(Equal(context.Background()))
+			})
+		})
 	})
 })
 
@@ -50,3 +50,66 @@ var ValidScheduleExpectation = []Schedule{
 		WaitingTime:    "Boarding",
 	},
 }
+
+const ValidBusJSON = `
+[
+  {
+    "ADHERENCE": "-2",
+    "BLOCKID": "501",
+    "BLOCK_ABBR": "110-3",
+    "DIRECTION": "Northbound",
+    "LATITUDE": "33.7589027",
+    "LONGITUDE": "-84.3879138",
+    "MSGTIME": "1/20/2020 10:54:47 AM",
+    "ROUTE": "110",
+    "STOPID": "907462",
+    "TIMEPOINT": "Five Points Station",
+    "TRIPID": "6828745",
+    "VEHICLE": "1545"
+  },
+  {
+    "ADHERENCE": "0",
+    "BLOCKID": "77",
+    "BLOCK_ABBR": "2-1",
+    "DIRECTION": "Eastbound",
+    "LATITUDE": "33.7610854",
+    "LONGITUDE": "-84.3614017",
+    "MSGTIME": "1/20/2020 10:54:51 AM",
+    "ROUTE": "2",
+    "STOPID": "212086",
+    "TIMEPOINT": "Ponce de Leon Ave & Moreland Ave",
+    "TRIPID": "6825103",
+    "VEHICLE": "2814"
+  }
+]`
+
+var ValidBusExpectation = []BusPosition{
+	BusPosition{
+		Adherence:   "-2",
+		BlockID:     "501",
+		BlockAbbr:   "110-3",
+		Direction:   "Northbound",
+		Latitude:    "33.7589027",
+		Longitude:   "-84.3879138",
+		MessageTime: "1/20/2020 10:54:47 AM",
+		Route:       "110",
+		StopID:      "907462",
+		Timepoint:   "Five Points Station",
+		TripID:      "6828745",
+		Vehicle:     "1545",
+	},
+	BusPosition{
+		Adherence:   "0",
+		BlockID:     "77",
+		BlockAbbr:   "2-1",
+		Direction:   "Eastbound",
+		Latitude:    "33.7610854",
+		Longitude:   "-84.3614017",
+		MessageTime: "1/20/2020 10:54:51 AM",
+		Route:       "2",
+		StopID:      "212086",
+		Timepoint:   "Ponce de Leon Ave & Moreland Ave",
+		TripID:      "6825103",
+		Vehicle:     "2814",
+	},
+}
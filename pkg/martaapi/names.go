@@ -0,0 +1,86 @@
+package martaapi
+
+import (
+	"strings"
+)
+
+//The MARTA API spells names differently from the constants in this package,
+//e.g. "FIVE POINTS STATION", "GOLD" and "N". These helpers resolve the API's
+//spellings to Stations, Lines and Directions.
+
+func normalizeName(s string) string {
+	s = strings.ToUpper(s)
+	s = strings.NewReplacer(".", " ", "-", " ", "/", " ", ",", " ").Replace(s)
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.TrimSpace(strings.TrimSuffix(s, "STATION"))
+}
+
+//stationAliases holds spellings that don't normalize to a Station's own name
+var stationAliases = map[string]Station{
+	"HAMILTON E HOLMES":     HamiltonEHolmesStation,
+	"HE HOLMES":             HamiltonEHolmesStation,
+	"DOME GWCC PHILIPS CNN": OmniDomeStation,
+	"GWCC CNN CENTER":       OmniDomeStation,
+	"OMNI":                  OmniDomeStation,
+	"LINDBERGH":             LindberghStation,
+	"NORTH AVE":             NorthAveStation,
+	"EDGEWOOD CANDLER PARK": EdgewoodCandlerParkStation,
+	"EDGEWOOD":              EdgewoodCandlerParkStation,
+	"MEDICAL CTR":           MedicalCenterStation,
+	"CIVIC CTR":             CivicCenterStation,
+	"PEACHTREE CTR":         PeachtreeCenterStation,
+}
+
+var stationsByNormalizedName = func() map[string]Station {
+	res := map[string]Station{}
+	for station := range Stations {
+		res[normalizeName(string(station))] = station
+	}
+	for alias, station := range stationAliases {
+		res[alias] = station
+	}
+	return res
+}()
+
+//StationFromAPIName resolves a station name as reported by the MARTA API
+func StationFromAPIName(name string) (Station, bool) {
+	station, ok := stationsByNormalizedName[normalizeName(name)]
+	return station, ok
+}
+
+//LineFromAPIName resolves a line name as reported by the MARTA API
+func LineFromAPIName(name string) (Line, bool) {
+	norm := normalizeName(name)
+	for line := range Lines {
+		if normalizeName(string(line)) == norm {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+//DirectionFromAPIName resolves a direction as reported by the MARTA API, which
+//uses single-letter codes for trains and full names for buses
+func DirectionFromAPIName(name string) (Direction, bool) {
+	norm := normalizeName(name)
+	for dir := range Directions {
+		full := normalizeName(string(dir))
+		if norm == full || norm == full[:1] {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+//LineAPIName spells a line as the MARTA API does for trains, e.g. "GOLD"
+func LineAPIName(line Line) string {
+	return strings.ToUpper(string(line))
+}
+
+//DirectionAPIName spells a direction as the MARTA API does for trains, e.g. "N"
+func DirectionAPIName(dir Direction) string {
+	if dir == "" {
+		return ""
+	}
+	return strings.ToUpper(string(dir)[:1])
+}
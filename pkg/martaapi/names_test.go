@@ -0,0 +1,75 @@
+package martaapi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+)
+
+var _ = Describe("Names", func() {
+	Describe("StationFromAPIName", func() {
+		It("resolves the API's spellings", func() {
+			for name, expected := range map[string]martaapi.Station{
+				"FIVE POINTS STATION":           martaapi.FivePointsStation,
+				"Lakewood Station":              martaapi.LakewoodStation,
+				"EDGEWOOD-CANDLER PARK STATION": martaapi.EdgewoodCandlerParkStation,
+				"H. E. HOLMES STATION":          martaapi.HamiltonEHolmesStation,
+				"DOME/GWCC/PHILIPS/CNN STATION": martaapi.OmniDomeStation,
+				"LINDBERGH STATION":             martaapi.LindberghStation,
+				"North Avenue":                  martaapi.NorthAveStation,
+			} {
+				station, ok := martaapi.StationFromAPIName(name)
+				Expect(ok).To(BeTrue(), name)
+				Expect(station).To(Equal(expected), name)
+			}
+		})
+		It("rejects unknown stations", func() {
+			_, ok := martaapi.StationFromAPIName("SPRINGFIELD STATION")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("LineFromAPIName", func() {
+		It("resolves the API's spellings", func() {
+			line, ok := martaapi.LineFromAPIName("GOLD")
+			Expect(ok).To(BeTrue())
+			Expect(line).To(Equal(martaapi.Gold))
+			_, ok = martaapi.LineFromAPIName("PURPLE")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("DirectionFromAPIName", func() {
+		It("resolves single letter codes and full names", func() {
+			dir, ok := martaapi.DirectionFromAPIName("N")
+			Expect(ok).To(BeTrue())
+			Expect(dir).To(Equal(martaapi.North))
+			dir, ok = martaapi.DirectionFromAPIName("Westbound")
+			Expect(ok).To(BeTrue())
+			Expect(dir).To(Equal(martaapi.West))
+			_, ok = martaapi.DirectionFromAPIName("X")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("LineAPIName and DirectionAPIName", func() {
+		It("spell names as the API does for trains", func() {
+			Expect(martaapi.LineAPIName(martaapi.Gold)).To(Equal("GOLD"))
+			Expect(martaapi.DirectionAPIName(martaapi.North)).To(Equal("N"))
+			Expect(martaapi.DirectionAPIName("")).To(Equal(""))
+		})
+		It("round trip through the resolvers", func() {
+			for line := range martaapi.Lines {
+				resolved, ok := martaapi.LineFromAPIName(martaapi.LineAPIName(line))
+				Expect(ok).To(BeTrue())
+				Expect(resolved).To(Equal(line))
+			}
+			for dir := range martaapi.Directions {
+				resolved, ok := martaapi.DirectionFromAPIName(martaapi.DirectionAPIName(dir))
+				Expect(ok).To(BeTrue())
+				Expect(resolved).To(Equal(dir))
+			}
+		})
+	})
+})
@@ -205,6 +205,22 @@ var LineDirections = map[Line][]Direction{
 	Red:   {North, South},
 }
 
+//StationsInDirection lists the stations of a line in the order that a train
+//travelling in the given direction reaches them
+func StationsInDirection(line Line, dir Direction) []Station {
+	stations := LineStations[line]
+	dirs := LineDirections[line]
+	if len(dirs) != 2 || dir != dirs[1] {
+		return stations
+	}
+
+	reversed := make([]Station, len(stations))
+	for i, station := range stations {
+		reversed[len(stations)-1-i] = station
+	}
+	return reversed
+}
+
 //Termini allow for lookups of all the terminuseses of the different lines
 var Termini = map[Line]map[Direction]Station{
 	Green: {
@@ -216,7 +232,7 @@ var Termini = map[Line]map[Direction]Station{
 		West: HamiltonEHolmesStation,
 	},
 	Gold: {
-		North: DunwoodyStation,
+		North: DoravilleStation,
 		South: AirportStation,
 	},
 	Red: {
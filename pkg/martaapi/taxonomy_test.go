@@ -0,0 +1,38 @@
+package martaapi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+)
+
+var _ = Describe("Taxonomy", func() {
+	Describe("StationsInDirection", func() {
+		It("lists the stations in the line's first direction as they are", func() {
+			stations := martaapi.StationsInDirection(martaapi.Gold, martaapi.North)
+			Expect(stations[0]).To(Equal(martaapi.AirportStation))
+			Expect(stations[len(stations)-1]).To(Equal(martaapi.DoravilleStation))
+		})
+		It("reverses them in the line's second direction", func() {
+			stations := martaapi.StationsInDirection(martaapi.Green, martaapi.West)
+			Expect(stations[0]).To(Equal(martaapi.EdgewoodCandlerParkStation))
+			Expect(stations[len(stations)-1]).To(Equal(martaapi.BankheadStation))
+			Expect(martaapi.LineStations[martaapi.Green][0]).To(Equal(martaapi.BankheadStation))
+		})
+		It("lists nothing for an unknown line", func() {
+			Expect(martaapi.StationsInDirection(martaapi.Line("Purple"), martaapi.North)).To(BeEmpty())
+		})
+	})
+
+	Describe("Termini", func() {
+		It("are the last stations in each direction", func() {
+			for line, termini := range martaapi.Termini {
+				for dir, terminus := range termini {
+					stations := martaapi.StationsInDirection(line, dir)
+					Expect(stations[len(stations)-1]).To(Equal(terminus), "%s %s", line, dir)
+				}
+			}
+		})
+	})
+})
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
+)
+
+const namespace = "scrapedumper"
+
+//Outcomes of an upsert, as counted by UpsertOutcome
+const (
+	RunCreated    = "run_created"
+	EstimateAdded = "estimate_added"
+	ArrivalSet    = "arrival_set"
+	//ArrivingRecorded counts records of trains that are arriving, which carry
+	//neither an estimate nor an arrival time, but bound the arrival time from
+	//below
+	ArrivingRecorded = "arriving_recorded"
+)
+
+//Metrics holds all of scrapedumper's collectors. A nil *Metrics is valid and
+//records nothing, so that instrumentation is optional everywhere.
+type Metrics struct {
+	scrapeDuration *prometheus.HistogramVec
+	scrapeErrors   *prometheus.CounterVec
+	scrapeBytes    *prometheus.CounterVec
+	scrapeRecords  *prometheus.CounterVec
+	responses      *prometheus.CounterVec
+	dumpDuration   *prometheus.HistogramVec
+	dumpErrors     *prometheus.CounterVec
+	dedupeSkipped  *prometheus.CounterVec
+	breakerState   *prometheus.GaugeVec
+	breakerOpened  *prometheus.CounterVec
+	upsertOutcomes *prometheus.CounterVec
+	upsertFailures prometheus.Counter
+}
+
+//New creates the collectors and registers them with reg
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		scrapeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "scrape_duration_seconds",
+			Help:      "Time taken to scrape a source, including retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"prefix"}),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_errors_total",
+			Help:      "Scrapes that failed.",
+		}, []string{"prefix"}),
+		scrapeBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_bytes_total",
+			Help:      "Bytes scraped from a source.",
+		}, []string{"prefix"}),
+		scrapeRecords: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_records_total",
+			Help:      "Records scraped from a source, for sources that return a JSON array.",
+		}, []string{"prefix"}),
+		responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrape_responses_total",
+			Help:      "HTTP responses received from a source, by status code. Each retry is counted.",
+		}, []string{"prefix", "code"}),
+		dumpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "dump_duration_seconds",
+			Help:      "Time taken to dump a scrape.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"kind"}),
+		dumpErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dump_errors_total",
+			Help:      "Dumps that failed.",
+		}, []string{"kind"}),
+		dedupeSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dedupe_skipped_total",
+			Help:      "Dumps skipped because the scrape was identical to the last one from its source.",
+		}, []string{"prefix"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_state",
+			Help:      "Current state of a circuit breaker: 0 is closed, 1 is open and 2 is half-open.",
+		}, []string{"name"}),
+		breakerOpened: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_opened_total",
+			Help:      "Times a circuit breaker has opened.",
+		}, []string{"name"}),
+		upsertOutcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "postgres_upserts_total",
+			Help:      "Changes made by the postgres upserter, by outcome.",
+		}, []string{"outcome"}),
+		upsertFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "postgres_upsert_errors_total",
+			Help:      "Records that the postgres upserter failed to upsert.",
+		}),
+	}
+
+	reg.MustRegister(
+		m.scrapeDuration,
+		m.scrapeErrors,
+		m.scrapeBytes,
+		m.scrapeRecords,
+		m.responses,
+		m.dumpDuration,
+		m.dumpErrors,
+		m.dedupeSkipped,
+		m.breakerState,
+		m.breakerOpened,
+		m.upsertOutcomes,
+		m.upsertFailures,
+	)
+	return m
+}
+
+//ObserveScrape records the outcome of one scrape
+func (m *Metrics) ObserveScrape(prefix string, took time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.scrapeDuration.WithLabelValues(prefix).Observe(took.Seconds())
+	if err != nil {
+		m.scrapeErrors.WithLabelValues(prefix).Inc()
+	}
+}
+
+//ObserveScrapeSize records the size of one scrape. records is negative if the
+//scrape couldn't be counted.
+func (m *Metrics) ObserveScrapeSize(prefix string, bytes int, records int) {
+	if m == nil {
+		return
+	}
+	m.scrapeBytes.WithLabelValues(prefix).Add(float64(bytes))
+	if records >= 0 {
+		m.scrapeRecords.WithLabelValues(prefix).Add(float64(records))
+	}
+}
+
+//ObserveDump records the outcome of one dump
+func (m *Metrics) ObserveDump(kind string, took time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.dumpDuration.WithLabelValues(kind).Observe(took.Seconds())
+	if err != nil {
+		m.dumpErrors.WithLabelValues(kind).Inc()
+	}
+}
+
+//DedupeSkipped counts a dump that was skipped as a duplicate
+func (m *Metrics) DedupeSkipped(prefix string) {
+	if m == nil {
+		return
+	}
+	m.dedupeSkipped.WithLabelValues(prefix).Inc()
+}
+
+//UpsertOutcome counts a change made by the postgres upserter
+func (m *Metrics) UpsertOutcome(outcome string) {
+	if m == nil {
+		return
+	}
+	m.upsertOutcomes.WithLabelValues(outcome).Inc()
+}
+
+//UpsertFailed counts a record that the postgres upserter failed to upsert
+func (m *Metrics) UpsertFailed() {
+	if m == nil {
+		return
+	}
+	m.upsertFailures.Inc()
+}
+
+//BreakerListener produces a listener that tracks the state of circuit breakers
+func (m *Metrics) BreakerListener() circuitbreaker.Listener {
+	return func(name string, from, to circuitbreaker.CircuitState) {
+		if m == nil {
+			return
+		}
+		m.breakerState.WithLabelValues(name).Set(float64(to))
+		if to == circuitbreaker.Open {
+			m.breakerOpened.WithLabelValues(name).Inc()
+		}
+	}
+}
+
+//TrackBreaker starts tracking a breaker's state, which is otherwise only
+//reported once it first changes
+func (m *Metrics) TrackBreaker(cb *circuitbreaker.CircuitBreaker) {
+	if m == nil {
+		return
+	}
+	m.breakerState.WithLabelValues(cb.Name()).Set(float64(cb.State()))
+}
+
+//Doer performs HTTP requests
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+//InstrumentDoer counts the status codes of the responses received by doer
+func (m *Metrics) InstrumentDoer(doer Doer, prefix string) Doer {
+	if m == nil {
+		return doer
+	}
+	return instrumentedDoer{doer, m, prefix}
+}
+
+type instrumentedDoer struct {
+	Doer
+	m      *Metrics
+	prefix string
+}
+
+func (d instrumentedDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.Doer.Do(req)
+	if err != nil {
+		d.m.responses.WithLabelValues(d.prefix, "error").Inc()
+		return resp, err
+	}
+	d.m.responses.WithLabelValues(d.prefix, strconv.Itoa(resp.StatusCode)).Inc()
+	return resp, err
+}
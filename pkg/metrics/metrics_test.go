@@ -0,0 +1,146 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("Metrics", func() {
+	var (
+		reg *prometheus.Registry
+		m   *metrics.Metrics
+	)
+
+	BeforeEach(func() {
+		reg = prometheus.NewRegistry()
+		m = metrics.New(reg)
+	})
+
+	//value reads a single series out of the registry
+	value := func(name string, labels map[string]string) float64 {
+		families, err := reg.Gather()
+		Expect(err).To(BeNil())
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+		series:
+			for _, s := range f.GetMetric() {
+				for _, l := range s.GetLabel() {
+					if labels[l.GetName()] != l.GetValue() {
+						continue series
+					}
+				}
+				switch {
+				case s.Counter != nil:
+					return s.GetCounter().GetValue()
+				case s.Gauge != nil:
+					return s.GetGauge().GetValue()
+				case s.Histogram != nil:
+					return float64(s.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+		Fail("no series " + name)
+		return 0
+	}
+
+	It("records scrapes by prefix", func() {
+		m.ObserveScrape("train-data", time.Second, nil)
+		m.ObserveScrape("train-data", time.Second, errors.New("scrape failed"))
+		m.ObserveScrapeSize("train-data", 1024, 3)
+		m.ObserveScrapeSize("train-data", 10, -1)
+
+		Expect(value("scrapedumper_scrape_duration_seconds", map[string]string{"prefix": "train-data"})).To(Equal(2.0))
+		Expect(value("scrapedumper_scrape_errors_total", map[string]string{"prefix": "train-data"})).To(Equal(1.0))
+		Expect(value("scrapedumper_scrape_bytes_total", map[string]string{"prefix": "train-data"})).To(Equal(1034.0))
+		Expect(value("scrapedumper_scrape_records_total", map[string]string{"prefix": "train-data"})).To(Equal(3.0))
+	})
+
+	It("records dumps by kind", func() {
+		m.ObserveDump("S3", time.Second, nil)
+		m.ObserveDump("S3", time.Second, errors.New("upload failed"))
+
+		Expect(value("scrapedumper_dump_duration_seconds", map[string]string{"kind": "S3"})).To(Equal(2.0))
+		Expect(value("scrapedumper_dump_errors_total", map[string]string{"kind": "S3"})).To(Equal(1.0))
+	})
+
+	It("counts upserts by outcome", func() {
+		m.UpsertOutcome(metrics.RunCreated)
+		m.UpsertOutcome(metrics.EstimateAdded)
+		m.UpsertOutcome(metrics.EstimateAdded)
+		m.UpsertFailed()
+
+		Expect(value("scrapedumper_postgres_upserts_total", map[string]string{"outcome": "run_created"})).To(Equal(1.0))
+		Expect(value("scrapedumper_postgres_upserts_total", map[string]string{"outcome": "estimate_added"})).To(Equal(2.0))
+		Expect(value("scrapedumper_postgres_upsert_errors_total", nil)).To(Equal(1.0))
+	})
+
+	It("tracks the state of circuit breakers", func() {
+		cb := circuitbreaker.New(zap.NewNop(), time.Hour, 1,
+			circuitbreaker.WithName("bus"),
+			circuitbreaker.WithListener(m.BreakerListener()),
+		)
+		m.TrackBreaker(cb)
+		Expect(value("scrapedumper_circuit_breaker_state", map[string]string{"name": "bus"})).To(Equal(float64(circuitbreaker.Closed)))
+
+		_ = cb.Run(func() error { return errors.New("scrape failed") })
+		Expect(value("scrapedumper_circuit_breaker_state", map[string]string{"name": "bus"})).To(Equal(float64(circuitbreaker.Open)))
+		Expect(value("scrapedumper_circuit_breaker_opened_total", map[string]string{"name": "bus"})).To(Equal(1.0))
+	})
+
+	It("counts responses by status code", func() {
+		codes := []int{http.StatusServiceUnavailable, http.StatusOK}
+		doer := m.InstrumentDoer(doerFunc(func(*http.Request) (*http.Response, error) {
+			code := codes[0]
+			codes = codes[1:]
+			return &http.Response{StatusCode: code}, nil
+		}), "bus-data")
+		failing := m.InstrumentDoer(doerFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		}), "bus-data")
+
+		_, _ = doer.Do(nil)
+		_, _ = doer.Do(nil)
+		_, _ = failing.Do(nil)
+
+		Expect(value("scrapedumper_scrape_responses_total", map[string]string{"prefix": "bus-data", "code": "503"})).To(Equal(1.0))
+		Expect(value("scrapedumper_scrape_responses_total", map[string]string{"prefix": "bus-data", "code": "200"})).To(Equal(1.0))
+		Expect(value("scrapedumper_scrape_responses_total", map[string]string{"prefix": "bus-data", "code": "error"})).To(Equal(1.0))
+	})
+
+	When("it's nil", func() {
+		BeforeEach(func() {
+			m = nil
+		})
+
+		It("records nothing and doesn't panic", func() {
+			m.ObserveScrape("train-data", time.Second, nil)
+			m.ObserveScrapeSize("train-data", 1, 1)
+			m.ObserveDump("S3", time.Second, nil)
+			m.UpsertOutcome(metrics.RunCreated)
+			m.UpsertFailed()
+			m.BreakerListener()("bus", circuitbreaker.Closed, circuitbreaker.Open)
+
+			doer := doerFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+			Expect(m.InstrumentDoer(doer, "bus-data")).To(BeAssignableToTypeOf(doer))
+			Expect(value("scrapedumper_postgres_upsert_errors_total", nil)).To(Equal(0.0))
+		})
+	})
+})
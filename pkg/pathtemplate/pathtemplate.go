@@ -0,0 +1,197 @@
+package pathtemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Default names dumps the way scrapedumper always has
+const Default = "{prefix}/{rfc3339}.json"
+
+//Values are what a template's placeholders are filled in from
+type Values struct {
+	Prefix string
+	Time   time.Time
+	Body   []byte
+}
+
+//Template names each dump. Placeholders are enclosed in braces:
+//
+//  {prefix} or {source}  the prefix of the scraper
+//  {rfc3339}             the scrape time in RFC3339
+//  {unix}                the scrape time in seconds since the epoch
+//  {hash}                the hex SHA-256 of the scrape
+//  {yyyy-MM-dd}, {HH}... a part of the scrape time, spelled with yyyy, yy,
+//                        MM, dd, HH, mm and ss, separated by - _ . or :
+//
+//Times are in UTC. Bulk loading reads dumps in path order, so a template should
+//put the scrape time before anything else that varies within a directory.
+type Template struct {
+	raw   string
+	parts []func(Values) string
+	hash  bool
+}
+
+//Parse parses a template, rejecting unknown placeholders
+func Parse(raw string) (t Template, err error) {
+	t.raw = raw
+	rest := raw
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return Template{}, errors.Errorf("unexpected `}` in path template `%s`", raw)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, literal(rest))
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, literal(rest[:open]))
+		}
+
+		close := strings.IndexByte(rest[open:], '}')
+		if close < 0 {
+			return Template{}, errors.Errorf("unclosed `{` in path template `%s`", raw)
+		}
+		name := rest[open+1 : open+close]
+		part, err := placeholder(name)
+		if err != nil {
+			return Template{}, errors.Wrapf(err, "invalid path template `%s`", raw)
+		}
+		if name == "hash" {
+			t.hash = true
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[open+close+1:]
+	}
+
+	if len(t.parts) == 0 {
+		return Template{}, errors.New("path template is empty")
+	}
+	return t, nil
+}
+
+//MustParse parses a template that's known to be valid
+func MustParse(raw string) Template {
+	t, err := Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+//String is the template as it was parsed
+func (t Template) String() string {
+	return t.raw
+}
+
+//NeedsBody reports whether the template uses the contents of a scrape, which
+//then have to be read in full before the dump's path is known
+func (t Template) NeedsBody() bool {
+	return t.hash
+}
+
+//Execute fills in the template. The zero Template executes as Default.
+func (t Template) Execute(v Values) string {
+	if t.parts == nil {
+		t = MustParse(Default)
+	}
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		b.WriteString(part(v))
+	}
+	return b.String()
+}
+
+func literal(s string) func(Values) string {
+	return func(Values) string { return s }
+}
+
+func placeholder(name string) (func(Values) string, error) {
+	switch name {
+	case "prefix", "source":
+		return func(v Values) string { return v.Prefix }, nil
+	case "rfc3339":
+		return func(v Values) string { return v.Time.UTC().Format(time.RFC3339) }, nil
+	case "unix":
+		return func(v Values) string { return strconv.FormatInt(v.Time.Unix(), 10) }, nil
+	case "hash":
+		return func(v Values) string {
+			sum := sha256.Sum256(v.Body)
+			return hex.EncodeToString(sum[:])
+		}, nil
+	}
+
+	layout, err := timeLayout(name)
+	if err != nil {
+		return nil, err
+	}
+	return func(v Values) string { return v.Time.UTC().Format(layout) }, nil
+}
+
+var timeTokens = []struct{ token, layout string }{
+	{"yyyy", "2006"},
+	{"yy", "06"},
+	{"MM", "01"},
+	{"dd", "02"},
+	{"HH", "15"},
+	{"mm", "04"},
+	{"ss", "05"},
+}
+
+//timeLayout converts a placeholder like yyyy-MM-dd into a time layout
+func timeLayout(name string) (string, error) {
+	var layout strings.Builder
+	tokens := 0
+	rest := name
+next:
+	for rest != "" {
+		for _, t := range timeTokens {
+			if strings.HasPrefix(rest, t.token) {
+				layout.WriteString(t.layout)
+				rest = rest[len(t.token):]
+				tokens++
+				continue next
+			}
+		}
+		if strings.IndexByte("-_.:", rest[0]) < 0 {
+			return "", errors.Errorf("unknown placeholder `{%s}`", name)
+		}
+		layout.WriteByte(rest[0])
+		rest = rest[1:]
+	}
+	if tokens == 0 {
+		return "", errors.Errorf("unknown placeholder `{%s}`", name)
+	}
+	return layout.String(), nil
+}
+
+var rfc3339Pattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+
+//TimeFromPath recovers the scrape time from a dump's path, from the last
+//{rfc3339} timestamp in it, or else from a file named by {unix}. It reports
+//false for paths that don't have either, such as those named by {hash} alone.
+func TimeFromPath(p string) (time.Time, bool) {
+	if matches := rfc3339Pattern.FindAllString(p, -1); len(matches) > 0 {
+		if t, err := time.Parse(time.RFC3339, matches[len(matches)-1]); err == nil {
+			return t.UTC(), true
+		}
+	}
+
+	name := path.Base(p)
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	if unix, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
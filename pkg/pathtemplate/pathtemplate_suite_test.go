@@ -0,0 +1,13 @@
+package pathtemplate_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPathtemplate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pathtemplate Suite")
+}
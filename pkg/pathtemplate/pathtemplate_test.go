@@ -0,0 +1,143 @@
+package pathtemplate_test
+
+import (
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/pathtemplate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template", func() {
+	var (
+		raw    string
+		values pathtemplate.Values
+
+		t        pathtemplate.Template
+		parseErr error
+	)
+
+	BeforeEach(func() {
+		raw = pathtemplate.Default
+		values = pathtemplate.Values{
+			Prefix: "train-data",
+			Time:   time.Date(2020, time.March, 1, 7, 5, 9, 0, time.FixedZone("EST", -5*60*60)),
+			Body:   []byte("[]"),
+		}
+	})
+
+	JustBeforeEach(func() {
+		t, parseErr = pathtemplate.Parse(raw)
+	})
+
+	It("names dumps the way scrapedumper always has by default", func() {
+		Expect(parseErr).To(BeNil())
+		Expect(t.Execute(values)).To(Equal("train-data/2020-03-01T12:05:09Z.json"))
+		Expect(pathtemplate.Template{}.Execute(values)).To(Equal("train-data/2020-03-01T12:05:09Z.json"))
+		Expect(t.NeedsBody()).To(BeFalse())
+	})
+
+	When("the template is partitioned by date", func() {
+		BeforeEach(func() {
+			raw = "{source}/date={yyyy-MM-dd}/hour={HH}/{rfc3339}.json.gz"
+		})
+		It("fills in the parts of the scrape time in UTC", func() {
+			Expect(parseErr).To(BeNil())
+			Expect(t.Execute(values)).To(Equal("train-data/date=2020-03-01/hour=12/2020-03-01T12:05:09Z.json.gz"))
+			Expect(t.String()).To(Equal(raw))
+		})
+	})
+
+	When("the template uses every kind of time placeholder", func() {
+		BeforeEach(func() {
+			raw = "{yy}/{MM}/{dd}/{HH:mm:ss}_{unix}"
+		})
+		It("fills them in", func() {
+			Expect(parseErr).To(BeNil())
+			Expect(t.Execute(values)).To(Equal("20/03/01/12:05:09_1583064309"))
+		})
+	})
+
+	When("the template uses the content hash", func() {
+		BeforeEach(func() {
+			raw = "{prefix}/{hash}.json"
+		})
+		It("hashes the scrape", func() {
+			Expect(parseErr).To(BeNil())
+			Expect(t.NeedsBody()).To(BeTrue())
+			Expect(t.Execute(values)).To(Equal("train-data/4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945.json"))
+		})
+	})
+
+	When("a placeholder is unknown", func() {
+		BeforeEach(func() {
+			raw = "{prefix}/{yyyy}/{line}.json"
+		})
+		It("fails", func() {
+			Expect(parseErr).To(MatchError("invalid path template `{prefix}/{yyyy}/{line}.json`: unknown placeholder `{line}`"))
+		})
+	})
+
+	When("a placeholder has no time part", func() {
+		BeforeEach(func() {
+			raw = "{-}"
+		})
+		It("fails", func() {
+			Expect(parseErr).To(MatchError(ContainSubstring("unknown placeholder `{-}`")))
+		})
+	})
+
+	When("a brace isn't closed", func() {
+		BeforeEach(func() {
+			raw = "{prefix}/{rfc3339.json"
+		})
+		It("fails", func() {
+			Expect(parseErr).To(MatchError("unclosed `{` in path template `{prefix}/{rfc3339.json`"))
+		})
+	})
+
+	When("a brace isn't opened", func() {
+		BeforeEach(func() {
+			raw = "{prefix}/rfc3339}.json"
+		})
+		It("fails", func() {
+			Expect(parseErr).To(MatchError("unexpected `}` in path template `{prefix}/rfc3339}.json`"))
+		})
+	})
+
+	When("the template is empty", func() {
+		BeforeEach(func() {
+			raw = ""
+		})
+		It("fails", func() {
+			Expect(parseErr).To(MatchError("path template is empty"))
+		})
+	})
+})
+
+var _ = Describe("TimeFromPath", func() {
+	expected := time.Date(2020, time.March, 1, 12, 5, 9, 0, time.UTC)
+
+	It("reads the time from an RFC3339 timestamp", func() {
+		for _, p := range []string{
+			"train-data/2020-03-01T12:05:09Z.json",
+			"train-data/2020-03-01T07:05:09-05:00.json.gz",
+			"train-data/date=2020-03-01/hour=12/2020-03-01T12:05:09Z.json",
+			"train-data/2020-03-01T12:05:09Z_4f53cda1.ndjson",
+		} {
+			t, ok := pathtemplate.TimeFromPath(p)
+			Expect(ok).To(BeTrue(), p)
+			Expect(t).To(Equal(expected), p)
+		}
+	})
+	It("reads the time from a unix timestamp", func() {
+		t, ok := pathtemplate.TimeFromPath("train-data/1583064309.json.zst")
+		Expect(ok).To(BeTrue())
+		Expect(t).To(Equal(expected))
+	})
+	It("reports paths without a time", func() {
+		_, ok := pathtemplate.TimeFromPath("train-data/date=2020-03-01/4f53cda1.json")
+		Expect(ok).To(BeFalse())
+	})
+})
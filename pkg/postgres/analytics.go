@@ -0,0 +1,299 @@
+package postgres
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+)
+
+//Day types that analytics are bucketed by, along with the hour of day
+const (
+	Weekday  = "weekday"
+	Saturday = "saturday"
+	Sunday   = "sunday"
+)
+
+//dayTypeOf buckets a timestamptz expression by its day type in the Eastern timezone
+func dayTypeOf(expr string) string {
+	return fmt.Sprintf(
+		`CASE EXTRACT(ISODOW FROM %s AT TIME ZONE 'America/New_York') WHEN 6 THEN '%s' WHEN 7 THEN '%s' ELSE '%s' END`,
+		expr, Saturday, Sunday, Weekday,
+	)
+}
+
+//hourOf buckets a timestamptz expression by its hour of day in the Eastern timezone
+func hourOf(expr string) string {
+	return fmt.Sprintf(`EXTRACT(HOUR FROM %s AT TIME ZONE 'America/New_York')::integer`, expr)
+}
+
+//lineOf resolves a line expression to its Line, since runs hold lines as the
+//MARTA API spells them ("GOLD") or, if they were written before that, as the
+//Line itself ("Gold")
+func lineOf(expr string) string {
+	var lines []string
+	for line := range martaapi.Lines {
+		lines = append(lines, string(line))
+	}
+	sort.Strings(lines)
+
+	cases := make([]string, len(lines))
+	for i, line := range lines {
+		cases[i] = fmt.Sprintf(`WHEN '%s' THEN '%s'`, martaapi.LineAPIName(martaapi.Line(line)), line)
+	}
+	return fmt.Sprintf(`CASE upper(%[1]s) %[2]s ELSE %[1]s END`, expr, strings.Join(cases, " "))
+}
+
+//directionOf resolves a direction expression to its Direction, since runs hold
+//directions as the MARTA API spells them ("N") or, if they were written before
+//that, as the Direction itself ("Northbound")
+func directionOf(expr string) string {
+	var dirs []string
+	for dir := range martaapi.Directions {
+		dirs = append(dirs, string(dir))
+	}
+	sort.Strings(dirs)
+
+	cases := make([]string, len(dirs))
+	for i, dir := range dirs {
+		cases[i] = fmt.Sprintf(`WHEN '%s' THEN '%s'`, martaapi.DirectionAPIName(martaapi.Direction(dir)), dir)
+	}
+	return fmt.Sprintf(`CASE upper(left(%[1]s, 1)) %[2]s ELSE %[1]s END`, expr, strings.Join(cases, " "))
+}
+
+//Percentiles summarize a distribution of durations, in seconds
+type Percentiles struct {
+	P10 float64 `json:"p10_seconds"`
+	P25 float64 `json:"p25_seconds"`
+	P50 float64 `json:"p50_seconds"`
+	P75 float64 `json:"p75_seconds"`
+	P90 float64 `json:"p90_seconds"`
+}
+
+//percentilesOf selects the Percentiles of an expression, in order
+func percentilesOf(expr string) string {
+	return fmt.Sprintf(`percentile_cont(0.1) WITHIN GROUP (ORDER BY %[1]s),
+  percentile_cont(0.25) WITHIN GROUP (ORDER BY %[1]s),
+  percentile_cont(0.5) WITHIN GROUP (ORDER BY %[1]s),
+  percentile_cont(0.75) WITHIN GROUP (ORDER BY %[1]s),
+  percentile_cont(0.9) WITHIN GROUP (ORDER BY %[1]s)`, expr)
+}
+
+//scanDest lists the destinations to scan the Percentiles into
+func (p *Percentiles) scanDest() []interface{} {
+	return []interface{}{&p.P10, &p.P25, &p.P50, &p.P75, &p.P90}
+}
+
+//HeadwayQuery selects the arrivals that headways are computed from. Arrivals are
+//taken at their refined times, where they've been refined.
+type HeadwayQuery struct {
+	From EasternTime
+	To   EasternTime
+	//MaxHeadway leaves out longer gaps between trains, which are breaks in
+	//service or in scraping rather than headways
+	MaxHeadway time.Duration
+	//IncludeInferred includes arrivals that were inferred rather than observed
+	IncludeInferred bool
+}
+
+//HeadwaySummary summarizes the headways between successive trains arriving at a
+//station on a line and in a direction, during one hour of one day type
+type HeadwaySummary struct {
+	Station   martaapi.Station   `json:"station"`
+	Line      martaapi.Line      `json:"line"`
+	Direction martaapi.Direction `json:"direction"`
+	DayType   string             `json:"day_type"`
+	Hour      int                `json:"hour"`
+
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean_seconds"`
+	Percentiles
+}
+
+//GetHeadwaySummaries computes the headway between each arrival and the one before
+//it at the same station, on the same line and in the same direction, and
+//summarizes them by station, line, direction, day type and hour. Lines and
+//directions are resolved first, so runs stored in either spelling are headways
+//of one another. A train that's recorded at a station twice, in two runs,
+//doesn't count as a headway.
+func (a *RepositoryAgent) GetHeadwaySummaries(query HeadwayQuery) (summaries []HeadwaySummary, err error) {
+	rows, err := a.DB.Query(`
+WITH observed AS (
+  SELECT arrivals.station,
+    `+lineOf("runs.corrected_line")+` AS line,
+    `+directionOf("runs.corrected_direction")+` AS direction,
+    runs.run_group_identifier,
+    COALESCE(arrivals.refined_arrival_time, arrivals.arrival_time) AS arrival_time
+  FROM arrivals
+  JOIN runs
+    ON runs.identifier = arrivals.run_identifier
+  WHERE arrivals.arrival_time >= $1
+    AND arrivals.arrival_time < $2
+    AND ($3 OR NOT arrivals.arrival_time_inferred)
+), successive AS (
+  SELECT station, line, direction, arrival_time,
+    EXTRACT(EPOCH FROM arrival_time - LAG(arrival_time) OVER w) AS headway,
+    run_group_identifier = LAG(run_group_identifier) OVER w AS same_train
+  FROM observed
+  WINDOW w AS (PARTITION BY station, line, direction ORDER BY arrival_time)
+)
+
+SELECT station, line, direction,
+  `+dayTypeOf("arrival_time")+` AS day_type,
+  `+hourOf("arrival_time")+` AS hour,
+  count(*), avg(headway),
+  `+percentilesOf("headway")+`
+FROM successive
+WHERE headway IS NOT NULL
+  AND NOT same_train
+  AND headway <= $4
+GROUP BY 1, 2, 3, 4, 5
+ORDER BY 1, 2, 3, 4, 5`,
+		query.From,
+		query.To,
+		query.IncludeInferred,
+		query.MaxHeadway.Seconds(),
+	)
+	if err != nil {
+		err = errors.Wrap(err, "failed to get headways")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary HeadwaySummary
+		var station string
+		err = rows.Scan(append([]interface{}{
+			&station,
+			&summary.Line,
+			&summary.Direction,
+			&summary.DayType,
+			&summary.Hour,
+			&summary.Count,
+			&summary.Mean,
+		}, summary.Percentiles.scanDest()...)...)
+		if err != nil {
+			err = errors.Wrap(err, "failed to scan headway summary")
+			return
+		}
+
+		summary.Station = martaapi.Station(station)
+		if s, ok := martaapi.StationFromAPIName(station); ok {
+			summary.Station = s
+		}
+		summaries = append(summaries, summary)
+	}
+
+	err = errors.Wrap(rows.Err(), "failed to read headway summaries")
+	return
+}
+
+//PredictionAccuracyQuery selects the estimates whose accuracy is summarized.
+//Arrivals are taken at their refined times, where they've been refined.
+type PredictionAccuracyQuery struct {
+	From EasternTime
+	To   EasternTime
+	//LeadBucket is the width of the lead time buckets
+	LeadBucket time.Duration
+	//MaxLead leaves out estimates made further ahead than this
+	MaxLead time.Duration
+	//IncludeInferred includes arrivals that were inferred rather than observed
+	IncludeInferred bool
+}
+
+//PredictionAccuracySummary summarizes the error of the estimates for a station,
+//on a line and in a direction, that were made during one hour of the day with a
+//lead time in one bucket. Errors are the estimated arrival time less the actual
+//one, so estimates of trains that came early are positive.
+type PredictionAccuracySummary struct {
+	//LeadMinutes is the start of the lead time bucket
+	LeadMinutes int                `json:"lead_minutes"`
+	Line        martaapi.Line      `json:"line"`
+	Direction   martaapi.Direction `json:"direction"`
+	Station     martaapi.Station   `json:"station"`
+	Hour        int                `json:"hour"`
+
+	Count int     `json:"count"`
+	Bias  float64 `json:"bias_seconds"`
+	MAE   float64 `json:"mae_seconds"`
+	Percentiles
+}
+
+//GetPredictionAccuracySummaries joins each estimate made before an arrival to
+//the arrival's actual time, and summarizes the errors by lead time bucket, line,
+//direction, station and the hour the estimate was made in. The lead time is how
+//far ahead the estimate placed the arrival when it was made. Lines and
+//directions are resolved, as they are for headways.
+func (a *RepositoryAgent) GetPredictionAccuracySummaries(query PredictionAccuracyQuery) (summaries []PredictionAccuracySummary, err error) {
+	rows, err := a.DB.Query(`
+WITH errors AS (
+  SELECT `+lineOf("runs.corrected_line")+` AS line,
+    `+directionOf("runs.corrected_direction")+` AS direction,
+    arrivals.station,
+    estimates.estimate_moment,
+    EXTRACT(EPOCH FROM estimates.estimated_arrival_time - estimates.estimate_moment) AS lead,
+    EXTRACT(EPOCH FROM estimates.estimated_arrival_time - COALESCE(arrivals.refined_arrival_time, arrivals.arrival_time)) AS error
+  FROM estimates
+  JOIN arrivals
+    ON arrivals.identifier = estimates.arrival_identifier
+  JOIN runs
+    ON runs.identifier = arrivals.run_identifier
+  WHERE arrivals.arrival_time >= $1
+    AND arrivals.arrival_time < $2
+    AND ($3 OR NOT arrivals.arrival_time_inferred)
+    AND estimates.estimate_moment <= COALESCE(arrivals.refined_arrival_time, arrivals.arrival_time)
+)
+
+SELECT (floor(lead / $4) * $4 / 60)::integer AS lead_minutes,
+  line, direction, station,
+  `+hourOf("estimate_moment")+` AS hour,
+  count(*), avg(error), avg(abs(error)),
+  `+percentilesOf("error")+`
+FROM errors
+WHERE lead >= 0
+  AND lead < $5
+GROUP BY 1, 2, 3, 4, 5
+ORDER BY 1, 2, 3, 4, 5`,
+		query.From,
+		query.To,
+		query.IncludeInferred,
+		query.LeadBucket.Seconds(),
+		query.MaxLead.Seconds(),
+	)
+	if err != nil {
+		err = errors.Wrap(err, "failed to get prediction errors")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary PredictionAccuracySummary
+		var station string
+		err = rows.Scan(append([]interface{}{
+			&summary.LeadMinutes,
+			&summary.Line,
+			&summary.Direction,
+			&station,
+			&summary.Hour,
+			&summary.Count,
+			&summary.Bias,
+			&summary.MAE,
+		}, summary.Percentiles.scanDest()...)...)
+		if err != nil {
+			err = errors.Wrap(err, "failed to scan prediction accuracy summary")
+			return
+		}
+
+		summary.Station = martaapi.Station(station)
+		if s, ok := martaapi.StationFromAPIName(station); ok {
+			summary.Station = s
+		}
+		summaries = append(summaries, summary)
+	}
+
+	err = errors.Wrap(rows.Err(), "failed to read prediction accuracy summaries")
+	return
+}
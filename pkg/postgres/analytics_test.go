@@ -0,0 +1,194 @@
+package postgres_test
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Analytics", func() {
+	var (
+		db    *sql.DB
+		smock sqlmock.Sqlmock
+
+		repo postgres.Repository
+	)
+
+	BeforeEach(func() {
+		var err error
+		db, smock, err = sqlmock.New()
+		Expect(err).To(BeNil())
+	})
+
+	JustBeforeEach(func() {
+		repo = postgres.NewRepository(zap.NewNop(), db)
+	})
+
+	Describe("GetHeadwaySummaries", func() {
+		var (
+			summaries []postgres.HeadwaySummary
+			callErr   error
+
+			query *sqlmock.ExpectedQuery
+			rows  *sqlmock.Rows
+		)
+		BeforeEach(func() {
+			rows = sqlmock.NewRows([]string{"station", "line", "direction", "day_type", "hour", "count", "avg", "p10", "p25", "p50", "p75", "p90"})
+			//runs hold lines and directions in either spelling, so they're resolved
+			//before they're partitioned by
+			query = smock.ExpectQuery(`(?s)CASE upper\(runs\.corrected_line\) WHEN 'BLUE' THEN 'Blue' WHEN 'GOLD' THEN 'Gold' WHEN 'GREEN' THEN 'Green' WHEN 'RED' THEN 'Red' ELSE runs\.corrected_line END AS line,
+    CASE upper\(left\(runs\.corrected_direction, 1\)\) WHEN 'E' THEN 'Eastbound' WHEN 'N' THEN 'Northbound' WHEN 'S' THEN 'Southbound' WHEN 'W' THEN 'Westbound' ELSE runs\.corrected_direction END AS direction,
+.*PARTITION BY station, line, direction
+.*FROM successive
+WHERE headway IS NOT NULL
+  AND NOT same_train
+  AND headway <= \$4`).
+				WithArgs(
+					easternDate(2019, time.August, 1, 0, 0, 0, 0),
+					easternDate(2019, time.September, 1, 0, 0, 0, 0),
+					false,
+					float64(3600),
+				)
+			query.WillReturnRows(rows)
+		})
+		JustBeforeEach(func() {
+			summaries, callErr = repo.GetHeadwaySummaries(postgres.HeadwayQuery{
+				From:       easternDate(2019, time.August, 1, 0, 0, 0, 0),
+				To:         easternDate(2019, time.September, 1, 0, 0, 0, 0),
+				MaxHeadway: time.Hour,
+			})
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				query.WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to get headways: query failed"))
+			})
+		})
+		When("a row is malformed", func() {
+			BeforeEach(func() {
+				rows.AddRow("GARNETT STATION", "Gold", "Northbound", postgres.Weekday, "eight", 12, 600.0, 300.0, 450.0, 600.0, 750.0, 900.0)
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to scan headway summary: ")))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				rows.AddRow("GARNETT STATION", "Gold", "Northbound", postgres.Weekday, 8, 12, 600.0, 300.0, 450.0, 600.0, 750.0, 900.0)
+				rows.AddRow("SOMEWHERE ELSE", "Gold", "Northbound", postgres.Sunday, 8, 2, 1200.0, 1200.0, 1200.0, 1200.0, 1200.0, 1200.0)
+			})
+			It("summarizes the headways", func() {
+				Expect(callErr).To(BeNil())
+				Expect(summaries).To(Equal([]postgres.HeadwaySummary{
+					{
+						Station:   martaapi.GarnettStation,
+						Line:      martaapi.Gold,
+						Direction: martaapi.North,
+						DayType:   postgres.Weekday,
+						Hour:      8,
+						Count:     12,
+						Mean:      600,
+						Percentiles: postgres.Percentiles{
+							P10: 300, P25: 450, P50: 600, P75: 750, P90: 900,
+						},
+					},
+					{
+						Station:   martaapi.Station("SOMEWHERE ELSE"),
+						Line:      martaapi.Gold,
+						Direction: martaapi.North,
+						DayType:   postgres.Sunday,
+						Hour:      8,
+						Count:     2,
+						Mean:      1200,
+						Percentiles: postgres.Percentiles{
+							P10: 1200, P25: 1200, P50: 1200, P75: 1200, P90: 1200,
+						},
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("GetPredictionAccuracySummaries", func() {
+		var (
+			summaries []postgres.PredictionAccuracySummary
+			callErr   error
+
+			query *sqlmock.ExpectedQuery
+			rows  *sqlmock.Rows
+		)
+		BeforeEach(func() {
+			rows = sqlmock.NewRows([]string{"lead_minutes", "line", "direction", "station", "hour", "count", "avg", "avg", "p10", "p25", "p50", "p75", "p90"})
+			query = smock.ExpectQuery(`(?s)SELECT CASE upper\(runs\.corrected_line\) WHEN 'BLUE' THEN 'Blue' .* AS line,
+    CASE upper\(left\(runs\.corrected_direction, 1\)\) WHEN 'E' THEN 'Eastbound' .* AS direction,
+.*SELECT \(floor\(lead / \$4\) \* \$4 / 60\)::integer AS lead_minutes,`).
+				WithArgs(
+					easternDate(2019, time.August, 1, 0, 0, 0, 0),
+					easternDate(2019, time.September, 1, 0, 0, 0, 0),
+					true,
+					float64(300),
+					float64(1800),
+				)
+			query.WillReturnRows(rows)
+		})
+		JustBeforeEach(func() {
+			summaries, callErr = repo.GetPredictionAccuracySummaries(postgres.PredictionAccuracyQuery{
+				From:            easternDate(2019, time.August, 1, 0, 0, 0, 0),
+				To:              easternDate(2019, time.September, 1, 0, 0, 0, 0),
+				LeadBucket:      5 * time.Minute,
+				MaxLead:         30 * time.Minute,
+				IncludeInferred: true,
+			})
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				query.WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to get prediction errors: query failed"))
+			})
+		})
+		When("a row is malformed", func() {
+			BeforeEach(func() {
+				rows.AddRow("five", "Gold", "Northbound", "GARNETT STATION", 8, 40, 12.5, 30.0, -20.0, 0.0, 15.0, 30.0, 45.0)
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to scan prediction accuracy summary: ")))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				rows.AddRow(5, "Gold", "Northbound", "GARNETT STATION", 8, 40, 12.5, 30.0, -20.0, 0.0, 15.0, 30.0, 45.0)
+			})
+			It("summarizes the errors", func() {
+				Expect(callErr).To(BeNil())
+				Expect(summaries).To(Equal([]postgres.PredictionAccuracySummary{
+					{
+						LeadMinutes: 5,
+						Line:        martaapi.Gold,
+						Direction:   martaapi.North,
+						Station:     martaapi.GarnettStation,
+						Hour:        8,
+						Count:       40,
+						Bias:        12.5,
+						MAE:         30,
+						Percentiles: postgres.Percentiles{
+							P10: -20, P25: 0, P50: 15, P75: 30, P90: 45,
+						},
+					},
+				}))
+			})
+		})
+	})
+})
@@ -0,0 +1,354 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+)
+
+//Record is a record to be upserted, along with the corrections and aliases
+//that AddRecordToDatabase takes alongside it
+type Record struct {
+	Schedule      martaapi.Schedule
+	CorrectedLine martaapi.Line
+	CorrectedDir  martaapi.Direction
+	LineID        *uint
+	DirID         *uint
+	StationID     *uint
+}
+
+//BatchUpserter upserts all the records of a snapshot at once
+//go:generate counterfeiter . BatchUpserter
+type BatchUpserter interface {
+	AddRecordsToDatabase(recs []Record) (err error)
+}
+
+//RecordErrors lists the records of a batch that couldn't be upserted, while
+//the rest of the batch was
+type RecordErrors []error
+
+func (e RecordErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return fmt.Sprintf("failed to upsert %d records: %s", len(e), strings.Join(msgs, "; "))
+}
+
+//RunKey identifies a run
+type RunKey struct {
+	Direction           martaapi.Direction
+	Line                martaapi.Line
+	TrainID             string
+	RunFirstEventMoment EasternTime
+}
+
+//Identifier is the run's identifier
+func (k RunKey) Identifier() string {
+	return RunIdentifierFor(k.Direction, k.Line, k.TrainID, k.RunFirstEventMoment)
+}
+
+//ArrivalIdentifier is the identifier of the run's arrival at a station
+func (k RunKey) ArrivalIdentifier(station martaapi.Station) string {
+	return ArrivalIdentifierFor(k.Direction, k.Line, k.TrainID, k.RunFirstEventMoment, station)
+}
+
+//RunQuery asks for the latest run in a run group as of a moment, as
+//GetLatestRunStartMomentFor does
+type RunQuery struct {
+	RunGroupIdentifier string
+	AsOf               EasternTime
+}
+
+//RunMoments are the first and most recent event moments of a run
+type RunMoments struct {
+	RunFirstEventMoment   EasternTime
+	MostRecentEventMoment EasternTime
+}
+
+//BatchRun is a run to be created
+type BatchRun struct {
+	RunKey
+	CorrectedLine      martaapi.Line
+	CorrectedDirection martaapi.Direction
+	LineID             *uint
+	DirID              *uint
+}
+
+//BatchArrival is an arrival record to be ensured
+type BatchArrival struct {
+	RunKey
+	Station   martaapi.Station
+	StationID *uint
+}
+
+//BatchEstimate is an arrival estimate to be added
+type BatchEstimate struct {
+	RunKey
+	Station   martaapi.Station
+	EventTime EasternTime
+	Estimate  EasternTime
+}
+
+//BatchArrivalTime is an arrival time to be set, unless one already is, along
+//with the latest moment the train was seen at the station, which is taken as
+//its departure unless a later one is already set
+type BatchArrivalTime struct {
+	RunKey
+	Station       martaapi.Station
+	ArrivalTime   EasternTime
+	DepartureTime EasternTime
+}
+
+//BatchArriving records that a train was arriving at a station, as
+//SetArrivingTime does
+type BatchArriving struct {
+	RunKey
+	Station   martaapi.Station
+	EventTime EasternTime
+}
+
+//BatchTouch sets the most recent event moment of a run
+type BatchTouch struct {
+	RunKey
+	MostRecentEventMoment EasternTime
+}
+
+//Batch is everything a snapshot writes, to be written in one transaction
+type Batch struct {
+	Runs         []BatchRun
+	Arrivals     []BatchArrival
+	Estimates    []BatchEstimate
+	Arrivings    []BatchArriving
+	ArrivalTimes []BatchArrivalTime
+	Touches      []BatchTouch
+}
+
+//batchRun is the state of a run as of the record being upserted, as it would
+//be in the database had the records before it been upserted one at a time
+type batchRun struct {
+	key        RunKey
+	mostRecent EasternTime
+}
+
+//batchBuilder splits a snapshot's records into runs the way AddRecordToDatabase
+//would, keeping track of the runs it creates and touches along the way
+type batchBuilder struct {
+	runLifetime time.Duration
+	latest      map[RunQuery]RunMoments
+	runs        map[string][]*batchRun
+	touches     map[string]int
+	arrivals    map[string]bool
+	arriving    map[string]int
+	arrived     map[string]int
+	batch       Batch
+	outcomes    []string
+}
+
+//runFor finds the run that a record belongs to, or creates one. Like
+//GetLatestRunStartMomentFor, it picks the run with the latest first event
+//moment among those whose most recent event isn't after the record's.
+func (b *batchBuilder) runFor(rec Record, eventTime EasternTime) *batchRun {
+	dir, line := martaapi.Direction(rec.Schedule.Direction), martaapi.Line(rec.Schedule.Line)
+	group := RunGroupIdentifierFor(dir, line, rec.Schedule.TrainID)
+
+	if moments, ok := b.latest[RunQuery{group, eventTime}]; ok {
+		b.knownRun(group, RunKey{dir, line, rec.Schedule.TrainID, moments.RunFirstEventMoment}, moments.MostRecentEventMoment)
+	}
+
+	var best *batchRun
+	for _, run := range b.runs[group] {
+		if time.Time(run.mostRecent).After(time.Time(eventTime)) {
+			continue
+		}
+		if best == nil || laterRun(run, best) {
+			best = run
+		}
+	}
+
+	if best != nil && !newRunRequired(best.key.RunFirstEventMoment, best.mostRecent, time.Time(eventTime), b.runLifetime) {
+		return best
+	}
+
+	key := RunKey{dir, line, rec.Schedule.TrainID, eventTime}
+	run := b.knownRun(group, key, eventTime)
+	b.batch.Runs = append(b.batch.Runs, BatchRun{
+		RunKey:             key,
+		CorrectedLine:      rec.CorrectedLine,
+		CorrectedDirection: rec.CorrectedDir,
+		LineID:             rec.LineID,
+		DirID:              rec.DirID,
+	})
+	b.outcomes = append(b.outcomes, metrics.RunCreated)
+	return run
+}
+
+func laterRun(a, b *batchRun) bool {
+	af, bf := time.Time(a.key.RunFirstEventMoment), time.Time(b.key.RunFirstEventMoment)
+	if !af.Equal(bf) {
+		return af.After(bf)
+	}
+	return time.Time(a.mostRecent).After(time.Time(b.mostRecent))
+}
+
+//knownRun adds a run to those the batch knows of, unless it already does
+func (b *batchBuilder) knownRun(group string, key RunKey, mostRecent EasternTime) *batchRun {
+	for _, run := range b.runs[group] {
+		if run.key.Identifier() == key.Identifier() {
+			return run
+		}
+	}
+	run := &batchRun{key: key, mostRecent: mostRecent}
+	b.runs[group] = append(b.runs[group], run)
+	return run
+}
+
+//touch sets the run's most recent event moment, which is written once per run
+func (b *batchBuilder) touch(run *batchRun, moment EasternTime) {
+	run.mostRecent = moment
+	id := run.key.Identifier()
+	if i, ok := b.touches[id]; ok {
+		b.batch.Touches[i].MostRecentEventMoment = moment
+		return
+	}
+	b.touches[id] = len(b.batch.Touches)
+	b.batch.Touches = append(b.batch.Touches, BatchTouch{run.key, moment})
+}
+
+func (b *batchBuilder) add(rec Record, eventTime EasternTime) error {
+	run := b.runFor(rec, eventTime)
+	station := martaapi.Station(rec.Schedule.Station)
+
+	arrivalID := run.key.ArrivalIdentifier(station)
+	if !b.arrivals[arrivalID] {
+		b.arrivals[arrivalID] = true
+		b.batch.Arrivals = append(b.batch.Arrivals, BatchArrival{run.key, station, rec.StationID})
+	}
+
+	if rec.Schedule.HasArrived() {
+		//only the first arrival is kept, as SetArrivalTime does, while the
+		//departure moves to the latest record of the train at the station
+		if i, ok := b.arrived[arrivalID]; ok {
+			if time.Time(eventTime).After(time.Time(b.batch.ArrivalTimes[i].DepartureTime)) {
+				b.batch.ArrivalTimes[i].DepartureTime = eventTime
+			}
+		} else {
+			b.arrived[arrivalID] = len(b.batch.ArrivalTimes)
+			b.batch.ArrivalTimes = append(b.batch.ArrivalTimes, BatchArrivalTime{run.key, station, eventTime, eventTime})
+		}
+		b.touch(run, eventTime)
+		b.outcomes = append(b.outcomes, metrics.ArrivalSet)
+		return nil
+	}
+	if rec.Schedule.IsArriving() {
+		//only the latest arriving record is kept, as SetArrivingTime does
+		if i, ok := b.arriving[arrivalID]; ok {
+			if time.Time(eventTime).After(time.Time(b.batch.Arrivings[i].EventTime)) {
+				b.batch.Arrivings[i].EventTime = eventTime
+			}
+		} else {
+			b.arriving[arrivalID] = len(b.batch.Arrivings)
+			b.batch.Arrivings = append(b.batch.Arrivings, BatchArriving{run.key, station, eventTime})
+		}
+		b.outcomes = append(b.outcomes, metrics.ArrivingRecorded)
+		return nil
+	}
+
+	goEstimate, err := time.ParseInLocation(martaapi.MartaAPITimeFormat, rec.Schedule.NextArrival, EasternTimeZone)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse record estimated arrival time `%s`", rec.Schedule.NextArrival)
+	}
+
+	//take the time part of estimate together with the date part of runFirstEventMoment
+	goRunFirstEventMoment := time.Time(run.key.RunFirstEventMoment)
+	estimate := EasternTime(time.Date(
+		goRunFirstEventMoment.Year(), goRunFirstEventMoment.Month(), goRunFirstEventMoment.Day(),
+		goEstimate.Hour(), goEstimate.Minute(), goEstimate.Second(), goEstimate.Nanosecond(),
+		EasternTimeZone,
+	))
+
+	b.batch.Estimates = append(b.batch.Estimates, BatchEstimate{run.key, station, eventTime, estimate})
+	b.touch(run, eventTime)
+	b.outcomes = append(b.outcomes, metrics.EstimateAdded)
+	return nil
+}
+
+//AddRecordsToDatabase upserts a snapshot's records with the same outcome as
+//upserting them one at a time with AddRecordToDatabase, but with one query to
+//look up their runs and one transaction to write them. If only some of the
+//records can't be upserted, the rest are, and RecordErrors is returned.
+func (a *UpserterAgent) AddRecordsToDatabase(recs []Record) (err error) {
+	var (
+		recErrs    RecordErrors
+		eventTimes = make([]EasternTime, len(recs))
+		valid      = make([]bool, len(recs))
+		queries    []RunQuery
+		queried    = map[RunQuery]bool{}
+	)
+	for i, rec := range recs {
+		goEventTime, err := time.ParseInLocation(martaapi.MartaAPIDatetimeFormat, rec.Schedule.EventTime, EasternTimeZone)
+		if err != nil {
+			recErrs = append(recErrs, errors.Wrapf(err, "failed to parse record event time `%s`", rec.Schedule.EventTime))
+			continue
+		}
+		eventTimes[i] = EasternTime(goEventTime)
+		valid[i] = true
+
+		q := RunQuery{
+			RunGroupIdentifier: RunGroupIdentifierFor(martaapi.Direction(rec.Schedule.Direction), martaapi.Line(rec.Schedule.Line), rec.Schedule.TrainID),
+			AsOf:               eventTimes[i],
+		}
+		if !queried[q] {
+			queried[q] = true
+			queries = append(queries, q)
+		}
+	}
+
+	latest, err := a.repo.GetLatestRunStartMomentsFor(queries)
+	if err != nil {
+		a.batchFailed(len(recs))
+		return errors.Wrap(err, "failed to get latest run start moments for batch")
+	}
+
+	b := batchBuilder{
+		runLifetime: a.runLifetime,
+		latest:      latest,
+		runs:        map[string][]*batchRun{},
+		touches:     map[string]int{},
+		arrivals:    map[string]bool{},
+		arriving:    map[string]int{},
+		arrived:     map[string]int{},
+	}
+	for i, rec := range recs {
+		if !valid[i] {
+			continue
+		}
+		if err := b.add(rec, eventTimes[i]); err != nil {
+			recErrs = append(recErrs, errors.Wrapf(err, "failed to upsert record `%s`", rec.Schedule.String()))
+		}
+	}
+
+	if err = a.repo.WriteBatch(b.batch); err != nil {
+		a.batchFailed(len(recs))
+		return errors.Wrapf(err, "failed to write batch of %d records", len(recs))
+	}
+
+	for _, outcome := range b.outcomes {
+		a.metrics.UpsertOutcome(outcome)
+	}
+	a.batchFailed(len(recErrs))
+	if len(recErrs) > 0 {
+		return recErrs
+	}
+	return nil
+}
+
+func (a *UpserterAgent) batchFailed(n int) {
+	for i := 0; i < n; i++ {
+		a.metrics.UpsertFailed()
+	}
+}
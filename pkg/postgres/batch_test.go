@@ -0,0 +1,194 @@
+package postgres_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+	"github.com/smartatransit/scrapedumper/pkg/postgres/postgresfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AddRecordsToDatabase", func() {
+	var (
+		repo *postgresfakes.FakeRepository
+		reg  *prometheus.Registry
+
+		recs    []postgres.Record
+		callErr error
+		batch   postgres.Batch
+	)
+
+	var record = func(trainID, station, eventTime, waitingTime string) postgres.Record {
+		return postgres.Record{
+			Schedule: martaapi.Schedule{
+				Direction:   "N",
+				Line:        "GOLD",
+				TrainID:     trainID,
+				Station:     station,
+				EventTime:   eventTime,
+				NextArrival: "9:45:02 PM",
+				WaitingTime: waitingTime,
+			},
+			CorrectedLine: martaapi.Gold,
+			CorrectedDir:  martaapi.North,
+		}
+	}
+
+	var expectCounts = func(upserts string, failures int) {
+		ExpectWithOffset(1, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+# HELP scrapedumper_postgres_upserts_total Changes made by the postgres upserter, by outcome.
+# TYPE scrapedumper_postgres_upserts_total counter
+%s
+# HELP scrapedumper_postgres_upsert_errors_total Records that the postgres upserter failed to upsert.
+# TYPE scrapedumper_postgres_upsert_errors_total counter
+scrapedumper_postgres_upsert_errors_total %d
+`, upserts, failures)), "scrapedumper_postgres_upserts_total", "scrapedumper_postgres_upsert_errors_total")).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		repo = &postgresfakes.FakeRepository{}
+		reg = prometheus.NewRegistry()
+		batch = postgres.Batch{}
+		recs = []postgres.Record{
+			record("324898", "FIVE POINTS STATION", "6/18/2019 9:41:02 PM", "3 min"),
+			record("324898", "GARNETT STATION", "6/18/2019 9:41:02 PM", "5 min"),
+			record("324898", "FIVE POINTS STATION", "6/18/2019 9:42:02 PM", "2 min"),
+		}
+	})
+	JustBeforeEach(func() {
+		callErr = postgres.NewUpserter(repo, 10*time.Minute, false, postgres.WithMetrics(metrics.New(reg))).AddRecordsToDatabase(recs)
+		if repo.WriteBatchCallCount() > 0 {
+			batch = repo.WriteBatchArgsForCall(0)
+		}
+	})
+
+	When("the run group has no runs", func() {
+		It("creates one run for the records", func() {
+			Expect(callErr).To(BeNil())
+			Expect(repo.GetLatestRunStartMomentsForCallCount()).To(Equal(1))
+			Expect(repo.GetLatestRunStartMomentsForArgsForCall(0)).To(Equal([]postgres.RunQuery{
+				{RunGroupIdentifier: "N_GOLD_324898", AsOf: easternDate(2019, time.June, 18, 21, 41, 2, 0)},
+				{RunGroupIdentifier: "N_GOLD_324898", AsOf: easternDate(2019, time.June, 18, 21, 42, 2, 0)},
+			}))
+
+			Expect(batch.Runs).To(HaveLen(1))
+			Expect(batch.Runs[0].RunFirstEventMoment).To(Equal(easternDate(2019, time.June, 18, 21, 41, 2, 0)))
+			Expect(batch.Runs[0].CorrectedLine).To(Equal(martaapi.Gold))
+			Expect(batch.Arrivals).To(HaveLen(2))
+			Expect(batch.Estimates).To(HaveLen(3))
+			Expect(batch.Estimates[2].Estimate).To(Equal(easternDate(2019, time.June, 18, 21, 45, 2, 0)))
+			Expect(batch.Touches).To(Equal([]postgres.BatchTouch{{
+				RunKey:                batch.Runs[0].RunKey,
+				MostRecentEventMoment: easternDate(2019, time.June, 18, 21, 42, 2, 0),
+			}}))
+
+			expectCounts(`scrapedumper_postgres_upserts_total{outcome="estimate_added"} 3
+scrapedumper_postgres_upserts_total{outcome="run_created"} 1`, 0)
+		})
+	})
+	When("the run group has a recent run", func() {
+		BeforeEach(func() {
+			repo.GetLatestRunStartMomentsForReturns(map[postgres.RunQuery]postgres.RunMoments{
+				{RunGroupIdentifier: "N_GOLD_324898", AsOf: easternDate(2019, time.June, 18, 21, 41, 2, 0)}: {
+					RunFirstEventMoment:   easternDate(2019, time.June, 18, 21, 35, 2, 0),
+					MostRecentEventMoment: easternDate(2019, time.June, 18, 21, 40, 2, 0),
+				},
+			}, nil)
+		})
+		It("adds the records to it", func() {
+			Expect(callErr).To(BeNil())
+			Expect(batch.Runs).To(BeEmpty())
+			Expect(batch.Estimates).To(HaveLen(3))
+			for _, estimate := range batch.Estimates {
+				Expect(estimate.RunFirstEventMoment).To(Equal(easternDate(2019, time.June, 18, 21, 35, 2, 0)))
+			}
+		})
+	})
+	When("the records are further apart than the run lifetime", func() {
+		BeforeEach(func() {
+			recs[2].Schedule.EventTime = "6/18/2019 9:55:02 PM"
+		})
+		It("splits them into two runs", func() {
+			Expect(callErr).To(BeNil())
+			Expect(batch.Runs).To(HaveLen(2))
+			Expect(batch.Runs[1].RunFirstEventMoment).To(Equal(easternDate(2019, time.June, 18, 21, 55, 2, 0)))
+			Expect(batch.Estimates[2].RunFirstEventMoment).To(Equal(easternDate(2019, time.June, 18, 21, 55, 2, 0)))
+			Expect(batch.Touches).To(HaveLen(2))
+		})
+	})
+	When("the train arrives", func() {
+		BeforeEach(func() {
+			recs[0].Schedule.WaitingTime = "Arrived"
+			recs[2].Schedule.WaitingTime = "Arrived"
+			recs[1].Schedule.WaitingTime = "Arriving"
+		})
+		It("keeps the first arrival time and records arriving records", func() {
+			Expect(callErr).To(BeNil())
+			Expect(batch.Estimates).To(BeEmpty())
+			Expect(batch.ArrivalTimes).To(HaveLen(1))
+			Expect(batch.ArrivalTimes[0].ArrivalTime).To(Equal(easternDate(2019, time.June, 18, 21, 41, 2, 0)))
+			Expect(batch.ArrivalTimes[0].DepartureTime).To(Equal(easternDate(2019, time.June, 18, 21, 42, 2, 0)))
+			Expect(batch.Arrivings).To(Equal([]postgres.BatchArriving{{
+				RunKey:    batch.Runs[0].RunKey,
+				Station:   martaapi.Station("GARNETT STATION"),
+				EventTime: easternDate(2019, time.June, 18, 21, 41, 2, 0),
+			}}))
+			expectCounts(`scrapedumper_postgres_upserts_total{outcome="arrival_set"} 2
+scrapedumper_postgres_upserts_total{outcome="arriving_recorded"} 1
+scrapedumper_postgres_upserts_total{outcome="run_created"} 1`, 0)
+		})
+	})
+	When("the train arrives and then boards", func() {
+		BeforeEach(func() {
+			recs[0].Schedule.WaitingTime = "Arrived"
+			recs[2].Schedule.WaitingTime = "Boarding"
+		})
+		It("departs at the last boarding record", func() {
+			Expect(callErr).To(BeNil())
+			Expect(batch.ArrivalTimes).To(HaveLen(1))
+			Expect(batch.ArrivalTimes[0].DepartureTime).To(Equal(easternDate(2019, time.June, 18, 21, 42, 2, 0)))
+		})
+	})
+	When("some records are malformed", func() {
+		BeforeEach(func() {
+			recs[0].Schedule.EventTime = "asdf"
+			recs[1].Schedule.NextArrival = "asdf"
+		})
+		It("upserts the rest and lists the failures", func() {
+			Expect(callErr).To(BeAssignableToTypeOf(postgres.RecordErrors{}))
+			Expect(callErr.(postgres.RecordErrors)).To(HaveLen(2))
+			Expect(batch.Estimates).To(HaveLen(1))
+			expectCounts(`scrapedumper_postgres_upserts_total{outcome="estimate_added"} 1
+scrapedumper_postgres_upserts_total{outcome="run_created"} 1`, 2)
+		})
+	})
+	When("looking up the runs fails", func() {
+		BeforeEach(func() {
+			repo.GetLatestRunStartMomentsForReturns(nil, errors.New("query failed"))
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError("failed to get latest run start moments for batch: query failed"))
+			Expect(repo.WriteBatchCallCount()).To(Equal(0))
+			expectCounts("", 3)
+		})
+	})
+	When("writing the batch fails", func() {
+		BeforeEach(func() {
+			repo.WriteBatchReturns(errors.New("transaction failed"))
+		})
+		It("fails without counting any outcomes", func() {
+			Expect(callErr).To(MatchError("failed to write batch of 3 records: transaction failed"))
+			expectCounts("", 3)
+		})
+	})
+})
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+)
+
+//BusRepository implements storage of MARTA bus positions
+//go:generate counterfeiter . BusRepository
+type BusRepository interface {
+	AddBusPosition(pos martaapi.BusPosition) (err error)
+}
+
+//BusTripIdentifierFor creates a bus trip identifier for the given metadata. MARTA
+//reuses trip IDs from one day to the next, so the service date is included.
+func BusTripIdentifierFor(route string, tripID string, vehicle string, messageTime EasternTime) string {
+	return fmt.Sprintf("%s_%s_%s_%s", route, tripID, vehicle, time.Time(messageTime).In(EasternTimeZone).Format("2006-01-02"))
+}
+
+//BusPositionIdentifierFor creates a bus position identifier for the given metadata
+func BusPositionIdentifierFor(tripIdentifier string, messageTime EasternTime) string {
+	return fmt.Sprintf("%s_%s", tripIdentifier, messageTime.String())
+}
+
+//AddBusPosition records a bus position, creating or touching its trip record
+func (a *RepositoryAgent) AddBusPosition(pos martaapi.BusPosition) (err error) {
+	goMessageTime, err := pos.MessageTimeIn(EasternTimeZone)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse message time for bus position `%s`", pos.String())
+		return
+	}
+	messageTime := EasternTime(goMessageTime)
+
+	lat, lon, err := pos.Coordinates()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse coordinates for bus position `%s`", pos.String())
+		return
+	}
+
+	//adherence is sometimes left blank, which we record as NULL
+	var adherence *int
+	if pos.Adherence != "" {
+		var adh int
+		adh, err = pos.AdherenceMinutes()
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse adherence for bus position `%s`", pos.String())
+			return
+		}
+		adherence = &adh
+	}
+
+	tripIdentifier := BusTripIdentifierFor(pos.Route, pos.TripID, pos.Vehicle, messageTime)
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to begin transaction to add bus position `%s`", pos.String())
+		return
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO bus_trips
+(identifier, route, trip_id, vehicle, direction, block_id, first_message_time, most_recent_message_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+ON CONFLICT (identifier) DO UPDATE
+SET most_recent_message_time = GREATEST(bus_trips.most_recent_message_time, EXCLUDED.most_recent_message_time)`,
+		tripIdentifier,
+		pos.Route,
+		pos.TripID,
+		pos.Vehicle,
+		pos.Direction,
+		pos.BlockID,
+		messageTime,
+	)
+	if err != nil {
+		rollback(tx, a.Logger)
+		err = errors.Wrapf(err, "failed to upsert bus trip for bus position `%s`", pos.String())
+		return
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO bus_positions
+(identifier, trip_identifier, stop_id, timepoint, latitude, longitude, adherence, message_time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT DO NOTHING`,
+		BusPositionIdentifierFor(tripIdentifier, messageTime),
+		tripIdentifier,
+		pos.StopID,
+		pos.Timepoint,
+		lat,
+		lon,
+		adherence,
+		messageTime,
+	)
+	if err != nil {
+		rollback(tx, a.Logger)
+		err = errors.Wrapf(err, "failed to insert bus position `%s`", pos.String())
+		return
+	}
+
+	err = errors.Wrapf(tx.Commit(), "failed to commit transaction when adding bus position `%s`", pos.String())
+	return
+}
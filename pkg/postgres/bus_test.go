@@ -0,0 +1,142 @@
+package postgres_test
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BusRepository", func() {
+	var (
+		db    *sql.DB
+		smock sqlmock.Sqlmock
+
+		repo postgres.BusRepository
+	)
+
+	BeforeEach(func() {
+		var err error
+		db, smock, err = sqlmock.New()
+		Expect(err).To(BeNil())
+	})
+
+	JustBeforeEach(func() {
+		repo = postgres.NewRepository(zap.NewNop(), db)
+	})
+
+	Describe("BusTripIdentifierFor", func() {
+		It("includes the service date", func() {
+			Expect(postgres.BusTripIdentifierFor("110", "6828745", "1545", easternDate(2020, time.January, 20, 10, 54, 47, 0))).
+				To(Equal("110_6828745_1545_2020-01-20"))
+		})
+	})
+
+	Describe("AddBusPosition", func() {
+		var (
+			pos     martaapi.BusPosition
+			callErr error
+
+			begin     *sqlmock.ExpectedBegin
+			tripExec  *sqlmock.ExpectedExec
+			posExec   *sqlmock.ExpectedExec
+			commit    *sqlmock.ExpectedCommit
+			msgMoment postgres.EasternTime
+		)
+		BeforeEach(func() {
+			pos = martaapi.ValidBusExpectation[0]
+			msgMoment = easternDate(2020, time.January, 20, 10, 54, 47, 0)
+
+			begin = smock.ExpectBegin()
+			tripExec = smock.ExpectExec(`INSERT INTO bus_trips`).
+				WithArgs("110_6828745_1545_2020-01-20", "110", "6828745", "1545", "Northbound", "501", msgMoment).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			posExec = smock.ExpectExec(`INSERT INTO bus_positions`).
+				WithArgs(
+					"110_6828745_1545_2020-01-20_2020-01-20T10:54:47-05:00",
+					"110_6828745_1545_2020-01-20",
+					"907462",
+					"Five Points Station",
+					33.7589027,
+					-84.3879138,
+					-2,
+					msgMoment,
+				).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			commit = smock.ExpectCommit()
+		})
+		JustBeforeEach(func() {
+			callErr = repo.AddBusPosition(pos)
+		})
+		When("the message time is malformed", func() {
+			BeforeEach(func() {
+				pos.MessageTime = "asdf"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to parse message time for bus position `110:Northbound:6828745:1545:asdf`")))
+			})
+		})
+		When("the coordinates are malformed", func() {
+			BeforeEach(func() {
+				pos.Latitude = "asdf"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to parse coordinates for bus position")))
+			})
+		})
+		When("the adherence is malformed", func() {
+			BeforeEach(func() {
+				pos.Adherence = "asdf"
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to parse adherence for bus position")))
+			})
+		})
+		When("beginning the transaction fails", func() {
+			BeforeEach(func() {
+				begin.WillReturnError(errors.New("begin failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to begin transaction to add bus position `110:Northbound:6828745:1545:1/20/2020 10:54:47 AM`: begin failed"))
+			})
+		})
+		When("the trip upsert fails", func() {
+			BeforeEach(func() {
+				tripExec.WillReturnError(errors.New("exec failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to upsert bus trip for bus position `110:Northbound:6828745:1545:1/20/2020 10:54:47 AM`: exec failed"))
+			})
+		})
+		When("the position insert fails", func() {
+			BeforeEach(func() {
+				posExec.WillReturnError(errors.New("exec failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to insert bus position `110:Northbound:6828745:1545:1/20/2020 10:54:47 AM`: exec failed"))
+			})
+		})
+		When("committing fails", func() {
+			BeforeEach(func() {
+				commit.WillReturnError(errors.New("commit failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to commit transaction when adding bus position `110:Northbound:6828745:1545:1/20/2020 10:54:47 AM`: commit failed"))
+			})
+		})
+		When("all goes well", func() {
+			It("succeeds", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+//migrationLockID identifies the advisory lock held while migrating, so that
+//instances starting at once don't migrate the same database concurrently
+const migrationLockID int64 = 7306925417
+
+//MigrationStatus is whether a migration has been applied, and when
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+//appliedMigration is a migration's row in schema_migrations. ThirdRail is
+//whether it was applied for a third-rail database.
+type appliedMigration struct {
+	AppliedAt time.Time
+	ThirdRail bool
+}
+
+//variesByThirdRail reports whether a migration differs in third-rail databases
+func (m Migration) variesByThirdRail() bool {
+	return !reflect.DeepEqual(m.Up(true), m.Up(false))
+}
+
+//variantName names the kind of database a migration was applied for
+func variantName(thirdRail bool) string {
+	if thirdRail {
+		return "third-rail"
+	}
+	return "standalone"
+}
+
+//Migrator applies and reverts migrations, keeping track of the ones that are
+//applied in the schema_migrations table
+type Migrator struct {
+	logger     *zap.Logger
+	db         *sql.DB
+	thirdRail  bool
+	migrations []Migration
+}
+
+//NewMigrator creates a new Migrator for Migrations
+func NewMigrator(logger *zap.Logger, db *sql.DB, thirdRail bool) *Migrator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Migrator{
+		logger:     logger,
+		db:         db,
+		thirdRail:  thirdRail,
+		migrations: Migrations,
+	}
+}
+
+//Status lists every migration, and whether it's been applied
+func (m *Migrator) Status(ctx context.Context) (statuses []MigrationStatus, err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to check migrations")
+	}
+	defer conn.Close()
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range m.migrations {
+		a, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{migration, ok, a.AppliedAt})
+	}
+	return statuses, nil
+}
+
+//Up applies the migrations that haven't been applied, in order, up to and
+//including the target version. A target of 0 applies all of them. It fails
+//without applying any if a migration that differs in third-rail databases was
+//applied for the other kind of database than this Migrator's, since the schema
+//wouldn't be the one that's expected.
+func (m *Migrator) Up(ctx context.Context, target int) (done []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if a, ok := applied[migration.Version]; ok && a.ThirdRail != m.thirdRail && migration.variesByThirdRail() {
+				return errors.Errorf(
+					"migration %d %s was applied for a %s database, but this is migrating a %s one",
+					migration.Version, migration.Name, variantName(a.ThirdRail), variantName(m.thirdRail),
+				)
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if target > 0 && migration.Version > target {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			m.logger.Info(fmt.Sprintf("applied migration %d %s", migration.Version, migration.Name))
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return
+}
+
+//Down reverts the latest steps applied migrations, latest first
+func (m *Migrator) Down(ctx context.Context, steps int) (done []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			m.logger.Info(fmt.Sprintf("reverted migration %d %s", migration.Version, migration.Name))
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return
+}
+
+//locked calls fn while holding the migration lock, with the migrations that
+//are applied as of taking it
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int]appliedMigration) error) error {
+	//advisory locks belong to a session, so everything happens on one connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to migrate")
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return errors.Wrap(err, "failed to take the migration lock")
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			m.logger.Error(fmt.Sprintf("failed to release the migration lock: %s", err.Error()))
+		}
+	}()
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+//apply applies or reverts a migration, and records that it did, in one
+//transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin transaction for migration %d %s", migration.Version, migration.Name)
+	}
+	defer func() {
+		if err != nil {
+			rollback(tx, m.logger)
+		}
+	}()
+
+	stmts := migration.Down(m.thirdRail)
+	if up {
+		stmts = migration.Up(m.thirdRail)
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "failed to run migration %d %s", migration.Version, migration.Name)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `
+INSERT INTO schema_migrations (version, name, third_rail)
+VALUES ($1, $2, $3)`, migration.Version, migration.Name, m.thirdRail)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+DELETE FROM schema_migrations
+WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to record migration %d %s", migration.Version, migration.Name)
+	}
+
+	return errors.Wrapf(tx.Commit(), "failed to commit migration %d %s", migration.Version, migration.Name)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	_, err := conn.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(	version integer,
+	name varchar NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now(),
+	third_rail boolean NOT NULL,
+
+	PRIMARY KEY (version)
+)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ensure schema_migrations table")
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at, third_rail FROM schema_migrations`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query applied migrations")
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var (
+			version int
+			a       appliedMigration
+		)
+		if err := rows.Scan(&version, &a.AppliedAt, &a.ThirdRail); err != nil {
+			return nil, errors.Wrap(err, "failed to scan applied migration")
+		}
+		applied[version] = a
+	}
+	return applied, errors.Wrap(rows.Err(), "failed to read applied migrations")
+}
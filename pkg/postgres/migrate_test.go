@@ -0,0 +1,242 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//expectAppliedMigrations expects the schema_migrations table to be ensured and
+//queried, returning the given versions as applied for a standalone database
+func expectAppliedMigrations(smock sqlmock.Sqlmock, applied ...int) *sqlmock.ExpectedQuery {
+	return expectAppliedMigrationsFor(smock, false, applied...)
+}
+
+//expectAppliedMigrationsFor is expectAppliedMigrations for either kind of
+//database
+func expectAppliedMigrationsFor(smock sqlmock.Sqlmock, thirdRail bool, applied ...int) *sqlmock.ExpectedQuery {
+	smock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at", "third_rail"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), thirdRail)
+	}
+	return smock.ExpectQuery(`SELECT version, applied_at, third_rail FROM schema_migrations`).WillReturnRows(rows)
+}
+
+//expectMigrationUp expects a migration to be applied and recorded
+func expectMigrationUp(smock sqlmock.Sqlmock, migration postgres.Migration, thirdRail bool) {
+	smock.ExpectBegin()
+	for range migration.Up(thirdRail) {
+		smock.ExpectExec(`.*`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	smock.ExpectExec(`INSERT INTO schema_migrations`).
+		WithArgs(migration.Version, migration.Name, thirdRail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	smock.ExpectCommit()
+}
+
+var _ = Describe("Migrator", func() {
+	var (
+		db    *sql.DB
+		smock sqlmock.Sqlmock
+
+		migrator *postgres.Migrator
+	)
+
+	BeforeEach(func() {
+		var err error
+		db, smock, err = sqlmock.New()
+		Expect(err).To(BeNil())
+	})
+
+	JustBeforeEach(func() {
+		migrator = postgres.NewMigrator(zap.NewNop(), db, false)
+	})
+
+	AfterEach(func() {
+		Expect(smock.ExpectationsWereMet()).To(BeNil())
+	})
+
+	Describe("Migrations", func() {
+		It("are numbered in order", func() {
+			for i, migration := range postgres.Migrations {
+				Expect(migration.Version).To(Equal(i + 1))
+				Expect(migration.Down(false)).NotTo(BeEmpty())
+			}
+		})
+		It("reference third-rail's tables only in third-rail databases", func() {
+			Expect(postgres.Migrations[0].Up(false)[0]).NotTo(ContainSubstring("REFERENCES"))
+			Expect(postgres.Migrations[0].Up(true)[0]).To(ContainSubstring("line_id integer REFERENCES lines(id)"))
+			Expect(postgres.Migrations[0].Up(true)[1]).To(ContainSubstring("station_id integer REFERENCES stations(id)"))
+		})
+		It("drop only the unnamed copies of the train indexes", func() {
+			up := postgres.Migrations[1].Up(false)
+			Expect(up[0]).To(ContainSubstring("DROP INDEX IF EXISTS"))
+			Expect(up[0]).To(ContainSubstring("AND indexname ~ '^(runs_run_group_identifier|"))
+			Expect(up[0]).NotTo(ContainSubstring("indisprimary"))
+		})
+		It("convert every moment column to timestamptz", func() {
+			up := postgres.Migrations[3].Up(false)
+			Expect(up).To(HaveLen(1))
+			Expect(up[0]).To(ContainSubstring("TYPE timestamptz"))
+			Expect(up[0]).To(ContainSubstring("('runs', 'run_first_event_moment')"))
+			Expect(up[0]).To(ContainSubstring("('bus_positions', 'message_time')"))
+			Expect(up[0]).To(ContainSubstring("RAISE EXCEPTION"))
+		})
+	})
+
+	Describe("Status", func() {
+		var (
+			statuses []postgres.MigrationStatus
+			callErr  error
+		)
+		JustBeforeEach(func() {
+			statuses, callErr = migrator.Status(context.Background())
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				expectAppliedMigrations(smock).WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to query applied migrations: query failed"))
+			})
+		})
+		When("some migrations are applied", func() {
+			BeforeEach(func() {
+				expectAppliedMigrations(smock, 1, 2)
+			})
+			It("lists every migration", func() {
+				Expect(callErr).To(BeNil())
+				Expect(statuses).To(HaveLen(len(postgres.Migrations)))
+				Expect(statuses[0].Applied).To(BeTrue())
+				Expect(statuses[0].AppliedAt).To(Equal(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+				Expect(statuses[1].Applied).To(BeTrue())
+				Expect(statuses[2].Applied).To(BeFalse())
+				Expect(statuses[2].Name).To(Equal("create_bus_tables"))
+			})
+		})
+	})
+
+	Describe("Up", func() {
+		var (
+			target  int
+			done    []postgres.Migration
+			callErr error
+
+			lock *sqlmock.ExpectedExec
+		)
+		BeforeEach(func() {
+			target = 0
+			lock = smock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+		JustBeforeEach(func() {
+			done, callErr = migrator.Up(context.Background(), target)
+		})
+		When("the lock can't be taken", func() {
+			BeforeEach(func() {
+				lock.WillReturnError(errors.New("exec failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to take the migration lock: exec failed"))
+			})
+		})
+		When("no migrations are applied", func() {
+			BeforeEach(func() {
+				expectAppliedMigrations(smock)
+				for _, migration := range postgres.Migrations {
+					expectMigrationUp(smock, migration, false)
+				}
+				smock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			})
+			It("applies them all in order", func() {
+				Expect(callErr).To(BeNil())
+				Expect(done).To(HaveLen(len(postgres.Migrations)))
+			})
+		})
+		When("some migrations are applied", func() {
+			BeforeEach(func() {
+				expectAppliedMigrations(smock, 1)
+				expectMigrationUp(smock, postgres.Migrations[1], false)
+				smock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+				target = 2
+			})
+			It("applies the rest up to the target", func() {
+				Expect(callErr).To(BeNil())
+				Expect(done).To(HaveLen(1))
+				Expect(done[0].Version).To(Equal(2))
+			})
+		})
+		When("the train tables were created for a third-rail database", func() {
+			BeforeEach(func() {
+				expectAppliedMigrationsFor(smock, true, 1, 2)
+				smock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			})
+			It("fails without applying anything", func() {
+				Expect(callErr).To(MatchError("migration 1 create_train_tables was applied for a third-rail database, but this is migrating a standalone one"))
+				Expect(done).To(BeEmpty())
+			})
+		})
+		When("only migrations that don't differ were applied for a third-rail database", func() {
+			BeforeEach(func() {
+				expectAppliedMigrationsFor(smock, true, 2)
+				expectMigrationUp(smock, postgres.Migrations[0], false)
+				smock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+				target = 2
+			})
+			It("applies the rest", func() {
+				Expect(callErr).To(BeNil())
+				Expect(done).To(HaveLen(1))
+			})
+		})
+		When("a migration fails", func() {
+			BeforeEach(func() {
+				expectAppliedMigrations(smock, 1, 2)
+				smock.ExpectBegin()
+				smock.ExpectExec(`CREATE TABLE IF NOT EXISTS bus_trips`).WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+				smock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			})
+			It("rolls it back and releases the lock", func() {
+				Expect(callErr).To(MatchError("failed to run migration 3 create_bus_tables: exec failed"))
+				Expect(done).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Down", func() {
+		var (
+			done    []postgres.Migration
+			callErr error
+		)
+		BeforeEach(func() {
+			smock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			expectAppliedMigrations(smock, 1, 2)
+
+			smock.ExpectBegin()
+			for range postgres.Migrations[1].Down(false) {
+				smock.ExpectExec(`DROP INDEX IF EXISTS`).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			smock.ExpectExec(`DELETE FROM schema_migrations`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+			smock.ExpectCommit()
+
+			smock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+		JustBeforeEach(func() {
+			done, callErr = migrator.Down(context.Background(), 1)
+		})
+		It("reverts the latest applied migration", func() {
+			Expect(callErr).To(BeNil())
+			Expect(done).To(HaveLen(1))
+			Expect(done[0].Name).To(Equal("index_train_tables"))
+		})
+	})
+})
@@ -0,0 +1,279 @@
+package postgres
+
+import "fmt"
+
+//Migration is a numbered change to the schema. Up applies it and Down reverts
+//it, and both are given whether the database is a third-rail database, in
+//which case the train tables reference third-rail's lines, directions and
+//stations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(thirdRail bool) []string
+	Down    func(thirdRail bool) []string
+}
+
+//statements is for migrations that don't differ in third-rail databases
+func statements(stmts ...string) func(bool) []string {
+	return func(bool) []string {
+		return stmts
+	}
+}
+
+//Migrations is the schema's history, in order. Migrations are never edited
+//once released; a change to the schema is a new migration at the end.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_train_tables",
+		//the tables may predate migrations, so they're only created if missing
+		Up: func(thirdRail bool) []string {
+			runsExtras := `
+	line_id integer,
+	direction_id integer,
+`
+			arrivalExtras := `
+	station_id integer,
+`
+			if thirdRail {
+				runsExtras = `
+	line_id integer REFERENCES lines(id),
+	direction_id integer REFERENCES directions(id),
+`
+				arrivalExtras = `
+	station_id integer REFERENCES stations(id),
+`
+			}
+
+			return []string{
+				fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS runs
+(	identifier varchar,
+	run_group_identifier varchar NOT NULL,
+	corrected_line varchar NOT NULL,
+	corrected_direction varchar NOT NULL,
+	most_recent_event_moment varchar NOT NULL,
+	run_first_event_moment varchar NOT NULL,%s
+	PRIMARY KEY (identifier)
+)`, runsExtras),
+				fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS arrivals
+(	identifier varchar,
+	run_identifier varchar NOT NULL,
+	station varchar NOT NULL,
+	arrival_time varchar,%s
+	PRIMARY KEY (identifier)
+)`, arrivalExtras),
+				`
+CREATE TABLE IF NOT EXISTS estimates
+(	identifier varchar,
+	run_identifier varchar NOT NULL,
+	arrival_identifier varchar NOT NULL,
+	estimate_moment varchar NOT NULL,
+	estimated_arrival_time varchar NOT NULL,
+	PRIMARY KEY (identifier)
+)`,
+			}
+		},
+		Down: statements(
+			`DROP TABLE IF EXISTS estimates`,
+			`DROP TABLE IF EXISTS arrivals`,
+			`DROP TABLE IF EXISTS runs`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "index_train_tables",
+		//before migrations, every start created another unnamed copy of each
+		//index, which Postgres named after the table and columns, numbering the
+		//copies. Only indexes with those names are dropped, in favor of one named
+		//index apiece. The runs index on run_group_identifier alone is left out,
+		//since the upsert index covers it.
+		Up: statements(
+			`
+DO $$
+DECLARE idx record;
+BEGIN
+	FOR idx IN
+		SELECT indexname
+		FROM pg_indexes
+		WHERE schemaname = current_schema()
+		  AND indexname ~ '^(runs_run_group_identifier|runs_run_group_identifier_run_first_event_moment_most_r[a-z_]*|arrivals_run_identifier|estimates_arrival_identifier|estimates_run_identifier)_idx[0-9]*$'
+	LOOP
+		EXECUTE 'DROP INDEX IF EXISTS ' || quote_ident(idx.indexname);
+	END LOOP;
+END
+$$`,
+			`CREATE INDEX runs_upsert_idx ON runs USING btree(
+	run_group_identifier,
+	run_first_event_moment DESC,
+	most_recent_event_moment DESC
+)`,
+			`CREATE INDEX arrivals_run_identifier_idx ON arrivals USING btree(run_identifier)`,
+			`CREATE INDEX estimates_arrival_identifier_idx ON estimates USING btree(arrival_identifier)`,
+			`CREATE INDEX estimates_run_identifier_idx ON estimates USING btree(run_identifier)`,
+		),
+		Down: statements(
+			`DROP INDEX IF EXISTS estimates_run_identifier_idx`,
+			`DROP INDEX IF EXISTS estimates_arrival_identifier_idx`,
+			`DROP INDEX IF EXISTS arrivals_run_identifier_idx`,
+			`DROP INDEX IF EXISTS runs_upsert_idx`,
+		),
+	},
+	{
+		Version: 3,
+		Name:    "create_bus_tables",
+		Up: statements(
+			`
+CREATE TABLE IF NOT EXISTS bus_trips
+(	identifier varchar,
+	route varchar NOT NULL,
+	trip_id varchar NOT NULL,
+	vehicle varchar NOT NULL,
+	direction varchar NOT NULL,
+	block_id varchar,
+	first_message_time varchar NOT NULL,
+	most_recent_message_time varchar NOT NULL,
+
+	PRIMARY KEY (identifier)
+)`,
+			`
+CREATE TABLE IF NOT EXISTS bus_positions
+(	identifier varchar,
+	trip_identifier varchar NOT NULL,
+	stop_id varchar,
+	timepoint varchar,
+	latitude double precision,
+	longitude double precision,
+	adherence integer,
+	message_time varchar NOT NULL,
+
+	PRIMARY KEY (identifier)
+)`,
+			`CREATE INDEX IF NOT EXISTS bus_trips_route_idx ON bus_trips USING btree(route, first_message_time)`,
+			`CREATE INDEX IF NOT EXISTS bus_positions_trip_identifier_idx ON bus_positions USING btree(trip_identifier)`,
+		),
+		Down: statements(
+			`DROP TABLE IF EXISTS bus_positions`,
+			`DROP TABLE IF EXISTS bus_trips`,
+		),
+	},
+	{
+		Version: 4,
+		Name:    "timestamptz_moments",
+		//moments were RFC3339 strings, which only sort correctly while they share
+		//an offset. Each column is converted in place, and the conversion is
+		//checked against an independent parse of the original strings, aborting
+		//the migration if any row was lost or changed.
+		Up: statements(`
+DO $$
+DECLARE
+	col record;
+	rows_before bigint;
+	rows_after bigint;
+	mismatched bigint;
+BEGIN
+	FOR col IN SELECT * FROM (VALUES ` + momentColumns + `) AS c(tbl, name)
+	LOOP
+		EXECUTE format('CREATE TEMP TABLE moments_before ON COMMIT DROP AS SELECT identifier, %I AS moment FROM %I', col.name, col.tbl);
+		EXECUTE 'SELECT count(*) FROM moments_before' INTO rows_before;
+
+		EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE timestamptz USING %I::timestamptz', col.tbl, col.name, col.name);
+
+		EXECUTE format('SELECT count(*) FROM %I', col.tbl) INTO rows_after;
+		IF rows_after <> rows_before THEN
+			RAISE EXCEPTION '%.% has % rows after conversion, expected %', col.tbl, col.name, rows_after, rows_before;
+		END IF;
+
+		EXECUTE format(
+			'SELECT count(*) FROM %I t JOIN moments_before b USING (identifier)
+			WHERE t.%I IS DISTINCT FROM (left(b.moment, 19)::timestamp - substr(b.moment, 20)::interval) AT TIME ZONE ''UTC''',
+			col.tbl, col.name
+		) INTO mismatched;
+		IF mismatched > 0 THEN
+			RAISE EXCEPTION '% values of %.% changed in conversion', mismatched, col.tbl, col.name;
+		END IF;
+
+		EXECUTE 'DROP TABLE moments_before';
+	END LOOP;
+END
+$$`),
+		//converting back writes RFC3339 strings in the Eastern timezone, as
+		//EasternTime used to
+		Down: statements(
+			`SET LOCAL TIME ZONE 'America/New_York'`,
+			`
+DO $$
+DECLARE
+	col record;
+BEGIN
+	FOR col IN SELECT * FROM (VALUES `+momentColumns+`) AS c(tbl, name)
+	LOOP
+		EXECUTE format(
+			'ALTER TABLE %I ALTER COLUMN %I TYPE varchar USING to_char(%I, ''YYYY-MM-DD"T"HH24:MI:SSTZH:TZM'')',
+			col.tbl, col.name, col.name
+		);
+	END LOOP;
+END
+$$`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "arrival_departures",
+		//arrivals recorded before this have no departure, since the records
+		//that would give it aren't kept
+		Up: statements(
+			`ALTER TABLE arrivals ADD COLUMN IF NOT EXISTS departure_time timestamptz`,
+			`ALTER TABLE arrivals ADD COLUMN IF NOT EXISTS dwell interval`,
+		),
+		Down: statements(
+			`ALTER TABLE arrivals DROP COLUMN IF EXISTS dwell`,
+			`ALTER TABLE arrivals DROP COLUMN IF EXISTS departure_time`,
+		),
+	},
+	{
+		Version: 6,
+		Name:    "arrival_refinement",
+		//arrival_time is left as it was observed, and the refiner's estimate
+		//of it is kept alongside, so that a refinement can always be redone
+		Up: statements(
+			`ALTER TABLE arrivals ADD COLUMN IF NOT EXISTS last_arriving_time timestamptz`,
+			`ALTER TABLE arrivals ADD COLUMN IF NOT EXISTS refined_arrival_time timestamptz`,
+			`ALTER TABLE arrivals ADD COLUMN IF NOT EXISTS arrival_time_method varchar`,
+			`CREATE INDEX IF NOT EXISTS arrivals_unrefined_idx ON arrivals USING btree(arrival_time) WHERE arrival_time_method IS NULL`,
+		),
+		Down: statements(
+			`DROP INDEX IF EXISTS arrivals_unrefined_idx`,
+			`ALTER TABLE arrivals DROP COLUMN IF EXISTS arrival_time_method`,
+			`ALTER TABLE arrivals DROP COLUMN IF EXISTS refined_arrival_time`,
+			`ALTER TABLE arrivals DROP COLUMN IF EXISTS last_arriving_time`,
+		),
+	},
+	{
+		Version: 7,
+		Name:    "arrival_inference",
+		Up: statements(
+			`ALTER TABLE arrivals ADD COLUMN IF NOT EXISTS arrival_time_inferred boolean NOT NULL DEFAULT false`,
+			`ALTER TABLE runs ADD COLUMN IF NOT EXISTS reconciled boolean NOT NULL DEFAULT false`,
+			`CREATE INDEX IF NOT EXISTS runs_unreconciled_idx ON runs USING btree(most_recent_event_moment) WHERE NOT reconciled`,
+		),
+		Down: statements(
+			`DROP INDEX IF EXISTS runs_unreconciled_idx`,
+			`ALTER TABLE runs DROP COLUMN IF EXISTS reconciled`,
+			`ALTER TABLE arrivals DROP COLUMN IF EXISTS arrival_time_inferred`,
+		),
+	},
+}
+
+//momentColumns lists the columns converted by the timestamptz_moments migration
+const momentColumns = `
+		('runs', 'most_recent_event_moment'),
+		('runs', 'run_first_event_moment'),
+		('arrivals', 'arrival_time'),
+		('estimates', 'estimate_moment'),
+		('estimates', 'estimated_arrival_time'),
+		('bus_trips', 'first_message_time'),
+		('bus_trips', 'most_recent_message_time'),
+		('bus_positions', 'message_time')
+	`
@@ -0,0 +1,116 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package postgresfakes
+
+import (
+	"sync"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+)
+
+type FakeBatchUpserter struct {
+	AddRecordsToDatabaseStub        func([]postgres.Record) error
+	addRecordsToDatabaseMutex       sync.RWMutex
+	addRecordsToDatabaseArgsForCall []struct {
+		arg1 []postgres.Record
+	}
+	addRecordsToDatabaseReturns struct {
+		result1 error
+	}
+	addRecordsToDatabaseReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeBatchUpserter) AddRecordsToDatabase(arg1 []postgres.Record) error {
+	var arg1Copy []postgres.Record
+	if arg1 != nil {
+		arg1Copy = make([]postgres.Record, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.addRecordsToDatabaseMutex.Lock()
+	ret, specificReturn := fake.addRecordsToDatabaseReturnsOnCall[len(fake.addRecordsToDatabaseArgsForCall)]
+	fake.addRecordsToDatabaseArgsForCall = append(fake.addRecordsToDatabaseArgsForCall, struct {
+		arg1 []postgres.Record
+	}{arg1Copy})
+	stub := fake.AddRecordsToDatabaseStub
+	fakeReturns := fake.addRecordsToDatabaseReturns
+	fake.recordInvocation("AddRecordsToDatabase", []interface{}{arg1Copy})
+	fake.addRecordsToDatabaseMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeBatchUpserter) AddRecordsToDatabaseCallCount() int {
+	fake.addRecordsToDatabaseMutex.RLock()
+	defer fake.addRecordsToDatabaseMutex.RUnlock()
+	return len(fake.addRecordsToDatabaseArgsForCall)
+}
+
+func (fake *FakeBatchUpserter) AddRecordsToDatabaseCalls(stub func([]postgres.Record) error) {
+	fake.addRecordsToDatabaseMutex.Lock()
+	defer fake.addRecordsToDatabaseMutex.Unlock()
+	fake.AddRecordsToDatabaseStub = stub
+}
+
+func (fake *FakeBatchUpserter) AddRecordsToDatabaseArgsForCall(i int) []postgres.Record {
+	fake.addRecordsToDatabaseMutex.RLock()
+	defer fake.addRecordsToDatabaseMutex.RUnlock()
+	argsForCall := fake.addRecordsToDatabaseArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeBatchUpserter) AddRecordsToDatabaseReturns(result1 error) {
+	fake.addRecordsToDatabaseMutex.Lock()
+	defer fake.addRecordsToDatabaseMutex.Unlock()
+	fake.AddRecordsToDatabaseStub = nil
+	fake.addRecordsToDatabaseReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBatchUpserter) AddRecordsToDatabaseReturnsOnCall(i int, result1 error) {
+	fake.addRecordsToDatabaseMutex.Lock()
+	defer fake.addRecordsToDatabaseMutex.Unlock()
+	fake.AddRecordsToDatabaseStub = nil
+	if fake.addRecordsToDatabaseReturnsOnCall == nil {
+		fake.addRecordsToDatabaseReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addRecordsToDatabaseReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBatchUpserter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.addRecordsToDatabaseMutex.RLock()
+	defer fake.addRecordsToDatabaseMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeBatchUpserter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ postgres.BatchUpserter = new(FakeBatchUpserter)
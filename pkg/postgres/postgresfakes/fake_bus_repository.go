@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package postgresfakes
+
+import (
+	"sync"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+)
+
+type FakeBusRepository struct {
+	AddBusPositionStub        func(martaapi.BusPosition) error
+	addBusPositionMutex       sync.RWMutex
+	addBusPositionArgsForCall []struct {
+		arg1 martaapi.BusPosition
+	}
+	addBusPositionReturns struct {
+		result1 error
+	}
+	addBusPositionReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeBusRepository) AddBusPosition(arg1 martaapi.BusPosition) error {
+	fake.addBusPositionMutex.Lock()
+	ret, specificReturn := fake.addBusPositionReturnsOnCall[len(fake.addBusPositionArgsForCall)]
+	fake.addBusPositionArgsForCall = append(fake.addBusPositionArgsForCall, struct {
+		arg1 martaapi.BusPosition
+	}{arg1})
+	stub := fake.AddBusPositionStub
+	fakeReturns := fake.addBusPositionReturns
+	fake.recordInvocation("AddBusPosition", []interface{}{arg1})
+	fake.addBusPositionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeBusRepository) AddBusPositionCallCount() int {
+	fake.addBusPositionMutex.RLock()
+	defer fake.addBusPositionMutex.RUnlock()
+	return len(fake.addBusPositionArgsForCall)
+}
+
+func (fake *FakeBusRepository) AddBusPositionCalls(stub func(martaapi.BusPosition) error) {
+	fake.addBusPositionMutex.Lock()
+	defer fake.addBusPositionMutex.Unlock()
+	fake.AddBusPositionStub = stub
+}
+
+func (fake *FakeBusRepository) AddBusPositionArgsForCall(i int) martaapi.BusPosition {
+	fake.addBusPositionMutex.RLock()
+	defer fake.addBusPositionMutex.RUnlock()
+	argsForCall := fake.addBusPositionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeBusRepository) AddBusPositionReturns(result1 error) {
+	fake.addBusPositionMutex.Lock()
+	defer fake.addBusPositionMutex.Unlock()
+	fake.AddBusPositionStub = nil
+	fake.addBusPositionReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBusRepository) AddBusPositionReturnsOnCall(i int, result1 error) {
+	fake.addBusPositionMutex.Lock()
+	defer fake.addBusPositionMutex.Unlock()
+	fake.AddBusPositionStub = nil
+	if fake.addBusPositionReturnsOnCall == nil {
+		fake.addBusPositionReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addBusPositionReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBusRepository) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.addBusPositionMutex.RLock()
+	defer fake.addBusPositionMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeBusRepository) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ postgres.BusRepository = new(FakeBusRepository)
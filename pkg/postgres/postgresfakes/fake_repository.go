@@ -88,6 +88,19 @@ type FakeRepository struct {
 	ensureTablesReturnsOnCall map[int]struct {
 		result1 error
 	}
+	GetHeadwaySummariesStub        func(postgres.HeadwayQuery) ([]postgres.HeadwaySummary, error)
+	getHeadwaySummariesMutex       sync.RWMutex
+	getHeadwaySummariesArgsForCall []struct {
+		arg1 postgres.HeadwayQuery
+	}
+	getHeadwaySummariesReturns struct {
+		result1 []postgres.HeadwaySummary
+		result2 error
+	}
+	getHeadwaySummariesReturnsOnCall map[int]struct {
+		result1 []postgres.HeadwaySummary
+		result2 error
+	}
 	GetLatestEstimatesStub        func(uint) ([]postgres.LastestEstimate, error)
 	getLatestEstimatesMutex       sync.RWMutex
 	getLatestEstimatesArgsForCall []struct {
@@ -119,6 +132,32 @@ type FakeRepository struct {
 		result2 postgres.EasternTime
 		result3 error
 	}
+	GetLatestRunStartMomentsForStub        func([]postgres.RunQuery) (map[postgres.RunQuery]postgres.RunMoments, error)
+	getLatestRunStartMomentsForMutex       sync.RWMutex
+	getLatestRunStartMomentsForArgsForCall []struct {
+		arg1 []postgres.RunQuery
+	}
+	getLatestRunStartMomentsForReturns struct {
+		result1 map[postgres.RunQuery]postgres.RunMoments
+		result2 error
+	}
+	getLatestRunStartMomentsForReturnsOnCall map[int]struct {
+		result1 map[postgres.RunQuery]postgres.RunMoments
+		result2 error
+	}
+	GetPredictionAccuracySummariesStub        func(postgres.PredictionAccuracyQuery) ([]postgres.PredictionAccuracySummary, error)
+	getPredictionAccuracySummariesMutex       sync.RWMutex
+	getPredictionAccuracySummariesArgsForCall []struct {
+		arg1 postgres.PredictionAccuracyQuery
+	}
+	getPredictionAccuracySummariesReturns struct {
+		result1 []postgres.PredictionAccuracySummary
+		result2 error
+	}
+	getPredictionAccuracySummariesReturnsOnCall map[int]struct {
+		result1 []postgres.PredictionAccuracySummary
+		result2 error
+	}
 	GetRecentlyActiveRunsStub        func(postgres.EasternTime) (map[string]postgres.Run, error)
 	getRecentlyActiveRunsMutex       sync.RWMutex
 	getRecentlyActiveRunsArgsForCall []struct {
@@ -132,6 +171,34 @@ type FakeRepository struct {
 		result1 map[string]postgres.Run
 		result2 error
 	}
+	GetUnreconciledRunsStub        func(postgres.EasternTime, int) ([]postgres.Run, error)
+	getUnreconciledRunsMutex       sync.RWMutex
+	getUnreconciledRunsArgsForCall []struct {
+		arg1 postgres.EasternTime
+		arg2 int
+	}
+	getUnreconciledRunsReturns struct {
+		result1 []postgres.Run
+		result2 error
+	}
+	getUnreconciledRunsReturnsOnCall map[int]struct {
+		result1 []postgres.Run
+		result2 error
+	}
+	GetUnrefinedArrivalsStub        func(postgres.EasternTime, int) ([]postgres.ArrivalObservations, error)
+	getUnrefinedArrivalsMutex       sync.RWMutex
+	getUnrefinedArrivalsArgsForCall []struct {
+		arg1 postgres.EasternTime
+		arg2 int
+	}
+	getUnrefinedArrivalsReturns struct {
+		result1 []postgres.ArrivalObservations
+		result2 error
+	}
+	getUnrefinedArrivalsReturnsOnCall map[int]struct {
+		result1 []postgres.ArrivalObservations
+		result2 error
+	}
 	SetArrivalTimeStub        func(martaapi.Direction, martaapi.Line, string, postgres.EasternTime, martaapi.Station, postgres.EasternTime, postgres.EasternTime) error
 	setArrivalTimeMutex       sync.RWMutex
 	setArrivalTimeArgsForCall []struct {
@@ -149,6 +216,56 @@ type FakeRepository struct {
 	setArrivalTimeReturnsOnCall map[int]struct {
 		result1 error
 	}
+	SetArrivingTimeStub        func(martaapi.Direction, martaapi.Line, string, postgres.EasternTime, martaapi.Station, postgres.EasternTime) error
+	setArrivingTimeMutex       sync.RWMutex
+	setArrivingTimeArgsForCall []struct {
+		arg1 martaapi.Direction
+		arg2 martaapi.Line
+		arg3 string
+		arg4 postgres.EasternTime
+		arg5 martaapi.Station
+		arg6 postgres.EasternTime
+	}
+	setArrivingTimeReturns struct {
+		result1 error
+	}
+	setArrivingTimeReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SetInferredArrivalTimesStub        func([]postgres.InferredArrival, []string) error
+	setInferredArrivalTimesMutex       sync.RWMutex
+	setInferredArrivalTimesArgsForCall []struct {
+		arg1 []postgres.InferredArrival
+		arg2 []string
+	}
+	setInferredArrivalTimesReturns struct {
+		result1 error
+	}
+	setInferredArrivalTimesReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SetRefinedArrivalTimesStub        func([]postgres.RefinedArrival) error
+	setRefinedArrivalTimesMutex       sync.RWMutex
+	setRefinedArrivalTimesArgsForCall []struct {
+		arg1 []postgres.RefinedArrival
+	}
+	setRefinedArrivalTimesReturns struct {
+		result1 error
+	}
+	setRefinedArrivalTimesReturnsOnCall map[int]struct {
+		result1 error
+	}
+	WriteBatchStub        func(postgres.Batch) error
+	writeBatchMutex       sync.RWMutex
+	writeBatchArgsForCall []struct {
+		arg1 postgres.Batch
+	}
+	writeBatchReturns struct {
+		result1 error
+	}
+	writeBatchReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -485,6 +602,70 @@ func (fake *FakeRepository) EnsureTablesReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeRepository) GetHeadwaySummaries(arg1 postgres.HeadwayQuery) ([]postgres.HeadwaySummary, error) {
+	fake.getHeadwaySummariesMutex.Lock()
+	ret, specificReturn := fake.getHeadwaySummariesReturnsOnCall[len(fake.getHeadwaySummariesArgsForCall)]
+	fake.getHeadwaySummariesArgsForCall = append(fake.getHeadwaySummariesArgsForCall, struct {
+		arg1 postgres.HeadwayQuery
+	}{arg1})
+	stub := fake.GetHeadwaySummariesStub
+	fakeReturns := fake.getHeadwaySummariesReturns
+	fake.recordInvocation("GetHeadwaySummaries", []interface{}{arg1})
+	fake.getHeadwaySummariesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) GetHeadwaySummariesCallCount() int {
+	fake.getHeadwaySummariesMutex.RLock()
+	defer fake.getHeadwaySummariesMutex.RUnlock()
+	return len(fake.getHeadwaySummariesArgsForCall)
+}
+
+func (fake *FakeRepository) GetHeadwaySummariesCalls(stub func(postgres.HeadwayQuery) ([]postgres.HeadwaySummary, error)) {
+	fake.getHeadwaySummariesMutex.Lock()
+	defer fake.getHeadwaySummariesMutex.Unlock()
+	fake.GetHeadwaySummariesStub = stub
+}
+
+func (fake *FakeRepository) GetHeadwaySummariesArgsForCall(i int) postgres.HeadwayQuery {
+	fake.getHeadwaySummariesMutex.RLock()
+	defer fake.getHeadwaySummariesMutex.RUnlock()
+	argsForCall := fake.getHeadwaySummariesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) GetHeadwaySummariesReturns(result1 []postgres.HeadwaySummary, result2 error) {
+	fake.getHeadwaySummariesMutex.Lock()
+	defer fake.getHeadwaySummariesMutex.Unlock()
+	fake.GetHeadwaySummariesStub = nil
+	fake.getHeadwaySummariesReturns = struct {
+		result1 []postgres.HeadwaySummary
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetHeadwaySummariesReturnsOnCall(i int, result1 []postgres.HeadwaySummary, result2 error) {
+	fake.getHeadwaySummariesMutex.Lock()
+	defer fake.getHeadwaySummariesMutex.Unlock()
+	fake.GetHeadwaySummariesStub = nil
+	if fake.getHeadwaySummariesReturnsOnCall == nil {
+		fake.getHeadwaySummariesReturnsOnCall = make(map[int]struct {
+			result1 []postgres.HeadwaySummary
+			result2 error
+		})
+	}
+	fake.getHeadwaySummariesReturnsOnCall[i] = struct {
+		result1 []postgres.HeadwaySummary
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeRepository) GetLatestEstimates(arg1 uint) ([]postgres.LastestEstimate, error) {
 	fake.getLatestEstimatesMutex.Lock()
 	ret, specificReturn := fake.getLatestEstimatesReturnsOnCall[len(fake.getLatestEstimatesArgsForCall)]
@@ -619,6 +800,139 @@ func (fake *FakeRepository) GetLatestRunStartMomentForReturnsOnCall(i int, resul
 	}{result1, result2, result3}
 }
 
+func (fake *FakeRepository) GetLatestRunStartMomentsFor(arg1 []postgres.RunQuery) (map[postgres.RunQuery]postgres.RunMoments, error) {
+	var arg1Copy []postgres.RunQuery
+	if arg1 != nil {
+		arg1Copy = make([]postgres.RunQuery, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.getLatestRunStartMomentsForMutex.Lock()
+	ret, specificReturn := fake.getLatestRunStartMomentsForReturnsOnCall[len(fake.getLatestRunStartMomentsForArgsForCall)]
+	fake.getLatestRunStartMomentsForArgsForCall = append(fake.getLatestRunStartMomentsForArgsForCall, struct {
+		arg1 []postgres.RunQuery
+	}{arg1Copy})
+	stub := fake.GetLatestRunStartMomentsForStub
+	fakeReturns := fake.getLatestRunStartMomentsForReturns
+	fake.recordInvocation("GetLatestRunStartMomentsFor", []interface{}{arg1Copy})
+	fake.getLatestRunStartMomentsForMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) GetLatestRunStartMomentsForCallCount() int {
+	fake.getLatestRunStartMomentsForMutex.RLock()
+	defer fake.getLatestRunStartMomentsForMutex.RUnlock()
+	return len(fake.getLatestRunStartMomentsForArgsForCall)
+}
+
+func (fake *FakeRepository) GetLatestRunStartMomentsForCalls(stub func([]postgres.RunQuery) (map[postgres.RunQuery]postgres.RunMoments, error)) {
+	fake.getLatestRunStartMomentsForMutex.Lock()
+	defer fake.getLatestRunStartMomentsForMutex.Unlock()
+	fake.GetLatestRunStartMomentsForStub = stub
+}
+
+func (fake *FakeRepository) GetLatestRunStartMomentsForArgsForCall(i int) []postgres.RunQuery {
+	fake.getLatestRunStartMomentsForMutex.RLock()
+	defer fake.getLatestRunStartMomentsForMutex.RUnlock()
+	argsForCall := fake.getLatestRunStartMomentsForArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) GetLatestRunStartMomentsForReturns(result1 map[postgres.RunQuery]postgres.RunMoments, result2 error) {
+	fake.getLatestRunStartMomentsForMutex.Lock()
+	defer fake.getLatestRunStartMomentsForMutex.Unlock()
+	fake.GetLatestRunStartMomentsForStub = nil
+	fake.getLatestRunStartMomentsForReturns = struct {
+		result1 map[postgres.RunQuery]postgres.RunMoments
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetLatestRunStartMomentsForReturnsOnCall(i int, result1 map[postgres.RunQuery]postgres.RunMoments, result2 error) {
+	fake.getLatestRunStartMomentsForMutex.Lock()
+	defer fake.getLatestRunStartMomentsForMutex.Unlock()
+	fake.GetLatestRunStartMomentsForStub = nil
+	if fake.getLatestRunStartMomentsForReturnsOnCall == nil {
+		fake.getLatestRunStartMomentsForReturnsOnCall = make(map[int]struct {
+			result1 map[postgres.RunQuery]postgres.RunMoments
+			result2 error
+		})
+	}
+	fake.getLatestRunStartMomentsForReturnsOnCall[i] = struct {
+		result1 map[postgres.RunQuery]postgres.RunMoments
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetPredictionAccuracySummaries(arg1 postgres.PredictionAccuracyQuery) ([]postgres.PredictionAccuracySummary, error) {
+	fake.getPredictionAccuracySummariesMutex.Lock()
+	ret, specificReturn := fake.getPredictionAccuracySummariesReturnsOnCall[len(fake.getPredictionAccuracySummariesArgsForCall)]
+	fake.getPredictionAccuracySummariesArgsForCall = append(fake.getPredictionAccuracySummariesArgsForCall, struct {
+		arg1 postgres.PredictionAccuracyQuery
+	}{arg1})
+	stub := fake.GetPredictionAccuracySummariesStub
+	fakeReturns := fake.getPredictionAccuracySummariesReturns
+	fake.recordInvocation("GetPredictionAccuracySummaries", []interface{}{arg1})
+	fake.getPredictionAccuracySummariesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) GetPredictionAccuracySummariesCallCount() int {
+	fake.getPredictionAccuracySummariesMutex.RLock()
+	defer fake.getPredictionAccuracySummariesMutex.RUnlock()
+	return len(fake.getPredictionAccuracySummariesArgsForCall)
+}
+
+func (fake *FakeRepository) GetPredictionAccuracySummariesCalls(stub func(postgres.PredictionAccuracyQuery) ([]postgres.PredictionAccuracySummary, error)) {
+	fake.getPredictionAccuracySummariesMutex.Lock()
+	defer fake.getPredictionAccuracySummariesMutex.Unlock()
+	fake.GetPredictionAccuracySummariesStub = stub
+}
+
+func (fake *FakeRepository) GetPredictionAccuracySummariesArgsForCall(i int) postgres.PredictionAccuracyQuery {
+	fake.getPredictionAccuracySummariesMutex.RLock()
+	defer fake.getPredictionAccuracySummariesMutex.RUnlock()
+	argsForCall := fake.getPredictionAccuracySummariesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) GetPredictionAccuracySummariesReturns(result1 []postgres.PredictionAccuracySummary, result2 error) {
+	fake.getPredictionAccuracySummariesMutex.Lock()
+	defer fake.getPredictionAccuracySummariesMutex.Unlock()
+	fake.GetPredictionAccuracySummariesStub = nil
+	fake.getPredictionAccuracySummariesReturns = struct {
+		result1 []postgres.PredictionAccuracySummary
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetPredictionAccuracySummariesReturnsOnCall(i int, result1 []postgres.PredictionAccuracySummary, result2 error) {
+	fake.getPredictionAccuracySummariesMutex.Lock()
+	defer fake.getPredictionAccuracySummariesMutex.Unlock()
+	fake.GetPredictionAccuracySummariesStub = nil
+	if fake.getPredictionAccuracySummariesReturnsOnCall == nil {
+		fake.getPredictionAccuracySummariesReturnsOnCall = make(map[int]struct {
+			result1 []postgres.PredictionAccuracySummary
+			result2 error
+		})
+	}
+	fake.getPredictionAccuracySummariesReturnsOnCall[i] = struct {
+		result1 []postgres.PredictionAccuracySummary
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeRepository) GetRecentlyActiveRuns(arg1 postgres.EasternTime) (map[string]postgres.Run, error) {
 	fake.getRecentlyActiveRunsMutex.Lock()
 	ret, specificReturn := fake.getRecentlyActiveRunsReturnsOnCall[len(fake.getRecentlyActiveRunsArgsForCall)]
@@ -683,6 +997,136 @@ func (fake *FakeRepository) GetRecentlyActiveRunsReturnsOnCall(i int, result1 ma
 	}{result1, result2}
 }
 
+func (fake *FakeRepository) GetUnreconciledRuns(arg1 postgres.EasternTime, arg2 int) ([]postgres.Run, error) {
+	fake.getUnreconciledRunsMutex.Lock()
+	ret, specificReturn := fake.getUnreconciledRunsReturnsOnCall[len(fake.getUnreconciledRunsArgsForCall)]
+	fake.getUnreconciledRunsArgsForCall = append(fake.getUnreconciledRunsArgsForCall, struct {
+		arg1 postgres.EasternTime
+		arg2 int
+	}{arg1, arg2})
+	stub := fake.GetUnreconciledRunsStub
+	fakeReturns := fake.getUnreconciledRunsReturns
+	fake.recordInvocation("GetUnreconciledRuns", []interface{}{arg1, arg2})
+	fake.getUnreconciledRunsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) GetUnreconciledRunsCallCount() int {
+	fake.getUnreconciledRunsMutex.RLock()
+	defer fake.getUnreconciledRunsMutex.RUnlock()
+	return len(fake.getUnreconciledRunsArgsForCall)
+}
+
+func (fake *FakeRepository) GetUnreconciledRunsCalls(stub func(postgres.EasternTime, int) ([]postgres.Run, error)) {
+	fake.getUnreconciledRunsMutex.Lock()
+	defer fake.getUnreconciledRunsMutex.Unlock()
+	fake.GetUnreconciledRunsStub = stub
+}
+
+func (fake *FakeRepository) GetUnreconciledRunsArgsForCall(i int) (postgres.EasternTime, int) {
+	fake.getUnreconciledRunsMutex.RLock()
+	defer fake.getUnreconciledRunsMutex.RUnlock()
+	argsForCall := fake.getUnreconciledRunsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRepository) GetUnreconciledRunsReturns(result1 []postgres.Run, result2 error) {
+	fake.getUnreconciledRunsMutex.Lock()
+	defer fake.getUnreconciledRunsMutex.Unlock()
+	fake.GetUnreconciledRunsStub = nil
+	fake.getUnreconciledRunsReturns = struct {
+		result1 []postgres.Run
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetUnreconciledRunsReturnsOnCall(i int, result1 []postgres.Run, result2 error) {
+	fake.getUnreconciledRunsMutex.Lock()
+	defer fake.getUnreconciledRunsMutex.Unlock()
+	fake.GetUnreconciledRunsStub = nil
+	if fake.getUnreconciledRunsReturnsOnCall == nil {
+		fake.getUnreconciledRunsReturnsOnCall = make(map[int]struct {
+			result1 []postgres.Run
+			result2 error
+		})
+	}
+	fake.getUnreconciledRunsReturnsOnCall[i] = struct {
+		result1 []postgres.Run
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetUnrefinedArrivals(arg1 postgres.EasternTime, arg2 int) ([]postgres.ArrivalObservations, error) {
+	fake.getUnrefinedArrivalsMutex.Lock()
+	ret, specificReturn := fake.getUnrefinedArrivalsReturnsOnCall[len(fake.getUnrefinedArrivalsArgsForCall)]
+	fake.getUnrefinedArrivalsArgsForCall = append(fake.getUnrefinedArrivalsArgsForCall, struct {
+		arg1 postgres.EasternTime
+		arg2 int
+	}{arg1, arg2})
+	stub := fake.GetUnrefinedArrivalsStub
+	fakeReturns := fake.getUnrefinedArrivalsReturns
+	fake.recordInvocation("GetUnrefinedArrivals", []interface{}{arg1, arg2})
+	fake.getUnrefinedArrivalsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) GetUnrefinedArrivalsCallCount() int {
+	fake.getUnrefinedArrivalsMutex.RLock()
+	defer fake.getUnrefinedArrivalsMutex.RUnlock()
+	return len(fake.getUnrefinedArrivalsArgsForCall)
+}
+
+func (fake *FakeRepository) GetUnrefinedArrivalsCalls(stub func(postgres.EasternTime, int) ([]postgres.ArrivalObservations, error)) {
+	fake.getUnrefinedArrivalsMutex.Lock()
+	defer fake.getUnrefinedArrivalsMutex.Unlock()
+	fake.GetUnrefinedArrivalsStub = stub
+}
+
+func (fake *FakeRepository) GetUnrefinedArrivalsArgsForCall(i int) (postgres.EasternTime, int) {
+	fake.getUnrefinedArrivalsMutex.RLock()
+	defer fake.getUnrefinedArrivalsMutex.RUnlock()
+	argsForCall := fake.getUnrefinedArrivalsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRepository) GetUnrefinedArrivalsReturns(result1 []postgres.ArrivalObservations, result2 error) {
+	fake.getUnrefinedArrivalsMutex.Lock()
+	defer fake.getUnrefinedArrivalsMutex.Unlock()
+	fake.GetUnrefinedArrivalsStub = nil
+	fake.getUnrefinedArrivalsReturns = struct {
+		result1 []postgres.ArrivalObservations
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) GetUnrefinedArrivalsReturnsOnCall(i int, result1 []postgres.ArrivalObservations, result2 error) {
+	fake.getUnrefinedArrivalsMutex.Lock()
+	defer fake.getUnrefinedArrivalsMutex.Unlock()
+	fake.GetUnrefinedArrivalsStub = nil
+	if fake.getUnrefinedArrivalsReturnsOnCall == nil {
+		fake.getUnrefinedArrivalsReturnsOnCall = make(map[int]struct {
+			result1 []postgres.ArrivalObservations
+			result2 error
+		})
+	}
+	fake.getUnrefinedArrivalsReturnsOnCall[i] = struct {
+		result1 []postgres.ArrivalObservations
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeRepository) SetArrivalTime(arg1 martaapi.Direction, arg2 martaapi.Line, arg3 string, arg4 postgres.EasternTime, arg5 martaapi.Station, arg6 postgres.EasternTime, arg7 postgres.EasternTime) error {
 	fake.setArrivalTimeMutex.Lock()
 	ret, specificReturn := fake.setArrivalTimeReturnsOnCall[len(fake.setArrivalTimeArgsForCall)]
@@ -750,6 +1194,271 @@ func (fake *FakeRepository) SetArrivalTimeReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeRepository) SetArrivingTime(arg1 martaapi.Direction, arg2 martaapi.Line, arg3 string, arg4 postgres.EasternTime, arg5 martaapi.Station, arg6 postgres.EasternTime) error {
+	fake.setArrivingTimeMutex.Lock()
+	ret, specificReturn := fake.setArrivingTimeReturnsOnCall[len(fake.setArrivingTimeArgsForCall)]
+	fake.setArrivingTimeArgsForCall = append(fake.setArrivingTimeArgsForCall, struct {
+		arg1 martaapi.Direction
+		arg2 martaapi.Line
+		arg3 string
+		arg4 postgres.EasternTime
+		arg5 martaapi.Station
+		arg6 postgres.EasternTime
+	}{arg1, arg2, arg3, arg4, arg5, arg6})
+	stub := fake.SetArrivingTimeStub
+	fakeReturns := fake.setArrivingTimeReturns
+	fake.recordInvocation("SetArrivingTime", []interface{}{arg1, arg2, arg3, arg4, arg5, arg6})
+	fake.setArrivingTimeMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4, arg5, arg6)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) SetArrivingTimeCallCount() int {
+	fake.setArrivingTimeMutex.RLock()
+	defer fake.setArrivingTimeMutex.RUnlock()
+	return len(fake.setArrivingTimeArgsForCall)
+}
+
+func (fake *FakeRepository) SetArrivingTimeCalls(stub func(martaapi.Direction, martaapi.Line, string, postgres.EasternTime, martaapi.Station, postgres.EasternTime) error) {
+	fake.setArrivingTimeMutex.Lock()
+	defer fake.setArrivingTimeMutex.Unlock()
+	fake.SetArrivingTimeStub = stub
+}
+
+func (fake *FakeRepository) SetArrivingTimeArgsForCall(i int) (martaapi.Direction, martaapi.Line, string, postgres.EasternTime, martaapi.Station, postgres.EasternTime) {
+	fake.setArrivingTimeMutex.RLock()
+	defer fake.setArrivingTimeMutex.RUnlock()
+	argsForCall := fake.setArrivingTimeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4, argsForCall.arg5, argsForCall.arg6
+}
+
+func (fake *FakeRepository) SetArrivingTimeReturns(result1 error) {
+	fake.setArrivingTimeMutex.Lock()
+	defer fake.setArrivingTimeMutex.Unlock()
+	fake.SetArrivingTimeStub = nil
+	fake.setArrivingTimeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) SetArrivingTimeReturnsOnCall(i int, result1 error) {
+	fake.setArrivingTimeMutex.Lock()
+	defer fake.setArrivingTimeMutex.Unlock()
+	fake.SetArrivingTimeStub = nil
+	if fake.setArrivingTimeReturnsOnCall == nil {
+		fake.setArrivingTimeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setArrivingTimeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) SetInferredArrivalTimes(arg1 []postgres.InferredArrival, arg2 []string) error {
+	var arg1Copy []postgres.InferredArrival
+	if arg1 != nil {
+		arg1Copy = make([]postgres.InferredArrival, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	var arg2Copy []string
+	if arg2 != nil {
+		arg2Copy = make([]string, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.setInferredArrivalTimesMutex.Lock()
+	ret, specificReturn := fake.setInferredArrivalTimesReturnsOnCall[len(fake.setInferredArrivalTimesArgsForCall)]
+	fake.setInferredArrivalTimesArgsForCall = append(fake.setInferredArrivalTimesArgsForCall, struct {
+		arg1 []postgres.InferredArrival
+		arg2 []string
+	}{arg1Copy, arg2Copy})
+	stub := fake.SetInferredArrivalTimesStub
+	fakeReturns := fake.setInferredArrivalTimesReturns
+	fake.recordInvocation("SetInferredArrivalTimes", []interface{}{arg1Copy, arg2Copy})
+	fake.setInferredArrivalTimesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) SetInferredArrivalTimesCallCount() int {
+	fake.setInferredArrivalTimesMutex.RLock()
+	defer fake.setInferredArrivalTimesMutex.RUnlock()
+	return len(fake.setInferredArrivalTimesArgsForCall)
+}
+
+func (fake *FakeRepository) SetInferredArrivalTimesCalls(stub func([]postgres.InferredArrival, []string) error) {
+	fake.setInferredArrivalTimesMutex.Lock()
+	defer fake.setInferredArrivalTimesMutex.Unlock()
+	fake.SetInferredArrivalTimesStub = stub
+}
+
+func (fake *FakeRepository) SetInferredArrivalTimesArgsForCall(i int) ([]postgres.InferredArrival, []string) {
+	fake.setInferredArrivalTimesMutex.RLock()
+	defer fake.setInferredArrivalTimesMutex.RUnlock()
+	argsForCall := fake.setInferredArrivalTimesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRepository) SetInferredArrivalTimesReturns(result1 error) {
+	fake.setInferredArrivalTimesMutex.Lock()
+	defer fake.setInferredArrivalTimesMutex.Unlock()
+	fake.SetInferredArrivalTimesStub = nil
+	fake.setInferredArrivalTimesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) SetInferredArrivalTimesReturnsOnCall(i int, result1 error) {
+	fake.setInferredArrivalTimesMutex.Lock()
+	defer fake.setInferredArrivalTimesMutex.Unlock()
+	fake.SetInferredArrivalTimesStub = nil
+	if fake.setInferredArrivalTimesReturnsOnCall == nil {
+		fake.setInferredArrivalTimesReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setInferredArrivalTimesReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) SetRefinedArrivalTimes(arg1 []postgres.RefinedArrival) error {
+	var arg1Copy []postgres.RefinedArrival
+	if arg1 != nil {
+		arg1Copy = make([]postgres.RefinedArrival, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.setRefinedArrivalTimesMutex.Lock()
+	ret, specificReturn := fake.setRefinedArrivalTimesReturnsOnCall[len(fake.setRefinedArrivalTimesArgsForCall)]
+	fake.setRefinedArrivalTimesArgsForCall = append(fake.setRefinedArrivalTimesArgsForCall, struct {
+		arg1 []postgres.RefinedArrival
+	}{arg1Copy})
+	stub := fake.SetRefinedArrivalTimesStub
+	fakeReturns := fake.setRefinedArrivalTimesReturns
+	fake.recordInvocation("SetRefinedArrivalTimes", []interface{}{arg1Copy})
+	fake.setRefinedArrivalTimesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) SetRefinedArrivalTimesCallCount() int {
+	fake.setRefinedArrivalTimesMutex.RLock()
+	defer fake.setRefinedArrivalTimesMutex.RUnlock()
+	return len(fake.setRefinedArrivalTimesArgsForCall)
+}
+
+func (fake *FakeRepository) SetRefinedArrivalTimesCalls(stub func([]postgres.RefinedArrival) error) {
+	fake.setRefinedArrivalTimesMutex.Lock()
+	defer fake.setRefinedArrivalTimesMutex.Unlock()
+	fake.SetRefinedArrivalTimesStub = stub
+}
+
+func (fake *FakeRepository) SetRefinedArrivalTimesArgsForCall(i int) []postgres.RefinedArrival {
+	fake.setRefinedArrivalTimesMutex.RLock()
+	defer fake.setRefinedArrivalTimesMutex.RUnlock()
+	argsForCall := fake.setRefinedArrivalTimesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) SetRefinedArrivalTimesReturns(result1 error) {
+	fake.setRefinedArrivalTimesMutex.Lock()
+	defer fake.setRefinedArrivalTimesMutex.Unlock()
+	fake.SetRefinedArrivalTimesStub = nil
+	fake.setRefinedArrivalTimesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) SetRefinedArrivalTimesReturnsOnCall(i int, result1 error) {
+	fake.setRefinedArrivalTimesMutex.Lock()
+	defer fake.setRefinedArrivalTimesMutex.Unlock()
+	fake.SetRefinedArrivalTimesStub = nil
+	if fake.setRefinedArrivalTimesReturnsOnCall == nil {
+		fake.setRefinedArrivalTimesReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setRefinedArrivalTimesReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) WriteBatch(arg1 postgres.Batch) error {
+	fake.writeBatchMutex.Lock()
+	ret, specificReturn := fake.writeBatchReturnsOnCall[len(fake.writeBatchArgsForCall)]
+	fake.writeBatchArgsForCall = append(fake.writeBatchArgsForCall, struct {
+		arg1 postgres.Batch
+	}{arg1})
+	stub := fake.WriteBatchStub
+	fakeReturns := fake.writeBatchReturns
+	fake.recordInvocation("WriteBatch", []interface{}{arg1})
+	fake.writeBatchMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) WriteBatchCallCount() int {
+	fake.writeBatchMutex.RLock()
+	defer fake.writeBatchMutex.RUnlock()
+	return len(fake.writeBatchArgsForCall)
+}
+
+func (fake *FakeRepository) WriteBatchCalls(stub func(postgres.Batch) error) {
+	fake.writeBatchMutex.Lock()
+	defer fake.writeBatchMutex.Unlock()
+	fake.WriteBatchStub = stub
+}
+
+func (fake *FakeRepository) WriteBatchArgsForCall(i int) postgres.Batch {
+	fake.writeBatchMutex.RLock()
+	defer fake.writeBatchMutex.RUnlock()
+	argsForCall := fake.writeBatchArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) WriteBatchReturns(result1 error) {
+	fake.writeBatchMutex.Lock()
+	defer fake.writeBatchMutex.Unlock()
+	fake.WriteBatchStub = nil
+	fake.writeBatchReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) WriteBatchReturnsOnCall(i int, result1 error) {
+	fake.writeBatchMutex.Lock()
+	defer fake.writeBatchMutex.Unlock()
+	fake.WriteBatchStub = nil
+	if fake.writeBatchReturnsOnCall == nil {
+		fake.writeBatchReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.writeBatchReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeRepository) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -763,14 +1472,32 @@ func (fake *FakeRepository) Invocations() map[string][][]interface{} {
 	defer fake.ensureArrivalRecordMutex.RUnlock()
 	fake.ensureTablesMutex.RLock()
 	defer fake.ensureTablesMutex.RUnlock()
+	fake.getHeadwaySummariesMutex.RLock()
+	defer fake.getHeadwaySummariesMutex.RUnlock()
 	fake.getLatestEstimatesMutex.RLock()
 	defer fake.getLatestEstimatesMutex.RUnlock()
 	fake.getLatestRunStartMomentForMutex.RLock()
 	defer fake.getLatestRunStartMomentForMutex.RUnlock()
+	fake.getLatestRunStartMomentsForMutex.RLock()
+	defer fake.getLatestRunStartMomentsForMutex.RUnlock()
+	fake.getPredictionAccuracySummariesMutex.RLock()
+	defer fake.getPredictionAccuracySummariesMutex.RUnlock()
 	fake.getRecentlyActiveRunsMutex.RLock()
 	defer fake.getRecentlyActiveRunsMutex.RUnlock()
+	fake.getUnreconciledRunsMutex.RLock()
+	defer fake.getUnreconciledRunsMutex.RUnlock()
+	fake.getUnrefinedArrivalsMutex.RLock()
+	defer fake.getUnrefinedArrivalsMutex.RUnlock()
 	fake.setArrivalTimeMutex.RLock()
 	defer fake.setArrivalTimeMutex.RUnlock()
+	fake.setArrivingTimeMutex.RLock()
+	defer fake.setArrivingTimeMutex.RUnlock()
+	fake.setInferredArrivalTimesMutex.RLock()
+	defer fake.setInferredArrivalTimesMutex.RUnlock()
+	fake.setRefinedArrivalTimesMutex.RLock()
+	defer fake.setRefinedArrivalTimesMutex.RUnlock()
+	fake.writeBatchMutex.RLock()
+	defer fake.writeBatchMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
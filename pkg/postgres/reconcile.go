@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+)
+
+//reconcileBatchSize is how many runs the Reconciler reads and writes at a time
+const reconcileBatchSize = 100
+
+//InferredArrival is an arrival time inferred for a station that a train passed
+//without being recorded there
+type InferredArrival struct {
+	Identifier  string
+	ArrivalTime EasternTime
+}
+
+//InferArrivals fills in the arrival times of the stations that a run passed
+//unobserved. A station between two that the train was recorded arriving at
+//must have been passed in between, so its arrival time is interpolated from
+//theirs by how many stations along it is. Stations before the first recorded
+//arrival or after the last are left alone, since the train may not have
+//reached them.
+func InferArrivals(run Run) (inferred []InferredArrival) {
+	route := martaapi.StationsInDirection(run.line(), run.direction())
+	position := map[martaapi.Station]int{}
+	for i, station := range route {
+		position[station] = i
+	}
+
+	stops := make([]*Arrival, len(route))
+	for name := range run.Arrivals {
+		station, ok := martaapi.StationFromAPIName(string(name))
+		if !ok {
+			continue
+		}
+		if i, ok := position[station]; ok {
+			arrival := run.Arrivals[name]
+			stops[i] = &arrival
+		}
+	}
+
+	prev := -1
+	for next, stop := range stops {
+		if stop == nil || stop.ArrivalTime == nil {
+			continue
+		}
+		if prev >= 0 {
+			inferred = append(inferred, inferBetween(stops, prev, next)...)
+		}
+		prev = next
+	}
+	return
+}
+
+//inferBetween interpolates the arrivals between two recorded ones. If the
+//train was recorded at the later station first, the records are inconsistent
+//and nothing is inferred from them.
+func inferBetween(stops []*Arrival, prev, next int) (inferred []InferredArrival) {
+	from, to := time.Time(*stops[prev].ArrivalTime), time.Time(*stops[next].ArrivalTime)
+	if !to.After(from) {
+		return
+	}
+
+	for i := prev + 1; i < next; i++ {
+		if stops[i] == nil {
+			continue
+		}
+		at := from.Add(to.Sub(from) * time.Duration(i-prev) / time.Duration(next-prev))
+		inferred = append(inferred, InferredArrival{
+			Identifier:  stops[i].Identifier,
+			ArrivalTime: EasternTime(at.In(EasternTimeZone)),
+		})
+	}
+	return
+}
+
+//NewReconciler creates a new Reconciler
+func NewReconciler(repo Repository) *Reconciler {
+	return &Reconciler{repo: repo}
+}
+
+//Reconciler fills in the arrivals of stations that trains passed unobserved
+type Reconciler struct {
+	repo Repository
+}
+
+//ReconcileRuns infers the missing arrivals of every run last touched before
+//settledBefore that hasn't been reconciled, and counts the runs reconciled and
+//the arrivals inferred. Each run is only reconciled once, so settledBefore
+//should leave time for any late records of it to come in.
+func (r *Reconciler) ReconcileRuns(settledBefore EasternTime) (runs int, inferred int, err error) {
+	for {
+		var batch []Run
+		batch, err = r.repo.GetUnreconciledRuns(settledBefore, reconcileBatchSize)
+		if err != nil {
+			return
+		}
+
+		var arrivals []InferredArrival
+		identifiers := make([]string, len(batch))
+		for i, run := range batch {
+			identifiers[i] = run.Identifier
+			arrivals = append(arrivals, InferArrivals(run)...)
+		}
+		if err = r.repo.SetInferredArrivalTimes(arrivals, identifiers); err != nil {
+			err = errors.Wrapf(err, "failed to reconcile %d runs", len(batch))
+			return
+		}
+		runs += len(batch)
+		inferred += len(arrivals)
+
+		if len(batch) < reconcileBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package postgres_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+	"github.com/smartatransit/scrapedumper/pkg/postgres/postgresfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reconciler", func() {
+	var at = func(min, sec int) *postgres.EasternTime {
+		t := easternDate(2019, time.August, 5, 18, min, sec, 0)
+		return &t
+	}
+	var arrival = func(station string, arrivalTime *postgres.EasternTime) postgres.Arrival {
+		return postgres.Arrival{
+			Identifier:  "N_GOLD_193230_2019-08-05T18:15:16-04:00_" + station,
+			Station:     martaapi.Station(station),
+			ArrivalTime: arrivalTime,
+		}
+	}
+
+	var run postgres.Run
+	BeforeEach(func() {
+		run = postgres.Run{
+			Identifier:         "N_GOLD_193230_2019-08-05T18:15:16-04:00",
+			CorrectedLine:      martaapi.Gold,
+			CorrectedDirection: martaapi.North,
+			Arrivals: postgres.Arrivals{
+				"WEST END STATION":         arrival("WEST END STATION", at(20, 0)),
+				"GARNETT STATION":          arrival("GARNETT STATION", nil),
+				"FIVE POINTS STATION":      arrival("FIVE POINTS STATION", nil),
+				"PEACHTREE CENTER STATION": arrival("PEACHTREE CENTER STATION", at(26, 0)),
+				"CIVIC CENTER STATION":     arrival("CIVIC CENTER STATION", nil),
+			},
+		}
+	})
+
+	Describe("InferArrivals", func() {
+		var inferred []postgres.InferredArrival
+		JustBeforeEach(func() {
+			inferred = postgres.InferArrivals(run)
+		})
+		It("interpolates the stations passed between recorded arrivals", func() {
+			Expect(inferred).To(Equal([]postgres.InferredArrival{
+				{Identifier: "N_GOLD_193230_2019-08-05T18:15:16-04:00_GARNETT STATION", ArrivalTime: *at(22, 0)},
+				{Identifier: "N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS STATION", ArrivalTime: *at(24, 0)},
+			}))
+		})
+		When("the run is heading in its line's second direction", func() {
+			BeforeEach(func() {
+				run.CorrectedDirection = martaapi.South
+				run.Arrivals["WEST END STATION"] = arrival("WEST END STATION", at(26, 0))
+				run.Arrivals["PEACHTREE CENTER STATION"] = arrival("PEACHTREE CENTER STATION", at(20, 0))
+			})
+			It("follows the stations in reverse", func() {
+				Expect(inferred).To(HaveLen(2))
+				Expect(inferred[0].Identifier).To(HaveSuffix("FIVE POINTS STATION"))
+				Expect(inferred[0].ArrivalTime).To(Equal(*at(22, 0)))
+			})
+		})
+		When("the recorded arrivals are out of order", func() {
+			BeforeEach(func() {
+				run.Arrivals["WEST END STATION"] = arrival("WEST END STATION", at(27, 0))
+			})
+			It("infers nothing from them", func() {
+				Expect(inferred).To(BeEmpty())
+			})
+		})
+		When("the line is spelled as the API spells it", func() {
+			BeforeEach(func() {
+				run.CorrectedLine = martaapi.Line("GOLD")
+				run.CorrectedDirection = martaapi.Direction("N")
+			})
+			It("still finds the stations", func() {
+				Expect(inferred).To(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("ReconcileRuns", func() {
+		var (
+			repo *postgresfakes.FakeRepository
+
+			runs     int
+			arrivals int
+			callErr  error
+		)
+		BeforeEach(func() {
+			repo = &postgresfakes.FakeRepository{}
+			repo.GetUnreconciledRunsReturns([]postgres.Run{run, {Identifier: "S_RED_101_2019-08-05T18:15:16-04:00"}}, nil)
+		})
+		JustBeforeEach(func() {
+			runs, arrivals, callErr = postgres.NewReconciler(repo).ReconcileRuns(*at(30, 0))
+		})
+		When("getting the runs fails", func() {
+			BeforeEach(func() {
+				repo.GetUnreconciledRunsReturns(nil, errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("query failed"))
+			})
+		})
+		When("setting the inferred arrivals fails", func() {
+			BeforeEach(func() {
+				repo.SetInferredArrivalTimesReturns(errors.New("exec failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to reconcile 2 runs: exec failed"))
+			})
+		})
+		When("all goes well", func() {
+			It("reconciles every settled run", func() {
+				Expect(callErr).To(BeNil())
+				settledBefore, limit := repo.GetUnreconciledRunsArgsForCall(0)
+				Expect(settledBefore).To(Equal(*at(30, 0)))
+				Expect(limit).To(Equal(100))
+
+				inferred, reconciled := repo.SetInferredArrivalTimesArgsForCall(0)
+				Expect(inferred).To(HaveLen(2))
+				Expect(reconciled).To(Equal([]string{
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00",
+					"S_RED_101_2019-08-05T18:15:16-04:00",
+				}))
+				Expect(runs).To(Equal(2))
+				Expect(arrivals).To(Equal(2))
+			})
+		})
+	})
+})
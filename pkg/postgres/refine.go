@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//Methods by which an arrival time is refined, from most to least confident
+const (
+	//ArrivalInterpolated is the midpoint between the last record of the train
+	//arriving at the station and the first of it having arrived
+	ArrivalInterpolated = "interpolated"
+	//ArrivalEstimated is the last estimate made before the train arrived, when
+	//it falls between the last record of the train and the first of it having
+	//arrived, which is what's left to go on when polls were missed
+	ArrivalEstimated = "estimated"
+	//ArrivalMidpoint is the midpoint between the last estimate before the train
+	//arrived and the first record of it having arrived
+	ArrivalMidpoint = "midpoint"
+	//ArrivalObserved is the first record of the train having arrived, kept as
+	//it was because nothing recorded before it narrows the arrival down
+	ArrivalObserved = "observed"
+	//ArrivalInferred is an arrival that was never recorded, interpolated by
+	//the Reconciler from the arrivals around it
+	ArrivalInferred = "inferred"
+)
+
+//refineBatchSize is how many arrivals the Refiner reads and writes at a time
+const refineBatchSize = 1000
+
+//ArrivalObservations are what was recorded of a train before and as it
+//arrived at a station
+type ArrivalObservations struct {
+	Identifier string
+	//FirstArrived is the first record of the train having arrived, which is
+	//the arrival time set by the upserter
+	FirstArrived EasternTime
+	//LastArriving is the last record of the train arriving, if any
+	LastArriving *EasternTime
+	//LastEstimateMoment is when the last estimate before the train arrived was
+	//made, if any, and LastEstimate is the arrival time it estimated
+	LastEstimateMoment *EasternTime
+	LastEstimate       *EasternTime
+}
+
+//RefinedArrival is an arrival time inferred from ArrivalObservations, along
+//with the method by which it was
+type RefinedArrival struct {
+	Identifier  string
+	ArrivalTime EasternTime
+	Method      string
+}
+
+//RefineArrival infers when a train arrived. It arrived after the last record
+//of it that hadn't, and no later than the first that had, but when the two are
+//more than maxPollGap apart, polls were missed in between and only an estimate
+//can narrow the arrival down.
+func RefineArrival(obs ArrivalObservations, maxPollGap time.Duration) RefinedArrival {
+	refined := RefinedArrival{
+		Identifier:  obs.Identifier,
+		ArrivalTime: obs.FirstArrived,
+		Method:      ArrivalObserved,
+	}
+
+	arrived := time.Time(obs.FirstArrived)
+	var lastSeen time.Time
+	var lastSeenArriving bool
+	for _, moment := range []*EasternTime{obs.LastArriving, obs.LastEstimateMoment} {
+		if moment != nil && time.Time(*moment).Before(arrived) && time.Time(*moment).After(lastSeen) {
+			lastSeen = time.Time(*moment)
+			lastSeenArriving = moment == obs.LastArriving
+		}
+	}
+	if lastSeen.IsZero() {
+		return refined
+	}
+
+	gap := arrived.Sub(lastSeen)
+	midpoint := EasternTime(lastSeen.Add(gap / 2))
+	switch {
+	case lastSeenArriving && gap <= maxPollGap:
+		refined.ArrivalTime, refined.Method = midpoint, ArrivalInterpolated
+	case obs.LastEstimate != nil && time.Time(*obs.LastEstimate).After(lastSeen) && time.Time(*obs.LastEstimate).Before(arrived):
+		refined.ArrivalTime, refined.Method = *obs.LastEstimate, ArrivalEstimated
+	case gap <= maxPollGap:
+		refined.ArrivalTime, refined.Method = midpoint, ArrivalMidpoint
+	}
+	return refined
+}
+
+//NewRefiner creates a new Refiner
+func NewRefiner(repo Repository, maxPollGap time.Duration) *Refiner {
+	return &Refiner{
+		repo:       repo,
+		maxPollGap: maxPollGap,
+	}
+}
+
+//Refiner refines the arrival times set by the upserter, which are the first
+//records of each train having arrived, from what was recorded before them
+type Refiner struct {
+	repo       Repository
+	maxPollGap time.Duration
+}
+
+//RefineArrivals refines every arrival before settledBefore that hasn't been,
+//and counts them by method. Each arrival is only refined once, so
+//settledBefore should leave time for any late records of it to come in.
+func (r *Refiner) RefineArrivals(settledBefore EasternTime) (counts map[string]int, err error) {
+	counts = map[string]int{}
+	for {
+		var arrivals []ArrivalObservations
+		arrivals, err = r.repo.GetUnrefinedArrivals(settledBefore, refineBatchSize)
+		if err != nil {
+			return
+		}
+
+		refined := make([]RefinedArrival, len(arrivals))
+		for i, obs := range arrivals {
+			refined[i] = RefineArrival(obs, r.maxPollGap)
+		}
+		if err = r.repo.SetRefinedArrivalTimes(refined); err != nil {
+			err = errors.Wrapf(err, "failed to refine %d arrivals", len(refined))
+			return
+		}
+		for _, arrival := range refined {
+			counts[arrival.Method]++
+		}
+
+		if len(arrivals) < refineBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package postgres_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+	"github.com/smartatransit/scrapedumper/pkg/postgres/postgresfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Refiner", func() {
+	var at = func(min, sec int) *postgres.EasternTime {
+		t := easternDate(2019, time.August, 5, 18, min, sec, 0)
+		return &t
+	}
+
+	Describe("RefineArrival", func() {
+		var (
+			obs     postgres.ArrivalObservations
+			refined postgres.RefinedArrival
+		)
+		BeforeEach(func() {
+			obs = postgres.ArrivalObservations{
+				Identifier:   "N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+				FirstArrived: *at(20, 30),
+			}
+		})
+		JustBeforeEach(func() {
+			refined = postgres.RefineArrival(obs, 45*time.Second)
+		})
+		When("nothing was recorded before the train arrived", func() {
+			It("keeps the observed arrival", func() {
+				Expect(refined).To(Equal(postgres.RefinedArrival{
+					Identifier:  "N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+					ArrivalTime: *at(20, 30),
+					Method:      postgres.ArrivalObserved,
+				}))
+			})
+		})
+		When("the train was arriving one poll before", func() {
+			BeforeEach(func() {
+				obs.LastArriving = at(20, 15)
+				obs.LastEstimateMoment = at(19, 45)
+				obs.LastEstimate = at(20, 29)
+			})
+			It("interpolates between the two", func() {
+				Expect(refined.ArrivalTime).To(Equal(easternDate(2019, time.August, 5, 18, 20, 22, 500000000)))
+				Expect(refined.Method).To(Equal(postgres.ArrivalInterpolated))
+			})
+		})
+		When("polls were missed after the train was arriving", func() {
+			BeforeEach(func() {
+				obs.LastArriving = at(19, 15)
+			})
+			When("an earlier estimate falls in the gap", func() {
+				BeforeEach(func() {
+					obs.LastEstimateMoment = at(18, 45)
+					obs.LastEstimate = at(20, 0)
+				})
+				It("uses the estimate", func() {
+					Expect(refined.ArrivalTime).To(Equal(*at(20, 0)))
+					Expect(refined.Method).To(Equal(postgres.ArrivalEstimated))
+				})
+			})
+			When("the estimate falls outside the gap", func() {
+				BeforeEach(func() {
+					obs.LastEstimateMoment = at(18, 45)
+					obs.LastEstimate = at(19, 0)
+				})
+				It("keeps the observed arrival", func() {
+					Expect(refined.ArrivalTime).To(Equal(*at(20, 30)))
+					Expect(refined.Method).To(Equal(postgres.ArrivalObserved))
+				})
+			})
+		})
+		When("an estimate was the last record one poll before", func() {
+			BeforeEach(func() {
+				obs.LastEstimateMoment = at(20, 10)
+				obs.LastEstimate = at(21, 0)
+			})
+			It("takes the midpoint", func() {
+				Expect(refined.ArrivalTime).To(Equal(*at(20, 20)))
+				Expect(refined.Method).To(Equal(postgres.ArrivalMidpoint))
+			})
+		})
+		When("the arriving record isn't before the arrival", func() {
+			BeforeEach(func() {
+				obs.LastArriving = at(20, 45)
+			})
+			It("ignores it", func() {
+				Expect(refined.Method).To(Equal(postgres.ArrivalObserved))
+			})
+		})
+	})
+
+	Describe("RefineArrivals", func() {
+		var (
+			repo *postgresfakes.FakeRepository
+
+			counts  map[string]int
+			callErr error
+		)
+		BeforeEach(func() {
+			repo = &postgresfakes.FakeRepository{}
+			repo.GetUnrefinedArrivalsReturns([]postgres.ArrivalObservations{
+				{Identifier: "a", FirstArrived: *at(20, 30)},
+				{Identifier: "b", FirstArrived: *at(20, 30), LastArriving: at(20, 15)},
+			}, nil)
+		})
+		JustBeforeEach(func() {
+			counts, callErr = postgres.NewRefiner(repo, 45*time.Second).RefineArrivals(*at(30, 0))
+		})
+		When("getting the arrivals fails", func() {
+			BeforeEach(func() {
+				repo.GetUnrefinedArrivalsReturns(nil, errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("query failed"))
+			})
+		})
+		When("setting the refined arrivals fails", func() {
+			BeforeEach(func() {
+				repo.SetRefinedArrivalTimesReturns(errors.New("exec failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to refine 2 arrivals: exec failed"))
+			})
+		})
+		When("all goes well", func() {
+			It("refines every settled arrival", func() {
+				Expect(callErr).To(BeNil())
+				settledBefore, limit := repo.GetUnrefinedArrivalsArgsForCall(0)
+				Expect(settledBefore).To(Equal(*at(30, 0)))
+				Expect(limit).To(Equal(1000))
+
+				Expect(repo.SetRefinedArrivalTimesCallCount()).To(Equal(1))
+				refined := repo.SetRefinedArrivalTimesArgsForCall(0)
+				Expect(refined).To(HaveLen(2))
+				Expect(refined[1].Identifier).To(Equal("b"))
+				Expect(counts).To(Equal(map[string]int{
+					postgres.ArrivalObserved:     1,
+					postgres.ArrivalInterpolated: 1,
+				}))
+			})
+		})
+	})
+})
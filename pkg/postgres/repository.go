@@ -1,9 +1,11 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
@@ -34,9 +36,20 @@ type Repository interface {
 	EnsureArrivalRecord(dir martaapi.Direction, line martaapi.Line, trainID string, runFirstEventMoment EasternTime, station martaapi.Station, stationID *uint) (err error)
 	AddArrivalEstimate(dir martaapi.Direction, line martaapi.Line, trainID string, runFirstEventMoment EasternTime, station martaapi.Station, eventTime EasternTime, estimate EasternTime) (err error)
 	SetArrivalTime(dir martaapi.Direction, line martaapi.Line, trainID string, runFirstEventMoment EasternTime, station martaapi.Station, eventTime EasternTime, arrival EasternTime) (err error)
+	SetArrivingTime(dir martaapi.Direction, line martaapi.Line, trainID string, runFirstEventMoment EasternTime, station martaapi.Station, eventTime EasternTime) (err error)
+
+	GetLatestRunStartMomentsFor(queries []RunQuery) (latest map[RunQuery]RunMoments, err error)
+	WriteBatch(batch Batch) (err error)
+
+	GetUnrefinedArrivals(settledBefore EasternTime, limit int) (arrivals []ArrivalObservations, err error)
+	SetRefinedArrivalTimes(refined []RefinedArrival) (err error)
+	GetUnreconciledRuns(settledBefore EasternTime, limit int) (runs []Run, err error)
+	SetInferredArrivalTimes(inferred []InferredArrival, reconciledRuns []string) (err error)
 
 	GetRecentlyActiveRuns(touchThreshold EasternTime) (runs map[string]Run, err error)
 	GetLatestEstimates(stationID uint) (res []LastestEstimate, err error)
+	GetHeadwaySummaries(query HeadwayQuery) (summaries []HeadwaySummary, err error)
+	GetPredictionAccuracySummaries(query PredictionAccuracyQuery) (summaries []PredictionAccuracySummary, err error)
 
 	DeleteStaleRuns(threshold EasternTime) (estimatesDropped int64, arrivalsDropped int64, runsDropped int64, err error)
 }
@@ -84,96 +97,14 @@ func ParseRunGroupIdentifier(id string) (dir martaapi.Direction, line martaapi.L
 	return martaapi.Direction(parts[0]), martaapi.Line(parts[1]), parts[2]
 }
 
-//EnsureTables ensures that all necessary tables exist. Three fields (line_id,
-//station_id, and direction_id) are always included, however if thirdRail is
-//false, they are always left empty. Including them in both cases simplifies
-//our update/select queries.
+//EnsureTables brings the schema up to date by applying any migrations that
+//haven't been applied. The line_id, station_id, and direction_id fields are
+//always included, however if thirdRail is false, they don't reference
+//third-rail's tables and are always left empty. Including them in both cases
+//simplifies our update/select queries.
 func (a *RepositoryAgent) EnsureTables(thirdRail bool) error {
-	runsExtras := `
-	line_id integer,
-	direction_id integer,
-`
-	if thirdRail {
-		runsExtras = `
-	line_id integer REFERENCES lines(id),
-	direction_id integer REFERENCES directions(id),
-`
-	}
-
-	_, err := a.DB.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS runs
-(	identifier varchar,
-	run_group_identifier varchar NOT NULL,
-	corrected_line varchar NOT NULL,
-	corrected_direction varchar NOT NULL,
-	most_recent_event_moment varchar NOT NULL,
-	run_first_event_moment varchar NOT NULL,%s
-
-	PRIMARY KEY (identifier)
-)`, runsExtras))
-	if err != nil {
-		return errors.Wrapf(err, "failed to ensure runs table")
-	}
-
-	arrivalExtras := `
-	station_id integer,
-`
-	if thirdRail {
-		arrivalExtras = `
-	station_id integer REFERENCES stations(id),
-`
-	}
-
-	_, err = a.DB.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS arrivals
-(	identifier varchar,
-	run_identifier varchar NOT NULL,
-	station varchar NOT NULL,
-	arrival_time varchar,%s
-
-	PRIMARY KEY (identifier)
-)`, arrivalExtras))
-	if err != nil {
-		return errors.Wrapf(err, "failed to ensure arrivals table")
-	}
-
-	_, err = a.DB.Exec(`
-CREATE TABLE IF NOT EXISTS estimates
-(	identifier varchar,
-	run_identifier varchar NOT NULL,
-	arrival_identifier varchar NOT NULL,
-	estimate_moment varchar NOT NULL,
-	estimated_arrival_time varchar NOT NULL,
-	PRIMARY KEY (identifier)
-)`)
-	if err != nil {
-		return errors.Wrapf(err, "failed to ensure estimates table")
-	}
-
-	_, err = a.DB.Exec(`CREATE INDEX ON runs USING btree(run_group_identifier)`)
-	if err != nil {
-		return errors.Wrapf(err, "failed to index runs by run group")
-	}
-	_, err = a.DB.Exec(`CREATE INDEX ON arrivals USING btree(run_identifier)`)
-	if err != nil {
-		return errors.Wrapf(err, "failed to index arrivals by run")
-	}
-	_, err = a.DB.Exec(`CREATE INDEX ON estimates USING btree(arrival_identifier)`)
-	if err != nil {
-		return errors.Wrapf(err, "failed to index estimates by arrival")
-	}
-	_, err = a.DB.Exec(`CREATE INDEX ON estimates USING btree(run_identifier)`)
-	if err != nil {
-		return errors.Wrapf(err, "failed to index estimates by run")
-	}
-
-	_, err = a.DB.Exec(`
-CREATE INDEX ON runs USING btree(
-	run_group_identifier,
-	run_first_event_moment DESC,
-	most_recent_event_moment DESC
-)`)
-	return errors.Wrap(err, "failed to index runs for upserting")
+	_, err := NewMigrator(a.Logger, a.DB, thirdRail).Up(context.Background(), 0)
+	return errors.Wrap(err, "failed to migrate schema")
 }
 
 //GetLatestRunStartMomentFor from among all runs in this run group, this method selects the most recently
@@ -284,7 +215,9 @@ ON CONFLICT DO NOTHING`,
 	return
 }
 
-//SetArrivalTime upserts the specified actual arrival time to the arrival record in question
+//SetArrivalTime upserts the specified actual arrival time to the arrival record in question.
+//The arrival time is only set once, but eventTime is taken as the train's departure if it's
+//the latest moment the train has been seen at the station, and the dwell is updated to match.
 func (a *RepositoryAgent) SetArrivalTime(dir martaapi.Direction, line martaapi.Line, trainID string, runFirstEventMoment EasternTime, station martaapi.Station, eventTime EasternTime, arrivalTime EasternTime) (err error) {
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -294,10 +227,12 @@ func (a *RepositoryAgent) SetArrivalTime(dir martaapi.Direction, line martaapi.L
 
 	_, err = tx.Exec(`
 UPDATE arrivals
-SET arrival_time = $1
-WHERE arrivals.identifier = $2
-  AND arrival_time IS NULL`,
+SET arrival_time = COALESCE(arrival_time, $1),
+  departure_time = GREATEST(departure_time, $2),
+  dwell = GREATEST(departure_time, $2) - COALESCE(arrival_time, $1)
+WHERE arrivals.identifier = $3`,
 		arrivalTime,
+		eventTime,
 		ArrivalIdentifierFor(dir, line, trainID, runFirstEventMoment, station),
 	)
 	if err != nil {
@@ -316,6 +251,301 @@ WHERE arrivals.identifier = $2
 	return
 }
 
+//SetArrivingTime records that the train was arriving at the station at eventTime, unless it
+//had already arrived by then, keeping the latest such moment as a lower bound on its arrival
+func (a *RepositoryAgent) SetArrivingTime(dir martaapi.Direction, line martaapi.Line, trainID string, runFirstEventMoment EasternTime, station martaapi.Station, eventTime EasternTime) (err error) {
+	_, err = a.DB.Exec(`
+UPDATE arrivals
+SET last_arriving_time = GREATEST(last_arriving_time, $1)
+WHERE arrivals.identifier = $2
+  AND (arrival_time IS NULL OR arrival_time > $1)`,
+		eventTime,
+		ArrivalIdentifierFor(dir, line, trainID, runFirstEventMoment, station),
+	)
+	err = errors.Wrapf(err, "failed to set arriving time for dir `%s` line `%s` train `%s` first event moment `%s` and station `%s`", dir, line, trainID, runFirstEventMoment.String(), station)
+	return
+}
+
+//batchChunkSize is the most rows written by a single statement of a batch,
+//which keeps statements well within postgres' limit of 65535 parameters
+const batchChunkSize = 1000
+
+//valuesList builds a VALUES list of rows placeholders with cols columns each.
+//A VALUES list used as a table can't infer the types of its columns from
+//where they're written to, so casts gives their types, if any, in order.
+func valuesList(rows, cols int, casts ...string) string {
+	tuples := make([]string, rows)
+	for i := range tuples {
+		placeholders := make([]string, cols)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*cols+j+1)
+			if j < len(casts) && casts[j] != "" {
+				placeholders[j] += "::" + casts[j]
+			}
+		}
+		tuples[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	return strings.Join(tuples, ",\n")
+}
+
+//chunks calls fn with the bounds of each chunk of n rows
+func chunks(n int, fn func(start, end int) error) error {
+	for start := 0; start < n; start += batchChunkSize {
+		end := start + batchChunkSize
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runQueryKey(group string, asOf EasternTime) string {
+	return group + " " + time.Time(asOf).UTC().Format(time.RFC3339Nano)
+}
+
+//GetLatestRunStartMomentsFor answers many of GetLatestRunStartMomentFor's
+//queries at once. Queries whose run group has no runs as of their moment are
+//left out of the result.
+func (a *RepositoryAgent) GetLatestRunStartMomentsFor(queries []RunQuery) (latest map[RunQuery]RunMoments, err error) {
+	latest = map[RunQuery]RunMoments{}
+	err = chunks(len(queries), func(start, end int) error {
+		chunk := queries[start:end]
+		args := make([]interface{}, 0, 2*len(chunk))
+		byKey := map[string]RunQuery{}
+		for _, q := range chunk {
+			args = append(args, q.RunGroupIdentifier, q.AsOf)
+			byKey[runQueryKey(q.RunGroupIdentifier, q.AsOf)] = q
+		}
+
+		rows, err := a.DB.Query(`
+SELECT q.run_group_identifier, q.as_of, latest.run_first_event_moment, latest.most_recent_event_moment
+FROM (VALUES
+`+valuesList(len(chunk), 2, "", "timestamptz")+`
+) AS q(run_group_identifier, as_of)
+JOIN LATERAL (
+	SELECT run_first_event_moment, runs.most_recent_event_moment
+	FROM arrivals JOIN runs ON runs.identifier = arrivals.run_identifier
+	WHERE run_group_identifier = q.run_group_identifier AND runs.most_recent_event_moment <= q.as_of
+	ORDER BY run_first_event_moment DESC, runs.most_recent_event_moment DESC, arrivals.identifier ASC
+	LIMIT 1
+) AS latest ON true`,
+			args...,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to query latest run start moments for %d run groups", len(chunk))
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				group   string
+				asOf    EasternTime
+				moments RunMoments
+			)
+			if err := rows.Scan(&group, &asOf, &moments.RunFirstEventMoment, &moments.MostRecentEventMoment); err != nil {
+				return errors.Wrap(err, "failed to scan latest run start moment")
+			}
+			if q, ok := byKey[runQueryKey(group, asOf)]; ok {
+				latest[q] = moments
+			}
+		}
+		return errors.Wrap(rows.Err(), "failed to read latest run start moments")
+	})
+	return
+}
+
+//WriteBatch writes a batch in a single transaction: it creates the batch's
+//runs, ensures its arrivals, adds its estimates, records arriving trains,
+//sets arrival times that aren't already set along with departures, and
+//touches its runs, each with as few statements as possible.
+func (a *RepositoryAgent) WriteBatch(batch Batch) (err error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction to write batch")
+	}
+
+	for _, write := range []func(*sql.Tx, Batch) error{
+		createRuns,
+		ensureArrivals,
+		addEstimates,
+		setArrivingTimes,
+		setArrivalTimes,
+		touchRuns,
+	} {
+		if err = write(tx, batch); err != nil {
+			rollback(tx, a.Logger)
+			return
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit transaction when writing batch")
+}
+
+func createRuns(tx *sql.Tx, batch Batch) error {
+	return chunks(len(batch.Runs), func(start, end int) error {
+		chunk := batch.Runs[start:end]
+		args := make([]interface{}, 0, 8*len(chunk))
+		for _, run := range chunk {
+			args = append(args,
+				run.Identifier(),
+				RunGroupIdentifierFor(run.Direction, run.Line, run.TrainID),
+				run.RunFirstEventMoment, //most_recent_event_moment
+				run.RunFirstEventMoment,
+				run.CorrectedLine,
+				run.CorrectedDirection,
+				run.LineID,
+				run.DirID,
+			)
+		}
+
+		//a scrape that's dumped again, after later ones have touched its runs,
+		//doesn't find them as of its records, so it creates them again
+		_, err := tx.Exec(`
+INSERT INTO runs
+(identifier, run_group_identifier, most_recent_event_moment, run_first_event_moment, corrected_line, corrected_direction, line_id, direction_id)
+VALUES
+`+valuesList(len(chunk), 8)+`
+ON CONFLICT DO NOTHING`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to create %d runs", len(chunk))
+	})
+}
+
+func ensureArrivals(tx *sql.Tx, batch Batch) error {
+	return chunks(len(batch.Arrivals), func(start, end int) error {
+		chunk := batch.Arrivals[start:end]
+		args := make([]interface{}, 0, 4*len(chunk))
+		for _, arrival := range chunk {
+			args = append(args,
+				arrival.ArrivalIdentifier(arrival.Station),
+				arrival.Identifier(),
+				arrival.Station,
+				arrival.StationID,
+			)
+		}
+
+		_, err := tx.Exec(`
+INSERT INTO arrivals
+(identifier, run_identifier, station, station_id)
+VALUES
+`+valuesList(len(chunk), 4)+`
+ON CONFLICT DO NOTHING`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to ensure %d arrivals", len(chunk))
+	})
+}
+
+func addEstimates(tx *sql.Tx, batch Batch) error {
+	return chunks(len(batch.Estimates), func(start, end int) error {
+		chunk := batch.Estimates[start:end]
+		args := make([]interface{}, 0, 5*len(chunk))
+		for _, estimate := range chunk {
+			args = append(args,
+				EstimateIdentifierFor(estimate.Direction, estimate.Line, estimate.TrainID, estimate.RunFirstEventMoment, estimate.Station, estimate.EventTime),
+				estimate.Identifier(),
+				estimate.ArrivalIdentifier(estimate.Station),
+				estimate.EventTime,
+				estimate.Estimate,
+			)
+		}
+
+		_, err := tx.Exec(`
+INSERT INTO estimates
+(identifier, run_identifier, arrival_identifier, estimate_moment, estimated_arrival_time)
+VALUES
+`+valuesList(len(chunk), 5)+`
+ON CONFLICT DO NOTHING`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to add %d arrival estimates", len(chunk))
+	})
+}
+
+func setArrivingTimes(tx *sql.Tx, batch Batch) error {
+	return chunks(len(batch.Arrivings), func(start, end int) error {
+		chunk := batch.Arrivings[start:end]
+		args := make([]interface{}, 0, 2*len(chunk))
+		for _, arriving := range chunk {
+			args = append(args, arriving.ArrivalIdentifier(arriving.Station), arriving.EventTime)
+		}
+
+		_, err := tx.Exec(`
+UPDATE arrivals
+SET last_arriving_time = GREATEST(arrivals.last_arriving_time, v.last_arriving_time)
+FROM (VALUES
+`+valuesList(len(chunk), 2, "", "timestamptz")+`
+) AS v(identifier, last_arriving_time)
+WHERE arrivals.identifier = v.identifier
+  AND (arrivals.arrival_time IS NULL OR arrivals.arrival_time > v.last_arriving_time)`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to set %d arriving times", len(chunk))
+	})
+}
+
+func setArrivalTimes(tx *sql.Tx, batch Batch) error {
+	return chunks(len(batch.ArrivalTimes), func(start, end int) error {
+		chunk := batch.ArrivalTimes[start:end]
+		args := make([]interface{}, 0, 3*len(chunk))
+		for _, arrival := range chunk {
+			args = append(args, arrival.ArrivalIdentifier(arrival.Station), arrival.ArrivalTime, arrival.DepartureTime)
+		}
+
+		_, err := tx.Exec(`
+UPDATE arrivals
+SET arrival_time = COALESCE(arrivals.arrival_time, v.arrival_time),
+  departure_time = GREATEST(arrivals.departure_time, v.departure_time),
+  dwell = GREATEST(arrivals.departure_time, v.departure_time) - COALESCE(arrivals.arrival_time, v.arrival_time)
+FROM (VALUES
+`+valuesList(len(chunk), 3, "", "timestamptz", "timestamptz")+`
+) AS v(identifier, arrival_time, departure_time)
+WHERE arrivals.identifier = v.identifier`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to set %d arrival times", len(chunk))
+	})
+}
+
+func touchRuns(tx *sql.Tx, batch Batch) error {
+	return chunks(len(batch.Touches), func(start, end int) error {
+		chunk := batch.Touches[start:end]
+		args := make([]interface{}, 0, 2*len(chunk))
+		for _, touch := range chunk {
+			args = append(args, touch.Identifier(), touch.MostRecentEventMoment)
+		}
+
+		res, err := tx.Exec(`
+UPDATE runs
+SET most_recent_event_moment = GREATEST(runs.most_recent_event_moment, v.most_recent_event_moment)
+FROM (VALUES
+`+valuesList(len(chunk), 2, "", "timestamptz")+`
+) AS v(identifier, most_recent_event_moment)
+WHERE runs.identifier = v.identifier`,
+			args...,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to touch %d runs", len(chunk))
+		}
+		return expectRowsAffected(res, len(chunk), "touch-runs")
+	})
+}
+
+func expectRowsAffected(res sql.Result, expected int, query string) error {
+	i, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "received malformed result from %s query", query)
+	}
+	if i != int64(expected) {
+		return fmt.Errorf("%s query unexpectedly affected %v rows - expected %v", query, i, expected)
+	}
+	return nil
+}
+
 func (a *RepositoryAgent) DeleteStaleRuns(threshold EasternTime) (estimatesDropped int64, arrivalsDropped int64, runsDropped int64, err error) {
 	tx, err := a.DB.Begin()
 	if err != nil {
@@ -379,6 +609,203 @@ WHERE most_recent_event_moment < $1`,
 	return
 }
 
+//GetUnrefinedArrivals lists up to limit arrivals before settledBefore whose arrival time
+//hasn't been refined, oldest first, with the observations of the train before it arrived
+func (a *RepositoryAgent) GetUnrefinedArrivals(settledBefore EasternTime, limit int) (arrivals []ArrivalObservations, err error) {
+	rows, err := a.DB.Query(`
+SELECT arrivals.identifier, arrivals.arrival_time, arrivals.last_arriving_time,
+  last_estimate.estimate_moment, last_estimate.estimated_arrival_time
+FROM arrivals
+LEFT JOIN LATERAL (
+  SELECT estimate_moment, estimated_arrival_time
+  FROM estimates
+  WHERE estimates.arrival_identifier = arrivals.identifier
+    AND estimates.estimate_moment < arrivals.arrival_time
+  ORDER BY estimate_moment DESC
+  LIMIT 1
+) AS last_estimate ON true
+WHERE arrivals.arrival_time_method IS NULL
+  AND arrivals.arrival_time < $1
+ORDER BY arrivals.arrival_time ASC
+LIMIT $2`,
+		settledBefore,
+		limit,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "failed to get unrefined arrivals")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var obs ArrivalObservations
+		err = rows.Scan(
+			&obs.Identifier,
+			&obs.FirstArrived,
+			&obs.LastArriving,
+			&obs.LastEstimateMoment,
+			&obs.LastEstimate,
+		)
+		if err != nil {
+			err = errors.Wrap(err, "failed to scan unrefined arrival")
+			return
+		}
+		arrivals = append(arrivals, obs)
+	}
+
+	err = errors.Wrap(rows.Err(), "failed to read unrefined arrivals")
+	return
+}
+
+//SetRefinedArrivalTimes stores refined arrival times along with how each was refined
+func (a *RepositoryAgent) SetRefinedArrivalTimes(refined []RefinedArrival) (err error) {
+	return chunks(len(refined), func(start, end int) error {
+		chunk := refined[start:end]
+		args := make([]interface{}, 0, 3*len(chunk))
+		for _, arrival := range chunk {
+			args = append(args, arrival.Identifier, arrival.ArrivalTime, arrival.Method)
+		}
+
+		_, err := a.DB.Exec(`
+UPDATE arrivals
+SET refined_arrival_time = v.refined_arrival_time,
+  arrival_time_method = v.arrival_time_method
+FROM (VALUES
+`+valuesList(len(chunk), 3, "", "timestamptz", "varchar")+`
+) AS v(identifier, refined_arrival_time, arrival_time_method)
+WHERE arrivals.identifier = v.identifier`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to set %d refined arrival times", len(chunk))
+	})
+}
+
+//GetUnreconciledRuns lists up to limit runs last touched before settledBefore that haven't
+//been reconciled, oldest first, with their arrivals but not their estimates. Arrival times
+//are refined, where they have been.
+func (a *RepositoryAgent) GetUnreconciledRuns(settledBefore EasternTime, limit int) (runs []Run, err error) {
+	rows, err := a.DB.Query(`
+SELECT runs.identifier, runs.run_group_identifier,
+  runs.corrected_line, runs.corrected_direction,
+  arrivals.identifier, arrivals.station,
+  COALESCE(arrivals.refined_arrival_time, arrivals.arrival_time)
+FROM (
+  SELECT identifier, run_group_identifier, corrected_line, corrected_direction, most_recent_event_moment
+  FROM runs
+  WHERE NOT reconciled
+    AND most_recent_event_moment < $1
+  ORDER BY most_recent_event_moment ASC
+  LIMIT $2
+) AS runs
+LEFT JOIN arrivals
+  ON runs.identifier = arrivals.run_identifier
+ORDER BY runs.most_recent_event_moment ASC, runs.identifier ASC`,
+		settledBefore,
+		limit,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "failed to get unreconciled runs")
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run Run
+		var arrivalIdentifier, station sql.NullString
+		var arrivalTime *EasternTime
+		err = rows.Scan(
+			&run.Identifier,
+			&run.RunGroupIdentifier,
+			&run.CorrectedLine,
+			&run.CorrectedDirection,
+			&arrivalIdentifier,
+			&station,
+			&arrivalTime,
+		)
+		if err != nil {
+			err = errors.Wrap(err, "failed to scan unreconciled run")
+			return
+		}
+
+		if len(runs) == 0 || runs[len(runs)-1].Identifier != run.Identifier {
+			run.Arrivals = Arrivals{}
+			runs = append(runs, run)
+		}
+		if arrivalIdentifier.Valid {
+			runs[len(runs)-1].Arrivals[martaapi.Station(station.String)] = Arrival{
+				Identifier:  arrivalIdentifier.String,
+				Station:     martaapi.Station(station.String),
+				ArrivalTime: arrivalTime,
+			}
+		}
+	}
+
+	err = errors.Wrap(rows.Err(), "failed to read unreconciled runs")
+	return
+}
+
+//SetInferredArrivalTimes sets the inferred arrival times that haven't since been observed,
+//flagging them as inferred, and marks the runs they belong to as reconciled, in a single
+//transaction. Inferred arrivals are marked as refined too, so that the refiner leaves them be.
+func (a *RepositoryAgent) SetInferredArrivalTimes(inferred []InferredArrival, reconciledRuns []string) (err error) {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction to set inferred arrival times")
+	}
+
+	err = chunks(len(inferred), func(start, end int) error {
+		chunk := inferred[start:end]
+		args := make([]interface{}, 0, 2*len(chunk))
+		for _, arrival := range chunk {
+			args = append(args, arrival.Identifier, arrival.ArrivalTime)
+		}
+
+		_, err := tx.Exec(`
+UPDATE arrivals
+SET arrival_time = v.arrival_time,
+  refined_arrival_time = v.arrival_time,
+  arrival_time_method = '`+ArrivalInferred+`',
+  arrival_time_inferred = true
+FROM (VALUES
+`+valuesList(len(chunk), 2, "", "timestamptz")+`
+) AS v(identifier, arrival_time)
+WHERE arrivals.identifier = v.identifier
+  AND arrivals.arrival_time IS NULL`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to set %d inferred arrival times", len(chunk))
+	})
+	if err != nil {
+		rollback(tx, a.Logger)
+		return
+	}
+
+	err = chunks(len(reconciledRuns), func(start, end int) error {
+		chunk := reconciledRuns[start:end]
+		args := make([]interface{}, len(chunk))
+		for i, identifier := range chunk {
+			args[i] = identifier
+		}
+
+		_, err := tx.Exec(`
+UPDATE runs
+SET reconciled = true
+FROM (VALUES
+`+valuesList(len(chunk), 1)+`
+) AS v(identifier)
+WHERE runs.identifier = v.identifier`,
+			args...,
+		)
+		return errors.Wrapf(err, "failed to mark %d runs reconciled", len(chunk))
+	})
+	if err != nil {
+		rollback(tx, a.Logger)
+		return
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit transaction when setting inferred arrival times")
+}
+
 //GetRecentlyActiveRuns collects all the data about any runs that have been updated
 //since touchThreshold. The Run#Finished method can be used to determine which runs
 //have arrived at their terminal station, and can therefore be removed from state.
@@ -409,14 +836,15 @@ ORDER BY estimates.identifier ASC`,
 	for rows.Next() {
 		var run Run
 		var arrival Arrival
+		var mostRecentEventMoment, runFirstEventMoment EasternTime
 		var estimateMoment, estimatedArrivalTime EasternTime
 		err = rows.Scan(
 			&run.Identifier,
 			&run.RunGroupIdentifier,
 			&run.CorrectedLine,
 			&run.CorrectedDirection,
-			&run.MostRecentEventMoment,
-			&run.RunFirstEventMoment,
+			&mostRecentEventMoment,
+			&runFirstEventMoment,
 			&arrival.Identifier,
 			&arrival.Station,
 			&arrival.ArrivalTime,
@@ -427,6 +855,8 @@ ORDER BY estimates.identifier ASC`,
 			err = errors.Wrapf(err, "failed to scan run")
 			return
 		}
+		run.MostRecentEventMoment = mostRecentEventMoment.String()
+		run.RunFirstEventMoment = runFirstEventMoment.String()
 
 		if seenRun, ok := runs[run.Identifier]; ok {
 			run = seenRun
@@ -40,158 +40,44 @@ var _ = Describe("Repository", func() {
 	Describe("EnsureTables", func() {
 		var callErr error
 
-		var expectRunsTableExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`
-CREATE TABLE IF NOT EXISTS runs
-\(	identifier varchar,
-	run_group_identifier varchar NOT NULL,
-	corrected_line varchar NOT NULL,
-	corrected_direction varchar NOT NULL,
-	most_recent_event_moment varchar NOT NULL,
-	run_first_event_moment varchar NOT NULL,
-	line_id integer,
-	direction_id integer,
-
-	PRIMARY KEY \(identifier\)
-\)`)
-		}
-		var expectArrivalsTableExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`
-CREATE TABLE IF NOT EXISTS arrivals
-\(	identifier varchar,
-	run_identifier varchar NOT NULL,
-	station varchar NOT NULL,
-	arrival_time varchar,
-	station_id integer,
-
-	PRIMARY KEY \(identifier\)
-\)`)
-		}
-		var expectEstimatesTableExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`
-CREATE TABLE IF NOT EXISTS estimates
-\(	identifier varchar,
-	run_identifier varchar NOT NULL,
-	arrival_identifier varchar NOT NULL,
-	estimate_moment varchar NOT NULL,
-	estimated_arrival_time varchar NOT NULL,
-	PRIMARY KEY \(identifier\)
-\)`)
-		}
-		var expectRunGroupIndexExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`CREATE INDEX ON runs USING btree\(run_group_identifier\)`)
-		}
-		var expectRunIndexExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`CREATE INDEX ON arrivals USING btree\(run_identifier\)`)
-		}
-		var expectArrivalIndexExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`CREATE INDEX ON estimates USING btree\(arrival_identifier\)`)
-		}
-		var expectEstimatesByRunIndexExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`CREATE INDEX ON estimates USING btree\(run_identifier\)`)
-		}
-		var expectLatestRunIndexExec = func() *sqlmock.ExpectedExec {
-			return smock.ExpectExec(`
-CREATE INDEX ON runs USING btree\(
-	run_group_identifier,
-	run_first_event_moment DESC,
-	most_recent_event_moment DESC
-\)`)
-		}
-
 		JustBeforeEach(func() {
-			callErr = repo.EnsureTables(false)
-		})
-		When("the runs table fails", func() {
-			BeforeEach(func() {
-				expectRunsTableExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to ensure runs table: exec failed"))
-			})
+			callErr = repo.EnsureTables(true)
 		})
-		When("the arrivals table fails", func() {
+		When("migrating fails", func() {
 			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnError(errors.New("exec failed"))
+				smock.ExpectExec(`SELECT pg_advisory_lock`).WillReturnError(errors.New("exec failed"))
 			})
 			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to ensure arrivals table: exec failed"))
+				Expect(callErr).To(MatchError("failed to migrate schema: failed to take the migration lock: exec failed"))
 			})
 		})
-		When("the estimates table fails", func() {
+		When("the schema is up to date", func() {
 			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesTableExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to ensure estimates table: exec failed"))
-			})
-		})
-		When("the run group index fails", func() {
-			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunGroupIndexExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to index runs by run group: exec failed"))
-			})
-		})
-		When("the run index fails", func() {
-			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunGroupIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunIndexExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to index arrivals by run: exec failed"))
-			})
-		})
-		When("the arrival index fails", func() {
-			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunGroupIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalIndexExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to index estimates by arrival: exec failed"))
-			})
-		})
-		When("the estimates-by-run index fails", func() {
-			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunGroupIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesByRunIndexExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to index estimates by run: exec failed"))
+				smock.ExpectExec(`SELECT pg_advisory_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+				versions := make([]int, len(postgres.Migrations))
+				for i, migration := range postgres.Migrations {
+					versions[i] = migration.Version
+				}
+				expectAppliedMigrationsFor(smock, true, versions...)
+				smock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+			})
+			It("changes nothing", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
 			})
 		})
-		When("the latest-matching-run index fails", func() {
+		When("the schema is new", func() {
 			BeforeEach(func() {
-				expectRunsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalsTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesTableExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunGroupIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectRunIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectArrivalIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectEstimatesByRunIndexExec().WillReturnResult(sqlmock.NewResult(0, 0))
-				expectLatestRunIndexExec().WillReturnError(errors.New("exec failed"))
-			})
-			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to index runs for upserting: exec failed"))
+				smock.ExpectExec(`SELECT pg_advisory_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectAppliedMigrations(smock)
+				for _, migration := range postgres.Migrations {
+					expectMigrationUp(smock, migration, true)
+				}
+				smock.ExpectExec(`SELECT pg_advisory_unlock`).WillReturnResult(sqlmock.NewResult(0, 0))
+			})
+			It("applies every migration", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
 			})
 		})
 	})
@@ -212,7 +98,7 @@ FROM arrivals JOIN runs ON runs.identifier = arrivals.run_identifier
 WHERE run_group_identifier = \$1 AND runs.most_recent_event_moment <= \$2
 ORDER BY run_first_event_moment DESC, runs.most_recent_event_moment DESC, arrivals.identifier ASC
 LIMIT 1`).
-				WithArgs("N_GOLD_193230", "2019-08-05T18:15:16-04:00")
+				WithArgs("N_GOLD_193230", easternDate(2019, time.August, 5, 18, 15, 16, 0))
 
 			rows = sqlmock.NewRows([]string{"run_first_event_moment", "most_recent_event_moment"})
 			query.WillReturnRows(rows)
@@ -241,7 +127,7 @@ LIMIT 1`).
 				query.WillReturnRows(rows)
 			})
 			It("fails", func() {
-				Expect(callErr).To(MatchError("failed to query latest run start moment for dir `N` line `GOLD` and train `193230`: sql: Scan error on column index 0, name \"run_first_event_moment\": expected string, got int64"))
+				Expect(callErr).To(MatchError("failed to query latest run start moment for dir `N` line `GOLD` and train `193230`: sql: Scan error on column index 0, name \"run_first_event_moment\": expected time or string, got int64"))
 			})
 		})
 		When("no record is found", func() {
@@ -264,6 +150,28 @@ LIMIT 1`).
 				Expect(mostRecentEventTime).To(Equal(easternDate(2019, time.August, 5, 18, 34, 16, 0)))
 			})
 		})
+		When("the connection's timezone isn't Eastern", func() {
+			BeforeEach(func() {
+				rows.AddRow(
+					time.Date(2019, time.August, 5, 22, 15, 16, 0, time.UTC),
+					time.Date(2019, time.August, 5, 22, 34, 16, 0, time.UTC),
+				)
+			})
+			It("reads the times in the Eastern timezone", func() {
+				Expect(callErr).To(BeNil())
+				Expect(runFirstEventMoment).To(Equal(easternDate(2019, time.August, 5, 18, 15, 16, 0)))
+				Expect(runFirstEventMoment.String()).To(Equal("2019-08-05T18:15:16-04:00"))
+			})
+		})
+		When("the columns predate timestamptz", func() {
+			BeforeEach(func() {
+				rows.AddRow("2019-08-05T18:15:16-04:00", "2019-08-05T18:34:16-04:00")
+			})
+			It("parses them", func() {
+				Expect(callErr).To(BeNil())
+				Expect(mostRecentEventTime).To(Equal(easternDate(2019, time.August, 5, 18, 34, 16, 0)))
+			})
+		})
 	})
 
 	Describe("CreateRunRecord", func() {
@@ -485,11 +393,13 @@ WHERE identifier = \$2`)
 
 			firstExec = smock.ExpectExec(`
 UPDATE arrivals
-SET arrival_time = \$1
-WHERE arrivals.identifier = \$2
-  AND arrival_time IS NULL`).
+SET arrival_time = COALESCE\(arrival_time, \$1\),
+  departure_time = GREATEST\(departure_time, \$2\),
+  dwell = GREATEST\(departure_time, \$2\) - COALESCE\(arrival_time, \$1\)
+WHERE arrivals.identifier = \$3`).
 				WithArgs(
 					easternDate(2019, time.August, 5, 22, 15, 16, 0),
+					easternDate(2019, time.August, 5, 20, 15, 16, 0),
 					"N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
 				)
 			firstExec.WillReturnResult(sqlmock.NewResult(0, 1))
@@ -549,6 +459,580 @@ WHERE identifier = \$2`).
 		})
 	})
 
+	Describe("SetArrivingTime", func() {
+		var (
+			callErr error
+
+			exec *sqlmock.ExpectedExec
+		)
+		BeforeEach(func() {
+			exec = smock.ExpectExec(`
+UPDATE arrivals
+SET last_arriving_time = GREATEST\(last_arriving_time, \$1\)
+WHERE arrivals.identifier = \$2
+  AND \(arrival_time IS NULL OR arrival_time > \$1\)`).
+				WithArgs(
+					easternDate(2019, time.August, 5, 18, 20, 16, 0),
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+				)
+			exec.WillReturnResult(sqlmock.NewResult(0, 1))
+		})
+		JustBeforeEach(func() {
+			callErr = repo.SetArrivingTime(
+				martaapi.Direction("N"),
+				martaapi.Line("GOLD"),
+				"193230",
+				easternDate(2019, time.August, 5, 18, 15, 16, 0),
+				martaapi.Station("FIVE POINTS"),
+				easternDate(2019, time.August, 5, 18, 20, 16, 0),
+			)
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				exec.WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to set arriving time for dir `N` line `GOLD` train `193230` first event moment `2019-08-05T18:15:16-04:00` and station `FIVE POINTS`: query failed"))
+			})
+		})
+		When("all goes well", func() {
+			It("succeeds", func() {
+				Expect(callErr).To(BeNil())
+			})
+		})
+	})
+
+	Describe("GetLatestRunStartMomentsFor", func() {
+		var (
+			queries []postgres.RunQuery
+			latest  map[postgres.RunQuery]postgres.RunMoments
+			callErr error
+
+			query *sqlmock.ExpectedQuery
+		)
+		BeforeEach(func() {
+			queries = []postgres.RunQuery{
+				{RunGroupIdentifier: "N_GOLD_193230", AsOf: easternDate(2019, time.August, 5, 18, 15, 16, 0)},
+				{RunGroupIdentifier: "S_RED_193231", AsOf: easternDate(2019, time.August, 5, 18, 15, 16, 0)},
+			}
+
+			query = smock.ExpectQuery(`
+SELECT q.run_group_identifier, q.as_of, latest.run_first_event_moment, latest.most_recent_event_moment
+FROM \(VALUES
+\(\$1, \$2::timestamptz\),
+\(\$3, \$4::timestamptz\)
+\) AS q\(run_group_identifier, as_of\)
+JOIN LATERAL \(`).
+				WithArgs(
+					"N_GOLD_193230", easternDate(2019, time.August, 5, 18, 15, 16, 0),
+					"S_RED_193231", easternDate(2019, time.August, 5, 18, 15, 16, 0),
+				)
+			query.WillReturnRows(sqlmock.NewRows([]string{"run_group_identifier", "as_of", "run_first_event_moment", "most_recent_event_moment"}).
+				AddRow("N_GOLD_193230", "2019-08-05T18:15:16-04:00", "2019-08-05T18:05:16-04:00", "2019-08-05T18:10:16-04:00"))
+		})
+		JustBeforeEach(func() {
+			latest, callErr = repo.GetLatestRunStartMomentsFor(queries)
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				query.WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to query latest run start moments for 2 run groups: query failed"))
+			})
+		})
+		When("all goes well", func() {
+			It("returns the latest run of each run group that has one", func() {
+				Expect(callErr).To(BeNil())
+				Expect(latest).To(HaveLen(1))
+				Expect(latest[queries[0]]).To(Equal(postgres.RunMoments{
+					RunFirstEventMoment:   easternDate(2019, time.August, 5, 18, 5, 16, 0),
+					MostRecentEventMoment: easternDate(2019, time.August, 5, 18, 10, 16, 0),
+				}))
+			})
+		})
+	})
+
+	Describe("WriteBatch", func() {
+		var (
+			batch   postgres.Batch
+			callErr error
+
+			begin         *sqlmock.ExpectedBegin
+			runsExec      *sqlmock.ExpectedExec
+			arrivalsExec  *sqlmock.ExpectedExec
+			estimatesExec *sqlmock.ExpectedExec
+			arrivingExec  *sqlmock.ExpectedExec
+			arrivedExec   *sqlmock.ExpectedExec
+			touchExec     *sqlmock.ExpectedExec
+		)
+		BeforeEach(func() {
+			key := postgres.RunKey{
+				Direction:           martaapi.Direction("N"),
+				Line:                martaapi.Line("GOLD"),
+				TrainID:             "193230",
+				RunFirstEventMoment: easternDate(2019, time.August, 5, 18, 15, 16, 0),
+			}
+			batch = postgres.Batch{
+				Runs: []postgres.BatchRun{{RunKey: key, CorrectedLine: martaapi.Gold, CorrectedDirection: martaapi.North}},
+				Arrivals: []postgres.BatchArrival{
+					{RunKey: key, Station: martaapi.Station("FIVE POINTS")},
+					{RunKey: key, Station: martaapi.Station("GARNETT")},
+				},
+				Estimates: []postgres.BatchEstimate{{
+					RunKey:    key,
+					Station:   martaapi.Station("GARNETT"),
+					EventTime: easternDate(2019, time.August, 5, 18, 16, 16, 0),
+					Estimate:  easternDate(2019, time.August, 5, 18, 20, 16, 0),
+				}},
+				Arrivings: []postgres.BatchArriving{{
+					RunKey:    key,
+					Station:   martaapi.Station("GARNETT"),
+					EventTime: easternDate(2019, time.August, 5, 18, 16, 16, 0),
+				}},
+				ArrivalTimes: []postgres.BatchArrivalTime{{
+					RunKey:        key,
+					Station:       martaapi.Station("FIVE POINTS"),
+					ArrivalTime:   easternDate(2019, time.August, 5, 18, 15, 16, 0),
+					DepartureTime: easternDate(2019, time.August, 5, 18, 16, 16, 0),
+				}},
+				Touches: []postgres.BatchTouch{{RunKey: key, MostRecentEventMoment: easternDate(2019, time.August, 5, 18, 16, 16, 0)}},
+			}
+
+			begin = smock.ExpectBegin()
+			runsExec = smock.ExpectExec(`
+INSERT INTO runs
+\(identifier, run_group_identifier, most_recent_event_moment, run_first_event_moment, corrected_line, corrected_direction, line_id, direction_id\)
+VALUES
+\(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8\)
+ON CONFLICT DO NOTHING`).
+				WithArgs(
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00",
+					"N_GOLD_193230",
+					easternDate(2019, time.August, 5, 18, 15, 16, 0),
+					easternDate(2019, time.August, 5, 18, 15, 16, 0),
+					string(martaapi.Gold),
+					string(martaapi.North),
+					nil,
+					nil,
+				)
+			runsExec.WillReturnResult(sqlmock.NewResult(0, 1))
+			arrivalsExec = smock.ExpectExec(`
+INSERT INTO arrivals
+\(identifier, run_identifier, station, station_id\)
+VALUES
+\(\$1, \$2, \$3, \$4\),
+\(\$5, \$6, \$7, \$8\)
+ON CONFLICT DO NOTHING`)
+			arrivalsExec.WillReturnResult(sqlmock.NewResult(0, 2))
+			estimatesExec = smock.ExpectExec(`
+INSERT INTO estimates
+\(identifier, run_identifier, arrival_identifier, estimate_moment, estimated_arrival_time\)
+VALUES
+\(\$1, \$2, \$3, \$4, \$5\)
+ON CONFLICT DO NOTHING`).
+				WithArgs(
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00_GARNETT_2019-08-05T18:16:16-04:00",
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00",
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00_GARNETT",
+					easternDate(2019, time.August, 5, 18, 16, 16, 0),
+					easternDate(2019, time.August, 5, 18, 20, 16, 0),
+				)
+			estimatesExec.WillReturnResult(sqlmock.NewResult(0, 1))
+			arrivingExec = smock.ExpectExec(`
+UPDATE arrivals
+SET last_arriving_time = GREATEST\(arrivals.last_arriving_time, v.last_arriving_time\)
+FROM \(VALUES
+\(\$1, \$2::timestamptz\)
+\) AS v\(identifier, last_arriving_time\)
+WHERE arrivals.identifier = v.identifier
+  AND \(arrivals.arrival_time IS NULL OR arrivals.arrival_time > v.last_arriving_time\)`).
+				WithArgs("N_GOLD_193230_2019-08-05T18:15:16-04:00_GARNETT", easternDate(2019, time.August, 5, 18, 16, 16, 0))
+			arrivingExec.WillReturnResult(sqlmock.NewResult(0, 1))
+			arrivedExec = smock.ExpectExec(`
+UPDATE arrivals
+SET arrival_time = COALESCE\(arrivals.arrival_time, v.arrival_time\),
+  departure_time = GREATEST\(arrivals.departure_time, v.departure_time\),
+  dwell = GREATEST\(arrivals.departure_time, v.departure_time\) - COALESCE\(arrivals.arrival_time, v.arrival_time\)
+FROM \(VALUES
+\(\$1, \$2::timestamptz, \$3::timestamptz\)
+\) AS v\(identifier, arrival_time, departure_time\)
+WHERE arrivals.identifier = v.identifier`).
+				WithArgs(
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+					easternDate(2019, time.August, 5, 18, 15, 16, 0),
+					easternDate(2019, time.August, 5, 18, 16, 16, 0),
+				)
+			arrivedExec.WillReturnResult(sqlmock.NewResult(0, 1))
+			touchExec = smock.ExpectExec(`
+UPDATE runs
+SET most_recent_event_moment = GREATEST\(runs.most_recent_event_moment, v.most_recent_event_moment\)
+FROM \(VALUES
+\(\$1, \$2::timestamptz\)
+\) AS v\(identifier, most_recent_event_moment\)
+WHERE runs.identifier = v.identifier`).
+				WithArgs("N_GOLD_193230_2019-08-05T18:15:16-04:00", easternDate(2019, time.August, 5, 18, 16, 16, 0))
+			touchExec.WillReturnResult(sqlmock.NewResult(0, 1))
+		})
+		JustBeforeEach(func() {
+			callErr = repo.WriteBatch(batch)
+		})
+		When("beginning the transaction fails", func() {
+			BeforeEach(func() {
+				begin.WillReturnError(errors.New("begin failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to begin transaction to write batch: begin failed"))
+			})
+		})
+		When("creating the runs fails", func() {
+			BeforeEach(func() {
+				runsExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to create 1 runs: exec failed"))
+			})
+		})
+		When("a run already exists", func() {
+			BeforeEach(func() {
+				runsExec.WillReturnResult(sqlmock.NewResult(0, 0))
+				smock.ExpectCommit()
+			})
+			It("leaves it as it is, and writes the rest", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+		When("the same batch is written twice", func() {
+			BeforeEach(func() {
+				smock.ExpectCommit()
+
+				smock.ExpectBegin()
+				smock.ExpectExec(`INSERT INTO runs`).WillReturnResult(sqlmock.NewResult(0, 0))
+				smock.ExpectExec(`INSERT INTO arrivals`).WillReturnResult(sqlmock.NewResult(0, 0))
+				smock.ExpectExec(`INSERT INTO estimates`).WillReturnResult(sqlmock.NewResult(0, 0))
+				smock.ExpectExec(`SET last_arriving_time`).WillReturnResult(sqlmock.NewResult(0, 0))
+				smock.ExpectExec(`SET arrival_time`).WillReturnResult(sqlmock.NewResult(0, 1))
+				smock.ExpectExec(`SET most_recent_event_moment`).WillReturnResult(sqlmock.NewResult(0, 1))
+				smock.ExpectCommit()
+			})
+			It("writes it again without failing on what's already there", func() {
+				Expect(callErr).To(BeNil())
+				Expect(repo.WriteBatch(batch)).To(Succeed())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+		When("ensuring the arrivals fails", func() {
+			BeforeEach(func() {
+				arrivalsExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to ensure 2 arrivals: exec failed"))
+			})
+		})
+		When("adding the estimates fails", func() {
+			BeforeEach(func() {
+				estimatesExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to add 1 arrival estimates: exec failed"))
+			})
+		})
+		When("setting the arriving times fails", func() {
+			BeforeEach(func() {
+				arrivingExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to set 1 arriving times: exec failed"))
+			})
+		})
+		When("setting the arrival times fails", func() {
+			BeforeEach(func() {
+				arrivedExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to set 1 arrival times: exec failed"))
+			})
+		})
+		When("a touched run is missing", func() {
+			BeforeEach(func() {
+				touchExec.WillReturnResult(sqlmock.NewResult(0, 0))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("touch-runs query unexpectedly affected 0 rows - expected 1"))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				smock.ExpectCommit()
+			})
+			It("writes the batch in one transaction", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+		When("the batch is empty", func() {
+			BeforeEach(func() {
+				batch = postgres.Batch{}
+
+				var err error
+				db, smock, err = sqlmock.New()
+				Expect(err).To(BeNil())
+				smock.ExpectBegin()
+				smock.ExpectCommit()
+			})
+			It("writes nothing", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+	})
+
+	Describe("GetUnrefinedArrivals", func() {
+		var (
+			arrivals []postgres.ArrivalObservations
+			callErr  error
+
+			query *sqlmock.ExpectedQuery
+			rows  *sqlmock.Rows
+		)
+		BeforeEach(func() {
+			rows = sqlmock.NewRows([]string{"identifier", "arrival_time", "last_arriving_time", "estimate_moment", "estimated_arrival_time"})
+			query = smock.ExpectQuery(`
+SELECT arrivals.identifier, arrivals.arrival_time, arrivals.last_arriving_time,
+  last_estimate.estimate_moment, last_estimate.estimated_arrival_time
+FROM arrivals
+LEFT JOIN LATERAL \(`).
+				WithArgs(easternDate(2019, time.August, 5, 19, 0, 0, 0), 1000)
+			query.WillReturnRows(rows)
+		})
+		JustBeforeEach(func() {
+			arrivals, callErr = repo.GetUnrefinedArrivals(easternDate(2019, time.August, 5, 19, 0, 0, 0), 1000)
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				query.WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to get unrefined arrivals: query failed"))
+			})
+		})
+		When("a row is malformed", func() {
+			BeforeEach(func() {
+				rows.AddRow("N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS", 5, nil, nil, nil)
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to scan unrefined arrival: ")))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				rows.AddRow(
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+					easternDate(2019, time.August, 5, 18, 20, 16, 0),
+					nil,
+					easternDate(2019, time.August, 5, 18, 20, 1, 0),
+					easternDate(2019, time.August, 5, 18, 20, 10, 0),
+				)
+			})
+			It("reads the observations, leaving those without a record empty", func() {
+				Expect(callErr).To(BeNil())
+				Expect(arrivals).To(HaveLen(1))
+				Expect(arrivals[0].FirstArrived).To(Equal(easternDate(2019, time.August, 5, 18, 20, 16, 0)))
+				Expect(arrivals[0].LastArriving).To(BeNil())
+				Expect(*arrivals[0].LastEstimateMoment).To(Equal(easternDate(2019, time.August, 5, 18, 20, 1, 0)))
+				Expect(*arrivals[0].LastEstimate).To(Equal(easternDate(2019, time.August, 5, 18, 20, 10, 0)))
+			})
+		})
+	})
+
+	Describe("SetRefinedArrivalTimes", func() {
+		var (
+			callErr error
+
+			exec *sqlmock.ExpectedExec
+		)
+		BeforeEach(func() {
+			exec = smock.ExpectExec(`
+UPDATE arrivals
+SET refined_arrival_time = v.refined_arrival_time,
+  arrival_time_method = v.arrival_time_method
+FROM \(VALUES
+\(\$1, \$2::timestamptz, \$3::varchar\)
+\) AS v\(identifier, refined_arrival_time, arrival_time_method\)
+WHERE arrivals.identifier = v.identifier`).
+				WithArgs(
+					"N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+					easternDate(2019, time.August, 5, 18, 20, 8, 0),
+					postgres.ArrivalInterpolated,
+				)
+			exec.WillReturnResult(sqlmock.NewResult(0, 1))
+		})
+		JustBeforeEach(func() {
+			callErr = repo.SetRefinedArrivalTimes([]postgres.RefinedArrival{{
+				Identifier:  "N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+				ArrivalTime: easternDate(2019, time.August, 5, 18, 20, 8, 0),
+				Method:      postgres.ArrivalInterpolated,
+			}})
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				exec.WillReturnError(errors.New("exec failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to set 1 refined arrival times: exec failed"))
+			})
+		})
+		When("all goes well", func() {
+			It("succeeds", func() {
+				Expect(callErr).To(BeNil())
+			})
+		})
+	})
+
+	Describe("GetUnreconciledRuns", func() {
+		var (
+			runs    []postgres.Run
+			callErr error
+
+			query *sqlmock.ExpectedQuery
+			rows  *sqlmock.Rows
+		)
+		BeforeEach(func() {
+			rows = sqlmock.NewRows([]string{"identifier", "run_group_identifier", "corrected_line", "corrected_direction", "identifier", "station", "arrival_time"})
+			query = smock.ExpectQuery(`
+SELECT runs.identifier, runs.run_group_identifier,
+  runs.corrected_line, runs.corrected_direction,
+  arrivals.identifier, arrivals.station,
+  COALESCE\(arrivals.refined_arrival_time, arrivals.arrival_time\)
+FROM \(`).
+				WithArgs(easternDate(2019, time.August, 5, 19, 0, 0, 0), 100)
+			query.WillReturnRows(rows)
+		})
+		JustBeforeEach(func() {
+			runs, callErr = repo.GetUnreconciledRuns(easternDate(2019, time.August, 5, 19, 0, 0, 0), 100)
+		})
+		When("the query fails", func() {
+			BeforeEach(func() {
+				query.WillReturnError(errors.New("query failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to get unreconciled runs: query failed"))
+			})
+		})
+		When("a row is malformed", func() {
+			BeforeEach(func() {
+				rows.AddRow("N_GOLD_193230_2019-08-05T18:15:16-04:00", "N_GOLD_193230", "Gold", "Northbound", "N_GOLD_193230_2019-08-05T18:15:16-04:00_GARNETT", "GARNETT", 5)
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError(MatchRegexp("^failed to scan unreconciled run: ")))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				rows.AddRow("N_GOLD_193230_2019-08-05T18:15:16-04:00", "N_GOLD_193230", "Gold", "Northbound", "N_GOLD_193230_2019-08-05T18:15:16-04:00_GARNETT", "GARNETT", easternDate(2019, time.August, 5, 18, 20, 16, 0))
+				rows.AddRow("N_GOLD_193230_2019-08-05T18:15:16-04:00", "N_GOLD_193230", "Gold", "Northbound", "N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS", "FIVE POINTS", nil)
+				rows.AddRow("S_RED_101_2019-08-05T18:15:16-04:00", "S_RED_101", "Red", "Southbound", nil, nil, nil)
+			})
+			It("groups the arrivals by run", func() {
+				Expect(callErr).To(BeNil())
+				Expect(runs).To(HaveLen(2))
+				Expect(runs[0].CorrectedLine).To(Equal(martaapi.Gold))
+				Expect(runs[0].Arrivals).To(HaveLen(2))
+				Expect(*runs[0].Arrivals["GARNETT"].ArrivalTime).To(Equal(easternDate(2019, time.August, 5, 18, 20, 16, 0)))
+				Expect(runs[0].Arrivals["FIVE POINTS"].ArrivalTime).To(BeNil())
+				Expect(runs[1].Identifier).To(Equal("S_RED_101_2019-08-05T18:15:16-04:00"))
+				Expect(runs[1].Arrivals).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("SetInferredArrivalTimes", func() {
+		var (
+			callErr error
+
+			begin        *sqlmock.ExpectedBegin
+			arrivalsExec *sqlmock.ExpectedExec
+			runsExec     *sqlmock.ExpectedExec
+		)
+		BeforeEach(func() {
+			begin = smock.ExpectBegin()
+			arrivalsExec = smock.ExpectExec(`
+UPDATE arrivals
+SET arrival_time = v.arrival_time,
+  refined_arrival_time = v.arrival_time,
+  arrival_time_method = 'inferred',
+  arrival_time_inferred = true
+FROM \(VALUES
+\(\$1, \$2::timestamptz\)
+\) AS v\(identifier, arrival_time\)
+WHERE arrivals.identifier = v.identifier
+  AND arrivals.arrival_time IS NULL`).
+				WithArgs("N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS", easternDate(2019, time.August, 5, 18, 22, 0, 0))
+			arrivalsExec.WillReturnResult(sqlmock.NewResult(0, 1))
+			runsExec = smock.ExpectExec(`
+UPDATE runs
+SET reconciled = true
+FROM \(VALUES
+\(\$1\),
+\(\$2\)
+\) AS v\(identifier\)
+WHERE runs.identifier = v.identifier`).
+				WithArgs("N_GOLD_193230_2019-08-05T18:15:16-04:00", "S_RED_101_2019-08-05T18:15:16-04:00")
+			runsExec.WillReturnResult(sqlmock.NewResult(0, 2))
+		})
+		JustBeforeEach(func() {
+			callErr = repo.SetInferredArrivalTimes(
+				[]postgres.InferredArrival{{
+					Identifier:  "N_GOLD_193230_2019-08-05T18:15:16-04:00_FIVE POINTS",
+					ArrivalTime: easternDate(2019, time.August, 5, 18, 22, 0, 0),
+				}},
+				[]string{"N_GOLD_193230_2019-08-05T18:15:16-04:00", "S_RED_101_2019-08-05T18:15:16-04:00"},
+			)
+		})
+		When("beginning the transaction fails", func() {
+			BeforeEach(func() {
+				begin.WillReturnError(errors.New("begin failed"))
+			})
+			It("fails", func() {
+				Expect(callErr).To(MatchError("failed to begin transaction to set inferred arrival times: begin failed"))
+			})
+		})
+		When("setting the arrival times fails", func() {
+			BeforeEach(func() {
+				arrivalsExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to set 1 inferred arrival times: exec failed"))
+			})
+		})
+		When("marking the runs fails", func() {
+			BeforeEach(func() {
+				runsExec.WillReturnError(errors.New("exec failed"))
+				smock.ExpectRollback()
+			})
+			It("rolls back", func() {
+				Expect(callErr).To(MatchError("failed to mark 2 runs reconciled: exec failed"))
+			})
+		})
+		When("all goes well", func() {
+			BeforeEach(func() {
+				smock.ExpectCommit()
+			})
+			It("commits", func() {
+				Expect(callErr).To(BeNil())
+				Expect(smock.ExpectationsWereMet()).To(BeNil())
+			})
+		})
+	})
+
 	Describe("DeleteStaleRuns", func() {
 		var (
 			callErr error
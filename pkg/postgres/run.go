@@ -15,9 +15,33 @@ type Run struct {
 	Arrivals Arrivals `json:"arrivals"`
 }
 
+//Finished is whether the train has arrived at the terminus of its line. Arrivals are
+//keyed by the station names that the MARTA API gives, so they're resolved first.
 func (r Run) Finished() bool {
-	terminus := martaapi.Termini[r.CorrectedLine][r.CorrectedDirection]
-	return r.Arrivals[terminus].ArrivalTime != nil
+	terminus := martaapi.Termini[r.line()][r.direction()]
+	for name, arrival := range r.Arrivals {
+		station, ok := martaapi.StationFromAPIName(string(name))
+		if ok && station == terminus && arrival.ArrivalTime != nil {
+			return true
+		}
+	}
+	return false
+}
+
+//line resolves the run's line, in case it's spelled as the MARTA API spells it
+func (r Run) line() martaapi.Line {
+	if line, ok := martaapi.LineFromAPIName(string(r.CorrectedLine)); ok {
+		return line
+	}
+	return r.CorrectedLine
+}
+
+//direction resolves the run's direction, in case it's spelled as the MARTA API spells it
+func (r Run) direction() martaapi.Direction {
+	if dir, ok := martaapi.DirectionFromAPIName(string(r.CorrectedDirection)); ok {
+		return dir
+	}
+	return r.CorrectedDirection
 }
 
 type Arrivals map[martaapi.Station]Arrival
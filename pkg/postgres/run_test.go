@@ -0,0 +1,35 @@
+package postgres_test
+
+import (
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Run", func() {
+	Describe("Finished", func() {
+		var run postgres.Run
+		BeforeEach(func() {
+			run = postgres.Run{
+				CorrectedLine:      martaapi.Gold,
+				CorrectedDirection: martaapi.North,
+				Arrivals: postgres.Arrivals{
+					"LINDBERGH STATION": {Station: "LINDBERGH STATION"},
+					"DORAVILLE STATION": {Station: "DORAVILLE STATION"},
+				},
+			}
+		})
+		It("is false until the train arrives at its terminus", func() {
+			Expect(run.Finished()).To(BeFalse())
+		})
+		It("is true once the train arrives at its terminus", func() {
+			arrivalTime := easternDate(2019, time.August, 5, 18, 15, 16, 0)
+			run.Arrivals["DORAVILLE STATION"] = postgres.Arrival{Station: "DORAVILLE STATION", ArrivalTime: &arrivalTime}
+			Expect(run.Finished()).To(BeTrue())
+		})
+	})
+})
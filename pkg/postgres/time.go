@@ -17,8 +17,9 @@ func init() {
 //EasternTimeZone is the eastern timezone, where all MARTA times should be interpreted
 var EasternTimeZone *time.Location
 
-//EasternTime stores times in the Eastern timezone in postgres as strings, so that
-//integrity is guaranteed regardless of the timezone of the connection.
+//EasternTime is a time in the Eastern timezone. It's stored in postgres as a
+//timestamptz, and read back in the Eastern timezone regardless of the timezone
+//of the connection.
 type EasternTime time.Time
 
 //String provides an RFC3339 representation of this EasternTime
@@ -32,20 +33,23 @@ func ParseEasternTime(str string) (EasternTime, error) {
 	return EasternTime(t), err
 }
 
-//Scan implements the db/sql.Scanner interface
+//Scan implements the db/sql.Scanner interface. Strings are accepted as well as
+//times, for columns that predate timestamptz.
 func (ae *EasternTime) Scan(value interface{}) error {
-	str, ok := value.(string)
-	if !ok {
-		return fmt.Errorf("expected string, got %T", value)
+	switch v := value.(type) {
+	case time.Time:
+		*ae = EasternTime(v.In(EasternTimeZone))
+		return nil
+	case string:
+		var err error
+		*ae, err = ParseEasternTime(v)
+		return err
+	default:
+		return fmt.Errorf("expected time or string, got %T", value)
 	}
-
-	var err error
-	*ae, err = ParseEasternTime(str)
-	return err
 }
 
 //Value implements the db/sql.Valuer interface
 func (ae EasternTime) Value() (driver.Value, error) {
-	ae = EasternTime(time.Time(ae).In(EasternTimeZone))
-	return ae.String(), nil
+	return time.Time(ae).In(EasternTimeZone), nil
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
 )
 
 //Upserter upserts a record to the database, while attempting to
@@ -14,17 +15,32 @@ type Upserter interface {
 	AddRecordToDatabase(rec martaapi.Schedule, correctedLine martaapi.Line, correctedDir martaapi.Direction, lineID *uint, dirID *uint, stationID *uint) (err error)
 }
 
+//UpserterOption configures an UpserterAgent
+type UpserterOption func(*UpserterAgent)
+
+//WithMetrics counts the outcome of each upsert
+func WithMetrics(m *metrics.Metrics) UpserterOption {
+	return func(a *UpserterAgent) {
+		a.metrics = m
+	}
+}
+
 //NewUpserter creates a new postgres upserter
 func NewUpserter(
 	repo Repository,
 	runLifetime time.Duration,
 	thirdRail bool,
+	opts ...UpserterOption,
 ) *UpserterAgent {
-	return &UpserterAgent{
+	a := &UpserterAgent{
 		repo:        repo,
 		runLifetime: runLifetime,
 		thirdRail:   thirdRail,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 //UpserterAgent implements Upserter
@@ -32,6 +48,7 @@ type UpserterAgent struct {
 	repo        Repository
 	runLifetime time.Duration
 	thirdRail   bool
+	metrics     *metrics.Metrics
 }
 
 func newRunRequired(
@@ -54,6 +71,12 @@ func (a *UpserterAgent) AddRecordToDatabase(
 	dirID *uint,
 	stationID *uint,
 ) (err error) {
+	defer func() {
+		if err != nil {
+			a.metrics.UpsertFailed()
+		}
+	}()
+
 	goEventTime, err := time.ParseInLocation(martaapi.MartaAPIDatetimeFormat, rec.EventTime, EasternTimeZone)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to parse record event time `%s`", rec.EventTime)
@@ -90,6 +113,7 @@ func (a *UpserterAgent) AddRecordToDatabase(
 			err = errors.Wrapf(err, "failed to create run record for `%s`", rec.String())
 			return
 		}
+		a.metrics.UpsertOutcome(metrics.RunCreated)
 	}
 
 	if err = a.repo.EnsureArrivalRecord(
@@ -107,8 +131,9 @@ func (a *UpserterAgent) AddRecordToDatabase(
 	if rec.HasArrived() {
 		//NOTE this is a good first pass, but it is a potential source of error
 		//to assume that the arrival time equals the first event time where the
-		//train appears to have arrived. There may be smarter ways to infer the
-		//arrival moment.
+		//train appears to have arrived. The Refiner infers a better arrival
+		//moment once the run has settled. The train departs after the last such
+		//record, so each one also pushes the departure back to its event time.
 		arrivalTime := eventTime
 
 		err = a.repo.SetArrivalTime(
@@ -124,9 +149,24 @@ func (a *UpserterAgent) AddRecordToDatabase(
 			err = errors.Wrapf(err, "failed to set arrival time from record `%s`", rec.String())
 			return
 		}
+		a.metrics.UpsertOutcome(metrics.ArrivalSet)
 	} else if rec.IsArriving() {
 		// we don't have an estimate to add, but we also don't want to set the arrival
-		// time until the state changes again, so for now we ignore the record.
+		// time until the state changes again. The train hadn't arrived yet at the event
+		// time, though, which the refiner uses to narrow down when it did.
+		err = a.repo.SetArrivingTime(
+			martaapi.Direction(rec.Direction),
+			martaapi.Line(rec.Line),
+			rec.TrainID,
+			runFirstEventMoment,
+			martaapi.Station(rec.Station),
+			eventTime,
+		)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to set arriving time from record `%s`", rec.String())
+			return
+		}
+		a.metrics.UpsertOutcome(metrics.ArrivingRecorded)
 	} else {
 		var goEstimate time.Time
 		goEstimate, err = time.ParseInLocation(martaapi.MartaAPITimeFormat, rec.NextArrival, EasternTimeZone)
@@ -156,6 +196,7 @@ func (a *UpserterAgent) AddRecordToDatabase(
 			err = errors.Wrapf(err, "failed to add arrival estimate from record `%s`", rec.String())
 			return
 		}
+		a.metrics.UpsertOutcome(metrics.EstimateAdded)
 	}
 
 	return nil
@@ -2,9 +2,14 @@ package postgres_test
 
 import (
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
 	"github.com/smartatransit/scrapedumper/pkg/postgres"
 	"github.com/smartatransit/scrapedumper/pkg/postgres/postgresfakes"
 
@@ -15,16 +20,18 @@ import (
 var _ = Describe("Upserter", func() {
 	var (
 		repo *postgresfakes.FakeRepository
+		opts []postgres.UpserterOption
 
 		upserter postgres.Upserter
 	)
 
 	BeforeEach(func() {
 		repo = &postgresfakes.FakeRepository{}
+		opts = nil
 	})
 
 	JustBeforeEach(func() {
-		upserter = postgres.NewUpserter(repo, 10*time.Minute, false)
+		upserter = postgres.NewUpserter(repo, 10*time.Minute, false, opts...)
 	})
 
 	Describe("AddRecordToDatabase", func() {
@@ -128,6 +135,27 @@ var _ = Describe("Upserter", func() {
 				})
 			})
 		})
+		When("the train is arriving", func() {
+			BeforeEach(func() {
+				rec.WaitingTime = "Arriving"
+			})
+			It("records that it's arriving", func() {
+				Expect(callErr).To(BeNil())
+				Expect(repo.SetArrivingTimeCallCount()).To(Equal(1))
+				_, _, _, runStartMoment, station, eventTime := repo.SetArrivingTimeArgsForCall(0)
+				Expect(runStartMoment).To(Equal(easternDate(2019, time.June, 18, 21, 42, 2, 0)))
+				Expect(station).To(Equal(martaapi.Station("FIVE POINTS STATION")))
+				Expect(eventTime).To(Equal(easternDate(2019, time.June, 18, 21, 41, 2, 0)))
+			})
+			When("recording it fails", func() {
+				BeforeEach(func() {
+					repo.SetArrivingTimeReturns(errors.New("query failed"))
+				})
+				It("fails", func() {
+					Expect(callErr).To(MatchError("failed to set arriving time from record `N:GOLD:DORAVILLE STATION:324898:6/18/2019 9:41:02 PM:false`: query failed"))
+				})
+			})
+		})
 		When("the train has not arrived", func() {
 			When("the next arrival time is malformed", func() {
 				BeforeEach(func() {
@@ -153,6 +181,37 @@ var _ = Describe("Upserter", func() {
 					Expect(estimate).To(Equal(easternDate(2019, time.June, 18, 21, 45, 2, 0)))
 				})
 			})
+			When("metrics are enabled", func() {
+				var reg *prometheus.Registry
+				BeforeEach(func() {
+					reg = prometheus.NewRegistry()
+					opts = append(opts, postgres.WithMetrics(metrics.New(reg)))
+				})
+				It("counts the estimate", func() {
+					Expect(callErr).To(BeNil())
+					Expect(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP scrapedumper_postgres_upserts_total Changes made by the postgres upserter, by outcome.
+# TYPE scrapedumper_postgres_upserts_total counter
+scrapedumper_postgres_upserts_total{outcome="estimate_added"} 1
+# HELP scrapedumper_postgres_upsert_errors_total Records that the postgres upserter failed to upsert.
+# TYPE scrapedumper_postgres_upsert_errors_total counter
+scrapedumper_postgres_upsert_errors_total 0
+`), "scrapedumper_postgres_upserts_total", "scrapedumper_postgres_upsert_errors_total")).To(Succeed())
+				})
+				When("the upsert fails", func() {
+					BeforeEach(func() {
+						repo.AddArrivalEstimateReturns(errors.New("query failed"))
+					})
+					It("counts the failure", func() {
+						Expect(callErr).NotTo(BeNil())
+						Expect(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP scrapedumper_postgres_upsert_errors_total Records that the postgres upserter failed to upsert.
+# TYPE scrapedumper_postgres_upsert_errors_total counter
+scrapedumper_postgres_upsert_errors_total 1
+`), "scrapedumper_postgres_upsert_errors_total")).To(Succeed())
+					})
+				})
+			})
 		})
 	})
 })
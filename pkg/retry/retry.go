@@ -0,0 +1,164 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Policy describes how many times, and how patiently, a failed call is retried.
+//The zero value makes a single attempt.
+type Policy struct {
+	//MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	//BaseDelay is the delay before the first retry; it doubles on each attempt
+	BaseDelay time.Duration
+	//MaxDelay caps the backoff delay, and any Retry-After longer than it is
+	//treated as a reason to give up rather than block the caller
+	MaxDelay time.Duration
+	//Jitter is the fraction (0 to 1) of each delay that is randomized away
+	Jitter float64
+}
+
+//DefaultPolicy is a modest policy suited to a poll loop of a few seconds
+var DefaultPolicy = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.2,
+}
+
+//Backoff computes the delay before the given retry, where attempt 1 is the
+//first retry
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	jitter := p.Jitter
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return delay - time.Duration(jitter*rand.Float64()*float64(delay))
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+func (e permanentError) Cause() error  { return e.err }
+
+//Permanent marks an error as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+//IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+type afterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e afterError) Error() string { return e.err.Error() }
+func (e afterError) Unwrap() error { return e.err }
+func (e afterError) Cause() error  { return e.err }
+
+//After marks an error as retryable no sooner than the given delay
+func After(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return afterError{err, after}
+}
+
+//Do calls fn until it succeeds, returns a permanent error, the attempts in the
+//policy are exhausted, or ctx is done. The error from the last attempt is returned.
+func Do(ctx context.Context, p Policy, fn func(attempt int) error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn(attempt)
+		if err == nil || IsPermanent(err) || attempt >= p.MaxAttempts {
+			return
+		}
+
+		delay := p.Backoff(attempt)
+		var ae afterError
+		if errors.As(err, &ae) && ae.after > delay {
+			if p.MaxDelay > 0 && ae.after > p.MaxDelay {
+				return
+			}
+			delay = ae.after
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+//ClassifyResponse marks err, which describes a failed response, according to
+//the response's status code: 401 and 403 are permanent, 429 and 503 honor
+//Retry-After, other 5xx codes and 408 are retryable, and any other code is permanent.
+func ClassifyResponse(resp *http.Response, err error) error {
+	switch code := resp.StatusCode; {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return Permanent(err)
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		if after, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return After(err, after)
+		}
+		return err
+	case code >= 500 || code == http.StatusRequestTimeout:
+		return err
+	default:
+		return Permanent(err)
+	}
+}
+
+//ParseRetryAfter parses a Retry-After header, which is either a number of
+//seconds or an HTTP date
+func ParseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	at, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if d := at.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
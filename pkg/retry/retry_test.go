@@ -0,0 +1,205 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+)
+
+var _ = Describe("Retry", func() {
+	Describe("Backoff", func() {
+		It("doubles up to the max delay", func() {
+			p := retry.Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+			Expect(p.Backoff(1)).To(Equal(time.Second))
+			Expect(p.Backoff(2)).To(Equal(2 * time.Second))
+			Expect(p.Backoff(3)).To(Equal(4 * time.Second))
+			Expect(p.Backoff(4)).To(Equal(5 * time.Second))
+			Expect(p.Backoff(40)).To(Equal(5 * time.Second))
+		})
+		It("randomizes away at most the jitter fraction", func() {
+			p := retry.Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: 0.5}
+			for i := 0; i < 20; i++ {
+				Expect(p.Backoff(1)).To(And(
+					BeNumerically(">=", 500*time.Millisecond),
+					BeNumerically("<=", time.Second),
+				))
+			}
+		})
+	})
+
+	Describe("Do", func() {
+		var (
+			policy  retry.Policy
+			ctx     context.Context
+			results []error
+			calls   int
+			callErr error
+		)
+		BeforeEach(func() {
+			policy = retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+			ctx = context.Background()
+			results = nil
+			calls = 0
+		})
+		JustBeforeEach(func() {
+			callErr = retry.Do(ctx, policy, func(attempt int) error {
+				calls++
+				Expect(attempt).To(Equal(calls))
+				if len(results) < calls {
+					return nil
+				}
+				return results[calls-1]
+			})
+		})
+		When("the first attempt succeeds", func() {
+			It("makes one attempt", func() {
+				Expect(callErr).To(BeNil())
+				Expect(calls).To(Equal(1))
+			})
+		})
+		When("a transient failure is followed by a success", func() {
+			BeforeEach(func() {
+				results = []error{errors.New("flaky"), nil}
+			})
+			It("retries", func() {
+				Expect(callErr).To(BeNil())
+				Expect(calls).To(Equal(2))
+			})
+		})
+		When("every attempt fails", func() {
+			BeforeEach(func() {
+				results = []error{errors.New("one"), errors.New("two"), errors.New("three")}
+			})
+			It("returns the last error", func() {
+				Expect(callErr).To(MatchError("three"))
+				Expect(calls).To(Equal(3))
+			})
+		})
+		When("the policy is the zero value", func() {
+			BeforeEach(func() {
+				policy = retry.Policy{}
+				results = []error{errors.New("one")}
+			})
+			It("makes a single attempt", func() {
+				Expect(callErr).To(MatchError("one"))
+				Expect(calls).To(Equal(1))
+			})
+		})
+		When("the failure is permanent", func() {
+			BeforeEach(func() {
+				results = []error{retry.Permanent(errors.New("denied"))}
+			})
+			It("does not retry", func() {
+				Expect(callErr).To(MatchError("denied"))
+				Expect(retry.IsPermanent(callErr)).To(BeTrue())
+				Expect(calls).To(Equal(1))
+			})
+		})
+		When("the failure asks for a delay longer than the max delay", func() {
+			BeforeEach(func() {
+				results = []error{retry.After(errors.New("slow down"), time.Hour)}
+			})
+			It("gives up", func() {
+				Expect(callErr).To(MatchError("slow down"))
+				Expect(calls).To(Equal(1))
+			})
+		})
+		When("the failure asks for an acceptable delay", func() {
+			BeforeEach(func() {
+				results = []error{retry.After(errors.New("slow down"), 5*time.Millisecond)}
+			})
+			It("waits and retries", func() {
+				Expect(callErr).To(BeNil())
+				Expect(calls).To(Equal(2))
+			})
+		})
+		When("the context is cancelled", func() {
+			BeforeEach(func() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				cancel()
+				policy.BaseDelay = time.Hour
+				policy.MaxDelay = time.Hour
+				results = []error{errors.New("one")}
+			})
+			It("stops waiting", func() {
+				Expect(callErr).To(MatchError(context.Canceled))
+				Expect(calls).To(Equal(1))
+			})
+		})
+	})
+
+	Describe("ClassifyResponse", func() {
+		var (
+			resp *http.Response
+			err  error
+		)
+		BeforeEach(func() {
+			resp = &http.Response{Header: http.Header{}}
+		})
+		JustBeforeEach(func() {
+			err = retry.ClassifyResponse(resp, errors.New("bad status"))
+		})
+		When("the status is 401", func() {
+			BeforeEach(func() { resp.StatusCode = http.StatusUnauthorized })
+			It("is permanent", func() { Expect(retry.IsPermanent(err)).To(BeTrue()) })
+		})
+		When("the status is 403", func() {
+			BeforeEach(func() { resp.StatusCode = http.StatusForbidden })
+			It("is permanent", func() { Expect(retry.IsPermanent(err)).To(BeTrue()) })
+		})
+		When("the status is 404", func() {
+			BeforeEach(func() { resp.StatusCode = http.StatusNotFound })
+			It("is permanent", func() { Expect(retry.IsPermanent(err)).To(BeTrue()) })
+		})
+		When("the status is 502", func() {
+			BeforeEach(func() { resp.StatusCode = http.StatusBadGateway })
+			It("is retryable", func() {
+				Expect(err).To(MatchError("bad status"))
+				Expect(retry.IsPermanent(err)).To(BeFalse())
+			})
+		})
+		When("the status is 429 with a Retry-After", func() {
+			BeforeEach(func() {
+				resp.StatusCode = http.StatusTooManyRequests
+				resp.Header.Set("Retry-After", "120")
+			})
+			It("honors the header", func() {
+				Expect(retry.IsPermanent(err)).To(BeFalse())
+				calls := 0
+				doErr := retry.Do(context.Background(), retry.Policy{MaxAttempts: 2, MaxDelay: time.Minute}, func(int) error {
+					calls++
+					return err
+				})
+				Expect(doErr).To(MatchError("bad status"))
+				Expect(calls).To(Equal(1))
+			})
+		})
+	})
+
+	Describe("ParseRetryAfter", func() {
+		now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+		It("parses seconds", func() {
+			d, ok := retry.ParseRetryAfter("30", now)
+			Expect(ok).To(BeTrue())
+			Expect(d).To(Equal(30 * time.Second))
+		})
+		It("parses HTTP dates", func() {
+			d, ok := retry.ParseRetryAfter("Wed, 01 Jan 2020 12:01:00 GMT", now)
+			Expect(ok).To(BeTrue())
+			Expect(d).To(Equal(time.Minute))
+		})
+		It("rejects garbage", func() {
+			_, ok := retry.ParseRetryAfter("soon", now)
+			Expect(ok).To(BeFalse())
+			_, ok = retry.ParseRetryAfter("", now)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,137 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+)
+
+//Scraper fetches a single snapshot of some data source. Prefix names the
+//source, and is used to place its dumps.
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Scraper
+type Scraper interface {
+	Scrape(ctx context.Context) (io.ReadCloser, error)
+	Prefix() string
+}
+
+//Doer performs HTTP requests
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+//HTTPOption configures optional HTTPScraper behavior
+type HTTPOption = func(*HTTPScraper)
+
+//WithMethod sets the HTTP method, which defaults to GET
+func WithMethod(method string) HTTPOption {
+	return func(s *HTTPScraper) {
+		s.Method = method
+	}
+}
+
+//WithHeader adds a request header
+func WithHeader(key, value string) HTTPOption {
+	return func(s *HTTPScraper) {
+		s.Headers[key] = value
+	}
+}
+
+//WithQueryParam adds a query parameter to the URL
+func WithQueryParam(key, value string) HTTPOption {
+	return func(s *HTTPScraper) {
+		s.Query[key] = value
+	}
+}
+
+//WithRetryPolicy sets the policy for retrying failed requests
+func WithRetryPolicy(p retry.Policy) HTTPOption {
+	return func(s *HTTPScraper) {
+		s.RetryPolicy = p
+	}
+}
+
+//HTTPScraper scrapes an arbitrary HTTP endpoint, such as another agency's JSON feed
+type HTTPScraper struct {
+	Doer         Doer
+	URL          string
+	Method       string
+	Headers      map[string]string
+	Query        map[string]string
+	OutputPrefix string
+	RetryPolicy  retry.Policy
+	logger       *zap.Logger
+}
+
+//NewHTTPScraper creates a new HTTPScraper
+func NewHTTPScraper(doer Doer, logger *zap.Logger, url string, prefix string, opts ...HTTPOption) HTTPScraper {
+	s := HTTPScraper{
+		Doer:         doer,
+		URL:          url,
+		Method:       http.MethodGet,
+		Headers:      map[string]string{},
+		Query:        map[string]string{},
+		OutputPrefix: prefix,
+		logger:       logger,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	return s
+}
+
+func (s HTTPScraper) Prefix() string {
+	return s.OutputPrefix
+}
+
+func (s HTTPScraper) buildRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, s.Method, s.URL, nil)
+	if err != nil {
+		return req, err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	q := req.URL.Query()
+	for k, v := range s.Query {
+		q.Set(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+	return req, nil
+}
+
+//Scrape requests the configured URL, retrying transient failures
+//according to the scraper's retry policy
+func (s HTTPScraper) Scrape(ctx context.Context) (body io.ReadCloser, err error) {
+	err = retry.Do(ctx, s.RetryPolicy, func(attempt int) error {
+		req, err := s.buildRequest(ctx)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+
+		resp, err := s.Doer.Do(req)
+		if err != nil {
+			s.logger.Warn(fmt.Sprintf("attempt %d to scrape `%s` failed: %s", attempt, s.OutputPrefix, err.Error()))
+			return err
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			resp.Body.Close()
+			s.logger.Warn(fmt.Sprintf("attempt %d to scrape `%s` received status `%v`", attempt, s.OutputPrefix, resp.StatusCode))
+			return retry.ClassifyResponse(resp, fmt.Errorf("request to `%s` failed with status `%v`", s.URL, resp.StatusCode))
+		}
+
+		body = resp.Body
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
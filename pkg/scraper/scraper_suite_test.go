@@ -0,0 +1,13 @@
+package scraper_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestScraper(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scraper Suite")
+}
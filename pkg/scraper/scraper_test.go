@@ -0,0 +1,103 @@
+package scraper_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/retry"
+	"github.com/smartatransit/scrapedumper/pkg/scraper"
+)
+
+var _ = Describe("HTTPScraper", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+		statuses []int
+		opts     []scraper.HTTPOption
+
+		body    string
+		callErr error
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		statuses = nil
+		opts = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			if len(statuses) >= len(requests) {
+				w.WriteHeader(statuses[len(requests)-1])
+				return
+			}
+			_, _ = w.Write([]byte(`{"alerts":[]}`))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	JustBeforeEach(func() {
+		s := scraper.NewHTTPScraper(server.Client(), zap.NewNop(), server.URL+"/feed?format=json", "alerts", opts...)
+		Expect(s.Prefix()).To(Equal("alerts"))
+
+		body = ""
+		r, err := s.Scrape(context.Background())
+		callErr = err
+		if err == nil {
+			bs, err := ioutil.ReadAll(r)
+			Expect(err).To(BeNil())
+			body = string(bs)
+			r.Close()
+		}
+	})
+
+	It("fetches the feed", func() {
+		Expect(callErr).To(BeNil())
+		Expect(body).To(Equal(`{"alerts":[]}`))
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Method).To(Equal(http.MethodGet))
+	})
+
+	When("the request is customized", func() {
+		BeforeEach(func() {
+			opts = append(opts,
+				scraper.WithMethod(http.MethodPost),
+				scraper.WithHeader("Accept", "application/json"),
+				scraper.WithQueryParam("apiKey", "secret"),
+			)
+		})
+		It("sends the method, headers and query parameters", func() {
+			Expect(callErr).To(BeNil())
+			Expect(requests[0].Method).To(Equal(http.MethodPost))
+			Expect(requests[0].Header.Get("Accept")).To(Equal("application/json"))
+			Expect(requests[0].URL.Query().Get("apiKey")).To(Equal("secret"))
+			Expect(requests[0].URL.Query().Get("format")).To(Equal("json"))
+		})
+	})
+
+	When("the server fails", func() {
+		BeforeEach(func() {
+			statuses = []int{http.StatusBadGateway}
+		})
+		It("fails", func() {
+			Expect(callErr).To(MatchError(ContainSubstring("failed with status `502`")))
+		})
+		When("a retry policy is set", func() {
+			BeforeEach(func() {
+				opts = append(opts, scraper.WithRetryPolicy(retry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+			})
+			It("retries", func() {
+				Expect(callErr).To(BeNil())
+				Expect(requests).To(HaveLen(2))
+			})
+		})
+	})
+})
@@ -1,14 +1,19 @@
 package worker
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"encoding/json"
 	"io"
+	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
 	"github.com/smartatransit/scrapedumper/pkg/dumper"
-	"github.com/smartatransit/scrapedumper/pkg/martaapi"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+	"github.com/smartatransit/scrapedumper/pkg/pathtemplate"
+	"github.com/smartatransit/scrapedumper/pkg/scraper"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -23,6 +28,8 @@ type ScrapeAndDumpClient struct {
 	pollTime time.Duration
 	logger   *zap.Logger
 	cb       *circuitbreaker.CircuitBreaker
+	metrics  *metrics.Metrics
+	status   *status
 }
 
 func NewWorkList() *WorkList {
@@ -34,8 +41,14 @@ type WorkGetter interface {
 	GetWork() []ScrapeDump
 }
 
-func (w *WorkList) AddWork(sched martaapi.ScheduleFinder, dump dumper.Dumper) *WorkList {
-	w.work = append(w.work, ScrapeDump{sched, dump})
+//AddWork adds a unit of work, which is polled on the client's poll time unless
+//a WorkOption says otherwise
+func (w *WorkList) AddWork(s scraper.Scraper, dump dumper.Dumper, opts ...WorkOption) *WorkList {
+	sd := ScrapeDump{Scraper: s, Dumper: dump}
+	for _, opt := range opts {
+		opt(&sd)
+	}
+	w.work = append(w.work, sd)
 	return w
 }
 
@@ -49,20 +62,83 @@ type WorkList struct {
 	work []ScrapeDump
 }
 
-// ScrapeDump is a pairing of a client (scraper) and a dumper.
+// ScrapeDump is a pairing of a client (scraper) and a dumper. Each ScrapeDump is polled in its own goroutine.
 type ScrapeDump struct {
-	Scraper martaapi.ScheduleFinder
+	Scraper scraper.Scraper
 	Dumper  dumper.Dumper
+
+	// PollTime overrides the client's poll time for this unit of work
+	PollTime time.Duration
+	// SkipIfBusy skips a tick if the previous scrape and dump is still running, rather than running them side by side
+	SkipIfBusy bool
+	// MaxInFlight caps how many scrapes and dumps run side by side; ticks beyond it are skipped. The zero value
+	// means DefaultMaxInFlight.
+	MaxInFlight int
+	// Breaker guards this unit of work, in place of the client's circuit breaker
+	Breaker *circuitbreaker.CircuitBreaker
+	// SinkChecks have to pass for this unit of work to be ready
+	SinkChecks []SinkCheck
+	// PathTemplate names each dump. The zero value names them `<prefix>/<RFC3339>.json`.
+	PathTemplate pathtemplate.Template
+}
+
+type WorkOption = func(*ScrapeDump)
+
+// WithPollTime polls a unit of work on its own interval
+func WithPollTime(pollTime time.Duration) WorkOption {
+	return func(sd *ScrapeDump) {
+		sd.PollTime = pollTime
+	}
+}
+
+// WithSkipIfBusy skips a tick if the previous one is still running
+func WithSkipIfBusy(skip bool) WorkOption {
+	return func(sd *ScrapeDump) {
+		sd.SkipIfBusy = skip
+	}
+}
+
+// WithMaxInFlight caps how many scrapes and dumps of a unit of work run side by side
+func WithMaxInFlight(n int) WorkOption {
+	return func(sd *ScrapeDump) {
+		sd.MaxInFlight = n
+	}
+}
+
+// DefaultMaxInFlight caps the scrapes and dumps of a unit of work that run side by side, so that a slow sink can't
+// pile them up without limit
+const DefaultMaxInFlight = 4
+
+// WithPathTemplate names each dump of a unit of work with a template
+func WithPathTemplate(t pathtemplate.Template) WorkOption {
+	return func(sd *ScrapeDump) {
+		sd.PathTemplate = t
+	}
+}
+
+// WithBreaker gives a unit of work its own circuit breaker, so that its failures don't affect other work
+func WithBreaker(cb *circuitbreaker.CircuitBreaker) WorkOption {
+	return func(sd *ScrapeDump) {
+		sd.Breaker = cb
+	}
 }
 
 type Option = func(*ScrapeAndDumpClient)
 
+// WithCircuitBreaker guards any unit of work that doesn't have its own breaker. The breaker is shared by all of them.
 func WithCircuitBreaker(c *circuitbreaker.CircuitBreaker) func(*ScrapeAndDumpClient) {
 	return func(x *ScrapeAndDumpClient) {
 		x.cb = c
 	}
 }
 
+// WithMetrics records the latency, size and outcome of each scrape
+func WithMetrics(m *metrics.Metrics) func(*ScrapeAndDumpClient) {
+	return func(x *ScrapeAndDumpClient) {
+		x.metrics = m
+	}
+}
+
 // New will initialize a new ScrapeDumper client, and if not provided with a circuit breaker, will fail immediately on the first error
 //is is adviced to provide a circuitbreaker to manage this logic if you would rather this not occur
 func New(pollTime time.Duration, logger *zap.Logger, workList WorkGetter, opts ...Option) ScrapeAndDumpClient {
@@ -70,6 +146,7 @@ func New(pollTime time.Duration, logger *zap.Logger, workList WorkGetter, opts .
 		workList: workList,
 		pollTime: pollTime,
 		logger:   logger,
+		status:   &status{},
 	}
 	for _, opt := range opts {
 		opt(&sc)
@@ -78,64 +155,171 @@ func New(pollTime time.Duration, logger *zap.Logger, workList WorkGetter, opts .
 	return sc
 }
 
+// Poll polls each unit of work in its own goroutine, on its own interval, until ctx is done or
+// a unit of work fails in a way that the circuit breaker (if any) can't absorb. errC is closed when polling stops
+// and every scrape and dump that was running has returned.
 func (c ScrapeAndDumpClient) Poll(ctx context.Context, errC chan error) {
 	c.logger.Info("starting to poll")
 	go func() {
 		defer close(errC)
-		for {
-			select {
-			case <-ctx.Done():
-				c.logger.Info("exiting poll")
-				return
-			default:
-			}
-			var err error
-			if c.cb != nil {
-				err = c.cb.Run(func() error {
-					innerErr := c.scrapeAndDumpAll(ctx)
-					if innerErr != nil {
-						c.logger.Error(innerErr.Error())
-					}
-					return innerErr
-				})
-				if err != nil && errors.Cause(err) == circuitbreaker.ErrSystemFailure {
-					errC <- err
-					return
-				}
-			} else {
-				err := c.scrapeAndDumpAll(ctx)
-				if err != nil {
-					errC <- err
-					return
+		select {
+		case <-ctx.Done():
+			c.logger.Info("exiting poll")
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		work := c.workList.GetWork()
+		c.status.start(work, time.Now())
+		defer c.status.stop()
+
+		fatal := make(chan error, 1)
+		var wg sync.WaitGroup
+		for i, sd := range work {
+			wg.Add(1)
+			go func(i int, sd ScrapeDump) {
+				defer wg.Done()
+				c.pollWork(ctx, i, sd, &wg, fatal)
+			}(i, sd)
+		}
+
+		select {
+		case err := <-fatal:
+			errC <- err
+		case <-ctx.Done():
+			c.logger.Info("exiting poll")
+		}
+		cancel()
+		wg.Wait()
+	}()
+}
+
+// pollWork runs a unit of work on each tick, adding each run to wg so that Poll can wait for them
+func (c ScrapeAndDumpClient) pollWork(ctx context.Context, i int, sd ScrapeDump, wg *sync.WaitGroup, fatal chan<- error) {
+	pollTime := sd.PollTime
+	if pollTime <= 0 {
+		pollTime = c.pollTime
+	}
+
+	maxInFlight := sd.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
+	if sd.SkipIfBusy {
+		maxInFlight = 1
+	}
+	inFlight := make(chan struct{}, maxInFlight)
+
+	tick := func() {
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			c.logger.Debug("too many scrapes still running; skipping", zap.String("prefix", sd.Scraper.Prefix()))
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			if err := c.runWork(ctx, i, sd); err != nil {
+				select {
+				case fatal <- err:
+				default:
 				}
 			}
-			time.Sleep(c.pollTime)
+		}()
+	}
+
+	tick()
+	ticker := time.NewTicker(pollTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tick()
 		}
-	}()
+	}
 }
 
-func (c ScrapeAndDumpClient) scrapeAndDumpAll(ctx context.Context) (err error) {
-	c.logger.Debug("scrape and dumping")
-	for _, sd := range c.workList.GetWork() {
-		if sdErr := c.scrapeAndDump(ctx, sd); sdErr != nil {
-			err = sdErr
+// runWork scrapes and dumps once, and returns an error only if polling should stop
+func (c ScrapeAndDumpClient) runWork(ctx context.Context, i int, sd ScrapeDump) error {
+	c.logger.Debug("scrape and dumping", zap.String("prefix", sd.Scraper.Prefix()))
+	cb := sd.Breaker
+	if cb == nil {
+		cb = c.cb
+	}
+	if cb == nil {
+		return c.recordScrapeAndDump(ctx, i, sd)
+	}
+
+	err := cb.Run(func() error {
+		innerErr := c.recordScrapeAndDump(ctx, i, sd)
+		if innerErr != nil {
+			c.logger.Error(innerErr.Error())
 		}
+		return innerErr
+	})
+	if err != nil && errors.Cause(err) == circuitbreaker.ErrSystemFailure {
+		return err
 	}
+	return nil
+}
+
+// recordScrapeAndDump scrapes and dumps, and records the outcome for the health endpoints
+func (c ScrapeAndDumpClient) recordScrapeAndDump(ctx context.Context, i int, sd ScrapeDump) error {
+	err := c.scrapeAndDump(ctx, sd)
+	c.status.record(i, time.Now(), err)
 	return err
 }
 
 func (c ScrapeAndDumpClient) scrapeAndDump(ctx context.Context, sd ScrapeDump) (err error) {
 	var reader io.ReadCloser
-	reader, err = sd.Scraper.FindSchedules(ctx)
+	start := time.Now()
+	reader, err = sd.Scraper.Scrape(ctx)
 	if err != nil {
+		c.metrics.ObserveScrape(sd.Scraper.Prefix(), time.Since(start), err)
 		return err
 	}
 	defer reader.Close()
+
+	var r io.Reader = reader
+	var b []byte
+	if c.metrics != nil || sd.PathTemplate.NeedsBody() {
+		// to measure or hash the scrape it has to be read in full, so buffer it here rather than streaming it to the dumper
+		b, err = ioutil.ReadAll(reader)
+		c.metrics.ObserveScrape(sd.Scraper.Prefix(), time.Since(start), err)
+		if err != nil {
+			return err
+		}
+		c.metrics.ObserveScrapeSize(sd.Scraper.Prefix(), len(b), countRecords(b))
+		r = bytes.NewReader(b)
+	}
+
 	t := time.Now().UTC()
-	path := fmt.Sprintf("%s/%s.json", sd.Scraper.Prefix(), t.Format(time.RFC3339))
-	err = sd.Dumper.Dump(ctx, reader, path)
+	path := sd.PathTemplate.Execute(pathtemplate.Values{
+		Prefix: sd.Scraper.Prefix(),
+		Time:   t,
+		Body:   b,
+	})
+	ctx = dumper.WithScrapeInfo(ctx, dumper.ScrapeInfo{Prefix: sd.Scraper.Prefix(), Time: t})
+	err = sd.Dumper.Dump(ctx, r, path)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// countRecords counts the elements of a JSON array, or returns -1 if b isn't one
+func countRecords(b []byte) int {
+	var records []json.RawMessage
+	if err := json.Unmarshal(b, &records); err != nil {
+		return -1
+	}
+	return len(records)
+}
@@ -2,17 +2,24 @@ package worker_test
 
 import (
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 
 	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
 	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
-	"github.com/smartatransit/scrapedumper/pkg/martaapi/martaapifakes"
+	"github.com/smartatransit/scrapedumper/pkg/metrics"
+	"github.com/smartatransit/scrapedumper/pkg/pathtemplate"
+	"github.com/smartatransit/scrapedumper/pkg/scraper/scraperfakes"
 	"github.com/smartatransit/scrapedumper/pkg/worker"
 	. "github.com/smartatransit/scrapedumper/pkg/worker"
 	"github.com/smartatransit/scrapedumper/pkg/worker/workerfakes"
@@ -27,7 +34,7 @@ var _ = Describe("Client", func() {
 			BeforeEach(func() {
 				workList = worker.NewWorkList()
 				for i := 0; i < 5; i++ {
-					workList.AddWork(&martaapifakes.FakeScheduleFinder{}, &dumperfakes.FakeDumper{})
+					workList.AddWork(&scraperfakes.FakeScraper{}, &dumperfakes.FakeDumper{})
 				}
 			})
 			When("adding work", func() {
@@ -35,6 +42,19 @@ var _ = Describe("Client", func() {
 					Expect(len(workList.GetWork())).To(Equal(5))
 				})
 			})
+			When("adding work with options", func() {
+				BeforeEach(func() {
+					workList.AddWork(&scraperfakes.FakeScraper{}, &dumperfakes.FakeDumper{},
+						worker.WithPollTime(30*time.Second),
+						worker.WithSkipIfBusy(true),
+					)
+				})
+				It("applies them", func() {
+					sd := workList.GetWork()[5]
+					Expect(sd.PollTime).To(Equal(30 * time.Second))
+					Expect(sd.SkipIfBusy).To(BeTrue())
+				})
+			})
 		})
 	})
 	Context("Poll", func() {
@@ -44,20 +64,25 @@ var _ = Describe("Client", func() {
 			logger   *zap.Logger
 			s        worker.ScrapeAndDumpClient
 			ctx      context.Context
+			stop     context.CancelFunc
 			opts     []worker.Option
+			errC     chan error
 		)
 		BeforeEach(func() {
-			ctx = context.Background()
+			ctx, stop = context.WithCancel(context.Background())
 			workList = &workerfakes.FakeWorkGetter{}
 			logger = zap.NewNop()
 			pollTime = 500 * time.Millisecond
 			opts = []worker.Option{}
 		})
 		JustBeforeEach(func() {
-			errC := make(chan error, 1)
+			errC = make(chan error, 1)
 			s = worker.New(pollTime, logger, workList, opts...)
 			s.Poll(ctx, errC)
 		})
+		AfterEach(func() {
+			stop()
+		})
 		When("context is cancelled", func() {
 			var cancelFunc context.CancelFunc
 			BeforeEach(func() {
@@ -71,38 +96,244 @@ var _ = Describe("Client", func() {
 		})
 		When("with a circuit breaker", func() {
 			var (
-				sc *martaapifakes.FakeScheduleFinder
+				sc *scraperfakes.FakeScraper
 				d  *dumperfakes.FakeDumper
 			)
 			BeforeEach(func() {
-				sc = &martaapifakes.FakeScheduleFinder{}
+				sc = &scraperfakes.FakeScraper{}
 				d = &dumperfakes.FakeDumper{}
-				sc.FindSchedulesReturns(ioutil.NopCloser(strings.NewReader("")), nil)
+				sc.ScrapeReturns(ioutil.NopCloser(strings.NewReader("")), nil)
 				workList.GetWorkReturns([]ScrapeDump{ScrapeDump{Scraper: sc, Dumper: d}})
 				cb := circuitbreaker.New(logger, 1*time.Hour, 10)
 				opts = append(opts, worker.WithCircuitBreaker(cb))
 			})
 			It("scrapes and dumps", func() {
-				Eventually(func() int { return sc.FindSchedulesCallCount() }).Should(BeNumerically(">=", 1))
+				Eventually(func() int { return sc.ScrapeCallCount() }).Should(BeNumerically(">=", 1))
 				Eventually(func() int { return d.DumpCallCount() }).Should(BeNumerically(">=", 1))
 			})
 
 		})
 		When("given work", func() {
 			var (
-				sc *martaapifakes.FakeScheduleFinder
+				sc *scraperfakes.FakeScraper
 				d  *dumperfakes.FakeDumper
 			)
 			BeforeEach(func() {
-				sc = &martaapifakes.FakeScheduleFinder{}
+				sc = &scraperfakes.FakeScraper{}
 				d = &dumperfakes.FakeDumper{}
-				sc.FindSchedulesReturns(ioutil.NopCloser(strings.NewReader("")), nil)
+				sc.ScrapeReturns(ioutil.NopCloser(strings.NewReader("")), nil)
 				workList.GetWorkReturns([]ScrapeDump{ScrapeDump{Scraper: sc, Dumper: d}})
 			})
 			It("scrapes and dumps", func() {
-				Eventually(func() int { return sc.FindSchedulesCallCount() }).Should(BeNumerically(">=", 1))
+				Eventually(func() int { return sc.ScrapeCallCount() }).Should(BeNumerically(">=", 1))
 				Eventually(func() int { return d.DumpCallCount() }).Should(BeNumerically(">=", 1))
 			})
 		})
+		When("given work with a path template", func() {
+			var d *dumperfakes.FakeDumper
+			BeforeEach(func() {
+				sc := &scraperfakes.FakeScraper{}
+				d = &dumperfakes.FakeDumper{}
+				sc.PrefixReturns("train-data")
+				sc.ScrapeReturns(ioutil.NopCloser(strings.NewReader("[]")), nil)
+				workList.GetWorkReturns([]ScrapeDump{{
+					Scraper:      sc,
+					Dumper:       d,
+					PathTemplate: pathtemplate.MustParse("{prefix}/date={yyyy-MM-dd}/{hash}.json"),
+				}})
+				pollTime = time.Hour
+			})
+			It("names the dump with it, and still dumps all of the scrape", func() {
+				Eventually(func() int { return d.DumpCallCount() }).Should(Equal(1))
+				dumpCtx, r, path := d.DumpArgsForCall(0)
+				Expect(dumper.ScrapeInfoFrom(dumpCtx, "").Prefix).To(Equal("train-data"))
+				Expect(path).To(MatchRegexp(`^train-data/date=\d{4}-\d{2}-\d{2}/4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945\.json$`))
+				Expect(ioutil.ReadAll(r)).To(Equal([]byte("[]")))
+			})
+		})
+		When("with metrics", func() {
+			var (
+				sc  *scraperfakes.FakeScraper
+				d   *dumperfakes.FakeDumper
+				reg *prometheus.Registry
+			)
+			BeforeEach(func() {
+				sc = &scraperfakes.FakeScraper{}
+				d = &dumperfakes.FakeDumper{}
+				sc.PrefixReturns("train-data")
+				sc.ScrapeReturns(ioutil.NopCloser(strings.NewReader(`[{"TRAIN_ID":"1"},{"TRAIN_ID":"2"}]`)), nil)
+				workList.GetWorkReturns([]ScrapeDump{ScrapeDump{Scraper: sc, Dumper: d}})
+				pollTime = time.Hour
+				reg = prometheus.NewRegistry()
+				opts = append(opts, worker.WithMetrics(metrics.New(reg)))
+			})
+			It("counts the scrape and still dumps all of it", func() {
+				Eventually(func() int { return d.DumpCallCount() }).Should(Equal(1))
+				_, r, _ := d.DumpArgsForCall(0)
+				body, err := ioutil.ReadAll(r)
+				Expect(err).To(BeNil())
+				Expect(string(body)).To(Equal(`[{"TRAIN_ID":"1"},{"TRAIN_ID":"2"}]`))
+
+				Expect(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP scrapedumper_scrape_bytes_total Bytes scraped from a source.
+# TYPE scrapedumper_scrape_bytes_total counter
+scrapedumper_scrape_bytes_total{prefix="train-data"} 35
+# HELP scrapedumper_scrape_records_total Records scraped from a source, for sources that return a JSON array.
+# TYPE scrapedumper_scrape_records_total counter
+scrapedumper_scrape_records_total{prefix="train-data"} 2
+`), "scrapedumper_scrape_bytes_total", "scrapedumper_scrape_records_total")).To(Succeed())
+			})
+		})
+		When("a unit of work has its own circuit breaker", func() {
+			var sc *scraperfakes.FakeScraper
+			BeforeEach(func() {
+				sc = &scraperfakes.FakeScraper{}
+				sc.ScrapeReturns(nil, errors.New("scrape failed"))
+				workList.GetWorkReturns([]ScrapeDump{{
+					Scraper:  sc,
+					Dumper:   &dumperfakes.FakeDumper{},
+					PollTime: 10 * time.Millisecond,
+					Breaker:  circuitbreaker.New(logger, time.Hour, 3),
+				}})
+			})
+			It("absorbs failures with it until it opens", func() {
+				Eventually(func() int { return sc.ScrapeCallCount() }).Should(Equal(3))
+				Consistently(func() int { return sc.ScrapeCallCount() }, 100*time.Millisecond).Should(Equal(3))
+				Consistently(errC).ShouldNot(Receive())
+			})
+		})
+		When("given work with different poll times", func() {
+			var (
+				fast, slow *scraperfakes.FakeScraper
+				release    chan struct{}
+			)
+			BeforeEach(func() {
+				pollTime = time.Hour
+				release = make(chan struct{})
+				released := release
+				fast = &scraperfakes.FakeScraper{}
+				fast.ScrapeStub = func(context.Context) (io.ReadCloser, error) {
+					return ioutil.NopCloser(strings.NewReader("")), nil
+				}
+				slow = &scraperfakes.FakeScraper{}
+				slow.ScrapeStub = func(context.Context) (io.ReadCloser, error) {
+					<-released
+					return ioutil.NopCloser(strings.NewReader("")), nil
+				}
+				workList.GetWorkReturns([]ScrapeDump{
+					{Scraper: slow, Dumper: &dumperfakes.FakeDumper{}},
+					{Scraper: fast, Dumper: &dumperfakes.FakeDumper{}, PollTime: 10 * time.Millisecond},
+				})
+			})
+			AfterEach(func() {
+				close(release)
+			})
+			It("polls each on its own schedule, without waiting on the others", func() {
+				Eventually(func() int { return fast.ScrapeCallCount() }).Should(BeNumerically(">=", 3))
+				Expect(slow.ScrapeCallCount()).To(Equal(1))
+			})
+		})
+		When("a unit of work is still running when it's next due", func() {
+			var (
+				sc      *scraperfakes.FakeScraper
+				release chan struct{}
+			)
+			BeforeEach(func() {
+				release = make(chan struct{})
+				released := release
+				sc = &scraperfakes.FakeScraper{}
+				sc.ScrapeStub = func(context.Context) (io.ReadCloser, error) {
+					<-released
+					return ioutil.NopCloser(strings.NewReader("")), nil
+				}
+				workList.GetWorkReturns([]ScrapeDump{
+					{Scraper: sc, Dumper: &dumperfakes.FakeDumper{}, PollTime: 10 * time.Millisecond},
+				})
+			})
+			AfterEach(func() {
+				close(release)
+			})
+			It("runs them side by side, up to a limit", func() {
+				Eventually(func() int { return sc.ScrapeCallCount() }).Should(Equal(worker.DefaultMaxInFlight))
+				Consistently(func() int { return sc.ScrapeCallCount() }, 100*time.Millisecond).Should(Equal(worker.DefaultMaxInFlight))
+			})
+			It("waits for them to return before it stops", func() {
+				Eventually(func() int { return sc.ScrapeCallCount() }).Should(BeNumerically(">=", 1))
+				stop()
+				Consistently(errC, 100*time.Millisecond).ShouldNot(BeClosed())
+				released := release
+				release = make(chan struct{})
+				close(released)
+				Eventually(errC).Should(BeClosed())
+			})
+			When("it sets its own limit", func() {
+				BeforeEach(func() {
+					workList.GetWorkReturns([]ScrapeDump{
+						{Scraper: sc, Dumper: &dumperfakes.FakeDumper{}, PollTime: 10 * time.Millisecond, MaxInFlight: 2},
+					})
+				})
+				It("runs up to that many", func() {
+					Eventually(func() int { return sc.ScrapeCallCount() }).Should(Equal(2))
+					Consistently(func() int { return sc.ScrapeCallCount() }, 100*time.Millisecond).Should(Equal(2))
+				})
+			})
+			When("it should skip if busy", func() {
+				BeforeEach(func() {
+					workList.GetWorkReturns([]ScrapeDump{
+						{Scraper: sc, Dumper: &dumperfakes.FakeDumper{}, PollTime: 10 * time.Millisecond, SkipIfBusy: true},
+					})
+				})
+				It("skips the tick", func() {
+					Eventually(func() int { return sc.ScrapeCallCount() }).Should(Equal(1))
+					Consistently(func() int { return sc.ScrapeCallCount() }, 100*time.Millisecond).Should(Equal(1))
+				})
+			})
+		})
+		When("a dump is still running when polling stops", func() {
+			var (
+				d       *dumperfakes.FakeDumper
+				release chan struct{}
+				work    ScrapeDump
+			)
+			BeforeEach(func() {
+				release = make(chan struct{})
+				released := release
+				sc := &scraperfakes.FakeScraper{}
+				sc.ScrapeReturns(ioutil.NopCloser(strings.NewReader("")), nil)
+				d = &dumperfakes.FakeDumper{}
+				d.DumpStub = func(context.Context, io.Reader, string) error {
+					<-released
+					return nil
+				}
+				work = ScrapeDump{Scraper: sc, Dumper: d, PollTime: time.Hour}
+				workList.GetWorkReturns([]ScrapeDump{work})
+			})
+			It("closes errC only once the dump returns", func() {
+				Eventually(func() int { return d.DumpCallCount() }).Should(Equal(1))
+				stop()
+				Consistently(errC, 100*time.Millisecond).ShouldNot(BeClosed())
+				close(release)
+				Eventually(errC).Should(BeClosed())
+			})
+			When("another unit of work fails for good", func() {
+				BeforeEach(func() {
+					failing := &scraperfakes.FakeScraper{}
+					failing.ScrapeReturns(nil, errors.New("scrape failed"))
+					workList.GetWorkReturns([]ScrapeDump{work, {
+						Scraper:  failing,
+						Dumper:   &dumperfakes.FakeDumper{},
+						PollTime: 10 * time.Millisecond,
+						Breaker:  circuitbreaker.New(logger, 10*time.Millisecond, 1),
+					}})
+				})
+				It("reports the error, and closes errC only once the dump returns", func() {
+					Eventually(func() int { return d.DumpCallCount() }).Should(Equal(1))
+					Eventually(errC).Should(Receive(MatchError(MatchRegexp("scrape failed"))))
+					Consistently(errC, 100*time.Millisecond).ShouldNot(BeClosed())
+					close(release)
+					Eventually(errC).Should(BeClosed())
+				})
+			})
+		})
 	})
 })
@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HealthPath reports whether the client is still polling
+	HealthPath = "/healthz"
+	// ReadyPath reports whether every unit of work has scraped recently and all of its sinks are reachable
+	ReadyPath = "/readyz"
+)
+
+// SinkCheck reports whether one of a unit of work's sinks is usable, e.g. whether its database connection is still open
+type SinkCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// WithSinkCheck adds a check that has to pass for the unit of work to be ready
+func WithSinkCheck(name string, check func(ctx context.Context) error) WorkOption {
+	return func(sd *ScrapeDump) {
+		sd.SinkChecks = append(sd.SinkChecks, SinkCheck{Name: name, Check: check})
+	}
+}
+
+// Status is a snapshot of the client's polling
+type Status struct {
+	Polling bool         `json:"polling"`
+	Started time.Time    `json:"started"`
+	Work    []WorkStatus `json:"work"`
+}
+
+// WorkStatus is a snapshot of one unit of work
+type WorkStatus struct {
+	Prefix              string            `json:"prefix"`
+	LastAttempt         time.Time         `json:"last_attempt"`
+	LastSuccess         time.Time         `json:"last_success"`
+	LastError           string            `json:"last_error,omitempty"`
+	ConsecutiveFailures int               `json:"consecutive_failures"`
+	SinkErrors          map[string]string `json:"sink_errors,omitempty"`
+}
+
+// Problems lists the reasons the client isn't ready. A unit of work is stale if it hasn't scraped successfully
+// within maxAge, counting from when polling started if it never has.
+func (s Status) Problems(maxAge time.Duration, now time.Time) (problems []string) {
+	if !s.Polling {
+		return []string{"not polling"}
+	}
+	for _, w := range s.Work {
+		since := w.LastSuccess
+		if since.IsZero() {
+			since = s.Started
+		}
+		if age := now.Sub(since); age > maxAge {
+			problem := fmt.Sprintf("%s: no successful scrape for %s", w.Prefix, age.Round(time.Second))
+			if w.LastError != "" {
+				problem += ": " + w.LastError
+			}
+			problems = append(problems, problem)
+		}
+		for name, err := range w.SinkErrors {
+			problems = append(problems, fmt.Sprintf("%s: sink %s: %s", w.Prefix, name, err))
+		}
+	}
+	return
+}
+
+// status is the state behind Status, shared by every copy of a client
+type status struct {
+	mu      sync.Mutex
+	polling bool
+	started time.Time
+	work    []ScrapeDump
+	items   []WorkStatus
+}
+
+func (s *status) start(work []ScrapeDump, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polling = true
+	s.started = now
+	s.work = work
+	s.items = make([]WorkStatus, len(work))
+	for i, sd := range work {
+		s.items[i].Prefix = sd.Scraper.Prefix()
+	}
+}
+
+func (s *status) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polling = false
+}
+
+func (s *status) record(i int, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := &s.items[i]
+	item.LastAttempt = now
+	if err != nil {
+		item.LastError = err.Error()
+		item.ConsecutiveFailures++
+		return
+	}
+	item.LastSuccess = now
+	item.LastError = ""
+	item.ConsecutiveFailures = 0
+}
+
+// Status reports the state of polling and of each unit of work, without checking any sinks
+func (c ScrapeAndDumpClient) Status() Status {
+	st, _ := c.snapshot()
+	return st
+}
+
+func (c ScrapeAndDumpClient) snapshot() (Status, []ScrapeDump) {
+	c.status.mu.Lock()
+	defer c.status.mu.Unlock()
+	return Status{
+		Polling: c.status.polling,
+		Started: c.status.started,
+		Work:    append([]WorkStatus(nil), c.status.items...),
+	}, c.status.work
+}
+
+// CheckSinks reports the same as Status, and also runs each unit's sink checks, side by side, giving each of them
+// up to timeout
+func (c ScrapeAndDumpClient) CheckSinks(ctx context.Context, timeout time.Duration) Status {
+	st, work := c.snapshot()
+
+	// the checks may be slow, so they run without the status lock
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i, sd := range work {
+		for _, check := range sd.SinkChecks {
+			wg.Add(1)
+			go func(i int, check SinkCheck) {
+				defer wg.Done()
+				checkCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+
+				err := runCheck(checkCtx, check)
+				if err == nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if st.Work[i].SinkErrors == nil {
+					st.Work[i].SinkErrors = map[string]string{}
+				}
+				st.Work[i].SinkErrors[check.Name] = err.Error()
+			}(i, check)
+		}
+	}
+	wg.Wait()
+	return st
+}
+
+// runCheck runs a sink check, giving up once ctx is done even if the check doesn't
+func runCheck(ctx context.Context, check SinkCheck) error {
+	errC := make(chan error, 1)
+	go func() {
+		errC <- check.Check(ctx)
+	}()
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "check timed out")
+	}
+}
+
+// StatusReporter provides the status that the health endpoints report. It's satisfied by ScrapeAndDumpClient.
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . StatusReporter
+type StatusReporter interface {
+	Status() Status
+	CheckSinks(ctx context.Context, timeout time.Duration) Status
+}
+
+// DefaultSinkCheckTimeout is how long each sink check has to pass before the client is reported as not ready
+const DefaultSinkCheckTimeout = 5 * time.Second
+
+// NewHealthHandler creates a HealthHandler that considers a unit of work stale after maxAge without a successful scrape
+func NewHealthHandler(reporter StatusReporter, maxAge time.Duration) *HealthHandler {
+	return &HealthHandler{
+		Reporter:         reporter,
+		MaxAge:           maxAge,
+		SinkCheckTimeout: DefaultSinkCheckTimeout,
+		Now:              time.Now,
+	}
+}
+
+// HealthHandler serves the health and readiness endpoints
+type HealthHandler struct {
+	Reporter         StatusReporter
+	MaxAge           time.Duration
+	SinkCheckTimeout time.Duration
+	Now              func() time.Time
+}
+
+// Register adds the health and readiness endpoints to a ServeMux
+func (h *HealthHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc(HealthPath, h.ServeHealth)
+	mux.HandleFunc(ReadyPath, h.ServeReady)
+}
+
+type healthResponse struct {
+	Status
+	Problems []string `json:"problems,omitempty"`
+}
+
+// ServeHealth fails once the client has stopped polling. It doesn't check any sinks, so that a slow sink can't get a
+// healthy client restarted.
+func (h *HealthHandler) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	st := h.Reporter.Status()
+	resp := healthResponse{Status: st}
+	if !st.Polling {
+		resp.Problems = []string{"not polling"}
+	}
+	writeHealth(w, resp)
+}
+
+// ServeReady fails if any unit of work is stale or has a failing sink check
+func (h *HealthHandler) ServeReady(w http.ResponseWriter, r *http.Request) {
+	st := h.Reporter.CheckSinks(r.Context(), h.SinkCheckTimeout)
+	writeHealth(w, healthResponse{
+		Status:   st,
+		Problems: st.Problems(h.MaxAge, h.Now()),
+	})
+}
+
+func writeHealth(w http.ResponseWriter, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(resp.Problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,258 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/circuitbreaker"
+	"github.com/smartatransit/scrapedumper/pkg/dumper/dumperfakes"
+	"github.com/smartatransit/scrapedumper/pkg/scraper/scraperfakes"
+	"github.com/smartatransit/scrapedumper/pkg/worker"
+	"github.com/smartatransit/scrapedumper/pkg/worker/workerfakes"
+)
+
+var _ = Describe("Health", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	Context("Status.Problems", func() {
+		var st worker.Status
+
+		BeforeEach(func() {
+			st = worker.Status{
+				Polling: true,
+				Started: now.Add(-time.Hour),
+				Work: []worker.WorkStatus{
+					{Prefix: "train-data", LastSuccess: now.Add(-time.Minute)},
+				},
+			}
+		})
+
+		It("has none while every unit of work is fresh", func() {
+			Expect(st.Problems(5*time.Minute, now)).To(BeEmpty())
+		})
+		When("a unit of work hasn't succeeded recently", func() {
+			BeforeEach(func() {
+				st.Work[0].LastSuccess = now.Add(-10 * time.Minute)
+				st.Work[0].LastError = "503 Service Unavailable"
+			})
+			It("reports it as stale, with its last error", func() {
+				Expect(st.Problems(5*time.Minute, now)).To(ConsistOf("train-data: no successful scrape for 10m0s: 503 Service Unavailable"))
+			})
+		})
+		When("a unit of work has never succeeded", func() {
+			BeforeEach(func() {
+				st.Work[0].LastSuccess = time.Time{}
+			})
+			It("counts from when polling started", func() {
+				Expect(st.Problems(2*time.Hour, now)).To(BeEmpty())
+				Expect(st.Problems(5*time.Minute, now)).To(ConsistOf("train-data: no successful scrape for 1h0m0s"))
+			})
+		})
+		When("a sink check fails", func() {
+			BeforeEach(func() {
+				st.Work[0].SinkErrors = map[string]string{"POSTGRES": "sql: database is closed"}
+			})
+			It("reports it", func() {
+				Expect(st.Problems(5*time.Minute, now)).To(ConsistOf("train-data: sink POSTGRES: sql: database is closed"))
+			})
+		})
+		When("polling has stopped", func() {
+			BeforeEach(func() {
+				st.Polling = false
+			})
+			It("reports only that", func() {
+				Expect(st.Problems(5*time.Minute, now)).To(ConsistOf("not polling"))
+			})
+		})
+	})
+
+	Context("ScrapeAndDumpClient.Status", func() {
+		var (
+			ctx  context.Context
+			stop context.CancelFunc
+			good *scraperfakes.FakeScraper
+			bad  *scraperfakes.FakeScraper
+			c    worker.ScrapeAndDumpClient
+		)
+
+		BeforeEach(func() {
+			ctx, stop = context.WithCancel(context.Background())
+			good = &scraperfakes.FakeScraper{}
+			good.PrefixReturns("train-data")
+			good.ScrapeStub = func(context.Context) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("")), nil
+			}
+			bad = &scraperfakes.FakeScraper{}
+			bad.PrefixReturns("bus-data")
+			bad.ScrapeReturns(nil, errors.New("scrape failed"))
+
+			workList := &workerfakes.FakeWorkGetter{}
+			workList.GetWorkReturns([]worker.ScrapeDump{
+				{Scraper: good, Dumper: &dumperfakes.FakeDumper{}},
+				{Scraper: bad, Dumper: &dumperfakes.FakeDumper{}, Breaker: circuitbreaker.New(zap.NewNop(), time.Hour, 10), SinkChecks: []worker.SinkCheck{{
+					Name:  "POSTGRES",
+					Check: func(context.Context) error { return errors.New("sql: database is closed") },
+				}}},
+			})
+			c = worker.New(time.Hour, zap.NewNop(), workList)
+		})
+		AfterEach(func() {
+			stop()
+		})
+
+		It("reports nothing before polling starts", func() {
+			st := c.Status()
+			Expect(st.Polling).To(BeFalse())
+			Expect(st.Work).To(BeEmpty())
+		})
+		It("tracks the outcome of each unit of work, and checks its sinks", func() {
+			errC := make(chan error, 1)
+			c.Poll(ctx, errC)
+			Eventually(func() int { return bad.ScrapeCallCount() }).Should(Equal(1))
+			Eventually(func() bool { return !c.Status().Work[0].LastSuccess.IsZero() }).Should(BeTrue())
+			Eventually(func() int { return c.Status().Work[1].ConsecutiveFailures }).Should(Equal(1))
+			Expect(c.Status().Work[1].SinkErrors).To(BeEmpty())
+
+			st := c.CheckSinks(ctx, time.Second)
+			Expect(st.Polling).To(BeTrue())
+			Expect(st.Work[0].Prefix).To(Equal("train-data"))
+			Expect(st.Work[0].SinkErrors).To(BeEmpty())
+			Expect(st.Work[1].Prefix).To(Equal("bus-data"))
+			Expect(st.Work[1].LastSuccess.IsZero()).To(BeTrue())
+			Expect(st.Work[1].LastError).To(Equal("scrape failed"))
+			Expect(st.Work[1].SinkErrors).To(Equal(map[string]string{"POSTGRES": "sql: database is closed"}))
+
+			stop()
+			Eventually(errC).Should(BeClosed())
+			Expect(c.Status().Polling).To(BeFalse())
+		})
+		It("gives up on a sink check that takes too long", func() {
+			slow := &scraperfakes.FakeScraper{}
+			slow.ScrapeReturns(ioutil.NopCloser(strings.NewReader("")), nil)
+			workList := &workerfakes.FakeWorkGetter{}
+			workList.GetWorkReturns([]worker.ScrapeDump{
+				{Scraper: slow, Dumper: &dumperfakes.FakeDumper{}, SinkChecks: []worker.SinkCheck{{
+					Name: "POSTGRES",
+					Check: func(context.Context) error {
+						time.Sleep(time.Second)
+						return nil
+					},
+				}}},
+			})
+			c = worker.New(time.Hour, zap.NewNop(), workList)
+			c.Poll(ctx, make(chan error, 1))
+			Eventually(func() bool { return c.Status().Polling }).Should(BeTrue())
+
+			start := time.Now()
+			st := c.CheckSinks(context.Background(), 20*time.Millisecond)
+			Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+			Expect(st.Work[0].SinkErrors).To(Equal(map[string]string{"POSTGRES": "check timed out: context deadline exceeded"}))
+		})
+	})
+
+	Context("HealthHandler", func() {
+		var (
+			reporter *workerfakes.FakeStatusReporter
+			mux      *http.ServeMux
+			rec      *httptest.ResponseRecorder
+		)
+
+		BeforeEach(func() {
+			reporter = &workerfakes.FakeStatusReporter{}
+			reporter.StatusReturns(worker.Status{
+				Polling: true,
+				Started: now.Add(-time.Hour),
+				Work:    []worker.WorkStatus{{Prefix: "train-data", LastSuccess: now.Add(-time.Minute)}},
+			})
+			reporter.CheckSinksReturns(reporter.Status())
+			h := worker.NewHealthHandler(reporter, 5*time.Minute)
+			h.Now = func() time.Time { return now }
+			mux = http.NewServeMux()
+			h.Register(mux)
+			rec = httptest.NewRecorder()
+		})
+
+		serve := func(path string) {
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		It("is healthy and ready while polling is fresh", func() {
+			serve(worker.HealthPath)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(reporter.CheckSinksCallCount()).To(BeZero())
+
+			rec = httptest.NewRecorder()
+			serve(worker.ReadyPath)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(ContainSubstring(`"prefix":"train-data"`))
+		})
+		When("a unit of work is stale", func() {
+			BeforeEach(func() {
+				reporter.StatusReturns(worker.Status{
+					Polling: true,
+					Started: now.Add(-time.Hour),
+					Work:    []worker.WorkStatus{{Prefix: "train-data", LastSuccess: now.Add(-time.Hour)}},
+				})
+				reporter.CheckSinksReturns(reporter.Status())
+			})
+			It("is healthy but not ready", func() {
+				serve(worker.HealthPath)
+				Expect(rec.Code).To(Equal(http.StatusOK))
+
+				rec = httptest.NewRecorder()
+				serve(worker.ReadyPath)
+				Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(rec.Body.String()).To(ContainSubstring("train-data: no successful scrape for 1h0m0s"))
+			})
+		})
+		When("polling has stopped", func() {
+			BeforeEach(func() {
+				reporter.StatusReturns(worker.Status{})
+				reporter.CheckSinksReturns(worker.Status{})
+			})
+			It("is unhealthy", func() {
+				serve(worker.HealthPath)
+				Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(rec.Body.String()).To(ContainSubstring("not polling"))
+			})
+		})
+		When("a sink check fails", func() {
+			BeforeEach(func() {
+				reporter.CheckSinksReturns(worker.Status{
+					Polling: true,
+					Started: now.Add(-time.Hour),
+					Work: []worker.WorkStatus{{
+						Prefix:      "train-data",
+						LastSuccess: now.Add(-time.Minute),
+						SinkErrors:  map[string]string{"POSTGRES": "check timed out: context deadline exceeded"},
+					}},
+				})
+			})
+			It("is healthy but not ready", func() {
+				serve(worker.HealthPath)
+				Expect(rec.Code).To(Equal(http.StatusOK))
+
+				rec = httptest.NewRecorder()
+				serve(worker.ReadyPath)
+				Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(rec.Body.String()).To(ContainSubstring("train-data: sink POSTGRES: check timed out"))
+				_, timeout := reporter.CheckSinksArgsForCall(0)
+				Expect(timeout).To(Equal(worker.DefaultSinkCheckTimeout))
+			})
+		})
+	})
+})
@@ -0,0 +1,180 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package workerfakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/smartatransit/scrapedumper/pkg/worker"
+)
+
+type FakeStatusReporter struct {
+	CheckSinksStub        func(context.Context, time.Duration) worker.Status
+	checkSinksMutex       sync.RWMutex
+	checkSinksArgsForCall []struct {
+		arg1 context.Context
+		arg2 time.Duration
+	}
+	checkSinksReturns struct {
+		result1 worker.Status
+	}
+	checkSinksReturnsOnCall map[int]struct {
+		result1 worker.Status
+	}
+	StatusStub        func() worker.Status
+	statusMutex       sync.RWMutex
+	statusArgsForCall []struct {
+	}
+	statusReturns struct {
+		result1 worker.Status
+	}
+	statusReturnsOnCall map[int]struct {
+		result1 worker.Status
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeStatusReporter) CheckSinks(arg1 context.Context, arg2 time.Duration) worker.Status {
+	fake.checkSinksMutex.Lock()
+	ret, specificReturn := fake.checkSinksReturnsOnCall[len(fake.checkSinksArgsForCall)]
+	fake.checkSinksArgsForCall = append(fake.checkSinksArgsForCall, struct {
+		arg1 context.Context
+		arg2 time.Duration
+	}{arg1, arg2})
+	stub := fake.CheckSinksStub
+	fakeReturns := fake.checkSinksReturns
+	fake.recordInvocation("CheckSinks", []interface{}{arg1, arg2})
+	fake.checkSinksMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStatusReporter) CheckSinksCallCount() int {
+	fake.checkSinksMutex.RLock()
+	defer fake.checkSinksMutex.RUnlock()
+	return len(fake.checkSinksArgsForCall)
+}
+
+func (fake *FakeStatusReporter) CheckSinksCalls(stub func(context.Context, time.Duration) worker.Status) {
+	fake.checkSinksMutex.Lock()
+	defer fake.checkSinksMutex.Unlock()
+	fake.CheckSinksStub = stub
+}
+
+func (fake *FakeStatusReporter) CheckSinksArgsForCall(i int) (context.Context, time.Duration) {
+	fake.checkSinksMutex.RLock()
+	defer fake.checkSinksMutex.RUnlock()
+	argsForCall := fake.checkSinksArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeStatusReporter) CheckSinksReturns(result1 worker.Status) {
+	fake.checkSinksMutex.Lock()
+	defer fake.checkSinksMutex.Unlock()
+	fake.CheckSinksStub = nil
+	fake.checkSinksReturns = struct {
+		result1 worker.Status
+	}{result1}
+}
+
+func (fake *FakeStatusReporter) CheckSinksReturnsOnCall(i int, result1 worker.Status) {
+	fake.checkSinksMutex.Lock()
+	defer fake.checkSinksMutex.Unlock()
+	fake.CheckSinksStub = nil
+	if fake.checkSinksReturnsOnCall == nil {
+		fake.checkSinksReturnsOnCall = make(map[int]struct {
+			result1 worker.Status
+		})
+	}
+	fake.checkSinksReturnsOnCall[i] = struct {
+		result1 worker.Status
+	}{result1}
+}
+
+func (fake *FakeStatusReporter) Status() worker.Status {
+	fake.statusMutex.Lock()
+	ret, specificReturn := fake.statusReturnsOnCall[len(fake.statusArgsForCall)]
+	fake.statusArgsForCall = append(fake.statusArgsForCall, struct {
+	}{})
+	stub := fake.StatusStub
+	fakeReturns := fake.statusReturns
+	fake.recordInvocation("Status", []interface{}{})
+	fake.statusMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStatusReporter) StatusCallCount() int {
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	return len(fake.statusArgsForCall)
+}
+
+func (fake *FakeStatusReporter) StatusCalls(stub func() worker.Status) {
+	fake.statusMutex.Lock()
+	defer fake.statusMutex.Unlock()
+	fake.StatusStub = stub
+}
+
+func (fake *FakeStatusReporter) StatusReturns(result1 worker.Status) {
+	fake.statusMutex.Lock()
+	defer fake.statusMutex.Unlock()
+	fake.StatusStub = nil
+	fake.statusReturns = struct {
+		result1 worker.Status
+	}{result1}
+}
+
+func (fake *FakeStatusReporter) StatusReturnsOnCall(i int, result1 worker.Status) {
+	fake.statusMutex.Lock()
+	defer fake.statusMutex.Unlock()
+	fake.StatusStub = nil
+	if fake.statusReturnsOnCall == nil {
+		fake.statusReturnsOnCall = make(map[int]struct {
+			result1 worker.Status
+		})
+	}
+	fake.statusReturnsOnCall[i] = struct {
+		result1 worker.Status
+	}{result1}
+}
+
+func (fake *FakeStatusReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.checkSinksMutex.RLock()
+	defer fake.checkSinksMutex.RUnlock()
+	fake.statusMutex.RLock()
+	defer fake.statusMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeStatusReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ worker.StatusReporter = new(FakeStatusReporter)
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	//database/sql driver
+	_ "github.com/lib/pq"
+)
+
+type options struct {
+	PostgresConnectionString string `long:"postgres-connection-string" env:"POSTGRES_CONNECTION_STRING" required:"true"`
+	Format                   string `long:"format" env:"FORMAT" default:"csv" choice:"csv" choice:"json" description:"the format of the report"`
+	Output                   string `long:"output" env:"OUTPUT" description:"a file to write the report to, instead of stdout"`
+
+	Headways           headwaysCommand           `command:"headways" description:"summarize the headways between successive trains at each station"`
+	PredictionAccuracy predictionAccuracyCommand `command:"prediction-accuracy" description:"summarize the error of MARTA's arrival estimates by lead time"`
+}
+
+var opts options
+
+//withRepository opens the database and calls fn with a repository for it
+func withRepository(fn func(repo *postgres.RepositoryAgent) error) error {
+	logger, _ := zap.NewProduction()
+	defer func() {
+		_ = logger.Sync() // flushes buffer, if any
+	}()
+
+	db, err := sql.Open("postgres", opts.PostgresConnectionString)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(postgres.NewRepository(logger, db))
+}
+
+//dateRange parses the dates given to a command, which are in the Eastern
+//timezone. The range ends at the end of the to date, or now if it's empty, and
+//starts at the start of the from date, or the given number of days earlier.
+func dateRange(from, to string, defaultDays int) (start postgres.EasternTime, end postgres.EasternTime, err error) {
+	endTime := time.Now().In(postgres.EasternTimeZone)
+	if to != "" {
+		endTime, err = time.ParseInLocation("2006-01-02", to, postgres.EasternTimeZone)
+		if err != nil {
+			return
+		}
+		endTime = endTime.AddDate(0, 0, 1)
+	}
+
+	startTime := endTime.AddDate(0, 0, -defaultDays)
+	if from != "" {
+		startTime, err = time.ParseInLocation("2006-01-02", from, postgres.EasternTimeZone)
+		if err != nil {
+			return
+		}
+	}
+
+	return postgres.EasternTime(startTime), postgres.EasternTime(endTime), nil
+}
+
+//writeReport writes the report in the chosen format: records under header as
+//CSV, or v as JSON
+func writeReport(header []string, records [][]string, v interface{}) (err error) {
+	var w io.Writer = os.Stdout
+	if opts.Output != "" {
+		var f *os.File
+		f, err = os.Create(opts.Output)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = f
+	}
+
+	if opts.Format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(header); err != nil {
+		return
+	}
+	if err = cw.WriteAll(records); err != nil {
+		return
+	}
+	return cw.Error()
+}
+
+func seconds(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+func percentiles(p postgres.Percentiles) []string {
+	return []string{seconds(p.P10), seconds(p.P25), seconds(p.P50), seconds(p.P75), seconds(p.P90)}
+}
+
+var percentilesHeader = []string{"p10_seconds", "p25_seconds", "p50_seconds", "p75_seconds", "p90_seconds"}
+
+type headwaysCommand struct {
+	From              string `long:"from" description:"the first date to include, as YYYY-MM-DD (default: 28 days before --to)"`
+	To                string `long:"to" description:"the last date to include, as YYYY-MM-DD (default: today)"`
+	MaxHeadwayMinutes int    `long:"max-headway-minutes" default:"60" description:"longer gaps between trains are breaks in service or scraping, and are left out"`
+	IncludeInferred   bool   `long:"include-inferred" description:"include arrivals that were inferred rather than observed"`
+}
+
+func (c headwaysCommand) Execute([]string) error {
+	from, to, err := dateRange(c.From, c.To, 28)
+	if err != nil {
+		return err
+	}
+
+	return withRepository(func(repo *postgres.RepositoryAgent) error {
+		summaries, err := repo.GetHeadwaySummaries(postgres.HeadwayQuery{
+			From:            from,
+			To:              to,
+			MaxHeadway:      time.Duration(c.MaxHeadwayMinutes) * time.Minute,
+			IncludeInferred: c.IncludeInferred,
+		})
+		if err != nil {
+			return err
+		}
+
+		records := make([][]string, len(summaries))
+		for i, s := range summaries {
+			records[i] = append([]string{
+				string(s.Station),
+				string(s.Line),
+				string(s.Direction),
+				s.DayType,
+				strconv.Itoa(s.Hour),
+				strconv.Itoa(s.Count),
+				seconds(s.Mean),
+			}, percentiles(s.Percentiles)...)
+		}
+
+		if summaries == nil {
+			summaries = []postgres.HeadwaySummary{}
+		}
+		return writeReport(
+			append([]string{"station", "line", "direction", "day_type", "hour", "count", "mean_seconds"}, percentilesHeader...),
+			records,
+			summaries,
+		)
+	})
+}
+
+type predictionAccuracyCommand struct {
+	From              string `long:"from" description:"the first date to include, as YYYY-MM-DD (default: 28 days before --to)"`
+	To                string `long:"to" description:"the last date to include, as YYYY-MM-DD (default: today)"`
+	LeadBucketMinutes int    `long:"lead-bucket-minutes" default:"5" description:"the width of the lead time buckets"`
+	MaxLeadMinutes    int    `long:"max-lead-minutes" default:"30" description:"estimates made further ahead than this are left out"`
+	IncludeInferred   bool   `long:"include-inferred" description:"include arrivals that were inferred rather than observed"`
+}
+
+func (c predictionAccuracyCommand) Execute([]string) error {
+	if c.LeadBucketMinutes <= 0 {
+		return errors.New("--lead-bucket-minutes must be positive")
+	}
+
+	from, to, err := dateRange(c.From, c.To, 28)
+	if err != nil {
+		return err
+	}
+
+	return withRepository(func(repo *postgres.RepositoryAgent) error {
+		summaries, err := repo.GetPredictionAccuracySummaries(postgres.PredictionAccuracyQuery{
+			From:            from,
+			To:              to,
+			LeadBucket:      time.Duration(c.LeadBucketMinutes) * time.Minute,
+			MaxLead:         time.Duration(c.MaxLeadMinutes) * time.Minute,
+			IncludeInferred: c.IncludeInferred,
+		})
+		if err != nil {
+			return err
+		}
+
+		records := make([][]string, len(summaries))
+		for i, s := range summaries {
+			records[i] = append([]string{
+				strconv.Itoa(s.LeadMinutes),
+				string(s.Line),
+				string(s.Direction),
+				string(s.Station),
+				strconv.Itoa(s.Hour),
+				strconv.Itoa(s.Count),
+				seconds(s.Bias),
+				seconds(s.MAE),
+			}, percentiles(s.Percentiles)...)
+		}
+
+		if summaries == nil {
+			summaries = []postgres.PredictionAccuracySummary{}
+		}
+		return writeReport(
+			append([]string{"lead_minutes", "line", "direction", "station", "hour", "count", "bias_seconds", "mae_seconds"}, percentilesHeader...),
+			records,
+			summaries,
+		)
+	})
+}
+
+func main() {
+	//the parser prints its own errors, including those of the command it runs
+	if _, err := flags.Parse(&opts); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return
+		}
+		os.Exit(1)
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/jessevdk/go-flags"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
@@ -20,9 +24,24 @@ import (
 )
 
 type options struct {
-	DataLocation             string `long:"data-location" env:"DATA_LOCATION" description:"local path to from which to collect JSON files" required:"true"`
+	DataLocation             string `long:"data-location" env:"DATA_LOCATION" description:"local path to from which to collect JSON files"`
 	PostgresConnectionString string `long:"postgres-connection-string" env:"POSTGRES_CONNECTION_STRING" required:"true"`
+	ThirdRailContext         bool   `long:"third-rail-context" env:"THIRD_RAIL_CONTEXT" description:"reference third-rail's lines, directions and stations tables, as scrapedumper does when deployed inside a third-rail database"`
 	StartAt                  string `long:"start-at-alphabetically" env:"START_AT_ALPHABETICALLY"`
+
+	Recursive bool     `long:"recursive" env:"RECURSIVE" description:"walk the data location's subdirectories and tarballs too, loading everything in timestamp order"`
+	Include   []string `long:"include" env:"INCLUDE" env-delim:"," description:"with --recursive, only load files matching one of these glob patterns"`
+	Exclude   []string `long:"exclude" env:"EXCLUDE" env-delim:"," description:"with --recursive, leave out files, directories and tarballs matching one of these glob patterns"`
+
+	S3BucketName string `long:"s3-bucket-name" env:"S3_BUCKET_NAME" description:"s3 bucket from which to collect JSON files, instead of a local path"`
+	S3Prefix     string `long:"s3-prefix" env:"S3_PREFIX" description:"only load objects whose keys start with this, e.g. train-data/"`
+	StartAfter   string `long:"start-after" env:"START_AFTER" description:"only load objects whose keys sort after this one"`
+	EndBefore    string `long:"end-before" env:"END_BEFORE" description:"only load objects whose keys sort before this one"`
+	S3Endpoint   string `long:"s3-endpoint" env:"S3_ENDPOINT" description:"an S3-compatible endpoint to use instead of AWS, e.g. http://localhost:9000 for MinIO"`
+
+	Concurrency    int    `long:"concurrency" env:"CONCURRENCY" default:"4" description:"how many trains to load at once; each train's records are still loaded in order"`
+	CheckpointPath string `long:"checkpoint-path" env:"CHECKPOINT_PATH" description:"a file recording the files already loaded, which are skipped when the load is run again"`
+	SkipBadFiles   bool   `long:"skip-bad-files" env:"SKIP_BAD_FILES" description:"record files that fail to load in the checkpoint and carry on, instead of stopping"`
 }
 
 func main() {
@@ -32,6 +51,12 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if (opts.DataLocation == "") == (opts.S3BucketName == "") {
+		log.Fatal("Exactly one of `--data-location` or `--s3-bucket-name` is required")
+	}
+	if !opts.Recursive && len(opts.Include)+len(opts.Exclude) > 0 {
+		log.Fatal("`--include` and `--exclude` require `--recursive`")
+	}
 
 	logger, _ := zap.NewProduction()
 	defer func() {
@@ -45,24 +70,76 @@ func main() {
 	defer db.Close()
 
 	repo := postgres.NewRepository(logger, db)
-	err = repo.EnsureTables(false)
+	err = repo.EnsureTables(opts.ThirdRailContext)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fs := afero.NewOsFs()
-
 	upserter := postgres.NewUpserter(repo, time.Hour, false)
 	dumper := dumper.NewPostgresDumpHandler(logger, upserter, nil)
-	dirDumper := bulk.NewDirectoryDumper(fs, dumper)
-	err = dirDumper.DumpDirectory(
-		context.Background(),
-		opts.DataLocation,
-		opts.StartAt,
-	)
+
+	loaderOpts := []bulk.ParallelOption{
+		bulk.WithConcurrency(opts.Concurrency),
+		bulk.WithPartitioner(bulk.PartitionByField("TRAIN_ID")),
+	}
+	if opts.SkipBadFiles {
+		loaderOpts = append(loaderOpts, bulk.WithSkipFailures())
+	}
+	if opts.CheckpointPath != "" {
+		checkpoint, err := bulk.OpenFileCheckpoint(afero.NewOsFs(), opts.CheckpointPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer checkpoint.Close()
+		loaderOpts = append(loaderOpts, bulk.WithCheckpoint(checkpoint))
+	}
+	loader := bulk.NewParallelLoader(dumper, loaderOpts...)
+
+	ctx := context.Background()
+	var walk func(bulk.WalkFunc) error
+	if opts.S3BucketName != "" {
+		s3Dumper := bulk.NewS3Dumper(newS3Client(opts.S3Endpoint), opts.S3BucketName, dumper)
+		walk = func(fn bulk.WalkFunc) error {
+			return s3Dumper.Walk(ctx, opts.S3Prefix, opts.StartAfter, opts.EndBefore, fn)
+		}
+	} else if opts.Recursive {
+		dirDumper := bulk.NewDirectoryDumper(afero.NewOsFs(), dumper)
+		treeOpts := bulk.TreeOptions{
+			Include: opts.Include,
+			Exclude: opts.Exclude,
+			StartAt: opts.StartAt,
+		}
+		walk = func(fn bulk.WalkFunc) error {
+			return dirDumper.WalkTree(ctx, opts.DataLocation, treeOpts, fn)
+		}
+	} else {
+		dirDumper := bulk.NewDirectoryDumper(afero.NewOsFs(), dumper)
+		walk = func(fn bulk.WalkFunc) error {
+			return dirDumper.Walk(ctx, opts.DataLocation, opts.StartAt, fn)
+		}
+	}
+
+	summary, err := loader.Load(ctx, walk)
+	fmt.Println("Summary:", summary)
+	for _, failure := range summary.Failed {
+		fmt.Println("Failed:", failure.Name, failure.Err)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(summary.Failed) > 0 {
+		os.Exit(1)
+	}
 
 	fmt.Println("Success!")
 }
+
+//newS3Client connects to S3, or to an S3-compatible endpoint such as MinIO,
+//which is addressed path-style since it won't have DNS for each bucket
+func newS3Client(endpoint string) *s3.S3 {
+	cfg := aws.NewConfig()
+	if endpoint != "" {
+		cfg = cfg.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+	return s3.New(session.Must(session.NewSession(cfg)))
+}
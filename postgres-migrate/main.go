@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	//database/sql driver
+	_ "github.com/lib/pq"
+)
+
+type options struct {
+	PostgresConnectionString string `long:"postgres-connection-string" env:"POSTGRES_CONNECTION_STRING" required:"true"`
+	ThirdRailContext         bool   `long:"third-rail-context" env:"THIRD_RAIL_CONTEXT" description:"reference third-rail's lines, directions and stations tables, as scrapedumper does when deployed inside a third-rail database"`
+
+	Status statusCommand `command:"status" description:"list the migrations and whether each has been applied"`
+	Up     upCommand     `command:"up" description:"apply the migrations that haven't been applied"`
+	Down   downCommand   `command:"down" description:"revert the latest applied migrations"`
+}
+
+var opts options
+
+//withMigrator opens the database and calls fn with a migrator for it
+func withMigrator(fn func(m *postgres.Migrator) error) error {
+	logger, _ := zap.NewProduction()
+	defer func() {
+		_ = logger.Sync() // flushes buffer, if any
+	}()
+
+	db, err := sql.Open("postgres", opts.PostgresConnectionString)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(postgres.NewMigrator(logger, db, opts.ThirdRailContext))
+}
+
+type statusCommand struct{}
+
+func (statusCommand) Execute([]string) error {
+	return withMigrator(func(m *postgres.Migrator) error {
+		statuses, err := m.Status(context.Background())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	})
+}
+
+type upCommand struct {
+	To int `long:"to" description:"the version to migrate up to, instead of the latest"`
+}
+
+func (c upCommand) Execute([]string) error {
+	return withMigrator(func(m *postgres.Migrator) error {
+		done, err := m.Up(context.Background(), c.To)
+		for _, migration := range done {
+			fmt.Println("Applied", migration.Version, migration.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("Already up to date")
+		}
+		return err
+	})
+}
+
+type downCommand struct {
+	Steps int `long:"steps" default:"1" description:"how many migrations to revert"`
+}
+
+func (c downCommand) Execute([]string) error {
+	return withMigrator(func(m *postgres.Migrator) error {
+		done, err := m.Down(context.Background(), c.Steps)
+		for _, migration := range done {
+			fmt.Println("Reverted", migration.Version, migration.Name)
+		}
+		return err
+	})
+}
+
+func main() {
+	//the parser prints its own errors, including those of the command it runs
+	if _, err := flags.Parse(&opts); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return
+		}
+		os.Exit(1)
+	}
+}
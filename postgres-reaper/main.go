@@ -17,6 +17,7 @@ import (
 
 type options struct {
 	PostgresConnectionString string `long:"postgres-connection-string" env:"POSTGRES_CONNECTION_STRING" required:"true"`
+	ThirdRailContext         bool   `long:"third-rail-context" env:"THIRD_RAIL_CONTEXT" description:"reference third-rail's lines, directions and stations tables, as scrapedumper does when deployed inside a third-rail database"`
 	RunTTLMinutes            int    `long:"run-ttl-minues" env:"RUN_TTL_MINUTES3339" description:"The TTL of a run in minues."`
 }
 
@@ -40,7 +41,7 @@ func main() {
 	defer db.Close()
 
 	repo := postgres.NewRepository(logger, db)
-	err = repo.EnsureTables(false)
+	err = repo.EnsureTables(opts.ThirdRailContext)
 	if err != nil {
 		log.Fatal(err)
 	}
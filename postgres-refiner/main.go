@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/postgres"
+
+	//database/sql driver
+	_ "github.com/lib/pq"
+)
+
+type options struct {
+	PostgresConnectionString string `long:"postgres-connection-string" env:"POSTGRES_CONNECTION_STRING" required:"true"`
+	ThirdRailContext         bool   `long:"third-rail-context" env:"THIRD_RAIL_CONTEXT" description:"reference third-rail's lines, directions and stations tables, as scrapedumper does when deployed inside a third-rail database"`
+	SettleMinutes            int    `long:"settle-minutes" env:"SETTLE_MINUTES" default:"60" description:"only arrivals older than this are refined, so that late records of them are in"`
+	MaxPollGapSeconds        int    `long:"max-poll-gap-seconds" env:"MAX_POLL_GAP_SECONDS" default:"45" description:"records further apart than this are taken to have missed polls in between"`
+}
+
+func main() {
+	fmt.Println("Starting postgres arrival refiner")
+	var opts options
+	_, err := flags.Parse(&opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, _ := zap.NewProduction()
+	defer func() {
+		_ = logger.Sync() // flushes buffer, if any
+	}()
+
+	db, err := sql.Open("postgres", opts.PostgresConnectionString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	repo := postgres.NewRepository(logger, db)
+	err = repo.EnsureTables(opts.ThirdRailContext)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	refiner := postgres.NewRefiner(repo, time.Duration(opts.MaxPollGapSeconds)*time.Second)
+	settledBefore := time.Now().Add(-time.Minute * time.Duration(opts.SettleMinutes))
+	counts, err := refiner.RefineArrivals(postgres.EasternTime(settledBefore))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//runs are reconciled after their arrivals are refined, so that missing
+	//arrivals are interpolated from refined ones
+	reconciler := postgres.NewReconciler(repo)
+	runsReconciled, arrivalsInferred, err := reconciler.ReconcileRuns(postgres.EasternTime(settledBefore))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Success:")
+	for _, method := range []string{
+		postgres.ArrivalInterpolated,
+		postgres.ArrivalEstimated,
+		postgres.ArrivalMidpoint,
+		postgres.ArrivalObserved,
+	} {
+		fmt.Printf("Arrivals %s: %d\n", method, counts[method])
+	}
+	fmt.Println("Runs reconciled:", runsReconciled)
+	fmt.Println("Arrivals inferred:", arrivalsInferred)
+}
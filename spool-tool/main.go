@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+
+	"github.com/smartatransit/scrapedumper/pkg/config"
+	"github.com/smartatransit/scrapedumper/pkg/dumper"
+)
+
+type options struct {
+	SpoolDirectory string `long:"spool-directory" env:"SPOOL_DIRECTORY" description:"the spool_directory of the SPOOL dumper" required:"true"`
+
+	List  listCommand  `command:"list" description:"list the spooled dumps, oldest first"`
+	Show  showCommand  `command:"show" description:"print a spooled dump"`
+	Drain drainCommand `command:"drain" description:"replay the spooled dumps in order, stopping at the first failure"`
+	Drop  dropCommand  `command:"drop" description:"delete spooled dumps without replaying them"`
+}
+
+var opts options
+
+func spool() dumper.Spool {
+	return dumper.NewSpool(afero.NewOsFs(), opts.SpoolDirectory)
+}
+
+type listCommand struct{}
+
+func (listCommand) Execute([]string) error {
+	entries, err := spool().List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPATH\tSCRAPED AT\tBYTES")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", e.Name, e.Path, e.Time.Format(time.RFC3339), e.Size)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d spooled dumps\n", len(entries))
+	return nil
+}
+
+type showCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"name" required:"true"`
+	} `positional-args:"true"`
+}
+
+func (c showCommand) Execute([]string) error {
+	_, rc, err := spool().Open(c.Args.Name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(os.Stdout, rc)
+	return err
+}
+
+type drainCommand struct {
+	DumperConfigPath string `long:"dumper-config-path" env:"DUMPER_CONFIG_PATH" description:"a file containing the JSON config of the dumper to replay to, usually the SPOOL dumper's own dumper" required:"true"`
+	Debug            bool   `long:"debug" env:"DEBUG" description:"enabled debug logging"`
+}
+
+func (c drainCommand) Execute([]string) error {
+	var logger *zap.Logger
+	if c.Debug {
+		logger, _ = zap.NewDevelopment()
+	} else {
+		logger, _ = zap.NewProduction()
+	}
+	defer func() {
+		_ = logger.Sync() // flushes buffer, if any
+	}()
+
+	file, err := os.Open(c.DumperConfigPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed opening dumper config file %s for reading", c.DumperConfigPath)
+	}
+	defer file.Close()
+
+	var dc config.DumpConfig
+	if err := json.NewDecoder(file).Decode(&dc); err != nil {
+		return errors.Wrapf(err, "failed parsing dumper config file %s", c.DumperConfigPath)
+	}
+
+	d, cleanup, err := config.BuildDumper(logger, sql.Open, dc)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cleanupErr := cleanup(); cleanupErr != nil {
+			logger.Error(cleanupErr.Error())
+		}
+	}()
+
+	//stop after the dump in flight when interrupted, so that it isn't replayed twice
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	go func() {
+		<-quit
+		cancel()
+	}()
+
+	replayed, err := spool().Replay(ctx, d)
+	fmt.Println("Dumps replayed:", replayed)
+	return err
+}
+
+type dropCommand struct {
+	Args struct {
+		Names []string `positional-arg-name:"name" required:"1"`
+	} `positional-args:"true"`
+}
+
+func (c dropCommand) Execute([]string) error {
+	s := spool()
+	for _, name := range c.Args.Names {
+		if err := s.Remove(name); err != nil {
+			return err
+		}
+		fmt.Println("Dropped", name)
+	}
+	return nil
+}
+
+func main() {
+	//the parser prints its own errors, including those of the command it runs
+	if _, err := flags.Parse(&opts); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			return
+		}
+		os.Exit(1)
+	}
+}